@@ -3,37 +3,532 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 )
 
 type Config struct {
+	PORT                         string
+	PUBLIC_BASE_URL              string
+	PASSWORD_RESET_URL           string
+	STORAGE_BACKEND              string
 	DB_CONNECTION                string
+	POSTGRES_URL                 string
 	DB_NAME                      string
 	DB_COLLECTION_USERS          string
 	DB_COLLECTION_REFRESH_TOKENS string
+	DB_COLLECTION_EXPORT_JOBS    string
+	// Bucket de GridFS con los archivos de las exportaciones asincronas.
+	DB_COLLECTION_EXPORT_FILES   string
+	DB_COLLECTION_AUDIT_EVENTS   string
+	DB_COLLECTION_LOGIN_HISTORY  string
+	DB_COLLECTION_OUTBOX         string
+	DB_COLLECTION_WEBHOOKS       string
+	DB_COLLECTION_WEBHOOK_LOG    string
+	DB_COLLECTION_GROUPS         string
+	DB_COLLECTION_OAUTH_CLIENTS  string
+	DB_COLLECTION_OAUTH_CODES    string
+	DB_COLLECTION_DPOP_PROOFS    string
+	DB_COLLECTION_MIGRATIONS     string
+	DB_COLLECTION_IDEMPOTENCY    string
 	JWT_SECRET_KEY               string
+	TOKEN_CONFIG                 TokenConfig
 	REFRESH_TOKEN_CONFIG         RefreshTokenConfig
+	USER_DELETION_CONFIG         UserDeletionConfig
+	EXPORT_CONFIG                ExportConfig
+	AUDIT_CONFIG                 AuditConfig
+	LOGIN_HISTORY_RETENTION      time.Duration
+	SMTP_CONFIG                  SMTPConfig
+	OUTBOX_CONFIG                OutboxConfig
+	EVENTS_CONFIG                EventsConfig
+	WEBHOOK_CONFIG               WebhookConfig
+	OAUTH_CONFIG                 OAuthConfig
+	OIDC_CONFIG                  OIDCConfig
+	SESSION_LIMIT_CONFIG         SessionLimitConfig
+	DPOP_CONFIG                  DPoPConfig
+	REFRESH_TOKEN_CLEANUP_CONFIG RefreshTokenCleanupConfig
+	// Tiempo durante el cual se repite la respuesta de una peticion con Idempotency-Key.
+	IDEMPOTENCY_TTL time.Duration
+	// Sin MIGRATE_ON_STARTUP las migraciones solo se aplican con el subcomando migrate.
+	MIGRATE_ON_STARTUP bool
+	// Con EMAIL_NORMALIZE_NFKC los emails tambien se normalizan con Unicode NFKC.
+	EMAIL_NORMALIZE_NFKC bool
+	// Token de cada tenant SCIM, indexado por tenant.
+	SCIM_TENANT_TOKENS map[string]string
+}
+
+type TokenConfig struct {
+	ISSUER string
+	// Audiencia de este servicio: los access tokens de usuario siempre la
+	// incluyen y las rutas autenticadas solo aceptan tokens emitidos para ella.
+	AUDIENCE          string
+	DEFAULT_AUDIENCES []string
+	// Audiencias que un login puede pedir ademas de las de por defecto.
+	ALLOWED_AUDIENCES []string
+	ACCESS_TOKEN_TTL  time.Duration
 }
 
 type RefreshTokenConfig struct {
 	EXPIRY_TIME time.Duration
+	// Una sesion expira tras IDLE_TIMEOUT sin refrescarse y nunca dura mas de ABSOLUTE_LIFETIME.
+	IDLE_TIMEOUT      time.Duration
+	ABSOLUTE_LIFETIME time.Duration
+	// Politica de los logins con "recordarme".
+	REMEMBER_ME_IDLE_TIMEOUT      time.Duration
+	REMEMBER_ME_ABSOLUTE_LIFETIME time.Duration
+}
+
+type UserDeletionConfig struct {
+	// Tiempo durante el cual un usuario borrado puede restaurarse y su email sigue
+	// reservado. Es a proposito el mismo plazo: si el email se liberara antes,
+	// otra cuenta podria tomarlo y la restauracion ya no seria posible.
+	GRACE_PERIOD     time.Duration
+	PURGE_INTERVAL   time.Duration
+	PURGE_BATCH_SIZE int
+}
+
+type ExportConfig struct {
+	// Tiempo que se guarda un archivo de exportacion asincrona antes de borrarse.
+	RETENTION       time.Duration
+	WORKER_INTERVAL time.Duration
+	// Tiempo que un worker retiene un job; si no lo termina antes, por ejemplo
+	// porque se cayo, otro worker lo vuelve a reclamar.
+	LEASE time.Duration
+}
+
+type AuditConfig struct {
+	// Encadena cada evento con el hash del anterior para detectar modificaciones.
+	HASH_CHAIN bool
+	RETENTION  time.Duration
+}
+
+// Sin SMTP_HOST los correos solo se escriben en el log.
+type SMTPConfig struct {
+	HOST     string
+	PORT     string
+	USERNAME string
+	PASSWORD string
+	FROM     string
+}
+
+type OutboxConfig struct {
+	RELAY_INTERVAL time.Duration
+	BATCH_SIZE     int
+	// Tiempo que se guardan los eventos ya publicados.
+	RETENTION time.Duration
+	// Espera antes de reintentar un evento fallido; se duplica en cada fallo.
+	BACKOFF_BASE time.Duration
+	BACKOFF_MAX  time.Duration
+}
+
+// PUBLISHER elige el destino de los eventos: log, stdout, file, nats o kafka.
+type EventsConfig struct {
+	PUBLISHER           string
+	SOURCE              string
+	FILE_PATH           string
+	NATS_URL            string
+	NATS_SUBJECT_PREFIX string
+	KAFKA_BROKERS       []string
+	KAFKA_TOPIC         string
+}
+
+type WebhookConfig struct {
+	WORKER_INTERVAL time.Duration
+	BATCH_SIZE      int
+	TIMEOUT         time.Duration
+	// Tras MAX_ATTEMPTS intentos fallidos la entrega pasa a dead_letter.
+	MAX_ATTEMPTS int
+	BACKOFF_BASE time.Duration
+	BACKOFF_MAX  time.Duration
+	// Tiempo que se guarda el registro de entregas.
+	LOG_RETENTION time.Duration
+	// Permite receptores en direcciones privadas, de loopback o link-local; solo
+	// para desarrollo, abre la puerta a SSRF contra la red interna.
+	ALLOW_PRIVATE_URLS bool
+}
+
+type OAuthConfig struct {
+	// Tiempo que un codigo de autorizacion puede canjearse en /oauth/token.
+	AUTHORIZATION_CODE_TTL time.Duration
+	// Duracion de los tokens de servicio emitidos con client_credentials.
+	CLIENT_CREDENTIALS_TTL time.Duration
+}
+
+// Sin SIGNING_KEY_FILE se genera una clave RSA efimera en cada arranque.
+type OIDCConfig struct {
+	ISSUER           string
+	SIGNING_KEY_FILE string
+	ID_TOKEN_TTL     time.Duration
+}
+
+// Las pruebas DPoP se aceptan durante PROOF_MAX_AGE desde su iat. Con
+// REQUIRE_NONCE deben incluir el nonce enviado en la cabecera DPoP-Nonce, que
+// cambia cada NONCE_TTL.
+type DPoPConfig struct {
+	PROOF_MAX_AGE time.Duration
+	REQUIRE_NONCE bool
+	NONCE_TTL     time.Duration
+}
+
+// El worker de limpieza borra cada INTERVAL los refresh tokens expirados y los
+// revocados hace mas de REVOKED_RETENTION, que se conservan ese tiempo para
+// detectar su reutilizacion.
+type RefreshTokenCleanupConfig struct {
+	INTERVAL          time.Duration
+	BATCH_SIZE        int
+	REVOKED_RETENTION time.Duration
+}
+
+// STORAGE_BACKEND elige donde se guardan los datos. Con postgres todo se guarda
+// en POSTGRES_URL, sin Mongo. Con memory el servicio arranca sin base de datos
+// y todo se pierde al reiniciar: solo para demos y pruebas.
+const (
+	StorageBackendMongo    = "mongo"
+	StorageBackendPostgres = "postgres"
+	StorageBackendMemory   = "memory"
+)
+
+const (
+	SessionLimitReject      = "reject"
+	SessionLimitEvictOldest = "evict_oldest"
+)
+
+// Limite de sesiones activas por usuario. 0 es ilimitado; el limite del rol
+// tiene prioridad sobre el global.
+type SessionLimitConfig struct {
+	MAX_SESSIONS      int
+	ROLE_MAX_SESSIONS map[string]int
+	POLICY            string
 }
 
 func LoadConfig() (*Config, error) {
 	config := &Config{
+		PORT:                         getEnv("PORT", "8080"),
+		PUBLIC_BASE_URL:              getEnv("PUBLIC_BASE_URL", "http://localhost:8080"),
+		STORAGE_BACKEND:              getEnv("STORAGE_BACKEND", StorageBackendMongo),
 		DB_CONNECTION:                os.Getenv("DB_CONNECTION"),
+		POSTGRES_URL:                 os.Getenv("POSTGRES_URL"),
 		DB_NAME:                      os.Getenv("DB_NAME"),
 		DB_COLLECTION_USERS:          os.Getenv("DB_COLLECTION_USERS"),
 		JWT_SECRET_KEY:               os.Getenv("JWT_SECRET_KEY"),
 		DB_COLLECTION_REFRESH_TOKENS: os.Getenv("DB_COLLECTION_REFRESH_TOKENS"),
-		REFRESH_TOKEN_CONFIG: RefreshTokenConfig{
-			EXPIRY_TIME: 24 * 7 * time.Hour,
+		DB_COLLECTION_EXPORT_JOBS:    getEnv("DB_COLLECTION_EXPORT_JOBS", "export-jobs"),
+		DB_COLLECTION_EXPORT_FILES:   getEnv("DB_COLLECTION_EXPORT_FILES", "export-files"),
+		DB_COLLECTION_AUDIT_EVENTS:   getEnv("DB_COLLECTION_AUDIT_EVENTS", "audit-events"),
+		DB_COLLECTION_LOGIN_HISTORY:  getEnv("DB_COLLECTION_LOGIN_HISTORY", "login-history"),
+		DB_COLLECTION_OUTBOX:         getEnv("DB_COLLECTION_OUTBOX", "outbox"),
+		DB_COLLECTION_WEBHOOKS:       getEnv("DB_COLLECTION_WEBHOOKS", "webhooks"),
+		DB_COLLECTION_WEBHOOK_LOG:    getEnv("DB_COLLECTION_WEBHOOK_LOG", "webhook-deliveries"),
+		DB_COLLECTION_GROUPS:         getEnv("DB_COLLECTION_GROUPS", "groups"),
+		DB_COLLECTION_OAUTH_CLIENTS:  getEnv("DB_COLLECTION_OAUTH_CLIENTS", "oauth-clients"),
+		DB_COLLECTION_OAUTH_CODES:    getEnv("DB_COLLECTION_OAUTH_CODES", "oauth-codes"),
+		DB_COLLECTION_DPOP_PROOFS:    getEnv("DB_COLLECTION_DPOP_PROOFS", "dpop-proofs"),
+		DB_COLLECTION_MIGRATIONS:     getEnv("DB_COLLECTION_MIGRATIONS", "schema-migrations"),
+		DB_COLLECTION_IDEMPOTENCY:    getEnv("DB_COLLECTION_IDEMPOTENCY", "idempotency-keys"),
+		TOKEN_CONFIG: TokenConfig{
+			ISSUER:            getEnv("JWT_ISSUER", "users-microservice"),
+			AUDIENCE:          getEnv("JWT_AUDIENCE", "users-microservice"),
+			DEFAULT_AUDIENCES: getEnvList("JWT_DEFAULT_AUDIENCES"),
+			ALLOWED_AUDIENCES: getEnvList("JWT_ALLOWED_AUDIENCES"),
+		},
+		SMTP_CONFIG: SMTPConfig{
+			HOST:     os.Getenv("SMTP_HOST"),
+			PORT:     getEnv("SMTP_PORT", "587"),
+			USERNAME: os.Getenv("SMTP_USERNAME"),
+			PASSWORD: os.Getenv("SMTP_PASSWORD"),
+			FROM:     getEnv("SMTP_FROM", "no-reply@users-microservice.local"),
 		},
+		EVENTS_CONFIG: EventsConfig{
+			PUBLISHER:           getEnv("EVENT_PUBLISHER", "log"),
+			SOURCE:              getEnv("EVENT_SOURCE", "users-microservice"),
+			FILE_PATH:           getEnv("EVENT_FILE_PATH", "events.jsonl"),
+			NATS_URL:            getEnv("NATS_URL", "nats://localhost:4222"),
+			NATS_SUBJECT_PREFIX: getEnv("NATS_SUBJECT_PREFIX", "users"),
+			KAFKA_BROKERS:       getEnvList("KAFKA_BROKERS"),
+			KAFKA_TOPIC:         getEnv("KAFKA_TOPIC", "users.events"),
+		},
+	}
+	// Por defecto, la pagina de reseteo que sirve el propio servicio.
+	config.PASSWORD_RESET_URL = getEnv("PASSWORD_RESET_URL", config.PUBLIC_BASE_URL+"/users/password/reset")
+	config.OIDC_CONFIG.ISSUER = strings.TrimSuffix(getEnv("OIDC_ISSUER", config.PUBLIC_BASE_URL), "/")
+	config.OIDC_CONFIG.SIGNING_KEY_FILE = os.Getenv("OIDC_SIGNING_KEY_FILE")
+	switch config.STORAGE_BACKEND {
+	case StorageBackendMongo:
+		if config.DB_CONNECTION == "" {
+			return nil, fmt.Errorf("variable de entorno DB_CONNECTION no configurada")
+		}
+	case StorageBackendPostgres:
+		// Postgres no usa Mongo, asi que DB_CONNECTION no hace falta.
+		if config.POSTGRES_URL == "" {
+			return nil, fmt.Errorf("variable de entorno POSTGRES_URL no configurada")
+		}
+	case StorageBackendMemory:
+	default:
+		return nil, fmt.Errorf("variable de entorno STORAGE_BACKEND invalida: %q", config.STORAGE_BACKEND)
+	}
+	if len(config.TOKEN_CONFIG.DEFAULT_AUDIENCES) == 0 {
+		config.TOKEN_CONFIG.DEFAULT_AUDIENCES = []string{"contacts-service"}
+	}
+	var err error
+	if config.MIGRATE_ON_STARTUP, err = getEnvBool("MIGRATE_ON_STARTUP", true); err != nil {
+		return nil, err
+	}
+	if config.EMAIL_NORMALIZE_NFKC, err = getEnvBool("EMAIL_NORMALIZE_NFKC", false); err != nil {
+		return nil, err
+	}
+	if config.USER_DELETION_CONFIG.GRACE_PERIOD, err = getEnvDuration("USER_DELETION_GRACE_PERIOD", 30*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.USER_DELETION_CONFIG.PURGE_INTERVAL, err = getEnvDuration("USER_PURGE_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+	if config.USER_DELETION_CONFIG.PURGE_BATCH_SIZE, err = getEnvInt("USER_PURGE_BATCH_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if config.REFRESH_TOKEN_CLEANUP_CONFIG.INTERVAL, err = getEnvDuration("REFRESH_TOKEN_CLEANUP_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+	if config.REFRESH_TOKEN_CLEANUP_CONFIG.BATCH_SIZE, err = getEnvInt("REFRESH_TOKEN_CLEANUP_BATCH_SIZE", 500); err != nil {
+		return nil, err
+	}
+	if config.REFRESH_TOKEN_CLEANUP_CONFIG.REVOKED_RETENTION, err = getEnvDuration("REFRESH_TOKEN_REVOKED_RETENTION", 7*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.IDEMPOTENCY_TTL, err = getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.EXPORT_CONFIG.RETENTION, err = getEnvDuration("EXPORT_RETENTION", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.EXPORT_CONFIG.WORKER_INTERVAL, err = getEnvDuration("EXPORT_WORKER_INTERVAL", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if config.EXPORT_CONFIG.LEASE, err = getEnvDuration("EXPORT_LEASE", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if config.AUDIT_CONFIG.HASH_CHAIN, err = getEnvBool("AUDIT_HASH_CHAIN", false); err != nil {
+		return nil, err
+	}
+	if config.AUDIT_CONFIG.RETENTION, err = getEnvDuration("AUDIT_RETENTION", 365*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.LOGIN_HISTORY_RETENTION, err = getEnvDuration("LOGIN_HISTORY_RETENTION", 90*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.OUTBOX_CONFIG.RELAY_INTERVAL, err = getEnvDuration("OUTBOX_RELAY_INTERVAL", time.Second); err != nil {
+		return nil, err
+	}
+	if config.OUTBOX_CONFIG.BATCH_SIZE, err = getEnvInt("OUTBOX_BATCH_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if config.OUTBOX_CONFIG.RETENTION, err = getEnvDuration("OUTBOX_RETENTION", 7*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.OUTBOX_CONFIG.BACKOFF_BASE, err = getEnvDuration("OUTBOX_BACKOFF_BASE", time.Second); err != nil {
+		return nil, err
+	}
+	if config.OUTBOX_CONFIG.BACKOFF_MAX, err = getEnvDuration("OUTBOX_BACKOFF_MAX", 5*time.Minute); err != nil {
+		return nil, err
 	}
-	if config.DB_CONNECTION == "" {
-		return nil, fmt.Errorf("variable de entorno DB_CONNECTION no configurada")
+	if config.SCIM_TENANT_TOKENS, err = getEnvPairs("SCIM_TENANT_TOKENS"); err != nil {
+		return nil, err
+	}
+	if config.WEBHOOK_CONFIG.WORKER_INTERVAL, err = getEnvDuration("WEBHOOK_WORKER_INTERVAL", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if config.WEBHOOK_CONFIG.BATCH_SIZE, err = getEnvInt("WEBHOOK_BATCH_SIZE", 50); err != nil {
+		return nil, err
+	}
+	if config.WEBHOOK_CONFIG.TIMEOUT, err = getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if config.WEBHOOK_CONFIG.MAX_ATTEMPTS, err = getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8); err != nil {
+		return nil, err
+	}
+	if config.WEBHOOK_CONFIG.BACKOFF_BASE, err = getEnvDuration("WEBHOOK_BACKOFF_BASE", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if config.WEBHOOK_CONFIG.BACKOFF_MAX, err = getEnvDuration("WEBHOOK_BACKOFF_MAX", 6*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.WEBHOOK_CONFIG.LOG_RETENTION, err = getEnvDuration("WEBHOOK_LOG_RETENTION", 30*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.WEBHOOK_CONFIG.ALLOW_PRIVATE_URLS, err = getEnvBool("WEBHOOK_ALLOW_PRIVATE_URLS", false); err != nil {
+		return nil, err
+	}
+	if config.OAUTH_CONFIG.AUTHORIZATION_CODE_TTL, err = getEnvDuration("OAUTH_AUTHORIZATION_CODE_TTL", time.Minute); err != nil {
+		return nil, err
+	}
+	if config.OAUTH_CONFIG.CLIENT_CREDENTIALS_TTL, err = getEnvDuration("OAUTH_CLIENT_CREDENTIALS_TTL", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if config.OIDC_CONFIG.ID_TOKEN_TTL, err = getEnvDuration("OIDC_ID_TOKEN_TTL", time.Hour); err != nil {
+		return nil, err
+	}
+	if config.DPOP_CONFIG.PROOF_MAX_AGE, err = getEnvDuration("DPOP_PROOF_MAX_AGE", time.Minute); err != nil {
+		return nil, err
+	}
+	if config.DPOP_CONFIG.REQUIRE_NONCE, err = getEnvBool("DPOP_REQUIRE_NONCE", false); err != nil {
+		return nil, err
+	}
+	if config.DPOP_CONFIG.NONCE_TTL, err = getEnvDuration("DPOP_NONCE_TTL", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if config.TOKEN_CONFIG.ACCESS_TOKEN_TTL, err = getEnvDuration("ACCESS_TOKEN_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.REFRESH_TOKEN_CONFIG.EXPIRY_TIME, err = getEnvDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.REFRESH_TOKEN_CONFIG.IDLE_TIMEOUT, err = getEnvDuration("SESSION_IDLE_TIMEOUT", config.REFRESH_TOKEN_CONFIG.EXPIRY_TIME); err != nil {
+		return nil, err
+	}
+	if config.REFRESH_TOKEN_CONFIG.ABSOLUTE_LIFETIME, err = getEnvDuration("SESSION_ABSOLUTE_LIFETIME", 30*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.REFRESH_TOKEN_CONFIG.REMEMBER_ME_IDLE_TIMEOUT, err = getEnvDuration("SESSION_REMEMBER_ME_IDLE_TIMEOUT", 30*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.REFRESH_TOKEN_CONFIG.REMEMBER_ME_ABSOLUTE_LIFETIME, err = getEnvDuration("SESSION_REMEMBER_ME_ABSOLUTE_LIFETIME", 90*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if err := validateTokenConfig(config); err != nil {
+		return nil, err
+	}
+	if config.SESSION_LIMIT_CONFIG, err = loadSessionLimitConfig(); err != nil {
+		return nil, err
 	}
 	return config, nil
 }
+
+// validateTokenConfig rechaza combinaciones de emisor, audiencias y duraciones
+// que dejarian tokens inutilizables.
+func validateTokenConfig(config *Config) error {
+	tokens := config.TOKEN_CONFIG
+	sessions := config.REFRESH_TOKEN_CONFIG
+	switch {
+	case config.JWT_SECRET_KEY == "":
+		return fmt.Errorf("variable de entorno JWT_SECRET_KEY no configurada")
+	case strings.TrimSpace(tokens.ISSUER) == "":
+		return fmt.Errorf("variable de entorno JWT_ISSUER invalida: %q", tokens.ISSUER)
+	case strings.TrimSpace(tokens.AUDIENCE) == "":
+		return fmt.Errorf("variable de entorno JWT_AUDIENCE invalida: %q", tokens.AUDIENCE)
+	case tokens.ACCESS_TOKEN_TTL >= sessions.EXPIRY_TIME:
+		return fmt.Errorf("ACCESS_TOKEN_TTL (%s) debe ser menor que REFRESH_TOKEN_TTL (%s)", tokens.ACCESS_TOKEN_TTL, sessions.EXPIRY_TIME)
+	case sessions.IDLE_TIMEOUT > sessions.ABSOLUTE_LIFETIME:
+		return fmt.Errorf("SESSION_IDLE_TIMEOUT (%s) no puede superar SESSION_ABSOLUTE_LIFETIME (%s)", sessions.IDLE_TIMEOUT, sessions.ABSOLUTE_LIFETIME)
+	case sessions.EXPIRY_TIME > sessions.ABSOLUTE_LIFETIME:
+		return fmt.Errorf("REFRESH_TOKEN_TTL (%s) no puede superar SESSION_ABSOLUTE_LIFETIME (%s)", sessions.EXPIRY_TIME, sessions.ABSOLUTE_LIFETIME)
+	case sessions.REMEMBER_ME_IDLE_TIMEOUT > sessions.REMEMBER_ME_ABSOLUTE_LIFETIME:
+		return fmt.Errorf("SESSION_REMEMBER_ME_IDLE_TIMEOUT (%s) no puede superar SESSION_REMEMBER_ME_ABSOLUTE_LIFETIME (%s)", sessions.REMEMBER_ME_IDLE_TIMEOUT, sessions.REMEMBER_ME_ABSOLUTE_LIFETIME)
+	case sessions.REMEMBER_ME_IDLE_TIMEOUT < sessions.IDLE_TIMEOUT || sessions.REMEMBER_ME_ABSOLUTE_LIFETIME < sessions.ABSOLUTE_LIFETIME:
+		return fmt.Errorf("la politica SESSION_REMEMBER_ME_* no puede ser mas corta que la normal")
+	case config.DPOP_CONFIG.NONCE_TTL < time.Second:
+		return fmt.Errorf("DPOP_NONCE_TTL (%s) debe ser de al menos 1s", config.DPOP_CONFIG.NONCE_TTL)
+	case config.OAUTH_CONFIG.CLIENT_CREDENTIALS_TTL > tokens.ACCESS_TOKEN_TTL:
+		return fmt.Errorf("OAUTH_CLIENT_CREDENTIALS_TTL (%s) no puede superar ACCESS_TOKEN_TTL (%s)", config.OAUTH_CONFIG.CLIENT_CREDENTIALS_TTL, tokens.ACCESS_TOKEN_TTL)
+	}
+	return nil
+}
+
+// loadSessionLimitConfig lee el limite de sesiones global, el de cada rol y la
+// politica que se aplica al alcanzarlo.
+func loadSessionLimitConfig() (SessionLimitConfig, error) {
+	limits := SessionLimitConfig{
+		ROLE_MAX_SESSIONS: map[string]int{},
+		POLICY:            getEnv("SESSION_LIMIT_POLICY", SessionLimitReject),
+	}
+	if limits.POLICY != SessionLimitReject && limits.POLICY != SessionLimitEvictOldest {
+		return limits, fmt.Errorf("variable de entorno SESSION_LIMIT_POLICY invalida: %q", limits.POLICY)
+	}
+	// A diferencia de getEnvInt se acepta 0, que deja las sesiones sin limite.
+	if value := os.Getenv("SESSION_MAX_CONCURRENT"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return limits, fmt.Errorf("variable de entorno SESSION_MAX_CONCURRENT invalida: %q", value)
+		}
+		limits.MAX_SESSIONS = number
+	}
+	roleLimits, err := getEnvPairs("SESSION_MAX_CONCURRENT_BY_ROLE")
+	if err != nil {
+		return limits, err
+	}
+	for role, value := range roleLimits {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return limits, fmt.Errorf("variable de entorno SESSION_MAX_CONCURRENT_BY_ROLE invalida: %q", role+":"+value)
+		}
+		limits.ROLE_MAX_SESSIONS[role] = number
+	}
+	return limits, nil
+}
+
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvPairs lee una lista "clave:valor,clave:valor".
+func getEnvPairs(key string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, pair := range getEnvList(key) {
+		name, value, ok := strings.Cut(pair, ":")
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("variable de entorno %s invalida: %q", key, pair)
+		}
+		pairs[name] = value
+	}
+	return pairs, nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("variable de entorno %s invalida: %q", key, value)
+	}
+	return duration, nil
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("variable de entorno %s invalida: %q", key, value)
+	}
+	return number, nil
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("variable de entorno %s invalida: %q", key, value)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTestEnv deja una configuracion valida sin base de datos y aplica env
+// encima. Las variables vacias cuentan como no configuradas.
+func setTestEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	base := map[string]string{
+		"STORAGE_BACKEND": StorageBackendMemory,
+		"JWT_SECRET_KEY":  "secret",
+	}
+	for _, key := range []string{
+		"DB_CONNECTION", "POSTGRES_URL", "JWT_ISSUER", "JWT_AUDIENCE", "JWT_DEFAULT_AUDIENCES", "JWT_ALLOWED_AUDIENCES",
+		"ACCESS_TOKEN_TTL", "REFRESH_TOKEN_TTL", "SESSION_IDLE_TIMEOUT", "SESSION_ABSOLUTE_LIFETIME",
+		"SESSION_REMEMBER_ME_IDLE_TIMEOUT", "SESSION_REMEMBER_ME_ABSOLUTE_LIFETIME", "OAUTH_CLIENT_CREDENTIALS_TTL",
+		"DPOP_NONCE_TTL", "SESSION_LIMIT_POLICY", "SESSION_MAX_CONCURRENT", "SESSION_MAX_CONCURRENT_BY_ROLE",
+	} {
+		t.Setenv(key, "")
+	}
+	for key, value := range base {
+		t.Setenv(key, value)
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "defaults", env: nil},
+		{name: "custom lifetimes", env: map[string]string{"ACCESS_TOKEN_TTL": "15m", "REFRESH_TOKEN_TTL": "24h", "SESSION_IDLE_TIMEOUT": "12h", "SESSION_ABSOLUTE_LIFETIME": "48h"}},
+		{name: "missing JWT_SECRET_KEY", env: map[string]string{"JWT_SECRET_KEY": ""}, wantErr: "JWT_SECRET_KEY no configurada"},
+		{name: "blank issuer", env: map[string]string{"JWT_ISSUER": " "}, wantErr: `JWT_ISSUER invalida: " "`},
+		{name: "blank audience", env: map[string]string{"JWT_AUDIENCE": " "}, wantErr: `JWT_AUDIENCE invalida: " "`},
+		{name: "unparsable duration", env: map[string]string{"ACCESS_TOKEN_TTL": "15 minutes"}, wantErr: `ACCESS_TOKEN_TTL invalida: "15 minutes"`},
+		{name: "negative duration", env: map[string]string{"REFRESH_TOKEN_TTL": "-1h"}, wantErr: `REFRESH_TOKEN_TTL invalida: "-1h"`},
+		{name: "access token outlives the refresh token", env: map[string]string{"ACCESS_TOKEN_TTL": "168h"},
+			wantErr: "ACCESS_TOKEN_TTL (168h0m0s) debe ser menor que REFRESH_TOKEN_TTL (168h0m0s)"},
+		{name: "idle timeout over the absolute lifetime", env: map[string]string{"SESSION_IDLE_TIMEOUT": "721h"},
+			wantErr: "SESSION_IDLE_TIMEOUT (721h0m0s) no puede superar SESSION_ABSOLUTE_LIFETIME (720h0m0s)"},
+		{name: "refresh token over the absolute lifetime", env: map[string]string{"REFRESH_TOKEN_TTL": "721h", "SESSION_IDLE_TIMEOUT": "24h"},
+			wantErr: "REFRESH_TOKEN_TTL (721h0m0s) no puede superar SESSION_ABSOLUTE_LIFETIME (720h0m0s)"},
+		{name: "remember me idle timeout over its absolute lifetime", env: map[string]string{"SESSION_REMEMBER_ME_IDLE_TIMEOUT": "2161h"},
+			wantErr: "SESSION_REMEMBER_ME_IDLE_TIMEOUT (2161h0m0s) no puede superar SESSION_REMEMBER_ME_ABSOLUTE_LIFETIME (2160h0m0s)"},
+		{name: "remember me shorter than a normal session", env: map[string]string{"SESSION_REMEMBER_ME_IDLE_TIMEOUT": "24h"},
+			wantErr: "SESSION_REMEMBER_ME_* no puede ser mas corta"},
+		{name: "client credentials outlive the access token", env: map[string]string{"OAUTH_CLIENT_CREDENTIALS_TTL": "25h"},
+			wantErr: "OAUTH_CLIENT_CREDENTIALS_TTL (25h0m0s) no puede superar ACCESS_TOKEN_TTL (24h0m0s)"},
+		{name: "DPoP nonce under a second", env: map[string]string{"DPOP_NONCE_TTL": "500ms"}, wantErr: "DPOP_NONCE_TTL (500ms) debe ser de al menos 1s"},
+		{name: "unknown storage backend", env: map[string]string{"STORAGE_BACKEND": "sqlite"}, wantErr: `STORAGE_BACKEND invalida: "sqlite"`},
+		{name: "mongo without DB_CONNECTION", env: map[string]string{"STORAGE_BACKEND": StorageBackendMongo}, wantErr: "DB_CONNECTION no configurada"},
+		{name: "postgres without POSTGRES_URL", env: map[string]string{"STORAGE_BACKEND": StorageBackendPostgres, "DB_CONNECTION": "mongodb://localhost"},
+			wantErr: "POSTGRES_URL no configurada"},
+		{name: "postgres without DB_CONNECTION", env: map[string]string{"STORAGE_BACKEND": StorageBackendPostgres, "POSTGRES_URL": "postgres://localhost/users"}},
+		{name: "unknown session limit policy", env: map[string]string{"SESSION_LIMIT_POLICY": "drop"}, wantErr: `SESSION_LIMIT_POLICY invalida: "drop"`},
+		{name: "negative session limit", env: map[string]string{"SESSION_MAX_CONCURRENT": "-1"}, wantErr: `SESSION_MAX_CONCURRENT invalida: "-1"`},
+		{name: "unlimited sessions", env: map[string]string{"SESSION_MAX_CONCURRENT": "0"}},
+		{name: "malformed role session limit", env: map[string]string{"SESSION_MAX_CONCURRENT_BY_ROLE": "admin"},
+			wantErr: `SESSION_MAX_CONCURRENT_BY_ROLE invalida: "admin"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestEnv(t, test.env)
+			config, err := LoadConfig()
+			if test.wantErr == "" {
+				if err != nil || config == nil {
+					t.Fatalf("LoadConfig() = %v, want a valid configuration", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("LoadConfig() error = %v, want %q", err, test.wantErr)
+			}
+			if config != nil {
+				t.Fatalf("LoadConfig() returned a configuration along with the error %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigTokenDefaults(t *testing.T) {
+	setTestEnv(t, map[string]string{"JWT_ALLOWED_AUDIENCES": "contacts-service, billing-service ,"})
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, sessions := config.TOKEN_CONFIG, config.REFRESH_TOKEN_CONFIG
+	if tokens.ISSUER != "users-microservice" || tokens.AUDIENCE != "users-microservice" || !slices.Equal(tokens.DEFAULT_AUDIENCES, []string{"contacts-service"}) {
+		t.Fatalf("TOKEN_CONFIG = %+v", tokens)
+	}
+	if !slices.Equal(tokens.ALLOWED_AUDIENCES, []string{"contacts-service", "billing-service"}) {
+		t.Fatalf("ALLOWED_AUDIENCES = %q", tokens.ALLOWED_AUDIENCES)
+	}
+	// Sin SESSION_IDLE_TIMEOUT la inactividad permitida es la vida del refresh token.
+	if tokens.ACCESS_TOKEN_TTL != 24*time.Hour || sessions.EXPIRY_TIME != 7*24*time.Hour || sessions.IDLE_TIMEOUT != sessions.EXPIRY_TIME || sessions.ABSOLUTE_LIFETIME != 30*24*time.Hour {
+		t.Fatalf("lifetimes = %s, %+v", tokens.ACCESS_TOKEN_TTL, sessions)
+	}
+}
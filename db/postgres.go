@@ -0,0 +1,26 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres_connection opens a connection pool to connectionString. The pool
+// size can be set in the URL with pool_max_conns.
+func Postgres_connection(connectionString string) (*pgxpool.Pool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	pool, err := pgxpool.New(ctx, connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("%s", err.Error())
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("%s", err.Error())
+	}
+	fmt.Println("Successfully pinged PostgreSQL!")
+	return pool, nil
+}
@@ -0,0 +1,28 @@
+package dto
+
+import (
+	"time"
+	"users-microservice/models"
+)
+
+type AuditEventQueryDTO struct {
+	ActorId  string     `form:"actor_id"`
+	TargetId string     `form:"target_id"`
+	Type     string     `form:"type"`
+	Outcome  string     `form:"outcome" validate:"omitempty,oneof=success failure"`
+	From     *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To       *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Cursor   string     `form:"cursor"`
+	Limit    int        `form:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+type AuditEventListDTO struct {
+	Events     []models.AuditEvent `json:"events"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+type AuditChainVerificationDTO struct {
+	Valid    bool  `json:"valid"`
+	Checked  int   `json:"checked"`
+	BrokenAt int64 `json:"broken_at_sequence,omitempty"`
+}
@@ -0,0 +1,48 @@
+package dto
+
+import "time"
+
+type ExportRequestDTO struct {
+	Format string `json:"format" form:"format" validate:"omitempty,oneof=json zip"`
+}
+
+type ExportJobDTO struct {
+	JobId       string     `json:"id"`
+	Status      string     `json:"status"`
+	Format      string     `json:"format"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+type ProfileExportDTO struct {
+	UserId    string     `json:"id"`
+	Name      string     `json:"name"`
+	LastName  string     `json:"lastname"`
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	Verified  bool       `json:"verified"`
+	Locked    bool       `json:"locked"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type SessionExportDTO struct {
+	SessionId string    `json:"id"`
+	IssuedAt  time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Revoked   bool      `json:"revoked"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// ConsentExportDTO is the access a user granted to an OAuth client on the
+// consent page, as recorded by the sessions of that client.
+type ConsentExportDTO struct {
+	ClientId   string    `json:"client_id"`
+	ClientName string    `json:"client_name,omitempty"`
+	Scopes     []string  `json:"scopes"`
+	GrantedAt  time.Time `json:"granted_at"`
+	Active     bool      `json:"active"`
+}
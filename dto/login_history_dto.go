@@ -0,0 +1,13 @@
+package dto
+
+import "users-microservice/models"
+
+type LoginHistoryQueryDTO struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+type LoginHistoryDTO struct {
+	Logins     []models.LoginAttempt `json:"logins"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
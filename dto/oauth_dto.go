@@ -0,0 +1,61 @@
+package dto
+
+import "users-microservice/models"
+
+type OAuthClientRequestDTO struct {
+	Name         string   `json:"name" validate:"required,min=3,max=60"`
+	ClientType   string   `json:"client_type" validate:"required,oneof=public confidential"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required,min=1,dive,required,max=2000"`
+	Scopes       []string `json:"scopes" validate:"omitempty,dive,required,max=64,excludesall= "`
+	// Servicios para los que el cliente puede pedir tokens con client_credentials.
+	Audiences []string `json:"audiences" validate:"omitempty,dive,required,max=200"`
+}
+
+// OAuthClientCreatedDTO is the only response that includes the client secret
+// of a confidential client.
+type OAuthClientCreatedDTO struct {
+	models.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type OAuthClientListDTO struct {
+	Clients []models.OAuthClient `json:"clients"`
+}
+
+// AuthorizationRequestDTO holds the parameters of /oauth/authorize. They are
+// checked by the OAuth service, which answers with RFC 6749 errors.
+type AuthorizationRequestDTO struct {
+	ResponseType        string `form:"response_type"`
+	ClientId            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	Nonce               string `form:"nonce"`
+	// Indica si la peticion traia redirect_uri o se uso la unica URI registrada.
+	RedirectURIProvided bool `form:"-"`
+}
+
+type TokenRequestDTO struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	// Puede repetirse para pedir un token valido para varios servicios.
+	Audience []string `form:"audience"`
+	// Credenciales del cliente cuando no se envian con HTTP Basic.
+	ClientId     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+type TokenResponseDTO struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
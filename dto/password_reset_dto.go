@@ -0,0 +1,6 @@
+package dto
+
+type PasswordResetRequestDTO struct {
+	Token    string `json:"token" form:"token" validate:"required,jwt"`
+	Password string `json:"password" form:"password" validate:"required,min=8,max=64"`
+}
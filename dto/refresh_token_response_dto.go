@@ -3,5 +3,5 @@ package dto
 import "time"
 
 type RefreshTokenResponse struct {
-	ExpiresAt    time.Time
+	ExpiresAt time.Time
 }
@@ -5,5 +5,13 @@ import "time"
 type RefreshTokenCreateDTO struct {
 	UserId     string 
 	Jti string		   
-	ExpiresAt  time.Time 
+	ClientId string
+	Scope    string
+	// Momento en que el usuario se autentico; por defecto, la creacion del token.
+	AuthTime  time.Time
+	Audiences []string
+	// La expiracion se calcula con la politica de sesion elegida en el login.
+	RememberMe bool
+	// Sesiones ligadas a una clave DPoP.
+	DPoPJkt string
 }
@@ -5,5 +5,8 @@ type AuthResponse struct {
 	Name         string               `json:"name" validate:"required,min=3,max=15"`
 	Email        string               `json:"email" validate:"required,email,min=5,max=40"`
 	JWT          string               `json:"token" validate:"required"`
+	TokenType    string               `json:"token_type"`
 	RefreshToken RefreshTokenResponse `json:"refresh_token" validate:"required"`
-}
\ No newline at end of file
+	// Sesiones cerradas para respetar el limite de sesiones activas.
+	EvictedSessions int `json:"evicted_sessions,omitempty"`
+}
@@ -0,0 +1,33 @@
+package dto
+
+import "time"
+
+type UserListQueryDTO struct {
+	Cursor       string     `form:"cursor"`
+	Limit        int        `form:"limit" validate:"omitempty,min=1,max=100"`
+	Search       string     `form:"q" validate:"omitempty,max=40"`
+	Verified     *bool      `form:"verified"`
+	Locked       *bool      `form:"locked"`
+	Role         string     `form:"role" validate:"omitempty,oneof=user admin"`
+	CreatedAfter *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	Deleted      bool       `form:"deleted"`
+	Sort         string     `form:"sort" validate:"omitempty,oneof=created_at email name last_name"`
+	Order        string     `form:"order" validate:"omitempty,oneof=asc desc"`
+}
+
+type AdminUserDTO struct {
+	UserId    string     `json:"id"`
+	Name      string     `json:"name"`
+	LastName  string     `json:"lastname"`
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	Verified  bool       `json:"verified"`
+	Locked    bool       `json:"locked"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type UserListResponseDTO struct {
+	Users      []AdminUserDTO `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
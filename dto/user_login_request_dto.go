@@ -3,4 +3,8 @@ package dto
 type LoginRequestDTO struct {
 	Email    string `json:"email" validate:"required,email,min=5,max=40"`
 	Password string `json:"password" validate:"required,min=8,max=64"`
+	// Servicios para los que sera valido el token; por defecto JWT_DEFAULT_AUDIENCES.
+	Audiences []string `json:"audiences" validate:"omitempty,max=10,dive,required,max=200"`
+	// Elige la politica de sesion larga (SESSION_REMEMBER_ME_*).
+	RememberMe bool `json:"remember_me"`
 }
@@ -0,0 +1,29 @@
+package dto
+
+import "time"
+
+// UserProfileDTO is the profile of the signed in user. Version is also sent as
+// the ETag of the response.
+type UserProfileDTO struct {
+	UserId    string    `json:"id"`
+	Name      string    `json:"name"`
+	LastName  string    `json:"lastname"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	Verified  bool      `json:"verified"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int       `json:"version"`
+}
+
+// UserProfileReplaceDTO is the body of PUT /users/me.
+type UserProfileReplaceDTO struct {
+	Name     string `json:"name" validate:"required,min=3,max=15"`
+	LastName string `json:"lastname" validate:"required,min=4,max=15"`
+}
+
+// UserProfilePatchDTO is the body of PATCH /users/me; the fields left out are
+// not changed.
+type UserProfilePatchDTO struct {
+	Name     *string `json:"name" validate:"omitempty,min=3,max=15"`
+	LastName *string `json:"lastname" validate:"omitempty,min=4,max=15"`
+}
@@ -0,0 +1,31 @@
+package dto
+
+import "users-microservice/models"
+
+type WebhookRequestDTO struct {
+	URL        string   `json:"url" validate:"required,http_url"`
+	EventTypes []string `json:"event_types" validate:"omitempty,dive,oneof=user.created user.updated user.deleted user.restored user.purged user.password_changed"`
+	// Si se omite se genera uno aleatorio.
+	Secret string `json:"secret" validate:"omitempty,min=16"`
+}
+
+// WebhookCreatedDTO is the only response that includes the signing secret.
+type WebhookCreatedDTO struct {
+	models.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+type WebhookListDTO struct {
+	Webhooks []models.WebhookSubscription `json:"webhooks"`
+}
+
+type WebhookDeliveryQueryDTO struct {
+	Status string `form:"status" validate:"omitempty,oneof=pending delivered dead_letter"`
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+type WebhookDeliveryListDTO struct {
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+	"users-microservice/models"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+
+	// UserEventSchemaVersion is bumped on every breaking change of
+	// models.UserEventData; consumers read it from the dataschema attribute.
+	UserEventSchemaVersion = "v1"
+	UserEventSchema        = "urn:users-microservice:schema:user-event:" + UserEventSchemaVersion
+)
+
+// CloudEvent is the structured mode JSON envelope of the CloudEvents 1.0 spec.
+type CloudEvent struct {
+	SpecVersion     string               `json:"specversion"`
+	ID              string               `json:"id"`
+	Source          string               `json:"source"`
+	Type            string               `json:"type"`
+	Subject         string               `json:"subject"`
+	Time            time.Time            `json:"time"`
+	DataContentType string               `json:"datacontenttype"`
+	DataSchema      string               `json:"dataschema"`
+	Data            models.UserEventData `json:"data"`
+}
+
+// NewCloudEvent wraps an outbox event. The outbox id is kept as the event id
+// so consumers can deduplicate redeliveries.
+func NewCloudEvent(source string, event *models.OutboxEvent) CloudEvent {
+	return CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              event.ID,
+		Source:          source,
+		Type:            event.Type,
+		Subject:         event.AggregateId,
+		Time:            event.CreatedAt.UTC(),
+		DataContentType: "application/json",
+		DataSchema:      UserEventSchema,
+		Data:            event.Data,
+	}
+}
+
+func marshalCloudEvent(source string, event *models.OutboxEvent) ([]byte, error) {
+	return json.Marshal(NewCloudEvent(source, event))
+}
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"users-microservice/models"
+)
+
+func newTestOutboxEvent() *models.OutboxEvent {
+	deletedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &models.OutboxEvent{
+		ID:          "0190b6c2-7c4d-7b9a-8f3e-2d1c0b9a8f7e",
+		AggregateId: "user-1",
+		Type:        models.EventUserDeleted,
+		Data: models.UserEventData{
+			UserId:        "user-1",
+			Email:         "john@example.com",
+			Name:          "John",
+			LastName:      "Doe",
+			Role:          models.RoleUser,
+			Verified:      true,
+			DeletedAt:     &deletedAt,
+			ChangedFields: []string{"deleted_at"},
+		},
+		CreatedAt: time.Date(2026, 1, 2, 4, 4, 5, 0, time.FixedZone("CET", 3600)),
+	}
+}
+
+func TestMarshalCloudEvent(t *testing.T) {
+	payload, err := marshalCloudEvent("users-microservice", newTestOutboxEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"specversion":"1.0","id":"0190b6c2-7c4d-7b9a-8f3e-2d1c0b9a8f7e","source":"users-microservice",` +
+		`"type":"user.deleted","subject":"user-1","time":"2026-01-02T03:04:05Z","datacontenttype":"application/json",` +
+		`"dataschema":"urn:users-microservice:schema:user-event:v1","data":{"user_id":"user-1","email":"john@example.com",` +
+		`"name":"John","lastname":"Doe","role":"user","verified":true,"locked":false,"deleted_at":"2026-01-02T03:04:05Z",` +
+		`"changed_fields":["deleted_at"]}}`
+	if string(payload) != want {
+		t.Fatalf("marshalCloudEvent =\n%s\nwant\n%s", payload, want)
+	}
+}
+
+func TestNewCloudEventRoundTrip(t *testing.T) {
+	event := newTestOutboxEvent()
+	payload, err := marshalCloudEvent("users-microservice", event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded CloudEvent
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID != event.ID || decoded.Subject != event.AggregateId || !decoded.Time.Equal(event.CreatedAt) ||
+		decoded.Data.Email != event.Data.Email || !decoded.Data.DeletedAt.Equal(*event.Data.DeletedAt) {
+		t.Fatalf("decoded event = %+v, want the fields of %+v", decoded, event)
+	}
+}
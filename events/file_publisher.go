@@ -0,0 +1,51 @@
+package events
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"users-microservice/models"
+)
+
+type writerPublisher struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	closer io.Closer
+	source string
+}
+
+// NewWriterPublisher writes one CloudEvent JSON document per line. It is meant
+// for local development, e.g. with os.Stdout.
+func NewWriterPublisher(writer io.Writer, source string) Publisher {
+	return &writerPublisher{writer: writer, source: source}
+}
+
+// NewFilePublisher appends the events to path as JSON lines.
+func NewFilePublisher(path string, source string) (Publisher, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &writerPublisher{writer: file, closer: file, source: source}, nil
+}
+
+// Publish implements Publisher.
+func (publisher *writerPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	payload, err := marshalCloudEvent(publisher.source, event)
+	if err != nil {
+		return err
+	}
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	_, err = publisher.writer.Write(append(payload, '\n'))
+	return err
+}
+
+// Close implements Publisher.
+func (publisher *writerPublisher) Close() error {
+	if publisher.closer == nil {
+		return nil
+	}
+	return publisher.closer.Close()
+}
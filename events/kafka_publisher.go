@@ -0,0 +1,55 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+	"users-microservice/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaBatchTimeout caps how long WriteMessages waits for more messages to
+// fill a batch. Publish sends one event at a time, so the default of one second
+// would hold every event that long and slow the outbox relay down to about one
+// event per second.
+const kafkaBatchTimeout = 5 * time.Millisecond
+
+type kafkaPublisher struct {
+	writer *kafka.Writer
+	source string
+}
+
+// NewKafkaPublisher publishes every event on topic keyed by the user id, so
+// all the events of a user land on the same partition and keep their order.
+func NewKafkaPublisher(brokers []string, topic string, source string) (Publisher, error) {
+	if len(brokers) == 0 || topic == "" {
+		return nil, errors.New("kafka publisher needs KAFKA_BROKERS and KAFKA_TOPIC")
+	}
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: kafkaBatchTimeout,
+	}
+	return &kafkaPublisher{writer: writer, source: source}, nil
+}
+
+// Publish implements Publisher.
+func (publisher *kafkaPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	payload, err := marshalCloudEvent(publisher.source, event)
+	if err != nil {
+		return err
+	}
+	return publisher.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(event.AggregateId),
+		Value:   payload,
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte(cloudEventsContentType)}},
+	})
+}
+
+// Close implements Publisher.
+func (publisher *kafkaPublisher) Close() error {
+	return publisher.writer.Close()
+}
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"users-microservice/models"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type natsPublisher struct {
+	connection    *nats.Conn
+	stream        jetstream.JetStream
+	subjectPrefix string
+	source        string
+}
+
+// NewNATSPublisher publishes every event on <subjectPrefix>.<event type>, e.g.
+// users.user.created, to the JetStream stream bound to <subjectPrefix>.>, and
+// fails when no stream captures those subjects. The Nats-Msg-Id header lets
+// the stream drop redeliveries of the same outbox event.
+func NewNATSPublisher(url string, subjectPrefix string, source string) (Publisher, error) {
+	connection, err := nats.Connect(url, nats.Name(source))
+	if err != nil {
+		return nil, err
+	}
+	stream, err := jetstream.New(connection)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := stream.StreamNameBySubject(ctx, subjectPrefix+".>"); err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("no JetStream stream captures %s.>: %w", subjectPrefix, err)
+	}
+	return &natsPublisher{connection: connection, stream: stream, subjectPrefix: subjectPrefix, source: source}, nil
+}
+
+// Publish implements Publisher. It waits for the PubAck of the stream, so the
+// relay only marks the event as published once the stream stored it. A
+// duplicate acknowledged by the stream is a success too.
+func (publisher *natsPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	payload, err := marshalCloudEvent(publisher.source, event)
+	if err != nil {
+		return err
+	}
+	message := nats.NewMsg(publisher.subjectPrefix + "." + event.Type)
+	message.Data = payload
+	message.Header.Set("Content-Type", cloudEventsContentType)
+	_, err = publisher.stream.PublishMsg(ctx, message, jetstream.WithMsgID(event.ID))
+	return err
+}
+
+// Close implements Publisher.
+func (publisher *natsPublisher) Close() error {
+	return publisher.connection.Drain()
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// startNATSServer arranca un servidor NATS embebido con JetStream.
+func startNATSServer(t *testing.T) *server.Server {
+	t.Helper()
+	natsServer, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go natsServer.Start()
+	t.Cleanup(natsServer.Shutdown)
+	if !natsServer.ReadyForConnections(10 * time.Second) {
+		t.Fatal("the NATS server did not start")
+	}
+	return natsServer
+}
+
+func createTestStream(t *testing.T, url string, subjects ...string) jetstream.Stream {
+	t.Helper()
+	connection, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(connection.Close)
+	js, err := jetstream.New(connection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "USERS", Subjects: subjects})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+func TestNATSPublisher(t *testing.T) {
+	natsServer := startNATSServer(t)
+	stream := createTestStream(t, natsServer.ClientURL(), "users.>")
+	publisher, err := NewNATSPublisher(natsServer.ClientURL(), "users", "users-microservice")
+	if err != nil {
+		t.Fatalf("NewNATSPublisher: %v", err)
+	}
+	defer publisher.Close()
+
+	event := newTestOutboxEvent()
+	// El relay reintenta tras un fallo: el segundo envio es un duplicado.
+	for range 2 {
+		if err := publisher.Publish(context.Background(), event); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	info, err := stream.Info(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 1 {
+		t.Fatalf("the stream has %d messages, want 1", info.State.Msgs)
+	}
+	message, err := stream.GetLastMsgForSubject(context.Background(), "users.user.deleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Header.Get(nats.MsgIdHdr) != event.ID || message.Header.Get("Content-Type") != cloudEventsContentType {
+		t.Fatalf("message headers = %v", message.Header)
+	}
+	var cloudEvent CloudEvent
+	if err := json.Unmarshal(message.Data, &cloudEvent); err != nil {
+		t.Fatal(err)
+	}
+	if cloudEvent.ID != event.ID || cloudEvent.Type != event.Type || cloudEvent.Source != "users-microservice" {
+		t.Fatalf("published event = %+v", cloudEvent)
+	}
+}
+
+func TestNATSPublisherWithoutStream(t *testing.T) {
+	natsServer := startNATSServer(t)
+	createTestStream(t, natsServer.ClientURL(), "other.>")
+	if _, err := NewNATSPublisher(natsServer.ClientURL(), "users", "users-microservice"); err == nil {
+		t.Fatal("NewNATSPublisher succeeded without a stream for users.>")
+	}
+}
+
+func TestNATSPublisherWaitsForAck(t *testing.T) {
+	natsServer := startNATSServer(t)
+	stream := createTestStream(t, natsServer.ClientURL(), "users.>")
+	publisher, err := NewNATSPublisher(natsServer.ClientURL(), "users", "users-microservice")
+	if err != nil {
+		t.Fatalf("NewNATSPublisher: %v", err)
+	}
+	defer publisher.Close()
+	// Sin el stream no llega el PubAck y el evento debe quedar pendiente.
+	if err := stream.Purge(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	connection, err := nats.Connect(natsServer.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	js, err := jetstream.New(connection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := js.DeleteStream(context.Background(), "USERS"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = publisher.Publish(ctx, newTestOutboxEvent())
+	if !errors.Is(err, jetstream.ErrNoStreamResponse) {
+		t.Fatalf("Publish error = %v, want %v", err, jetstream.ErrNoStreamResponse)
+	}
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"users-microservice/config"
+	"users-microservice/models"
+)
+
+const (
+	PublisherLog    = "log"
+	PublisherStdout = "stdout"
+	PublisherFile   = "file"
+	PublisherNATS   = "nats"
+	PublisherKafka  = "kafka"
+)
+
+// Publisher delivers outbox events to other services. Implementations must be
+// safe to retry: the relay publishes at-least-once.
+type Publisher interface {
+	Publish(ctx context.Context, event *models.OutboxEvent) error
+	Close() error
+}
+
+// NewPublisher builds the publisher selected by EVENT_PUBLISHER.
+func NewPublisher(config config.EventsConfig) (Publisher, error) {
+	switch config.PUBLISHER {
+	case PublisherLog, "":
+		return NewLogPublisher(config.SOURCE), nil
+	case PublisherStdout:
+		return NewWriterPublisher(os.Stdout, config.SOURCE), nil
+	case PublisherFile:
+		return NewFilePublisher(config.FILE_PATH, config.SOURCE)
+	case PublisherNATS:
+		return NewNATSPublisher(config.NATS_URL, config.NATS_SUBJECT_PREFIX, config.SOURCE)
+	case PublisherKafka:
+		return NewKafkaPublisher(config.KAFKA_BROKERS, config.KAFKA_TOPIC, config.SOURCE)
+	default:
+		return nil, fmt.Errorf("unknown event publisher %q", config.PUBLISHER)
+	}
+}
+
+type logPublisher struct {
+	source string
+}
+
+// NewLogPublisher only logs the events, until a message bus is configured.
+func NewLogPublisher(source string) Publisher {
+	return &logPublisher{source: source}
+}
+
+// Publish implements Publisher.
+func (publisher *logPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	payload, err := marshalCloudEvent(publisher.source, event)
+	if err != nil {
+		return err
+	}
+	log.Printf("event %s: %s", event.Type, payload)
+	return nil
+}
+
+// Close implements Publisher.
+func (publisher *logPublisher) Close() error {
+	return nil
+}
+
+type fanoutPublisher struct {
+	publishers []Publisher
+}
+
+// NewFanoutPublisher publishes every event to all the publishers in order and
+// fails if any of them fails, so the relay retries the event. The publishers
+// must therefore tolerate receiving the same event twice.
+func NewFanoutPublisher(publishers ...Publisher) Publisher {
+	return &fanoutPublisher{publishers: publishers}
+}
+
+// Publish implements Publisher.
+func (publisher *fanoutPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	for _, target := range publisher.publishers {
+		if err := target.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements Publisher.
+func (publisher *fanoutPublisher) Close() error {
+	var errs []error
+	for _, target := range publisher.publishers {
+		errs = append(errs, target.Close())
+	}
+	return errors.Join(errs...)
+}
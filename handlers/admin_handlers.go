@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"users-microservice/dto"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type AdminHandler struct {
+	Service   *service.UserService
+	Validator *validator.Validate
+}
+
+func NewAdminHandler(userService *service.UserService, validator *validator.Validate) *AdminHandler {
+	return &AdminHandler{
+		Service:   userService,
+		Validator: validator,
+	}
+}
+
+func (handler *AdminHandler) HandleListUsers(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	query := new(dto.UserListQueryDTO)
+	if err := gc.ShouldBindQuery(query); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"error":   "BAD_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+	if validationErr := handler.Validator.Struct(query); validationErr != nil {
+		if validateError, ok := validationErr.(validator.ValidationErrors); ok {
+			var errorMessage []string
+			for _, er := range validateError {
+				errorMessage = append(errorMessage, translateFieldErr(er))
+			}
+			gc.JSON(http.StatusBadRequest, gin.H{
+				"status":        http.StatusBadRequest,
+				"error":         "VALIDATION_FAILED",
+				"error_details": errorMessage,
+			})
+			return
+		}
+		return
+	}
+	users, serviceErr := handler.Service.ListUsersService(ctx, query)
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.JSON(http.StatusOK, users)
+}
+
+func (handler *AdminHandler) HandleDeleteUser(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	if serviceErr := handler.Service.DeleteUserByIDService(ctx, gc.Param("id")); serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.Status(http.StatusNoContent)
+}
+
+func (handler *AdminHandler) HandleRestoreUser(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	user, serviceErr := handler.Service.RestoreUserService(ctx, gc.Param("id"))
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"users-microservice/dto"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type AuditHandler struct {
+	Service   *service.AuditService
+	Validator *validator.Validate
+}
+
+func NewAuditHandler(auditService *service.AuditService, validator *validator.Validate) *AuditHandler {
+	return &AuditHandler{
+		Service:   auditService,
+		Validator: validator,
+	}
+}
+
+func (handler *AuditHandler) HandleListAuditEvents(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	query := new(dto.AuditEventQueryDTO)
+	if err := gc.ShouldBindQuery(query); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"error":   "BAD_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+	if validationErr := handler.Validator.Struct(query); validationErr != nil {
+		if validateError, ok := validationErr.(validator.ValidationErrors); ok {
+			var errorMessage []string
+			for _, er := range validateError {
+				errorMessage = append(errorMessage, translateFieldErr(er))
+			}
+			gc.JSON(http.StatusBadRequest, gin.H{
+				"status":        http.StatusBadRequest,
+				"error":         "VALIDATION_FAILED",
+				"error_details": errorMessage,
+			})
+			return
+		}
+		return
+	}
+	events, serviceErr := handler.Service.ListEventsService(ctx, query)
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.JSON(http.StatusOK, events)
+}
+
+func (handler *AuditHandler) HandleVerifyAuditChain(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 60*time.Second)
+	defer cancel()
+	result, serviceErr := handler.Service.VerifyChainService(ctx)
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"users-microservice/config"
+	"users-microservice/dto"
+	"users-microservice/models"
+	"users-microservice/repository"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// editedAuditRepository cambia el resultado de los eventos listados para la
+// verificacion, como si se hubieran editado en la base de datos.
+type editedAuditRepository struct {
+	repository.AuditRepository
+	edited bool
+}
+
+func (repo *editedAuditRepository) ListEventsAfterSequence(ctx context.Context, sequence int64, limit int) ([]models.AuditEvent, error) {
+	events, err := repo.AuditRepository.ListEventsAfterSequence(ctx, sequence, limit)
+	if repo.edited && len(events) > 1 {
+		events[1].Outcome = models.AuditOutcomeSuccess
+	}
+	return events, err
+}
+
+func TestHandleVerifyAuditChain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &editedAuditRepository{AuditRepository: repository.NewMemoryAuditRepository()}
+	auditService := service.NewAuditService(repo, &config.Config{AUDIT_CONFIG: config.AuditConfig{HASH_CHAIN: true}})
+	for range 3 {
+		auditService.Record(context.Background(), models.AuditEvent{Type: models.AuditUserLogin, ActorId: "user-1", Outcome: models.AuditOutcomeFailure})
+	}
+	router := gin.New()
+	router.GET("/admin/audit-events/verify", NewAuditHandler(auditService, validator.New()).HandleVerifyAuditChain)
+	verify := func() dto.AuditChainVerificationDTO {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/audit-events/verify", nil))
+		var result dto.AuditChainVerificationDTO
+		if recorder.Code != http.StatusOK || json.Unmarshal(recorder.Body.Bytes(), &result) != nil {
+			t.Fatalf("GET /admin/audit-events/verify = %d %s", recorder.Code, recorder.Body)
+		}
+		return result
+	}
+
+	if result := verify(); !result.Valid || result.Checked != 3 {
+		t.Fatalf("verification of the untouched chain = %+v", result)
+	}
+	repo.edited = true
+	if result := verify(); result.Valid || result.BrokenAt != 2 {
+		t.Fatalf("verification after editing the second event = %+v, want broken at 2", result)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ContextUserId   = "user_id"
+	ContextRole     = "role"
+	ContextTenantId = "tenant_id"
+	ContextScope    = "scope"
+)
+
+// RequestMetadataMiddleware exposes the caller IP, user agent and the optional
+// X-Device-Fingerprint header to the services through the request context.
+func RequestMetadataMiddleware() gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		metadata := service.RequestMetadata{
+			IP:                gc.ClientIP(),
+			UserAgent:         gc.Request.UserAgent(),
+			DeviceFingerprint: gc.GetHeader("X-Device-Fingerprint"),
+			// Varias cabeceras DPoP no forman un JWT valido y la prueba se rechaza.
+			DPoPProof: strings.Join(gc.Request.Header.Values("DPoP"), ","),
+			Method:    gc.Request.Method,
+			Path:      gc.Request.URL.Path,
+		}
+		gc.Request = gc.Request.WithContext(service.WithRequestMetadata(gc.Request.Context(), metadata))
+		gc.Next()
+	}
+}
+
+// AuthMiddleware rejects requests without a valid access token of a user and
+// stores the subject and role of the token in the gin context. The subject
+// also becomes the actor of the request metadata. Service tokens of the
+// client_credentials grant, whose subject is the client, are rejected.
+func AuthMiddleware(refreshTokenService *service.RefreshTokenService) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		scheme, accessToken, _ := strings.Cut(gc.GetHeader("Authorization"), " ")
+		if (scheme != "Bearer" && scheme != "DPoP") || accessToken == "" {
+			abortUnauthorized(gc, "authorization header required")
+			return
+		}
+		claims, err := refreshTokenService.ValidateAccessToken(accessToken)
+		if err != nil {
+			abortUnauthorized(gc, "invalid or expired token")
+			return
+		}
+		if err := refreshTokenService.CheckAccessTokenBindingService(gc.Request.Context(), claims, accessToken, scheme == "DPoP"); err != nil {
+			abortDPoP(gc, err)
+			return
+		}
+		userId, err := claims.GetSubject()
+		if err != nil || userId == "" {
+			abortUnauthorized(gc, "invalid or expired token")
+			return
+		}
+		role, _ := claims["role"].(string)
+		clientId, _ := claims["client_id"].(string)
+		if role == "" || clientId == userId {
+			abortUnauthorized(gc, "invalid or expired token")
+			return
+		}
+		scope, _ := claims["scope"].(string)
+		gc.Set(ContextUserId, userId)
+		gc.Set(ContextRole, role)
+		gc.Set(ContextScope, scope)
+		metadata := service.RequestMetadataFromContext(gc.Request.Context())
+		metadata.ActorId = userId
+		gc.Request = gc.Request.WithContext(service.WithRequestMetadata(gc.Request.Context(), metadata))
+		gc.Next()
+	}
+}
+
+// DPoPNonceMiddleware sends the current DPoP nonce to the clients that send
+// DPoP proofs when DPOP_REQUIRE_NONCE is set, so they can retry with it.
+func DPoPNonceMiddleware(dpopService *service.DPoPService) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		if dpopService.NonceRequired() && gc.GetHeader("DPoP") != "" {
+			gc.Header("DPoP-Nonce", dpopService.NonceService())
+		}
+		gc.Next()
+	}
+}
+
+// ScimAuthMiddleware authenticates SCIM clients with the static bearer token of
+// their tenant and stores the tenant in the gin context. The actor of the
+// request metadata becomes "scim:<tenant>".
+func ScimAuthMiddleware(tenantTokens map[string]string) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		authHeader := gc.GetHeader("Authorization")
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		tenantId := ""
+		for tenant, tenantToken := range tenantTokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(tenantToken)) == 1 {
+				tenantId = tenant
+			}
+		}
+		if !strings.HasPrefix(authHeader, "Bearer ") || tenantId == "" {
+			writeScimError(gc, service.ErrScimUnauthorized)
+			return
+		}
+		gc.Set(ContextTenantId, tenantId)
+		metadata := service.RequestMetadataFromContext(gc.Request.Context())
+		metadata.ActorId = "scim:" + tenantId
+		gc.Request = gc.Request.WithContext(service.WithRequestMetadata(gc.Request.Context(), metadata))
+		gc.Next()
+	}
+}
+
+// RequireRole must run after AuthMiddleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		if gc.GetString(ContextRole) != role {
+			gc.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"status":  http.StatusForbidden,
+				"error":   "FORBIDDEN",
+				"message": "insufficient permissions",
+			})
+			return
+		}
+		gc.Next()
+	}
+}
+
+// abortDPoP answers the requests whose DPoP proof is missing or invalid with the
+// DPoP challenge of RFC 9449 7.1.
+func abortDPoP(gc *gin.Context, err error) {
+	if !errors.Is(err, service.ErrInvalidDPoPProof) && !errors.Is(err, service.ErrDPoPNonceRequired) {
+		gc.Abort()
+		writeServiceError(gc, err)
+		return
+	}
+	code := service.ErrInvalidDPoPProof.Error()
+	if errors.Is(err, service.ErrDPoPNonceRequired) {
+		code = service.ErrDPoPNonceRequired.Error()
+	}
+	gc.Header("WWW-Authenticate", fmt.Sprintf(`DPoP error=%q, algs="ES256 RS256"`, code))
+	abortUnauthorized(gc, err.Error())
+}
+
+func abortUnauthorized(gc *gin.Context, message string) {
+	gc.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"status":  http.StatusUnauthorized,
+		"error":   "UNAUTHORIZED",
+		"message": message,
+	})
+}
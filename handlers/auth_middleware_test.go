@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"users-microservice/config"
+	"users-microservice/repository"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestAuthRouter() (*gin.Engine, *service.RefreshTokenService) {
+	gin.SetMode(gin.TestMode)
+	refreshTokenService := service.NewRefreshTokenService(repository.NewMemoryRefreshTokenRepository(), &config.Config{
+		JWT_SECRET_KEY: "secret",
+		TOKEN_CONFIG: config.TokenConfig{
+			ISSUER:            "users-microservice",
+			AUDIENCE:          "users-microservice",
+			DEFAULT_AUDIENCES: []string{"contacts-service"},
+		},
+		OAUTH_CONFIG: config.OAuthConfig{CLIENT_CREDENTIALS_TTL: time.Minute},
+	})
+	router := gin.New()
+	router.GET("/me", AuthMiddleware(refreshTokenService), func(gc *gin.Context) {
+		gc.String(http.StatusOK, gc.GetString(ContextUserId))
+	})
+	return router, refreshTokenService
+}
+
+func signTestToken(t *testing.T, edit func(claims jwt.MapClaims)) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"sub":  "user-1",
+		"role": "user",
+		"iss":  "users-microservice",
+		"aud":  []string{"contacts-service", "users-microservice"},
+		"iat":  time.Now().Unix(),
+		"exp":  time.Now().Add(time.Minute).Unix(),
+	}
+	if edit != nil {
+		edit(claims)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	router, refreshTokenService := newTestAuthRouter()
+	clientToken, err := refreshTokenService.IssueClientTokenService("client-1", []string{"users-microservice"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "user token", token: signTestToken(t, nil), wantStatus: http.StatusOK},
+		{name: "user token of an OAuth client", token: signTestToken(t, func(claims jwt.MapClaims) {
+			claims["client_id"] = "client-1"
+		}), wantStatus: http.StatusOK},
+		{name: "client_credentials token", token: clientToken.AccessToken, wantStatus: http.StatusUnauthorized},
+		{name: "token without role", token: signTestToken(t, func(claims jwt.MapClaims) {
+			delete(claims, "role")
+		}), wantStatus: http.StatusUnauthorized},
+		{name: "subject equal to the client", token: signTestToken(t, func(claims jwt.MapClaims) {
+			claims["client_id"] = "user-1"
+		}), wantStatus: http.StatusUnauthorized},
+		{name: "token for another service", token: signTestToken(t, func(claims jwt.MapClaims) {
+			claims["aud"] = "contacts-service"
+		}), wantStatus: http.StatusUnauthorized},
+		{name: "token without audience", token: signTestToken(t, func(claims jwt.MapClaims) {
+			delete(claims, "aud")
+		}), wantStatus: http.StatusUnauthorized},
+		{name: "token of another issuer", token: signTestToken(t, func(claims jwt.MapClaims) {
+			claims["iss"] = "other-issuer"
+		}), wantStatus: http.StatusUnauthorized},
+		{name: "expired token", token: signTestToken(t, func(claims jwt.MapClaims) {
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+		}), wantStatus: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/me", nil)
+			request.Header.Set("Authorization", "Bearer "+test.token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+	"users-microservice/dto"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type ExportHandler struct {
+	Service   *service.ExportService
+	Validator *validator.Validate
+}
+
+func NewExportHandler(exportService *service.ExportService, validator *validator.Validate) *ExportHandler {
+	return &ExportHandler{
+		Service:   exportService,
+		Validator: validator,
+	}
+}
+
+func (handler *ExportHandler) HandleExport(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 30*time.Second)
+	defer cancel()
+	request := new(dto.ExportRequestDTO)
+	if err := gc.ShouldBindQuery(request); err != nil || handler.Validator.Struct(request) != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"error":   "BAD_REQUEST",
+			"message": "format must be json or zip",
+		})
+		return
+	}
+	archive, serviceErr := handler.Service.ExportUserDataService(ctx, gc.GetString(ContextUserId), request.Format)
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	writeArchive(gc, archive)
+}
+
+func (handler *ExportHandler) HandleCreateExportJob(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	request := new(dto.ExportRequestDTO)
+	if gc.Request.ContentLength > 0 {
+		if err := gc.ShouldBindJSON(request); err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"error":   "BAD_REQUEST",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	if err := handler.Validator.Struct(request); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"error":   "BAD_REQUEST",
+			"message": "format must be json or zip",
+		})
+		return
+	}
+	job, serviceErr := handler.Service.CreateExportJobService(ctx, gc.GetString(ContextUserId), request.Format)
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.Header("Location", fmt.Sprintf("/users/me/exports/%s", job.JobId))
+	gc.JSON(http.StatusAccepted, job)
+}
+
+func (handler *ExportHandler) HandleExportJobStatus(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	job, serviceErr := handler.Service.FindExportJobService(ctx, gc.GetString(ContextUserId), gc.Param("id"))
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.JSON(http.StatusOK, job)
+}
+
+func (handler *ExportHandler) HandleDownloadExportJob(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	archive, serviceErr := handler.Service.DownloadExportJobService(ctx, gc.GetString(ContextUserId), gc.Param("id"))
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	writeArchive(gc, archive)
+}
+
+func writeArchive(gc *gin.Context, archive *service.ExportArchive) {
+	gc.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", archive.FileName))
+	gc.Data(http.StatusOK, archive.ContentType, archive.Data)
+}
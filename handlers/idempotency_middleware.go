@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header, as the IETF draft
+// suggests using UUIDs.
+const maxIdempotencyKeyLength = 255
+
+// idempotentResponseHeaders are the response headers replayed with the body.
+var idempotentResponseHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// IdempotencyMiddleware honors the Idempotency-Key header: the first request
+// with a key runs and its response is stored, retries with the same key and
+// payload get the stored response with Idempotent-Replayed: true, and a retry
+// with another payload is rejected. Requests without the header run as usual.
+// Responses with a 5xx status are not stored, so those requests can be retried.
+func IdempotencyMiddleware(idempotencyService *service.IdempotencyService) gin.HandlerFunc {
+	return idempotencyMiddleware(idempotencyService, true)
+}
+
+// IdempotencyMiddlewareWithoutBody is IdempotencyMiddleware for the endpoints
+// whose response carries credentials, like the password hash returned by
+// POST /users: only the status and the Location header are stored, and the
+// retries get them with an empty body.
+func IdempotencyMiddlewareWithoutBody(idempotencyService *service.IdempotencyService) gin.HandlerFunc {
+	return idempotencyMiddleware(idempotencyService, false)
+}
+
+func idempotencyMiddleware(idempotencyService *service.IdempotencyService, storeBody bool) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		key := gc.GetHeader("Idempotency-Key")
+		if key == "" {
+			gc.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			gc.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"error":   "BAD_REQUEST",
+				"message": "The Idempotency-Key header must have at most " + strconv.Itoa(maxIdempotencyKeyLength) + " characters.",
+			})
+			return
+		}
+		body, err := io.ReadAll(gc.Request.Body)
+		if err != nil {
+			gc.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"error":   "BAD_REQUEST",
+				"message": err.Error(),
+			})
+			return
+		}
+		gc.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// La misma clave de otro usuario o de otro endpoint es otra peticion.
+		scope := gc.GetString(ContextUserId) + " " + gc.Request.Method + " " + gc.Request.URL.Path
+		ctx, cancel := context.WithTimeout(gc.Request.Context(), 5*time.Second)
+		stored, err := idempotencyService.BeginService(ctx, scope, key, body)
+		cancel()
+		if err != nil {
+			writeServiceError(gc, err)
+			gc.Abort()
+			return
+		}
+		if stored != nil {
+			for name, value := range stored.Headers {
+				gc.Header(name, value)
+			}
+			gc.Header("Idempotent-Replayed", "true")
+			gc.Status(stored.StatusCode)
+			gc.Writer.Write(stored.Body)
+			gc.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: gc.Writer}
+		gc.Writer = recorder
+		gc.Next()
+
+		// La respuesta ya se envio: se guarda aunque el cliente haya cortado la conexion.
+		storeCtx, cancelStore := context.WithTimeout(context.WithoutCancel(gc.Request.Context()), 5*time.Second)
+		defer cancelStore()
+		statusCode := recorder.Status()
+		if statusCode >= http.StatusInternalServerError {
+			if releaseErr := idempotencyService.ReleaseService(storeCtx, scope, key); releaseErr != nil {
+				log.Printf("No se pudo liberar la clave de idempotencia: %v", releaseErr)
+			}
+			return
+		}
+		headers := map[string]string{}
+		var responseBody []byte
+		if storeBody {
+			for _, name := range idempotentResponseHeaders {
+				if value := recorder.Header().Get(name); value != "" {
+					headers[name] = value
+				}
+			}
+			responseBody = recorder.body.Bytes()
+		} else if location := recorder.Header().Get("Location"); location != "" {
+			headers["Location"] = location
+		}
+		if completeErr := idempotencyService.CompleteService(storeCtx, scope, key, statusCode, headers, responseBody); completeErr != nil {
+			log.Printf("No se pudo guardar la respuesta idempotente: %v", completeErr)
+		}
+	}
+}
+
+// responseRecorder copies the response body while it is written to the client.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.body.Write(data)
+	return recorder.ResponseWriter.Write(data)
+}
+
+func (recorder *responseRecorder) WriteString(data string) (int, error) {
+	recorder.body.WriteString(data)
+	return recorder.ResponseWriter.WriteString(data)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"users-microservice/config"
+	"users-microservice/models"
+	"users-microservice/repository"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// storedIdempotencyRepository guarda una copia de lo que el middleware
+// persiste, para comprobar que no queda nada sensible.
+type storedIdempotencyRepository struct {
+	repository.IdempotencyRepository
+	mutex     sync.Mutex
+	reserved  []models.IdempotencyRecord
+	completed []models.IdempotencyRecord
+}
+
+func (repo *storedIdempotencyRepository) Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	repo.mutex.Lock()
+	repo.reserved = append(repo.reserved, *record)
+	repo.mutex.Unlock()
+	return repo.IdempotencyRepository.Reserve(ctx, record)
+}
+
+func (repo *storedIdempotencyRepository) Complete(ctx context.Context, record *models.IdempotencyRecord) error {
+	repo.mutex.Lock()
+	repo.completed = append(repo.completed, *record)
+	repo.mutex.Unlock()
+	return repo.IdempotencyRepository.Complete(ctx, record)
+}
+
+// newIdempotencyRouter monta handler en POST /items detras de middleware y
+// cuenta las veces que se ejecuta.
+func newIdempotencyRouter(middleware func(*service.IdempotencyService) gin.HandlerFunc, handler gin.HandlerFunc) (*gin.Engine, *storedIdempotencyRepository, *int) {
+	gin.SetMode(gin.TestMode)
+	repo := &storedIdempotencyRepository{IdempotencyRepository: repository.NewMemoryIdempotencyRepository()}
+	idempotencyService := service.NewIdempotencyService(repo, &config.Config{JWT_SECRET_KEY: "secret", IDEMPOTENCY_TTL: time.Hour})
+	calls := 0
+	router := gin.New()
+	router.POST("/items", middleware(idempotencyService), func(gc *gin.Context) {
+		calls++
+		handler(gc)
+	})
+	return router, repo, &calls
+}
+
+func postItem(router *gin.Engine, key string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Idempotency-Key", key)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func createItem(gc *gin.Context) {
+	gc.Header("Location", "/items/1")
+	gc.JSON(http.StatusCreated, gin.H{"id": "1", "password": "hash"})
+}
+
+func TestIdempotencyMiddlewareReplay(t *testing.T) {
+	router, repo, calls := newIdempotencyRouter(IdempotencyMiddleware, createItem)
+	first := postItem(router, "key-1", `{"name":"a"}`)
+	second := postItem(router, "key-1", `{"name":"a"}`)
+	if *calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", *calls)
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("Idempotent-Replayed = %q, %q; want only the retry replayed", first.Header().Get("Idempotent-Replayed"), second.Header().Get("Idempotent-Replayed"))
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() || second.Header().Get("Location") != "/items/1" {
+		t.Fatalf("replay = %d %s %v, want %d %s", second.Code, second.Body, second.Header(), first.Code, first.Body)
+	}
+	// La huella es un HMAC con el secreto, no el sha256 del cuerpo.
+	plain := sha256.Sum256([]byte(`{"name":"a"}`))
+	if fingerprint := repo.reserved[0].Fingerprint; fingerprint == "" || fingerprint == hex.EncodeToString(plain[:]) {
+		t.Fatalf("fingerprint = %q, want an HMAC of the body", fingerprint)
+	}
+}
+
+func TestIdempotencyMiddlewareDifferentBody(t *testing.T) {
+	router, _, calls := newIdempotencyRouter(IdempotencyMiddleware, createItem)
+	postItem(router, "key-1", `{"name":"a"}`)
+	if recorder := postItem(router, "key-1", `{"name":"b"}`); recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("another body with the same key = %d %s, want 422", recorder.Code, recorder.Body)
+	}
+	if recorder := postItem(router, "key-2", `{"name":"b"}`); recorder.Code != http.StatusCreated || *calls != 2 {
+		t.Fatalf("another key = %d after %d calls, want 201 after 2", recorder.Code, *calls)
+	}
+}
+
+func TestIdempotencyMiddlewareInFlight(t *testing.T) {
+	started, finish := make(chan struct{}), make(chan struct{})
+	router, _, _ := newIdempotencyRouter(IdempotencyMiddleware, func(gc *gin.Context) {
+		close(started)
+		<-finish
+		createItem(gc)
+	})
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postItem(router, "key-1", `{}`) }()
+	<-started
+
+	if recorder := postItem(router, "key-1", `{}`); recorder.Code != http.StatusConflict {
+		t.Fatalf("retry while the first request runs = %d %s, want 409", recorder.Code, recorder.Body)
+	}
+	close(finish)
+	if recorder := <-done; recorder.Code != http.StatusCreated {
+		t.Fatalf("first request = %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder := postItem(router, "key-1", `{}`); recorder.Code != http.StatusCreated || recorder.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry after the first request finished = %d %v, want the replay", recorder.Code, recorder.Header())
+	}
+}
+
+func TestIdempotencyMiddlewareServerErrorReleasesTheKey(t *testing.T) {
+	failures := 1
+	router, repo, calls := newIdempotencyRouter(IdempotencyMiddleware, func(gc *gin.Context) {
+		if failures > 0 {
+			failures--
+			gc.JSON(http.StatusServiceUnavailable, gin.H{"error": "unavailable"})
+			return
+		}
+		createItem(gc)
+	})
+	if recorder := postItem(router, "key-1", `{}`); recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("first request = %d", recorder.Code)
+	}
+	recorder := postItem(router, "key-1", `{}`)
+	if recorder.Code != http.StatusCreated || recorder.Header().Get("Idempotent-Replayed") != "" || *calls != 2 {
+		t.Fatalf("retry after a 5xx = %d %v after %d calls, want the handler run again", recorder.Code, recorder.Header(), *calls)
+	}
+	if len(repo.completed) != 1 || repo.completed[0].StatusCode != http.StatusCreated {
+		t.Fatalf("stored responses = %+v, want only the 201", repo.completed)
+	}
+}
+
+func TestIdempotencyMiddlewareWithoutBody(t *testing.T) {
+	router, repo, calls := newIdempotencyRouter(IdempotencyMiddlewareWithoutBody, createItem)
+	first := postItem(router, "key-1", `{"password":"secret-password"}`)
+	if !strings.Contains(first.Body.String(), "password") {
+		t.Fatalf("first response = %s, want the handler body", first.Body)
+	}
+	for _, record := range repo.completed {
+		if len(record.Body) != 0 || record.Headers["Content-Type"] != "" {
+			t.Fatalf("stored record = %+v, want no body", record)
+		}
+	}
+	replay := postItem(router, "key-1", `{"password":"secret-password"}`)
+	if *calls != 1 || replay.Code != http.StatusCreated || replay.Body.Len() != 0 || replay.Header().Get("Location") != "/items/1" {
+		t.Fatalf("replay = %d %q %v after %d calls, want the status and Location only", replay.Code, replay.Body, replay.Header(), *calls)
+	}
+	if got := replay.Header().Get("Idempotent-Replayed"); got != "true" {
+		t.Fatalf("Idempotent-Replayed = %q", got)
+	}
+	if len(repo.completed) != 1 {
+		t.Fatalf("stored responses = %d, want 1", len(repo.completed))
+	}
+}
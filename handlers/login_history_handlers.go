@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"users-microservice/dto"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type LoginHistoryHandler struct {
+	Service   *service.LoginHistoryService
+	Validator *validator.Validate
+}
+
+func NewLoginHistoryHandler(loginHistoryService *service.LoginHistoryService, validator *validator.Validate) *LoginHistoryHandler {
+	return &LoginHistoryHandler{
+		Service:   loginHistoryService,
+		Validator: validator,
+	}
+}
+
+func (handler *LoginHistoryHandler) HandleListLogins(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	query := new(dto.LoginHistoryQueryDTO)
+	if err := gc.ShouldBindQuery(query); err != nil || handler.Validator.Struct(query) != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"error":   "BAD_REQUEST",
+			"message": "limit must be between 1 and 100",
+		})
+		return
+	}
+	logins, serviceErr := handler.Service.ListLoginsService(ctx, gc.GetString(ContextUserId), query)
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.JSON(http.StatusOK, logins)
+}
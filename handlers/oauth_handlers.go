@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"users-microservice/dto"
+	"users-microservice/models"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in</title>
+<style>
+body { font-family: sans-serif; max-width: 24rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; margin-top: .5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+{{if .Client}}
+<h1>Sign in to {{.Client.Name}}</h1>
+{{if .Scopes}}<p>{{.Client.Name}} is requesting access to:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientId}}">
+{{if .Request.RedirectURIProvided}}<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">{{end}}
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<label for="email">Email</label>
+<input id="email" name="email" type="email" autocomplete="username" required>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+</form>
+{{else}}
+<h1>Invalid request</h1>
+<p class="error">{{.Error}}</p>
+{{end}}
+</body>
+</html>
+`))
+
+type authorizePageData struct {
+	Client  *models.OAuthClient
+	Request *dto.AuthorizationRequestDTO
+	Scopes  []string
+	Error   string
+}
+
+type OAuthHandler struct {
+	Service   *service.OAuthService
+	Validator *validator.Validate
+}
+
+func NewOAuthHandler(oauthService *service.OAuthService, validator *validator.Validate) *OAuthHandler {
+	return &OAuthHandler{
+		Service:   oauthService,
+		Validator: validator,
+	}
+}
+
+// HandleAuthorize shows the login and consent page of an authorization request.
+func (handler *OAuthHandler) HandleAuthorize(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	request := new(dto.AuthorizationRequestDTO)
+	if err := gc.ShouldBindQuery(request); err != nil {
+		renderAuthorizePage(gc, http.StatusBadRequest, authorizePageData{Error: err.Error()})
+		return
+	}
+	client, err := handler.Service.ValidateAuthorizationRequestService(ctx, request)
+	if err != nil {
+		writeAuthorizeError(gc, request, err)
+		return
+	}
+	renderAuthorizePage(gc, http.StatusOK, authorizePageData{Client: client, Request: request})
+}
+
+// HandleAuthorizeDecision receives the login and consent form and redirects
+// back to the client with the authorization code or the error.
+func (handler *OAuthHandler) HandleAuthorizeDecision(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	request := new(dto.AuthorizationRequestDTO)
+	if err := gc.ShouldBindWith(request, binding.Form); err != nil {
+		renderAuthorizePage(gc, http.StatusBadRequest, authorizePageData{Error: err.Error()})
+		return
+	}
+	client, err := handler.Service.ValidateAuthorizationRequestService(ctx, request)
+	if err != nil {
+		writeAuthorizeError(gc, request, err)
+		return
+	}
+	if gc.PostForm("decision") != "allow" {
+		writeAuthorizeError(gc, request, fmt.Errorf("%w: the user denied the request", service.ErrOAuthAccessDenied))
+		return
+	}
+	code, err := handler.Service.AuthorizeService(ctx, client, request, gc.PostForm("email"), gc.PostForm("password"))
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrInvalidCredencials):
+		renderAuthorizePage(gc, http.StatusUnauthorized, authorizePageData{Client: client, Request: request, Error: "Invalid email or password."})
+		return
+	case errors.Is(err, service.ErrUserLocked), errors.Is(err, service.ErrPasswordResetRequired):
+		statusCode, message := MapErrorToHttp(err)
+		renderAuthorizePage(gc, statusCode, authorizePageData{Client: client, Request: request, Error: message})
+		return
+	case err != nil:
+		writeAuthorizeError(gc, request, err)
+		return
+	}
+	gc.Redirect(http.StatusSeeOther, authorizationRedirect(request, url.Values{"code": {code}}))
+}
+
+func (handler *OAuthHandler) HandleToken(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	gc.Header("Cache-Control", "no-store")
+	gc.Header("Pragma", "no-cache")
+	request := new(dto.TokenRequestDTO)
+	if err := gc.ShouldBindWith(request, binding.Form); err != nil {
+		writeOAuthError(gc, fmt.Errorf("%w: %s", service.ErrOAuthInvalidRequest, err))
+		return
+	}
+	// RFC 6749 2.3.1: las credenciales de HTTP Basic van codificadas como formulario.
+	if clientId, secret, ok := gc.Request.BasicAuth(); ok {
+		request.ClientId, _ = url.QueryUnescape(clientId)
+		request.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+	tokens, err := handler.Service.ExchangeTokenService(ctx, request)
+	if err != nil {
+		writeOAuthError(gc, err)
+		return
+	}
+	gc.JSON(http.StatusOK, tokens)
+}
+
+func (handler *OAuthHandler) HandleCreateClient(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	request := new(dto.OAuthClientRequestDTO)
+	if err := gc.ShouldBindJSON(request); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"error":   "BAD_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+	if validationErr := handler.Validator.Struct(request); validationErr != nil {
+		if validateError, ok := validationErr.(validator.ValidationErrors); ok {
+			var errorMessage []string
+			for _, er := range validateError {
+				errorMessage = append(errorMessage, translateFieldErr(er))
+			}
+			gc.JSON(http.StatusBadRequest, gin.H{
+				"status":        http.StatusBadRequest,
+				"error":         "VALIDATION_FAILED",
+				"error_details": errorMessage,
+			})
+			return
+		}
+		return
+	}
+	client, serviceErr := handler.Service.CreateClientService(ctx, request)
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.Header("Location", fmt.Sprintf("/admin/oauth/clients/%s", client.ID))
+	gc.JSON(http.StatusCreated, client)
+}
+
+func (handler *OAuthHandler) HandleListClients(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	clients, serviceErr := handler.Service.ListClientsService(ctx)
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.JSON(http.StatusOK, clients)
+}
+
+func (handler *OAuthHandler) HandleDeleteClient(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	if serviceErr := handler.Service.DeleteClientService(ctx, gc.Param("id")); serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.Status(http.StatusNoContent)
+}
+
+func renderAuthorizePage(gc *gin.Context, statusCode int, data authorizePageData) {
+	if data.Request != nil {
+		data.Scopes = strings.Fields(data.Request.Scope)
+	}
+	gc.Header("Cache-Control", "no-store")
+	gc.Header("X-Frame-Options", "DENY")
+	gc.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	gc.Header("Content-Type", "text/html; charset=utf-8")
+	gc.Status(statusCode)
+	if err := authorizePage.Execute(gc.Writer, data); err != nil {
+		gc.Error(err)
+	}
+}
+
+// writeAuthorizeError shows the errors about the client or the redirect URI to
+// the user, as redirecting could send the user to an attacker, and so are the
+// unexpected errors. OAuth errors are sent back to the validated redirect URI.
+func writeAuthorizeError(gc *gin.Context, request *dto.AuthorizationRequestDTO, err error) {
+	if errors.Is(err, service.ErrOAuthInvalidClient) || errors.Is(err, service.ErrInvalidRedirectURI) {
+		renderAuthorizePage(gc, http.StatusBadRequest, authorizePageData{Error: err.Error()})
+		return
+	}
+	code, statusCode, description := MapErrorToOAuth(err)
+	if statusCode == http.StatusInternalServerError {
+		_, message := MapErrorToHttp(err)
+		renderAuthorizePage(gc, statusCode, authorizePageData{Error: message})
+		return
+	}
+	values := url.Values{"error": {code}}
+	if description != "" {
+		values.Set("error_description", description)
+	}
+	gc.Redirect(http.StatusSeeOther, authorizationRedirect(request, values))
+}
+
+// authorizationRedirect adds values and the state of the request to the query
+// of the redirect URI, keeping the query it was registered with.
+func authorizationRedirect(request *dto.AuthorizationRequestDTO, values url.Values) string {
+	redirectURI, _ := url.Parse(request.RedirectURI)
+	query := redirectURI.Query()
+	for name, value := range values {
+		query[name] = value
+	}
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+	redirectURI.RawQuery = query.Encode()
+	return redirectURI.String()
+}
+
+// writeOAuthError writes the JSON error of the token endpoint (RFC 6749 5.2).
+func writeOAuthError(gc *gin.Context, err error) {
+	code, statusCode, description := MapErrorToOAuth(err)
+	if statusCode == http.StatusUnauthorized && gc.GetHeader("Authorization") != "" {
+		gc.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	response := gin.H{"error": code}
+	if description != "" {
+		response["error_description"] = description
+	}
+	gc.JSON(statusCode, response)
+}
+
+// MapErrorToOAuth returns the RFC 6749 error code, the status and the
+// description of a service error. Unknown errors become server_error without
+// description.
+func MapErrorToOAuth(err error) (string, int, string) {
+	oauthErrors := []struct {
+		err        error
+		statusCode int
+	}{
+		{service.ErrOAuthInvalidRequest, http.StatusBadRequest},
+		{service.ErrOAuthInvalidClient, http.StatusUnauthorized},
+		{service.ErrOAuthInvalidGrant, http.StatusBadRequest},
+		{service.ErrOAuthUnauthorizedClient, http.StatusBadRequest},
+		{service.ErrOAuthUnsupportedGrantType, http.StatusBadRequest},
+		{service.ErrOAuthUnsupportedResponseType, http.StatusBadRequest},
+		{service.ErrOAuthInvalidScope, http.StatusBadRequest},
+		{service.ErrOAuthAccessDenied, http.StatusForbidden},
+		{service.ErrInvalidDPoPProof, http.StatusBadRequest},
+		{service.ErrDPoPNonceRequired, http.StatusBadRequest},
+	}
+	for _, oauthError := range oauthErrors {
+		if errors.Is(err, oauthError.err) {
+			code := oauthError.err.Error()
+			return code, oauthError.statusCode, strings.TrimPrefix(err.Error(), code+": ")
+		}
+	}
+	return "server_error", http.StatusInternalServerError, ""
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OIDCHandler struct {
+	Service *service.OIDCService
+}
+
+func NewOIDCHandler(oidcService *service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		Service: oidcService,
+	}
+}
+
+func (handler *OIDCHandler) HandleDiscovery(gc *gin.Context) {
+	gc.JSON(http.StatusOK, handler.Service.DiscoveryService())
+}
+
+func (handler *OIDCHandler) HandleJWKS(gc *gin.Context) {
+	gc.JSON(http.StatusOK, handler.Service.JWKSService())
+}
+
+// HandleUserInfo runs behind AuthMiddleware and answers with the claims
+// allowed by the scope of the access token.
+func (handler *OIDCHandler) HandleUserInfo(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	claims, serviceErr := handler.Service.UserInfoService(ctx, gc.GetString(ContextUserId), gc.GetString(ContextScope))
+	if errors.Is(serviceErr, service.ErrInsufficientScope) {
+		gc.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		gc.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope"})
+		return
+	}
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.Header("Cache-Control", "no-store")
+	gc.JSON(http.StatusOK, claims)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"users-microservice/dto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+func (handler *UserHandler) HandleGetCurrentUser(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	profile, serviceErr := handler.Service.FindProfileService(ctx, gc.GetString(ContextUserId))
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	writeProfile(gc, profile)
+}
+
+func (handler *UserHandler) HandleReplaceCurrentUser(gc *gin.Context) {
+	request := new(dto.UserProfileReplaceDTO)
+	if !handler.bindProfile(gc, request) {
+		return
+	}
+	handler.updateCurrentUser(gc, &dto.UserProfilePatchDTO{Name: &request.Name, LastName: &request.LastName})
+}
+
+func (handler *UserHandler) HandlePatchCurrentUser(gc *gin.Context) {
+	request := new(dto.UserProfilePatchDTO)
+	if !handler.bindProfile(gc, request) {
+		return
+	}
+	handler.updateCurrentUser(gc, request)
+}
+
+func (handler *UserHandler) updateCurrentUser(gc *gin.Context, patch *dto.UserProfilePatchDTO) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	profile, serviceErr := handler.Service.UpdateProfileService(ctx, gc.GetString(ContextUserId), patch, ifMatchVersions(gc.GetHeader("If-Match")))
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	writeProfile(gc, profile)
+}
+
+func (handler *UserHandler) bindProfile(gc *gin.Context, request interface{}) bool {
+	if err := gc.BindJSON(request); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"error":   "BAD_REQUEST",
+			"message": err.Error(),
+		})
+		return false
+	}
+	if validationErr := handler.Validator.Struct(request); validationErr != nil {
+		if validateError, ok := validationErr.(validator.ValidationErrors); ok {
+			var errorMessage []string
+			for _, er := range validateError {
+				errorMessage = append(errorMessage, translateFieldErr(er))
+			}
+			gc.JSON(http.StatusBadRequest, gin.H{
+				"status":        http.StatusBadRequest,
+				"error":         "VALIDATION_FAILED",
+				"error_details": errorMessage,
+			})
+			return false
+		}
+		return false
+	}
+	return true
+}
+
+func writeProfile(gc *gin.Context, profile *dto.UserProfileDTO) {
+	gc.Header("ETag", strconv.Quote(strconv.Itoa(profile.Version)))
+	gc.JSON(http.StatusOK, profile)
+}
+
+// ifMatchVersions returns the user versions accepted by an If-Match header, or
+// nil when it is missing or "*". If-Match uses the strong comparison of RFC
+// 9110, so weak or malformed tags match no version.
+func ifMatchVersions(header string) []int {
+	if header = strings.TrimSpace(header); header == "" || header == "*" {
+		return nil
+	}
+	versions := []int{}
+	for _, tag := range strings.Split(header, ",") {
+		unquoted, err := strconv.Unquote(strings.TrimSpace(tag))
+		if err != nil {
+			continue
+		}
+		if version, err := strconv.Atoi(unquoted); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
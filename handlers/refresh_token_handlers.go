@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
+
 type RefreshTokenRequest struct {
 	Token string `validate:"required,jwt"`
 }
@@ -33,7 +34,8 @@ func (handler *RefreshTokenHandler) HandleRefreshToken(c *gin.Context) {
 		return
 	}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	// Las sesiones ligadas a DPoP envian el access token con el esquema DPoP.
+	tokenString := strings.TrimPrefix(strings.TrimPrefix(authHeader, "Bearer "), "DPoP ")
 	request := RefreshTokenRequest{Token: tokenString}
 
 	// Validar con el validator
@@ -47,10 +49,15 @@ func (handler *RefreshTokenHandler) HandleRefreshToken(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
+	// Con una prueba DPoP el nuevo token queda ligado a su clave.
+	tokenType := "Bearer"
+	if c.GetHeader("DPoP") != "" {
+		tokenType = "DPoP"
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"access_token": newAccessToken,
-		"token_type":   "Bearer",
+		"token_type":   tokenType,
 	})
 }
 
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"users-microservice/dto"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const scimContentType = "application/scim+json"
+
+type ScimHandler struct {
+	Service *service.ScimService
+}
+
+func NewScimHandler(scimService *service.ScimService) *ScimHandler {
+	return &ScimHandler{
+		Service: scimService,
+	}
+}
+
+func (handler *ScimHandler) HandleListUsers(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 30*time.Second)
+	defer cancel()
+	query := new(dto.ScimListQueryDTO)
+	if err := gc.ShouldBindQuery(query); err != nil {
+		writeScimError(gc, fmt.Errorf("%w: %w", service.ErrScimInvalidValue, err))
+		return
+	}
+	users, serviceErr := handler.Service.ListUsersService(ctx, gc.GetString(ContextTenantId), query)
+	if serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	writeScim(gc, http.StatusOK, users)
+}
+
+func (handler *ScimHandler) HandleGetUser(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	user, serviceErr := handler.Service.GetUserService(ctx, gc.GetString(ContextTenantId), gc.Param("id"))
+	if serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	writeScim(gc, http.StatusOK, user)
+}
+
+func (handler *ScimHandler) HandleCreateUser(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	request := new(dto.ScimUserDTO)
+	if !bindScim(gc, request) {
+		return
+	}
+	user, serviceErr := handler.Service.CreateUserService(ctx, gc.GetString(ContextTenantId), request)
+	if serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	gc.Header("Location", user.Meta.Location)
+	writeScim(gc, http.StatusCreated, user)
+}
+
+func (handler *ScimHandler) HandleReplaceUser(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	request := new(dto.ScimUserDTO)
+	if !bindScim(gc, request) {
+		return
+	}
+	user, serviceErr := handler.Service.ReplaceUserService(ctx, gc.GetString(ContextTenantId), gc.Param("id"), request)
+	if serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	writeScim(gc, http.StatusOK, user)
+}
+
+func (handler *ScimHandler) HandlePatchUser(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	patch := new(dto.ScimPatchDTO)
+	if !bindScim(gc, patch) {
+		return
+	}
+	user, serviceErr := handler.Service.PatchUserService(ctx, gc.GetString(ContextTenantId), gc.Param("id"), patch)
+	if serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	writeScim(gc, http.StatusOK, user)
+}
+
+func (handler *ScimHandler) HandleDeleteUser(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	if serviceErr := handler.Service.DeleteUserService(ctx, gc.GetString(ContextTenantId), gc.Param("id")); serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	gc.Status(http.StatusNoContent)
+}
+
+func (handler *ScimHandler) HandleListGroups(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 30*time.Second)
+	defer cancel()
+	query := new(dto.ScimListQueryDTO)
+	if err := gc.ShouldBindQuery(query); err != nil {
+		writeScimError(gc, fmt.Errorf("%w: %w", service.ErrScimInvalidValue, err))
+		return
+	}
+	groups, serviceErr := handler.Service.ListGroupsService(ctx, gc.GetString(ContextTenantId), query)
+	if serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	writeScim(gc, http.StatusOK, groups)
+}
+
+func (handler *ScimHandler) HandleGetGroup(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	group, serviceErr := handler.Service.GetGroupService(ctx, gc.GetString(ContextTenantId), gc.Param("id"))
+	if serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	writeScim(gc, http.StatusOK, group)
+}
+
+func (handler *ScimHandler) HandleCreateGroup(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	request := new(dto.ScimGroupDTO)
+	if !bindScim(gc, request) {
+		return
+	}
+	group, serviceErr := handler.Service.CreateGroupService(ctx, gc.GetString(ContextTenantId), request)
+	if serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	gc.Header("Location", group.Meta.Location)
+	writeScim(gc, http.StatusCreated, group)
+}
+
+func (handler *ScimHandler) HandleReplaceGroup(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	request := new(dto.ScimGroupDTO)
+	if !bindScim(gc, request) {
+		return
+	}
+	group, serviceErr := handler.Service.ReplaceGroupService(ctx, gc.GetString(ContextTenantId), gc.Param("id"), request)
+	if serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	writeScim(gc, http.StatusOK, group)
+}
+
+func (handler *ScimHandler) HandlePatchGroup(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	patch := new(dto.ScimPatchDTO)
+	if !bindScim(gc, patch) {
+		return
+	}
+	group, serviceErr := handler.Service.PatchGroupService(ctx, gc.GetString(ContextTenantId), gc.Param("id"), patch)
+	if serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	writeScim(gc, http.StatusOK, group)
+}
+
+func (handler *ScimHandler) HandleDeleteGroup(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	if serviceErr := handler.Service.DeleteGroupService(ctx, gc.GetString(ContextTenantId), gc.Param("id")); serviceErr != nil {
+		writeScimError(gc, serviceErr)
+		return
+	}
+	gc.Status(http.StatusNoContent)
+}
+
+func (handler *ScimHandler) HandleServiceProviderConfig(gc *gin.Context) {
+	writeScim(gc, http.StatusOK, handler.Service.ServiceProviderConfigService())
+}
+
+func (handler *ScimHandler) HandleResourceTypes(gc *gin.Context) {
+	resourceTypes := handler.Service.ResourceTypesService()
+	writeScim(gc, http.StatusOK, scimDiscoveryList(resourceTypes))
+}
+
+func (handler *ScimHandler) HandleResourceType(gc *gin.Context) {
+	resourceType := handler.Service.ResourceTypeService(gc.Param("id"))
+	if resourceType == nil {
+		writeScimError(gc, service.ErrScimResourceNotFound)
+		return
+	}
+	writeScim(gc, http.StatusOK, resourceType)
+}
+
+func (handler *ScimHandler) HandleSchemas(gc *gin.Context) {
+	writeScim(gc, http.StatusOK, scimDiscoveryList(handler.Service.SchemasService()))
+}
+
+func (handler *ScimHandler) HandleSchema(gc *gin.Context) {
+	schema := handler.Service.SchemaService(gc.Param("id"))
+	if schema == nil {
+		writeScimError(gc, service.ErrScimResourceNotFound)
+		return
+	}
+	writeScim(gc, http.StatusOK, schema)
+}
+
+func scimDiscoveryList(documents []map[string]interface{}) *dto.ScimListResponseDTO {
+	resources := make([]interface{}, 0, len(documents))
+	for _, document := range documents {
+		resources = append(resources, document)
+	}
+	return &dto.ScimListResponseDTO{
+		Schemas:      []string{dto.ScimListResponseSchema},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+// bindScim decodes the body whatever the content type (SCIM clients send
+// application/scim+json) and writes the SCIM error itself.
+func bindScim(gc *gin.Context, target interface{}) bool {
+	if err := gc.ShouldBindJSON(target); err != nil {
+		writeScimError(gc, fmt.Errorf("%w: %w", service.ErrScimInvalidSyntax, err))
+		return false
+	}
+	return true
+}
+
+func writeScim(gc *gin.Context, status int, body interface{}) {
+	gc.Header("Content-Type", scimContentType)
+	gc.JSON(status, body)
+}
+
+func writeScimError(gc *gin.Context, serviceErr error) {
+	status, scimType := MapErrorToScim(serviceErr)
+	detail := serviceErr.Error()
+	if status == http.StatusInternalServerError {
+		detail = "An unexpected error occurred on the server."
+	}
+	gc.Header("Content-Type", scimContentType)
+	gc.AbortWithStatusJSON(status, dto.ScimErrorDTO{
+		Schemas:  []string{dto.ScimErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+// MapErrorToScim returns the HTTP status and the scimType of RFC 7644 section
+// 3.12 for a service error.
+func MapErrorToScim(err error) (int, string) {
+	switch {
+	case errors.Is(err, service.ErrScimUnauthorized):
+		return http.StatusUnauthorized, ""
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrGroupNotFound), errors.Is(err, service.ErrScimResourceNotFound):
+		return http.StatusNotFound, ""
+	case errors.Is(err, service.ErrEmailConflict), errors.Is(err, service.ErrGroupNameConflict):
+		return http.StatusConflict, "uniqueness"
+	case errors.Is(err, service.ErrVersionConflict):
+		return http.StatusPreconditionFailed, ""
+	case errors.Is(err, service.ErrScimInvalidFilter):
+		return http.StatusBadRequest, "invalidFilter"
+	case errors.Is(err, service.ErrScimInvalidPath):
+		return http.StatusBadRequest, "invalidPath"
+	case errors.Is(err, service.ErrScimMutability):
+		return http.StatusBadRequest, "mutability"
+	case errors.Is(err, service.ErrScimInvalidSyntax):
+		return http.StatusBadRequest, "invalidSyntax"
+	case errors.Is(err, service.ErrScimInvalidValue):
+		return http.StatusBadRequest, "invalidValue"
+	}
+	return http.StatusInternalServerError, ""
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"time"
+	"users-microservice/dto"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var securityPage = template.Must(template.New("security").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 24rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; margin-top: .5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if eq .Form "not-me"}}
+<form method="post" action="/users/security/not-me">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Sign out every session</button>
+</form>
+{{else if eq .Form "reset"}}
+<form method="post" action="/users/password/reset">
+<input type="hidden" name="token" value="{{.Token}}">
+<label for="password">New password</label>
+<input id="password" name="password" type="password" autocomplete="new-password" minlength="8" maxlength="64" required>
+<button type="submit">Change password</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// securityPageData fills securityPage. Form is "not-me" or "reset" to show
+// the form of the link, or empty to only show the message.
+type securityPageData struct {
+	Title   string
+	Message string
+	Error   string
+	Form    string
+	Token   string
+}
+
+type SecurityHandler struct {
+	Service   *service.SecurityService
+	Validator *validator.Validate
+}
+
+func NewSecurityHandler(securityService *service.SecurityService, validator *validator.Validate) *SecurityHandler {
+	return &SecurityHandler{
+		Service:   securityService,
+		Validator: validator,
+	}
+}
+
+// HandleUnrecognizedLoginPage is the target of the "this wasn't me" link of
+// the new sign-in email. It changes nothing, as mail scanners open links: it
+// shows a form that posts the token to HandleReportUnrecognizedLogin.
+func (handler *SecurityHandler) HandleUnrecognizedLoginPage(gc *gin.Context) {
+	renderSecurityPage(gc, http.StatusOK, securityPageData{
+		Title:   "Wasn't you?",
+		Message: "Confirm to sign out every session of your account. You will get an email to choose a new password.",
+		Form:    "not-me",
+		Token:   gc.Query("token"),
+	})
+}
+
+// HandleReportUnrecognizedLogin receives the confirmation form of the "this
+// wasn't me" link.
+func (handler *SecurityHandler) HandleReportUnrecognizedLogin(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	if serviceErr := handler.Service.ReportUnrecognizedLoginService(ctx, gc.PostForm("token")); serviceErr != nil {
+		statusCode, message := MapErrorToHttp(serviceErr)
+		renderSecurityPage(gc, statusCode, securityPageData{Title: "Wasn't you?", Error: message})
+		return
+	}
+	renderSecurityPage(gc, http.StatusOK, securityPageData{
+		Title:   "Sessions signed out",
+		Message: "All sessions were signed out. Check your email to choose a new password.",
+	})
+}
+
+// HandlePasswordResetPage is the default PASSWORD_RESET_URL: it shows a form
+// that posts the token of the link and the new password to
+// HandleResetPassword.
+func (handler *SecurityHandler) HandlePasswordResetPage(gc *gin.Context) {
+	renderSecurityPage(gc, http.StatusOK, securityPageData{
+		Title: "Choose a new password",
+		Form:  "reset",
+		Token: gc.Query("token"),
+	})
+}
+
+// HandleResetPassword accepts a JSON body from API clients, answered with 204,
+// and the form of HandlePasswordResetPage, answered with a page.
+func (handler *SecurityHandler) HandleResetPassword(gc *gin.Context) {
+	if gc.ContentType() == binding.MIMEPOSTForm {
+		handler.handleResetPasswordForm(gc)
+		return
+	}
+	handler.handleResetPasswordJSON(gc)
+}
+
+func (handler *SecurityHandler) handleResetPasswordForm(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	request := new(dto.PasswordResetRequestDTO)
+	if err := gc.ShouldBindWith(request, binding.Form); err != nil {
+		renderSecurityPage(gc, http.StatusBadRequest, securityPageData{Title: "Choose a new password", Error: err.Error()})
+		return
+	}
+	if validationErr := handler.Validator.StructPartial(request, "Token"); validationErr != nil {
+		_, message := MapErrorToHttp(service.ErrInvalidSecurityToken)
+		renderSecurityPage(gc, http.StatusBadRequest, securityPageData{Title: "Choose a new password", Error: message})
+		return
+	}
+	if validationErr := handler.Validator.StructPartial(request, "Password"); validationErr != nil {
+		renderSecurityPage(gc, http.StatusBadRequest, securityPageData{
+			Title: "Choose a new password",
+			Error: "The password must have between 8 and 64 characters.",
+			Form:  "reset",
+			Token: request.Token,
+		})
+		return
+	}
+	if serviceErr := handler.Service.ResetPasswordService(ctx, request.Token, request.Password); serviceErr != nil {
+		statusCode, message := MapErrorToHttp(serviceErr)
+		renderSecurityPage(gc, statusCode, securityPageData{Title: "Choose a new password", Error: message})
+		return
+	}
+	renderSecurityPage(gc, http.StatusOK, securityPageData{
+		Title:   "Password changed",
+		Message: "Your password was changed. You can sign in with it now.",
+	})
+}
+
+func (handler *SecurityHandler) handleResetPasswordJSON(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	request := new(dto.PasswordResetRequestDTO)
+	if err := gc.BindJSON(request); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"error":   "BAD_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+	if validationErr := handler.Validator.Struct(request); validationErr != nil {
+		if validateError, ok := validationErr.(validator.ValidationErrors); ok {
+			var errorMessage []string
+			for _, er := range validateError {
+				errorMessage = append(errorMessage, translateFieldErr(er))
+			}
+			gc.JSON(http.StatusBadRequest, gin.H{
+				"status":        http.StatusBadRequest,
+				"error":         "VALIDATION_FAILED",
+				"error_details": errorMessage,
+			})
+			return
+		}
+		return
+	}
+	if serviceErr := handler.Service.ResetPasswordService(ctx, request.Token, request.Password); serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.Status(http.StatusNoContent)
+}
+
+func renderSecurityPage(gc *gin.Context, statusCode int, data securityPageData) {
+	gc.Header("Cache-Control", "no-store")
+	gc.Header("Referrer-Policy", "no-referrer")
+	gc.Header("X-Frame-Options", "DENY")
+	gc.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	gc.Header("Content-Type", "text/html; charset=utf-8")
+	gc.Status(statusCode)
+	if err := securityPage.Execute(gc.Writer, data); err != nil {
+		gc.Error(err)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"users-microservice/config"
+	"users-microservice/models"
+	"users-microservice/notification"
+	"users-microservice/repository"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestSecurityPages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userRepository := repository.NewMemoryUserRepository()
+	user := &models.User{UserId: "user-1", Email: "john@example.com", SessionVersion: 1, Role: models.RoleUser}
+	if err := userRepository.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	securityService := service.NewSecurityService(userRepository, repository.NewMemoryRefreshTokenRepository(), repository.NewMemoryOutboxRepository(),
+		repository.NewMemoryTransactionManager(), notification.NewLogMailer(), &config.Config{JWT_SECRET_KEY: "secret"})
+	handler := NewSecurityHandler(securityService, validator.New())
+	router := gin.New()
+	router.GET("/users/security/not-me", handler.HandleUnrecognizedLoginPage)
+	router.POST("/users/security/not-me", handler.HandleReportUnrecognizedLogin)
+	router.GET("/users/password/reset", handler.HandlePasswordResetPage)
+	router.POST("/users/password/reset", handler.HandleResetPassword)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		form       url.Values
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "not-me link", method: http.MethodGet, target: "/users/security/not-me?token=abc%22%3E",
+			wantStatus: http.StatusOK, wantBody: `<form method="post" action="/users/security/not-me">`},
+		{name: "not-me token is escaped", method: http.MethodGet, target: "/users/security/not-me?token=abc%22%3E",
+			wantStatus: http.StatusOK, wantBody: `value="abc&#34;&gt;"`},
+		{name: "not-me confirmation with an invalid token", method: http.MethodPost, target: "/users/security/not-me",
+			form: url.Values{"token": {"invalid"}}, wantStatus: http.StatusBadRequest, wantBody: "The link is invalid or has expired."},
+		{name: "reset link", method: http.MethodGet, target: "/users/password/reset?token=abc",
+			wantStatus: http.StatusOK, wantBody: `<form method="post" action="/users/password/reset">`},
+		{name: "reset form with an invalid token", method: http.MethodPost, target: "/users/password/reset",
+			form: url.Values{"token": {"invalid"}, "password": {"new-password"}}, wantStatus: http.StatusBadRequest, wantBody: "The link is invalid or has expired."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.target, strings.NewReader(test.form.Encode()))
+			if test.form != nil {
+				request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != test.wantStatus || !strings.Contains(recorder.Body.String(), test.wantBody) {
+				t.Fatalf("%s %s = %d %s, want %d with %q", test.method, test.target, recorder.Code, recorder.Body, test.wantStatus, test.wantBody)
+			}
+		})
+	}
+	// Abrir el enlace no debe cambiar nada: los escaneres de correo lo abren.
+	found, err := userRepository.FindUserByID(context.Background(), user.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.PasswordResetRequired || found.SessionVersion != user.SessionVersion {
+		t.Fatalf("after opening the links user = %+v", found)
+	}
+}
@@ -3,11 +3,13 @@ package handlers
 import (
 	"context"
 	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 	"users-microservice/dto"
+	"users-microservice/models"
 	"users-microservice/service"
 
 	"github.com/gin-gonic/gin"
@@ -26,16 +28,91 @@ func NewUserHandler(userService *service.UserService, validator *validator.Valid
 	}
 }
 
-func SetupRoutes(g *gin.Engine, userHandler *UserHandler, refreshTokenHandler *RefreshTokenHandler) {
+func SetupRoutes(g *gin.Engine, userHandler *UserHandler, refreshTokenHandler *RefreshTokenHandler, adminHandler *AdminHandler, exportHandler *ExportHandler, auditHandler *AuditHandler, loginHistoryHandler *LoginHistoryHandler, securityHandler *SecurityHandler, webhookHandler *WebhookHandler, scimHandler *ScimHandler, oauthHandler *OAuthHandler, oidcHandler *OIDCHandler, idempotencyService *service.IdempotencyService, scimTenantTokens map[string]string) {
+	g.Use(RequestMetadataMiddleware())
+	g.Use(DPoPNonceMiddleware(refreshTokenHandler.Service.DPoPService))
+	authMiddleware := AuthMiddleware(refreshTokenHandler.Service)
+	// Los endpoints cuya respuesta lleva credenciales (login, tokens, secretos de
+	// clientes y webhooks) no guardan la respuesta y quedan fuera. El alta de
+	// usuarios y el cambio de contrasena solo guardan el estado de la respuesta.
+	idempotencyMiddleware := IdempotencyMiddleware(idempotencyService)
+	idempotencyMiddlewareWithoutBody := IdempotencyMiddlewareWithoutBody(idempotencyService)
 	userPath := g.Group("/users")
 	{
-		userPath.POST("", userHandler.HandleCreateUser)
+		userPath.POST("", idempotencyMiddlewareWithoutBody, userHandler.HandleCreateUser)
 		userPath.POST("/login", userHandler.HandleLoginUser)
+		userPath.GET("/security/not-me", securityHandler.HandleUnrecognizedLoginPage)
+		userPath.POST("/security/not-me", securityHandler.HandleReportUnrecognizedLogin)
+		userPath.GET("/password/reset", securityHandler.HandlePasswordResetPage)
+		userPath.POST("/password/reset", idempotencyMiddlewareWithoutBody, securityHandler.HandleResetPassword)
+	}
+	currentUserPath := g.Group("/users/me", authMiddleware)
+	{
+		currentUserPath.GET("", userHandler.HandleGetCurrentUser)
+		currentUserPath.PUT("", userHandler.HandleReplaceCurrentUser)
+		currentUserPath.PATCH("", userHandler.HandlePatchCurrentUser)
+		currentUserPath.DELETE("", userHandler.HandleDeleteCurrentUser)
+		currentUserPath.GET("/logins", loginHistoryHandler.HandleListLogins)
+		currentUserPath.GET("/export", exportHandler.HandleExport)
+		currentUserPath.POST("/exports", idempotencyMiddleware, exportHandler.HandleCreateExportJob)
+		currentUserPath.GET("/exports/:id", exportHandler.HandleExportJobStatus)
+		currentUserPath.GET("/exports/:id/download", exportHandler.HandleDownloadExportJob)
 	}
 	refreshTokenPath := g.Group("refresh")
 	{
 		refreshTokenPath.POST("", refreshTokenHandler.HandleRefreshToken)
 	}
+	adminPath := g.Group("/admin", authMiddleware, RequireRole(models.RoleAdmin))
+	{
+		adminPath.GET("/users", adminHandler.HandleListUsers)
+		adminPath.DELETE("/users/:id", adminHandler.HandleDeleteUser)
+		adminPath.POST("/users/:id/restore", idempotencyMiddleware, adminHandler.HandleRestoreUser)
+		adminPath.GET("/audit-events", auditHandler.HandleListAuditEvents)
+		adminPath.GET("/audit-events/verify", auditHandler.HandleVerifyAuditChain)
+		adminPath.POST("/webhooks", webhookHandler.HandleCreateWebhook)
+		adminPath.GET("/webhooks", webhookHandler.HandleListWebhooks)
+		adminPath.DELETE("/webhooks/:id", webhookHandler.HandleDeleteWebhook)
+		adminPath.GET("/webhooks/:id/deliveries", webhookHandler.HandleListDeliveries)
+		adminPath.POST("/webhook-deliveries/:id/retry", idempotencyMiddleware, webhookHandler.HandleRetryDelivery)
+		adminPath.POST("/oauth/clients", oauthHandler.HandleCreateClient)
+		adminPath.GET("/oauth/clients", oauthHandler.HandleListClients)
+		adminPath.DELETE("/oauth/clients/:id", oauthHandler.HandleDeleteClient)
+		// Contadores de expvar de los workers, como los de la limpieza de refresh tokens.
+		adminPath.GET("/metrics", gin.WrapH(expvar.Handler()))
+	}
+	oauthPath := g.Group("/oauth")
+	{
+		oauthPath.GET("/authorize", oauthHandler.HandleAuthorize)
+		oauthPath.POST("/authorize", oauthHandler.HandleAuthorizeDecision)
+		oauthPath.POST("/token", oauthHandler.HandleToken)
+	}
+	g.GET("/.well-known/openid-configuration", oidcHandler.HandleDiscovery)
+	g.GET("/.well-known/jwks.json", oidcHandler.HandleJWKS)
+	g.GET("/userinfo", authMiddleware, oidcHandler.HandleUserInfo)
+	g.POST("/userinfo", authMiddleware, oidcHandler.HandleUserInfo)
+	scimPath := g.Group("/scim/v2")
+	{
+		scimPath.GET("/ServiceProviderConfig", scimHandler.HandleServiceProviderConfig)
+		scimPath.GET("/ResourceTypes", scimHandler.HandleResourceTypes)
+		scimPath.GET("/ResourceTypes/:id", scimHandler.HandleResourceType)
+		scimPath.GET("/Schemas", scimHandler.HandleSchemas)
+		scimPath.GET("/Schemas/:id", scimHandler.HandleSchema)
+	}
+	scimResourcesPath := scimPath.Group("", ScimAuthMiddleware(scimTenantTokens))
+	{
+		scimResourcesPath.GET("/Users", scimHandler.HandleListUsers)
+		scimResourcesPath.POST("/Users", scimHandler.HandleCreateUser)
+		scimResourcesPath.GET("/Users/:id", scimHandler.HandleGetUser)
+		scimResourcesPath.PUT("/Users/:id", scimHandler.HandleReplaceUser)
+		scimResourcesPath.PATCH("/Users/:id", scimHandler.HandlePatchUser)
+		scimResourcesPath.DELETE("/Users/:id", scimHandler.HandleDeleteUser)
+		scimResourcesPath.GET("/Groups", scimHandler.HandleListGroups)
+		scimResourcesPath.POST("/Groups", scimHandler.HandleCreateGroup)
+		scimResourcesPath.GET("/Groups/:id", scimHandler.HandleGetGroup)
+		scimResourcesPath.PUT("/Groups/:id", scimHandler.HandleReplaceGroup)
+		scimResourcesPath.PATCH("/Groups/:id", scimHandler.HandlePatchGroup)
+		scimResourcesPath.DELETE("/Groups/:id", scimHandler.HandleDeleteGroup)
+	}
 }
 
 func (handler *UserHandler) HandleCreateUser(gc *gin.Context) {
@@ -107,7 +184,12 @@ func (handler *UserHandler) HandleLoginUser(gc *gin.Context) {
 		}
 		return
 	}
-	jwt, authErr := handler.Service.AuthenticationService(ctx, newLogin.Email, newLogin.Password)
+	jwt, authErr := handler.Service.AuthenticationService(ctx, newLogin)
+	if errors.Is(authErr, service.ErrPasswordResetRequired) || errors.Is(authErr, service.ErrUserLocked) || errors.Is(authErr, service.ErrInvalidAudience) || errors.Is(authErr, service.ErrSessionLimitReached) ||
+		errors.Is(authErr, service.ErrInvalidDPoPProof) || errors.Is(authErr, service.ErrDPoPNonceRequired) {
+		writeServiceError(gc, authErr)
+		return
+	}
 	if authErr != nil {
 		gc.JSON(http.StatusBadRequest, gin.H{
 			"status":  http.StatusBadRequest,
@@ -119,6 +201,25 @@ func (handler *UserHandler) HandleLoginUser(gc *gin.Context) {
 	gc.JSON(http.StatusCreated, jwt)
 }
 
+func (handler *UserHandler) HandleDeleteCurrentUser(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	if serviceErr := handler.Service.DeleteUserByIDService(ctx, gc.GetString(ContextUserId)); serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.Status(http.StatusNoContent)
+}
+
+func writeServiceError(gc *gin.Context, serviceErr error) {
+	statusCode, errorMessage := MapErrorToHttp(serviceErr)
+	gc.JSON(statusCode, gin.H{
+		"status":  statusCode,
+		"error":   http.StatusText(statusCode),
+		"message": errorMessage,
+	})
+}
+
 func MapErrorToHttp(err error) (int, string) {
 	if errors.Is(err, service.ErrUserNotFound) {
 		return http.StatusNotFound, "The requested resource was not found."
@@ -129,9 +230,72 @@ func MapErrorToHttp(err error) (int, string) {
 	if errors.Is(err, service.ErrEmailConflict) {
 		return http.StatusConflict, "This email is already registered"
 	}
+	if errors.Is(err, service.ErrVersionConflict) {
+		return http.StatusPreconditionFailed, "The user was modified by another request. Reload it and try again."
+	}
+	if errors.Is(err, service.ErrIdempotencyKeyReused) {
+		return http.StatusUnprocessableEntity, "This Idempotency-Key was already used with a different request."
+	}
+	if errors.Is(err, service.ErrIdempotencyRequestInProgress) {
+		return http.StatusConflict, "A request with this Idempotency-Key is still being processed."
+	}
 	if errors.Is(err, service.ErrInvalidCredencials) {
 		return http.StatusBadRequest, "Invalid credentials"
 	}
+	if errors.Is(err, service.ErrInvalidQuery) {
+		return http.StatusBadRequest, "The query parameters are invalid."
+	}
+	if errors.Is(err, service.ErrUserNotDeleted) {
+		return http.StatusConflict, "The user is not deleted."
+	}
+	if errors.Is(err, service.ErrRestoreWindowExpired) {
+		return http.StatusGone, "The restore window for this user has expired."
+	}
+	if errors.Is(err, service.ErrUserLocked) {
+		return http.StatusForbidden, "This account is disabled."
+	}
+	if errors.Is(err, service.ErrPasswordResetRequired) {
+		return http.StatusForbidden, "A password reset is required before signing in."
+	}
+	if errors.Is(err, service.ErrInvalidSecurityToken) {
+		return http.StatusBadRequest, "The link is invalid or has expired."
+	}
+	if errors.Is(err, service.ErrExportJobNotFound) {
+		return http.StatusNotFound, "The requested export was not found."
+	}
+	if errors.Is(err, service.ErrExportNotReady) {
+		return http.StatusConflict, "The export is not ready yet."
+	}
+	if errors.Is(err, service.ErrInvalidWebhookURL) {
+		return http.StatusBadRequest, "The webhook URL must be a public http or https URL."
+	}
+	if errors.Is(err, service.ErrWebhookNotFound) {
+		return http.StatusNotFound, "The requested webhook was not found."
+	}
+	if errors.Is(err, service.ErrWebhookDeliveryNotFound) {
+		return http.StatusNotFound, "The requested webhook delivery was not found."
+	}
+	if errors.Is(err, service.ErrWebhookDeliveryNotDeadLetter) {
+		return http.StatusConflict, "Only dead lettered deliveries can be retried."
+	}
+	if errors.Is(err, service.ErrInvalidAudience) {
+		return http.StatusBadRequest, "The requested audience is not allowed."
+	}
+	if errors.Is(err, service.ErrSessionLimitReached) {
+		return http.StatusConflict, "The maximum number of active sessions was reached. Sign out of another device and try again."
+	}
+	if errors.Is(err, service.ErrInvalidDPoPProof) {
+		return http.StatusBadRequest, "The DPoP proof is invalid."
+	}
+	if errors.Is(err, service.ErrDPoPNonceRequired) {
+		return http.StatusBadRequest, "The DPoP proof must include the nonce of the DPoP-Nonce header."
+	}
+	if errors.Is(err, service.ErrOAuthClientNotFound) {
+		return http.StatusNotFound, "The requested OAuth client was not found."
+	}
+	if errors.Is(err, service.ErrInvalidRedirectURI) {
+		return http.StatusBadRequest, "Redirect URIs must be absolute, without fragment, and use https (http only on loopback)."
+	}
 	return http.StatusInternalServerError, "An unexpected error occurred on the server."
 }
 
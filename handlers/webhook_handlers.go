@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+	"users-microservice/dto"
+	"users-microservice/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type WebhookHandler struct {
+	Service   *service.WebhookService
+	Validator *validator.Validate
+}
+
+func NewWebhookHandler(webhookService *service.WebhookService, validator *validator.Validate) *WebhookHandler {
+	return &WebhookHandler{
+		Service:   webhookService,
+		Validator: validator,
+	}
+}
+
+func (handler *WebhookHandler) HandleCreateWebhook(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	request := new(dto.WebhookRequestDTO)
+	if err := gc.ShouldBindJSON(request); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"error":   "BAD_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+	if validationErr := handler.Validator.Struct(request); validationErr != nil {
+		if validateError, ok := validationErr.(validator.ValidationErrors); ok {
+			var errorMessage []string
+			for _, er := range validateError {
+				errorMessage = append(errorMessage, translateFieldErr(er))
+			}
+			gc.JSON(http.StatusBadRequest, gin.H{
+				"status":        http.StatusBadRequest,
+				"error":         "VALIDATION_FAILED",
+				"error_details": errorMessage,
+			})
+			return
+		}
+		return
+	}
+	webhook, serviceErr := handler.Service.CreateWebhookService(ctx, request)
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.Header("Location", fmt.Sprintf("/admin/webhooks/%s", webhook.ID))
+	gc.JSON(http.StatusCreated, webhook)
+}
+
+func (handler *WebhookHandler) HandleListWebhooks(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	webhooks, serviceErr := handler.Service.ListWebhooksService(ctx)
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.JSON(http.StatusOK, webhooks)
+}
+
+func (handler *WebhookHandler) HandleDeleteWebhook(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	if serviceErr := handler.Service.DeleteWebhookService(ctx, gc.Param("id")); serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.Status(http.StatusNoContent)
+}
+
+func (handler *WebhookHandler) HandleListDeliveries(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	query := new(dto.WebhookDeliveryQueryDTO)
+	if err := gc.ShouldBindQuery(query); err != nil || handler.Validator.Struct(query) != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"error":   "BAD_REQUEST",
+			"message": "status must be pending, delivered or dead_letter and limit between 1 and 100",
+		})
+		return
+	}
+	deliveries, serviceErr := handler.Service.ListDeliveriesService(ctx, gc.Param("id"), query)
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.JSON(http.StatusOK, deliveries)
+}
+
+func (handler *WebhookHandler) HandleRetryDelivery(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 10*time.Second)
+	defer cancel()
+	delivery, serviceErr := handler.Service.RetryDeliveryService(ctx, gc.Param("id"))
+	if serviceErr != nil {
+		writeServiceError(gc, serviceErr)
+		return
+	}
+	gc.JSON(http.StatusAccepted, delivery)
+}
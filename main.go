@@ -1,30 +1,57 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 	"users-microservice/config"
-	"users-microservice/db"
+	"users-microservice/events"
 	"users-microservice/handlers"
-	"users-microservice/repository"
+	"users-microservice/notification"
 	"users-microservice/service"
+	"users-microservice/workers"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
 
 func main() {
-	router := gin.Default()
-
-	// 1. Configuración y conexión
+	// 1. Configuración
 	config, err := config.LoadConfig()
-	client, mongoErr := db.Db_connection()
-	if err != nil || mongoErr != nil {
-		log.Fatalf("Error cargando configuración o conectando a la DB: %v %v", err, mongoErr)
+	if err != nil {
+		log.Fatalf("Error cargando configuración: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if migrateErr := runMigrateCommand(config, os.Args[2:]); migrateErr != nil {
+			log.Fatalf("Error aplicando las migraciones: %v", migrateErr)
+		}
+		return
 	}
 
-	// 2. Crear repositorios
-	userRepo := repository.NewMongoUserRepository(client, config.DB_NAME, config.DB_COLLECTION_USERS)
-	refreshTokenRepo := repository.NewRefreshTokenRepository(client, config.DB_NAME, config.DB_COLLECTION_REFRESH_TOKENS)
+	// 2. Crear repositorios del backend configurado
+	repos, err := newRepositories(config)
+	if err != nil {
+		log.Fatalf("Error conectando a la DB: %v", err)
+	}
+	userRepo := repos.users
+	refreshTokenRepo := repos.refreshTokens
+	exportJobRepo := repos.exportJobs
+	exportArchiveRepo := repos.exportFiles
+	auditRepo := repos.audit
+	loginHistoryRepo := repos.loginHistory
+	outboxRepo := repos.outbox
+	webhookRepo := repos.webhooks
+	groupRepo := repos.groups
+	oauthRepo := repos.oauth
+	dpopProofRepo := repos.dpopProofs
+	idempotencyRepo := repos.idempotency
+	transactionManager := repos.transactions
 
 	// 3. Crear servicios con dependencias circulares
 	var userService *service.UserService
@@ -34,19 +61,114 @@ func main() {
 	refreshTokenService = service.NewRefreshTokenService(refreshTokenRepo, config)
 
 	// Inicializar el userService con el refreshTokenService
-	userService = service.NewUserService(userRepo, refreshTokenService, config)
+	userService = service.NewUserService(userRepo, outboxRepo, transactionManager, refreshTokenService, config)
 
 	// Ahora conectar ambos correctamente
 	refreshTokenService.UserService = userService
 
+	// Auditoria e historial de sesiones compartidos por ambos servicios
+	auditService := service.NewAuditService(auditRepo, config)
+	userService.AuditService = auditService
+	refreshTokenService.AuditService = auditService
+	loginHistoryService := service.NewLoginHistoryService(loginHistoryRepo)
+	userService.LoginHistoryService = loginHistoryService
+	refreshTokenService.LoginHistoryService = loginHistoryService
+
+	// Pruebas DPoP para ligar los tokens a la clave del cliente
+	refreshTokenService.DPoPService = service.NewDPoPService(dpopProofRepo, config)
+
+	// Notificaciones de accesos desde dispositivos nuevos
+	mailer := notification.NewLogMailer()
+	if config.SMTP_CONFIG.HOST != "" {
+		mailer = notification.NewSMTPMailer(config.SMTP_CONFIG.HOST, config.SMTP_CONFIG.PORT, config.SMTP_CONFIG.USERNAME, config.SMTP_CONFIG.PASSWORD, config.SMTP_CONFIG.FROM)
+	}
+	securityService := service.NewSecurityService(userRepo, refreshTokenRepo, outboxRepo, transactionManager, mailer, config)
+	securityService.AuditService = auditService
+	userService.SecurityService = securityService
+
+	// Secciones de la exportacion de datos personales
+	exportService := service.NewExportService(userService, exportJobRepo, exportArchiveRepo, config)
+	exportService.RegisterSource(service.NewProfileExportSource(userService))
+	exportService.RegisterSource(service.NewSessionsExportSource(refreshTokenRepo))
+	exportService.RegisterSource(service.NewAuditExportSource(auditRepo))
+	exportService.RegisterSource(service.NewLoginHistoryExportSource(loginHistoryRepo))
+	exportService.RegisterSource(service.NewConsentsExportSource(refreshTokenRepo, oauthRepo))
+
+	webhookService := service.NewWebhookService(webhookRepo, config)
+	scimService := service.NewScimService(userService, groupRepo, config)
+	oauthService := service.NewOAuthService(oauthRepo, userService, refreshTokenService, config)
+	oauthService.AuditService = auditService
+	oidcSigningKey, keyErr := service.LoadOIDCSigningKey(config.OIDC_CONFIG.SIGNING_KEY_FILE)
+	if keyErr != nil {
+		log.Fatalf("Error cargando la clave de firma OIDC: %v", keyErr)
+	}
+	oidcService := service.NewOIDCService(userService, oidcSigningKey, config)
+	oauthService.OIDCService = oidcService
+
+	// Respuestas guardadas de las peticiones con Idempotency-Key
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo, config)
+
 	// 4. Handlers y validación
 	validate := validator.New()
 	userHandler := handlers.NewUserHandler(userService, validate, refreshTokenService)
 	refreshTokenHandler := handlers.NewRefreshTokenHandler(refreshTokenService, validate)
+	adminHandler := handlers.NewAdminHandler(userService, validate)
+	exportHandler := handlers.NewExportHandler(exportService, validate)
+	auditHandler := handlers.NewAuditHandler(auditService, validate)
+	loginHistoryHandler := handlers.NewLoginHistoryHandler(loginHistoryService, validate)
+	securityHandler := handlers.NewSecurityHandler(securityService, validate)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, validate)
+	scimHandler := handlers.NewScimHandler(scimService)
+	oauthHandler := handlers.NewOAuthHandler(oauthService, validate)
+	oidcHandler := handlers.NewOIDCHandler(oidcService)
 
 	// 5. Rutas
-	handlers.SetupRoutes(router, userHandler, refreshTokenHandler)
+	router := gin.Default()
+	handlers.SetupRoutes(router, userHandler, refreshTokenHandler, adminHandler, exportHandler, auditHandler, loginHistoryHandler, securityHandler, webhookHandler, scimHandler, oauthHandler, oidcHandler, idempotencyService, config.SCIM_TENANT_TOKENS)
 
-	// 6. Ejecutar servidor
-	router.Run()
-}
\ No newline at end of file
+	// 6. Workers en segundo plano
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var workersGroup sync.WaitGroup
+	purgeWorker := workers.NewUserPurgeWorker(userService, config.USER_DELETION_CONFIG.PURGE_INTERVAL, config.USER_DELETION_CONFIG.PURGE_BATCH_SIZE)
+	workersGroup.Go(func() { purgeWorker.Run(ctx) })
+	cleanupConfig := config.REFRESH_TOKEN_CLEANUP_CONFIG
+	refreshTokenCleanupWorker := workers.NewRefreshTokenCleanupWorker(refreshTokenService, cleanupConfig.INTERVAL, cleanupConfig.BATCH_SIZE)
+	workersGroup.Go(func() { refreshTokenCleanupWorker.Run(ctx) })
+	if repos.postgresCleaner != nil {
+		// Postgres no tiene indices TTL: este worker borra lo caducado con el
+		// mismo intervalo y tamano de lote que la limpieza de refresh tokens.
+		postgresCleanupWorker := workers.NewPostgresCleanupWorker(repos.postgresCleaner, cleanupConfig.INTERVAL, cleanupConfig.BATCH_SIZE)
+		workersGroup.Go(func() { postgresCleanupWorker.Run(ctx) })
+	}
+	exportWorker := workers.NewExportWorker(exportService, config.EXPORT_CONFIG.WORKER_INTERVAL)
+	workersGroup.Go(func() { exportWorker.Run(ctx) })
+	publisher, publisherErr := events.NewPublisher(config.EVENTS_CONFIG)
+	if publisherErr != nil {
+		log.Fatalf("Error creando el publicador de eventos: %v", publisherErr)
+	}
+	publisher = events.NewFanoutPublisher(publisher, webhookService)
+	outboxService := service.NewOutboxService(outboxRepo, publisher, config)
+	outboxRelay := workers.NewOutboxRelay(outboxService, config.OUTBOX_CONFIG.RELAY_INTERVAL, config.OUTBOX_CONFIG.BATCH_SIZE)
+	workersGroup.Go(func() { outboxRelay.Run(ctx) })
+	webhookWorker := workers.NewWebhookWorker(webhookService, config.WEBHOOK_CONFIG.WORKER_INTERVAL, config.WEBHOOK_CONFIG.BATCH_SIZE)
+	workersGroup.Go(func() { webhookWorker.Run(ctx) })
+
+	// 7. Ejecutar servidor hasta recibir una señal de apagado
+	server := &http.Server{Addr: ":" + config.PORT, Handler: router}
+	go func() {
+		if serveErr := server.ListenAndServe(); serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+			log.Fatalf("Error ejecutando el servidor: %v", serveErr)
+		}
+	}()
+	<-ctx.Done()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Printf("Error apagando el servidor: %v", shutdownErr)
+	}
+	workersGroup.Wait()
+	if closeErr := publisher.Close(); closeErr != nil {
+		log.Printf("Error cerrando el publicador de eventos: %v", closeErr)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+	"users-microservice/config"
+	"users-microservice/db"
+	"users-microservice/repository"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const migrationTimeout = 10 * time.Minute
+
+// runMigrateCommand implementa el subcomando migrate: "migrate" aplica las
+// migraciones pendientes y "migrate status" lista su estado.
+func runMigrateCommand(cfg *config.Config, args []string) error {
+	if len(args) > 1 || (len(args) == 1 && args[0] != "status") {
+		return fmt.Errorf("uso: %s migrate [status]", os.Args[0])
+	}
+	if cfg.STORAGE_BACKEND == config.StorageBackendMemory {
+		fmt.Println("STORAGE_BACKEND=memory: no hay migraciones que aplicar")
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+	// El backend postgres no usa MongoDB, tampoco para migrar.
+	if cfg.STORAGE_BACKEND == config.StorageBackendPostgres {
+		pool, err := db.Postgres_connection(cfg.POSTGRES_URL)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		if len(args) == 0 {
+			return migratePostgres(ctx, pool, cfg)
+		}
+		statuses, err := repository.PostgresMigrationStatus(ctx, pool, cfg.EMAIL_NORMALIZE_NFKC)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus("PostgreSQL", statuses)
+		return nil
+	}
+	client, err := db.Db_connection()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	if len(args) == 0 {
+		return migrateMongo(ctx, client, cfg)
+	}
+	statuses, err := repository.NewMongoMigrator(client, cfg.DB_NAME, cfg.DB_COLLECTION_MIGRATIONS).
+		Status(ctx, mongoMigrations(cfg))
+	if err != nil {
+		return err
+	}
+	printMigrationStatus("MongoDB", statuses)
+	return nil
+}
+
+func mongoMigrations(cfg *config.Config) []repository.MongoMigration {
+	return repository.MongoMigrations(cfg.DB_COLLECTION_USERS, cfg.DB_COLLECTION_REFRESH_TOKENS, cfg.EMAIL_NORMALIZE_NFKC)
+}
+
+func migrateMongo(ctx context.Context, client *mongo.Client, cfg *config.Config) error {
+	applied, err := repository.NewMongoMigrator(client, cfg.DB_NAME, cfg.DB_COLLECTION_MIGRATIONS).
+		Migrate(ctx, mongoMigrations(cfg))
+	for _, version := range applied {
+		log.Printf("Migracion de MongoDB aplicada: %s", version)
+	}
+	if err != nil {
+		return fmt.Errorf("migrando MongoDB: %w", err)
+	}
+	return nil
+}
+
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config) error {
+	applied, err := repository.MigratePostgres(ctx, pool, cfg.EMAIL_NORMALIZE_NFKC)
+	for _, version := range applied {
+		log.Printf("Migracion de PostgreSQL aplicada: %s", version)
+	}
+	if err != nil {
+		return fmt.Errorf("migrando PostgreSQL: %w", err)
+	}
+	return nil
+}
+
+// requireMongoNFKCEmails impide arrancar con EMAIL_NORMALIZE_NFKC mientras los
+// emails guardados en MongoDB no esten normalizados con NFKC: las busquedas ya
+// lo estarian y esos usuarios no se encontrarian.
+func requireMongoNFKCEmails(ctx context.Context, client *mongo.Client, cfg *config.Config) error {
+	if !cfg.EMAIL_NORMALIZE_NFKC {
+		return nil
+	}
+	statuses, err := repository.NewMongoMigrator(client, cfg.DB_NAME, cfg.DB_COLLECTION_MIGRATIONS).
+		Status(ctx, mongoMigrations(cfg))
+	if err != nil {
+		return err
+	}
+	return requireMigration(statuses, repository.MongoMigrationNFKCEmails)
+}
+
+// requirePostgresNFKCEmails es requireMongoNFKCEmails para PostgreSQL.
+func requirePostgresNFKCEmails(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config) error {
+	if !cfg.EMAIL_NORMALIZE_NFKC {
+		return nil
+	}
+	statuses, err := repository.PostgresMigrationStatus(ctx, pool, true)
+	if err != nil {
+		return err
+	}
+	return requireMigration(statuses, repository.PostgresMigrationNFKCEmails)
+}
+
+func requireMigration(statuses []repository.MigrationStatus, version string) error {
+	for _, status := range statuses {
+		if status.Version == version && status.AppliedAt == nil {
+			return fmt.Errorf("EMAIL_NORMALIZE_NFKC requiere la migracion %s: ejecuta \"%s migrate\" o activa MIGRATE_ON_STARTUP", version, os.Args[0])
+		}
+	}
+	return nil
+}
+
+func printMigrationStatus(database string, statuses []repository.MigrationStatus) {
+	fmt.Println(database)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, status := range statuses {
+		state := "pendiente"
+		if status.AppliedAt != nil {
+			state = "aplicada " + status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(writer, "  %s\t%s\t%s\n", status.Version, state, status.Description)
+	}
+	writer.Flush()
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+const (
+	AuditUserRegistered     = "user.registered"
+	AuditUserLogin          = "user.login"
+	AuditUserUpdated        = "user.updated"
+	AuditUserFieldUpdated   = "user.field_updated"
+	AuditUserDeleted        = "user.deleted"
+	AuditUserRestored       = "user.restored"
+	AuditUserPurged         = "user.purged"
+	AuditTokenReuseDetected = "token.reuse_detected"
+	AuditPasswordReset      = "user.password_reset"
+	AuditSessionEvicted     = "session.evicted"
+
+	AuditNewDeviceLogin            = "security.new_device_login"
+	AuditUnrecognizedLoginReported = "security.unrecognized_login_reported"
+
+	AuditOAuthClientCreated      = "oauth.client_created"
+	AuditOAuthClientDeleted      = "oauth.client_deleted"
+	AuditOAuthAuthorizationGrant = "oauth.authorization_granted"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+	AuditActorSystem    = "system"
+)
+
+// AuditEvent is append-only. When the hash chain is enabled Sequence orders the
+// events and Hash covers the event fields plus the PrevHash of the chain.
+type AuditEvent struct {
+	ID        string            `json:"id" bson:"_id"`
+	Sequence  int64             `json:"sequence,omitempty" bson:"sequence,omitempty"`
+	Type      string            `json:"type" bson:"type"`
+	ActorId   string            `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	TargetId  string            `json:"target_id,omitempty" bson:"target_id,omitempty"`
+	IP        string            `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Timestamp time.Time         `json:"timestamp" bson:"timestamp"`
+	Outcome   string            `json:"outcome" bson:"outcome"`
+	Details   map[string]string `json:"details,omitempty" bson:"details,omitempty"`
+	PrevHash  string            `json:"prev_hash,omitempty" bson:"prev_hash,omitempty"`
+	Hash      string            `json:"hash,omitempty" bson:"hash,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// DPoPProof records a DPoP proof that was already accepted, so the same proof
+// cannot be replayed while its iat is still acceptable.
+type DPoPProof struct {
+	// Hash del jti y del thumbprint de la clave que firmo la prueba.
+	ID        string    `bson:"_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	ExportJobPending   = "pending"
+	ExportJobRunning   = "running"
+	ExportJobCompleted = "completed"
+	ExportJobFailed    = "failed"
+)
+
+type ExportJob struct {
+	ID     string `bson:"_id"`
+	UserId string `bson:"user_id"`
+	Format string `bson:"format"`
+	Status string `bson:"status"`
+	Error  string `bson:"error,omitempty"`
+	// Id del archivo guardado aparte: dentro del job no cabria una exportacion
+	// de mas de 16MB.
+	ArchiveId string `bson:"archive_id,omitempty"`
+	// Veces que un worker reclamo el job, el reclamo vigente y hasta cuando lo
+	// retiene. Un job "running" con el lease vencido se vuelve a reclamar.
+	Attempts       int        `bson:"attempts"`
+	ClaimId        string     `bson:"claim_id,omitempty"`
+	LeaseExpiresAt *time.Time `bson:"lease_expires_at,omitempty"`
+	CreatedAt      time.Time  `bson:"created_at"`
+	CompletedAt    *time.Time `bson:"completed_at,omitempty"`
+	ExpiresAt      time.Time  `bson:"expires_at"`
+}
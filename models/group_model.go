@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Group is a SCIM group of users of one tenant. Members holds user ids.
+type Group struct {
+	ID          string    `json:"id" bson:"_id"`
+	TenantId    string    `json:"tenant_id" bson:"tenant_id"`
+	DisplayName string    `json:"display_name" bson:"display_name"`
+	ExternalId  string    `json:"external_id,omitempty" bson:"external_id,omitempty"`
+	Members     []string  `json:"members" bson:"members"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
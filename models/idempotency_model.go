@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is a request sent with an Idempotency-Key header and,
+// once it finished, its response, replayed to the retries of the request.
+type IdempotencyRecord struct {
+	// Hash del usuario, la ruta y la clave enviada por el cliente.
+	Key string `bson:"_id"`
+	// HMAC del cuerpo de la peticion original con el secreto del servidor.
+	Fingerprint string            `bson:"fingerprint"`
+	Completed   bool              `bson:"completed"`
+	StatusCode  int               `bson:"status_code,omitempty"`
+	Headers     map[string]string `bson:"headers,omitempty"`
+	Body        []byte            `bson:"body,omitempty"`
+	CreatedAt   time.Time         `bson:"created_at"`
+	// Mientras la peticion esta en curso es el limite del bloqueo; despues, el fin del TTL.
+	ExpiresAt time.Time `bson:"expires_at"`
+}
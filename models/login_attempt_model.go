@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	LoginMethodPassword = "password"
+	LoginMethodRefresh  = "refresh"
+	LoginMethodMFA      = "mfa"
+)
+
+type LoginAttempt struct {
+	ID            string    `json:"id" bson:"_id"`
+	UserId        string    `json:"-" bson:"user_id"`
+	Method        string    `json:"method" bson:"method"`
+	Success       bool      `json:"success" bson:"success"`
+	FailureReason string    `json:"failure_reason,omitempty" bson:"failure_reason,omitempty"`
+	IP            string    `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent     string    `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Timestamp     time.Time `json:"timestamp" bson:"timestamp"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+const (
+	OAuthClientPublic       = "public"
+	OAuthClientConfidential = "confidential"
+)
+
+// OAuthClient is an application allowed to obtain tokens through the
+// authorization server. Public clients (SPAs, mobile apps) cannot keep a
+// secret and must use PKCE; confidential clients also authenticate with their
+// secret at the token endpoint and can get tokens of their own with the
+// client_credentials grant, for the audiences they are registered for.
+type OAuthClient struct {
+	ID           string    `json:"client_id" bson:"_id"`
+	Name         string    `json:"name" bson:"name"`
+	Type         string    `json:"client_type" bson:"type"`
+	SecretHash   string    `json:"-" bson:"secret_hash,omitempty"`
+	RedirectURIs []string  `json:"redirect_uris" bson:"redirect_uris"`
+	Scopes       []string  `json:"scopes" bson:"scopes"`
+	Audiences    []string  `json:"audiences" bson:"audiences"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
+
+// AuthorizationCode is stored under the hash of the code handed to the client
+// and is deleted the first time it is exchanged.
+type AuthorizationCode struct {
+	ID                  string    `bson:"_id"`
+	ClientId            string    `bson:"client_id"`
+	UserId              string    `bson:"user_id"`
+	RedirectURI         string    `bson:"redirect_uri"`
+	Scope               string    `bson:"scope"`
+	CodeChallenge       string    `bson:"code_challenge"`
+	CodeChallengeMethod string    `bson:"code_challenge_method"`
+	Nonce               string    `bson:"nonce,omitempty"`
+	AuthTime            time.Time `bson:"auth_time"`
+	CreatedAt           time.Time `bson:"created_at"`
+	ExpiresAt           time.Time `bson:"expires_at"`
+	// Solo si /oauth/authorize recibio redirect_uri hay que repetirlo al canjear el codigo.
+	RedirectURIProvided bool `bson:"redirect_uri_provided,omitempty"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+const (
+	EventUserCreated         = "user.created"
+	EventUserUpdated         = "user.updated"
+	EventUserDeleted         = "user.deleted"
+	EventUserRestored        = "user.restored"
+	EventUserPurged          = "user.purged"
+	EventUserPasswordChanged = "user.password_changed"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the change
+// it describes. PublishedAt stays empty until the relay delivers it.
+type OutboxEvent struct {
+	ID          string        `json:"id" bson:"_id"`
+	AggregateId string        `json:"aggregate_id" bson:"aggregate_id"`
+	Type        string        `json:"type" bson:"type"`
+	Data        UserEventData `json:"data" bson:"data"`
+	CreatedAt   time.Time     `json:"created_at" bson:"created_at"`
+	PublishedAt *time.Time    `json:"published_at,omitempty" bson:"published_at,omitempty"`
+	Attempts    int           `json:"attempts" bson:"attempts"`
+	LastError   string        `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	// Tras un fallo, ni el evento ni los siguientes del mismo usuario se
+	// reintentan antes de esta fecha.
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty" bson:"next_attempt_at,omitempty"`
+}
+
+// UserEventData is the snapshot of the user carried by every user event.
+type UserEventData struct {
+	UserId        string     `json:"user_id" bson:"user_id"`
+	Email         string     `json:"email" bson:"email"`
+	Name          string     `json:"name,omitempty" bson:"name,omitempty"`
+	LastName      string     `json:"lastname,omitempty" bson:"last_name,omitempty"`
+	Role          string     `json:"role,omitempty" bson:"role,omitempty"`
+	Verified      bool       `json:"verified" bson:"verified"`
+	Locked        bool       `json:"locked" bson:"locked"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	ChangedFields []string   `json:"changed_fields,omitempty" bson:"changed_fields,omitempty"`
+}
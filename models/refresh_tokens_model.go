@@ -4,6 +4,9 @@ import (
 	"time"
 )
 
+// Motivo guardado en los refresh tokens revocados por el limite de sesiones.
+const RefreshTokenRevokedSessionLimit = "session_limit"
+
 type RefreshToken struct {
 	ID             string    `bson:"_id"`
 	UserId         string    `bson:"user_id"`
@@ -12,4 +15,24 @@ type RefreshToken struct {
 	Expires        time.Time `bson:"expiry_time"`
 	Revoked        bool      `bson:"revoked"`
 	SessionVersion int       `json:"-" validate:"required" bson:"session"`
+	// Metadatos del dispositivo que inicio la sesion, usados para detectar accesos nuevos.
+	DeviceFingerprint string `bson:"device_fingerprint,omitempty"`
+	IP                string `bson:"ip,omitempty"`
+	UserAgent         string `bson:"user_agent,omitempty"`
+	// Cliente OAuth y scopes de las sesiones emitidas por /oauth/token.
+	ClientId string `bson:"client_id,omitempty"`
+	Scope    string `bson:"scope,omitempty"`
+	// Momento del login que inicio la sesion, conservado en cada rotacion.
+	AuthTime time.Time `bson:"auth_time,omitempty"`
+	// Audiencias pedidas en el login, que se mantienen al refrescar.
+	Audiences []string `bson:"audiences,omitempty"`
+	// Los logins con "recordarme" usan la politica de sesion mas larga.
+	RememberMe bool `bson:"remember_me,omitempty"`
+	// Motivo de la revocacion cuando no fue por rotacion.
+	RevokedReason string `bson:"revoked_reason,omitempty"`
+	// Momento de la primera revocacion; el token se conserva un tiempo despues
+	// para detectar su reutilizacion.
+	RevokedAt time.Time `bson:"revoked_at,omitempty"`
+	// Thumbprint (RFC 7638) de la clave DPoP a la que esta ligada la sesion.
+	DPoPJkt string `bson:"dpop_jkt,omitempty"`
 }
@@ -1,10 +1,33 @@
 package models
 
+import "time"
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	UserId         string `json:"id" validate:"required" bson:"_id"`
-	Name           string `json:"name" validate:"required" bson:"name"`
-	LastName       string `json:"lastname" validate:"required" bson:"last_name"`
-	Email          string `json:"email" validate:"required,email" bson:"email"`
-	PasswordHash   string `json:"-" validate:"required" bson:"password_hash"`
-	SessionVersion int    `json:"sessions" validate:"required" bson:"sessions"`
+	UserId         string     `json:"id" validate:"required" bson:"_id"`
+	Name           string     `json:"name" validate:"required" bson:"name"`
+	LastName       string     `json:"lastname" validate:"required" bson:"last_name"`
+	Email          string     `json:"email" validate:"required,email" bson:"email"`
+	PasswordHash   string     `json:"-" validate:"required" bson:"password_hash"`
+	SessionVersion int        `json:"sessions" validate:"required" bson:"sessions"`
+	Role           string     `json:"role" bson:"role"`
+	Verified       bool       `json:"verified" bson:"verified"`
+	Locked         bool       `json:"locked" bson:"locked"`
+	CreatedAt      time.Time  `json:"created_at" bson:"created_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	// Se activa cuando el usuario reporta un acceso que no reconoce.
+	PasswordResetRequired bool `json:"password_reset_required" bson:"password_reset_required"`
+	// Solo para usuarios aprovisionados por SCIM.
+	TenantId   string `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	ExternalId string `json:"external_id,omitempty" bson:"external_id,omitempty"`
+	// Aumenta con cada escritura; UpdateUser solo reemplaza la version leida.
+	Version int `json:"version" bson:"version"`
+}
+
+func (user *User) IsDeleted() bool {
+	return user.DeletedAt != nil
 }
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+const (
+	WebhookDeliveryPending    = "pending"
+	WebhookDeliveryDelivered  = "delivered"
+	WebhookDeliveryDeadLetter = "dead_letter"
+)
+
+// WebhookSubscription receives the user events listed in EventTypes; an empty
+// list subscribes to every event. The secret signs the payloads and is never
+// returned after the subscription is created.
+type WebhookSubscription struct {
+	ID         string    `json:"id" bson:"_id"`
+	URL        string    `json:"url" bson:"url"`
+	EventTypes []string  `json:"event_types" bson:"event_types"`
+	Secret     string    `json:"-" bson:"secret"`
+	Active     bool      `json:"active" bson:"active"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+// WebhookDelivery is one event to be sent to one subscription. Its id is
+// derived from both so an event relayed twice is only delivered once.
+type WebhookDelivery struct {
+	ID             string     `json:"id" bson:"_id"`
+	SubscriptionId string     `json:"subscription_id" bson:"subscription_id"`
+	EventId        string     `json:"event_id" bson:"event_id"`
+	EventType      string     `json:"event_type" bson:"event_type"`
+	Payload        string     `json:"payload" bson:"payload"`
+	Status         string     `json:"status" bson:"status"`
+	Attempts       int        `json:"attempts" bson:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code,omitempty" bson:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" bson:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+	// Solo se fija al entregarse o pasar a dead_letter: las entregas pendientes
+	// no caducan.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"users-microservice/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrAuditEventNotFound = errors.New("audit event not found")
+var ErrAuditSequenceTaken = errors.New("audit sequence already taken")
+
+type AuditEventFilter struct {
+	ActorId string
+	// SubjectId matches events where the user is either the actor or the target.
+	SubjectId string
+	TargetId  string
+	Type      string
+	Outcome   string
+	From      *time.Time
+	To        *time.Time
+	Cursor    string
+	Limit     int
+}
+
+type AuditEventPage struct {
+	Events     []models.AuditEvent
+	NextCursor string
+}
+
+// AuditRepository is append-only: there is no update or delete, old events are
+// only removed by the retention TTL index.
+type AuditRepository interface {
+	CreateEvent(ctx context.Context, event *models.AuditEvent) error
+	LastEvent(ctx context.Context) (*models.AuditEvent, error)
+	ListEvents(ctx context.Context, filter AuditEventFilter) (*AuditEventPage, error)
+	ListEventsAfterSequence(ctx context.Context, sequence int64, limit int) ([]models.AuditEvent, error)
+}
+
+type mongoAuditRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuditRepository(client *mongo.Client, dbName string, collectionName string) AuditRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &mongoAuditRepository{
+		collection: collection,
+	}
+}
+
+// EnsureAuditIndexes creates the unique chain sequence index, the query
+// indexes and the retention TTL index.
+func EnsureAuditIndexes(ctx context.Context, client *mongo.Client, dbName string, collectionName string, retention time.Duration) error {
+	collection := client.Database(dbName).Collection(collectionName)
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "sequence", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "timestamp", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds()))},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "timestamp", Value: -1}}},
+	}
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// CreateEvent implements AuditRepository.
+func (m *mongoAuditRepository) CreateEvent(ctx context.Context, event *models.AuditEvent) error {
+	_, err := m.collection.InsertOne(ctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAuditSequenceTaken
+	}
+	return err
+}
+
+// LastEvent implements AuditRepository. Only chained events are considered.
+func (m *mongoAuditRepository) LastEvent(ctx context.Context) (*models.AuditEvent, error) {
+	var event models.AuditEvent
+	filter := bson.M{"sequence": bson.M{"$exists": true}}
+	findOptions := options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}})
+	err := m.collection.FindOne(ctx, filter, findOptions).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrAuditEventNotFound
+		}
+		return nil, err
+	}
+	return &event, nil
+}
+
+// ListEvents implements AuditRepository. Events are returned newest first.
+func (m *mongoAuditRepository) ListEvents(ctx context.Context, filter AuditEventFilter) (*AuditEventPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultListLimit
+	}
+	if filter.Limit > MaxListLimit {
+		filter.Limit = MaxListLimit
+	}
+	conditions := bson.A{}
+	if filter.ActorId != "" {
+		conditions = append(conditions, bson.M{"actor_id": filter.ActorId})
+	}
+	if filter.TargetId != "" {
+		conditions = append(conditions, bson.M{"target_id": filter.TargetId})
+	}
+	if filter.SubjectId != "" {
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"actor_id": filter.SubjectId},
+			bson.M{"target_id": filter.SubjectId},
+		}})
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, bson.M{"type": filter.Type})
+	}
+	if filter.Outcome != "" {
+		conditions = append(conditions, bson.M{"outcome": filter.Outcome})
+	}
+	if filter.From != nil {
+		conditions = append(conditions, bson.M{"timestamp": bson.M{"$gte": *filter.From}})
+	}
+	if filter.To != nil {
+		conditions = append(conditions, bson.M{"timestamp": bson.M{"$lt": *filter.To}})
+	}
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"timestamp": bson.M{"$lt": timestamp}},
+			bson.M{"timestamp": timestamp, "_id": bson.M{"$lt": cursor.Id}},
+		}})
+	}
+	query := bson.M{}
+	if len(conditions) > 0 {
+		query = bson.M{"$and": conditions}
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(filter.Limit + 1))
+	cursor, err := m.collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var events []models.AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	page := &AuditEventPage{Events: events}
+	if len(events) > filter.Limit {
+		page.Events = events[:filter.Limit]
+		last := page.Events[filter.Limit-1]
+		page.NextCursor = encodeKeysetCursor(last.Timestamp.UTC().Format(time.RFC3339Nano), last.ID)
+	}
+	return page, nil
+}
+
+// ListEventsAfterSequence implements AuditRepository.
+func (m *mongoAuditRepository) ListEventsAfterSequence(ctx context.Context, sequence int64, limit int) ([]models.AuditEvent, error) {
+	filter := bson.M{"sequence": bson.M{"$gt": sequence}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var events []models.AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"users-microservice/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrDPoPProofReplayed = errors.New("dpop proof already used")
+
+type DPoPProofRepository interface {
+	// SaveProof fails with ErrDPoPProofReplayed when the proof was already saved.
+	SaveProof(ctx context.Context, proof *models.DPoPProof) error
+}
+
+type mongoDPoPProofRepository struct {
+	collection *mongo.Collection
+}
+
+func NewDPoPProofRepository(client *mongo.Client, dbName string, collectionName string) DPoPProofRepository {
+	return &mongoDPoPProofRepository{
+		collection: client.Database(dbName).Collection(collectionName),
+	}
+}
+
+// EnsureDPoPIndexes creates the TTL index that removes the proofs once they
+// can no longer be replayed.
+func EnsureDPoPIndexes(ctx context.Context, client *mongo.Client, dbName string, collectionName string) error {
+	_, err := client.Database(dbName).Collection(collectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// SaveProof implements DPoPProofRepository.
+func (m *mongoDPoPProofRepository) SaveProof(ctx context.Context, proof *models.DPoPProof) error {
+	_, err := m.collection.InsertOne(ctx, proof)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDPoPProofReplayed
+	}
+	return err
+}
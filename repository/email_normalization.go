@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"users-microservice/models"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeEmail trims and lowercases email, so the same address written with
+// different case or surrounding spaces maps to one account. With nfkc it also
+// applies the Unicode NFKC normalization first, which folds full width and
+// compatibility characters into their plain form.
+func NormalizeEmail(email string, nfkc bool) string {
+	email = strings.TrimSpace(email)
+	if nfkc {
+		email = norm.NFKC.String(email)
+	}
+	return strings.ToLower(email)
+}
+
+type emailNormalizingUserRepository struct {
+	UserRepository
+	nfkc bool
+}
+
+// NewEmailNormalizingUserRepository wraps repo so every email is normalized
+// with NormalizeEmail before it is stored or looked up. The unique index of
+// the backend then rejects addresses that only differ in case or spaces.
+func NewEmailNormalizingUserRepository(repo UserRepository, nfkc bool) UserRepository {
+	return &emailNormalizingUserRepository{
+		UserRepository: repo,
+		nfkc:           nfkc,
+	}
+}
+
+// CreateUser implements UserRepository.
+func (repo *emailNormalizingUserRepository) CreateUser(ctx context.Context, user *models.User) error {
+	user.Email = repo.normalize(user.Email)
+	return repo.UserRepository.CreateUser(ctx, user)
+}
+
+// FindUser implements UserRepository.
+func (repo *emailNormalizingUserRepository) FindUser(ctx context.Context, email string) (*models.User, error) {
+	return repo.UserRepository.FindUser(ctx, repo.normalize(email))
+}
+
+// UpdateUser implements UserRepository.
+func (repo *emailNormalizingUserRepository) UpdateUser(ctx context.Context, email string, user *models.User) (*models.User, error) {
+	user.Email = repo.normalize(user.Email)
+	return repo.UserRepository.UpdateUser(ctx, repo.normalize(email), user)
+}
+
+// DeleteUser implements UserRepository.
+func (repo *emailNormalizingUserRepository) DeleteUser(ctx context.Context, email string) error {
+	return repo.UserRepository.DeleteUser(ctx, repo.normalize(email))
+}
+
+// UpdateField implements UserRepository.
+func (repo *emailNormalizingUserRepository) UpdateField(ctx context.Context, email string, newValue interface{}, field string) (*models.User, error) {
+	if value, ok := newValue.(string); ok && field == "email" {
+		newValue = repo.normalize(value)
+	}
+	return repo.UserRepository.UpdateField(ctx, repo.normalize(email), newValue, field)
+}
+
+// FindTenantUsers implements UserRepository.
+func (repo *emailNormalizingUserRepository) FindTenantUsers(ctx context.Context, query TenantUserQuery) (*TenantUserPage, error) {
+	if query.Email != "" {
+		query.Email = repo.normalize(query.Email)
+	}
+	return repo.UserRepository.FindTenantUsers(ctx, query)
+}
+
+func (repo *emailNormalizingUserRepository) normalize(email string) string {
+	return NormalizeEmail(email, repo.nfkc)
+}
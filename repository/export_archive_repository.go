@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrExportArchiveNotFound = errors.New("export archive not found")
+
+// ExportArchiveRepository stores the archives of the asynchronous exports
+// apart from their jobs, as an archive can exceed the 16MB limit of a
+// document.
+type ExportArchiveRepository interface {
+	SaveArchive(ctx context.Context, archiveId string, data []byte, expiresAt time.Time) error
+	LoadArchive(ctx context.Context, archiveId string) ([]byte, error)
+	DeleteArchive(ctx context.Context, archiveId string) error
+	// DeleteExpiredArchives removes the archives whose expiresAt is before now
+	// and returns how many it removed.
+	DeleteExpiredArchives(ctx context.Context, now time.Time) (int, error)
+}
+
+type gridFSExportArchiveRepository struct {
+	bucket *mongo.GridFSBucket
+}
+
+// NewExportArchiveRepository keeps the archives in the GridFS bucket
+// bucketName, split in chunks of 255KB.
+func NewExportArchiveRepository(client *mongo.Client, dbName string, bucketName string) ExportArchiveRepository {
+	bucket := client.Database(dbName).GridFSBucket(options.GridFSBucket().SetName(bucketName))
+	return &gridFSExportArchiveRepository{
+		bucket: bucket,
+	}
+}
+
+// EnsureExportArchiveIndexes creates the index DeleteExpiredArchives scans. A
+// TTL index is not used: it would only remove the files documents and leave
+// their chunks behind.
+func EnsureExportArchiveIndexes(ctx context.Context, client *mongo.Client, dbName string, bucketName string) error {
+	collection := client.Database(dbName).Collection(bucketName + ".files")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "metadata.expires_at", Value: 1}}})
+	return err
+}
+
+// SaveArchive implements ExportArchiveRepository.
+func (m *gridFSExportArchiveRepository) SaveArchive(ctx context.Context, archiveId string, data []byte, expiresAt time.Time) error {
+	uploadOptions := options.GridFSUpload().SetMetadata(bson.M{"expires_at": expiresAt})
+	return m.bucket.UploadFromStreamWithID(ctx, archiveId, archiveId, bytes.NewReader(data), uploadOptions)
+}
+
+// LoadArchive implements ExportArchiveRepository.
+func (m *gridFSExportArchiveRepository) LoadArchive(ctx context.Context, archiveId string) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	if _, err := m.bucket.DownloadToStream(ctx, archiveId, buffer); err != nil {
+		if errors.Is(err, mongo.ErrFileNotFound) {
+			return nil, ErrExportArchiveNotFound
+		}
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// DeleteArchive implements ExportArchiveRepository.
+func (m *gridFSExportArchiveRepository) DeleteArchive(ctx context.Context, archiveId string) error {
+	err := m.bucket.Delete(ctx, archiveId)
+	if errors.Is(err, mongo.ErrFileNotFound) {
+		return ErrExportArchiveNotFound
+	}
+	return err
+}
+
+// DeleteExpiredArchives implements ExportArchiveRepository.
+func (m *gridFSExportArchiveRepository) DeleteExpiredArchives(ctx context.Context, now time.Time) (int, error) {
+	cursor, err := m.bucket.Find(ctx, bson.M{"metadata.expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, err
+	}
+	var files []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &files); err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, file := range files {
+		// Otro worker pudo borrarlo a la vez.
+		if err := m.bucket.Delete(ctx, file.ID); err != nil && !errors.Is(err, mongo.ErrFileNotFound) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
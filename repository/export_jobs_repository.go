@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"users-microservice/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrExportJobNotFound = errors.New("export job not found")
+
+type ExportJobRepository interface {
+	CreateJob(ctx context.Context, job *models.ExportJob) error
+	FindJob(ctx context.Context, jobId string) (*models.ExportJob, error)
+	// ClaimPendingJob hands the oldest pending job, or a running one whose
+	// lease expired, to the caller for lease and returns it with a new ClaimId.
+	ClaimPendingJob(ctx context.Context, now time.Time, lease time.Duration) (*models.ExportJob, error)
+	// UpdateJob saves job only while it still holds the claim it was read with,
+	// and returns ErrExportJobNotFound once another worker reclaimed it.
+	UpdateJob(ctx context.Context, job *models.ExportJob) error
+}
+
+type mongoExportJobRepository struct {
+	collection *mongo.Collection
+}
+
+func NewExportJobRepository(client *mongo.Client, dbName string, collectionName string) ExportJobRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &mongoExportJobRepository{
+		collection: collection,
+	}
+}
+
+// EnsureExportJobIndexes drops the jobs once expires_at is reached. The
+// archives live in their own bucket, see ExportArchiveRepository.
+func EnsureExportJobIndexes(ctx context.Context, client *mongo.Client, dbName string, collectionName string) error {
+	collection := client.Database(dbName).Collection(collectionName)
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "lease_expires_at", Value: 1}}},
+	}
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// CreateJob implements ExportJobRepository.
+func (m *mongoExportJobRepository) CreateJob(ctx context.Context, job *models.ExportJob) error {
+	_, err := m.collection.InsertOne(ctx, job)
+	return err
+}
+
+// FindJob implements ExportJobRepository.
+func (m *mongoExportJobRepository) FindJob(ctx context.Context, jobId string) (*models.ExportJob, error) {
+	var job models.ExportJob
+	err := m.collection.FindOne(ctx, bson.M{"_id": jobId}).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrExportJobNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimPendingJob implements ExportJobRepository. The job is atomically
+// switched to running so only one worker processes it at a time.
+func (m *mongoExportJobRepository) ClaimPendingJob(ctx context.Context, now time.Time, lease time.Duration) (*models.ExportJob, error) {
+	var job models.ExportJob
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": models.ExportJobPending},
+		bson.M{"status": models.ExportJobRunning, "lease_expires_at": bson.M{"$lte": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{"status": models.ExportJobRunning, "claim_id": uuid.NewString(), "lease_expires_at": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	config := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetReturnDocument(options.After)
+	err := m.collection.FindOneAndUpdate(ctx, filter, update, config).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrExportJobNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// UpdateJob implements ExportJobRepository.
+func (m *mongoExportJobRepository) UpdateJob(ctx context.Context, job *models.ExportJob) error {
+	result, err := m.collection.ReplaceOne(ctx, bson.M{"_id": job.ID, "claim_id": job.ClaimId}, job)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrExportJobNotFound
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"users-microservice/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrGroupNotFound = errors.New("group not found")
+var ErrGroupNameTaken = errors.New("group display name already in use")
+
+type GroupRepository interface {
+	CreateGroup(ctx context.Context, group *models.Group) error
+	FindGroup(ctx context.Context, tenantId string, groupId string) (*models.Group, error)
+	ListGroups(ctx context.Context, tenantId string) ([]models.Group, error)
+	UpdateGroup(ctx context.Context, group *models.Group) error
+	DeleteGroup(ctx context.Context, tenantId string, groupId string) error
+	RemoveMember(ctx context.Context, tenantId string, userId string) error
+}
+
+type mongoGroupRepository struct {
+	collection *mongo.Collection
+}
+
+func NewGroupRepository(client *mongo.Client, dbName string, collectionName string) GroupRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &mongoGroupRepository{
+		collection: collection,
+	}
+}
+
+// EnsureGroupIndexes makes display names unique per tenant and indexes the
+// members so the groups of a user can be found.
+func EnsureGroupIndexes(ctx context.Context, client *mongo.Client, dbName string, collectionName string) error {
+	collection := client.Database(dbName).Collection(collectionName)
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "display_name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "members", Value: 1}}},
+	}
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// CreateGroup implements GroupRepository.
+func (m *mongoGroupRepository) CreateGroup(ctx context.Context, group *models.Group) error {
+	_, err := m.collection.InsertOne(ctx, group)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrGroupNameTaken
+	}
+	return err
+}
+
+// FindGroup implements GroupRepository.
+func (m *mongoGroupRepository) FindGroup(ctx context.Context, tenantId string, groupId string) (*models.Group, error) {
+	var group models.Group
+	err := m.collection.FindOne(ctx, bson.M{"_id": groupId, "tenant_id": tenantId}).Decode(&group)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// ListGroups implements GroupRepository.
+func (m *mongoGroupRepository) ListGroups(ctx context.Context, tenantId string) ([]models.Group, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	result, err := m.collection.Find(ctx, bson.M{"tenant_id": tenantId}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var groups []models.Group
+	if err := result.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// UpdateGroup implements GroupRepository.
+func (m *mongoGroupRepository) UpdateGroup(ctx context.Context, group *models.Group) error {
+	result, err := m.collection.ReplaceOne(ctx, bson.M{"_id": group.ID, "tenant_id": group.TenantId}, group)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrGroupNameTaken
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// DeleteGroup implements GroupRepository.
+func (m *mongoGroupRepository) DeleteGroup(ctx context.Context, tenantId string, groupId string) error {
+	result, err := m.collection.DeleteOne(ctx, bson.M{"_id": groupId, "tenant_id": tenantId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// RemoveMember implements GroupRepository. It drops the user from every group
+// of the tenant.
+func (m *mongoGroupRepository) RemoveMember(ctx context.Context, tenantId string, userId string) error {
+	_, err := m.collection.UpdateMany(ctx,
+		bson.M{"tenant_id": tenantId, "members": userId},
+		bson.M{"$pull": bson.M{"members": userId}})
+	return err
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"users-microservice/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrIdempotencyKeyInUse = errors.New("idempotency key already used")
+
+type IdempotencyRepository interface {
+	// Reserve stores record unless a record with the same key exists and has
+	// not expired; then it returns the stored record and ErrIdempotencyKeyInUse.
+	Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	// Complete stores the response and the new expiry of a reserved record.
+	Complete(ctx context.Context, record *models.IdempotencyRecord) error
+	// Release deletes a reserved record that did not complete, so the request
+	// can be retried with the same key.
+	Release(ctx context.Context, key string) error
+}
+
+type mongoIdempotencyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewIdempotencyRepository(client *mongo.Client, dbName string, collectionName string) IdempotencyRepository {
+	return &mongoIdempotencyRepository{
+		collection: client.Database(dbName).Collection(collectionName),
+	}
+}
+
+// EnsureIdempotencyIndexes creates the TTL index that removes the records once
+// their key can be reused.
+func EnsureIdempotencyIndexes(ctx context.Context, client *mongo.Client, dbName string, collectionName string) error {
+	_, err := client.Database(dbName).Collection(collectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Reserve implements IdempotencyRepository. The TTL monitor of Mongo runs once
+// a minute, so an expired record may still be there and is replaced.
+func (m *mongoIdempotencyRepository) Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	filter := bson.M{"_id": record.Key, "expires_at": bson.M{"$lt": time.Now().UTC()}}
+	_, err := m.collection.ReplaceOne(ctx, filter, record, options.Replace().SetUpsert(true))
+	if err == nil {
+		return nil, nil
+	}
+	// El upsert choca con el registro vigente de la misma clave.
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+	var stored models.IdempotencyRecord
+	if err := m.collection.FindOne(ctx, bson.M{"_id": record.Key}).Decode(&stored); err != nil {
+		return nil, err
+	}
+	return &stored, ErrIdempotencyKeyInUse
+}
+
+// Complete implements IdempotencyRepository.
+func (m *mongoIdempotencyRepository) Complete(ctx context.Context, record *models.IdempotencyRecord) error {
+	filter := bson.M{"_id": record.Key, "completed": false}
+	update := bson.M{"$set": bson.M{
+		"completed":   true,
+		"status_code": record.StatusCode,
+		"headers":     record.Headers,
+		"body":        record.Body,
+		"expires_at":  record.ExpiresAt,
+	}}
+	_, err := m.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// Release implements IdempotencyRepository.
+func (m *mongoIdempotencyRepository) Release(ctx context.Context, key string) error {
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": key, "completed": false})
+	return err
+}
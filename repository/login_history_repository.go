@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"users-microservice/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type LoginAttemptPage struct {
+	Attempts   []models.LoginAttempt
+	NextCursor string
+}
+
+type LoginHistoryRepository interface {
+	CreateAttempt(ctx context.Context, attempt *models.LoginAttempt) error
+	ListAttempts(ctx context.Context, userId string, cursor string, limit int) (*LoginAttemptPage, error)
+}
+
+type mongoLoginHistoryRepository struct {
+	collection *mongo.Collection
+}
+
+func NewLoginHistoryRepository(client *mongo.Client, dbName string, collectionName string) LoginHistoryRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &mongoLoginHistoryRepository{
+		collection: collection,
+	}
+}
+
+// EnsureLoginHistoryIndexes creates the per user listing index and the TTL
+// index that expires attempts older than retention.
+func EnsureLoginHistoryIndexes(ctx context.Context, client *mongo.Client, dbName string, collectionName string, retention time.Duration) error {
+	collection := client.Database(dbName).Collection(collectionName)
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "timestamp", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds()))},
+	}
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// CreateAttempt implements LoginHistoryRepository.
+func (m *mongoLoginHistoryRepository) CreateAttempt(ctx context.Context, attempt *models.LoginAttempt) error {
+	_, err := m.collection.InsertOne(ctx, attempt)
+	return err
+}
+
+// ListAttempts implements LoginHistoryRepository. Attempts are returned newest first.
+func (m *mongoLoginHistoryRepository) ListAttempts(ctx context.Context, userId string, cursor string, limit int) (*LoginAttemptPage, error) {
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+	query := bson.M{"user_id": userId}
+	if cursor != "" {
+		position, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, position.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		query["$or"] = bson.A{
+			bson.M{"timestamp": bson.M{"$lt": timestamp}},
+			bson.M{"timestamp": timestamp, "_id": bson.M{"$lt": position.Id}},
+		}
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit + 1))
+	result, err := m.collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var attempts []models.LoginAttempt
+	if err := result.All(ctx, &attempts); err != nil {
+		return nil, err
+	}
+	page := &LoginAttemptPage{Attempts: attempts}
+	if len(attempts) > limit {
+		page.Attempts = attempts[:limit]
+		last := page.Attempts[limit-1]
+		page.NextCursor = encodeKeysetCursor(last.Timestamp.UTC().Format(time.RFC3339Nano), last.ID)
+	}
+	return page, nil
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"users-microservice/models"
+)
+
+// memoryRefreshTokenRepository keeps the refresh tokens by id with an index by
+// jti, guarded by a mutex.
+type memoryRefreshTokenRepository struct {
+	mu     sync.RWMutex
+	tokens map[string]models.RefreshToken
+	byJti  map[string]string
+}
+
+// NewMemoryRefreshTokenRepository returns an empty RefreshTokenRepository that
+// lives in the process memory, for demos and tests.
+func NewMemoryRefreshTokenRepository() RefreshTokenRepository {
+	return &memoryRefreshTokenRepository{
+		tokens: map[string]models.RefreshToken{},
+		byJti:  map[string]string{},
+	}
+}
+
+// CreateRefreshToken implements RefreshTokenRepository.
+func (m *memoryRefreshTokenRepository) CreateRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tokens[refreshToken.ID]; ok {
+		return fmt.Errorf("refresh token %s already exists", refreshToken.ID)
+	}
+	m.tokens[refreshToken.ID] = cloneRefreshToken(refreshToken)
+	m.byJti[refreshToken.Jti] = refreshToken.ID
+	return nil
+}
+
+// FindRefreshTokenByHash implements RefreshTokenRepository. Refresh tokens are
+// no longer stored by hash, so no token is ever found, as with Mongo.
+func (m *memoryRefreshTokenRepository) FindRefreshTokenByHash(ctx context.Context, hashToken string) (*models.RefreshToken, error) {
+	return nil, ErrRefreshTokenNotFound
+}
+
+// FindRefreshTokenByID implements RefreshTokenRepository.
+func (m *memoryRefreshTokenRepository) FindRefreshTokenByID(ctx context.Context, tokenID string) (*models.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	refreshToken, ok := m.tokens[m.byJti[tokenID]]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+	refreshToken = cloneRefreshToken(&refreshToken)
+	return &refreshToken, nil
+}
+
+// RevokeToken implements RefreshTokenRepository.
+func (m *memoryRefreshTokenRepository) RevokeToken(ctx context.Context, tokenId string) error {
+	return m.RevokeTokenWithReason(ctx, tokenId, "")
+}
+
+// RevokeActiveToken implements RefreshTokenRepository.
+func (m *memoryRefreshTokenRepository) RevokeActiveToken(ctx context.Context, tokenId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.byJti[tokenId]
+	if !ok {
+		return ErrUserNotFound
+	}
+	refreshToken := m.tokens[id]
+	if refreshToken.Revoked {
+		return ErrRefreshTokenRevoked
+	}
+	revoke(&refreshToken, time.Now().UTC())
+	m.tokens[id] = refreshToken
+	return nil
+}
+
+// RevokeTokenWithReason implements RefreshTokenRepository.
+func (m *memoryRefreshTokenRepository) RevokeTokenWithReason(ctx context.Context, tokenId string, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.byJti[tokenId]
+	if !ok {
+		return ErrUserNotFound
+	}
+	refreshToken := m.tokens[id]
+	revoke(&refreshToken, time.Now().UTC())
+	if reason != "" {
+		refreshToken.RevokedReason = reason
+	}
+	m.tokens[id] = refreshToken
+	return nil
+}
+
+// RevokeAllTokenFromUser implements RefreshTokenRepository.
+func (m *memoryRefreshTokenRepository) RevokeAllTokenFromUser(ctx context.Context, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	for id, refreshToken := range m.tokens {
+		if refreshToken.UserId == userId {
+			revoke(&refreshToken, now)
+			m.tokens[id] = refreshToken
+		}
+	}
+	return nil
+}
+
+// DeleteAllTokensFromUser implements RefreshTokenRepository.
+func (m *memoryRefreshTokenRepository) DeleteAllTokensFromUser(ctx context.Context, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, refreshToken := range m.tokens {
+		if refreshToken.UserId == userId {
+			delete(m.tokens, id)
+			delete(m.byJti, refreshToken.Jti)
+		}
+	}
+	return nil
+}
+
+// FindTokensByUser implements RefreshTokenRepository. The newest tokens come
+// first.
+func (m *memoryRefreshTokenRepository) FindTokensByUser(ctx context.Context, userId string) ([]models.RefreshToken, error) {
+	m.mu.RLock()
+	var refreshTokens []models.RefreshToken
+	for _, refreshToken := range m.tokens {
+		if refreshToken.UserId == userId {
+			refreshTokens = append(refreshTokens, cloneRefreshToken(&refreshToken))
+		}
+	}
+	m.mu.RUnlock()
+	slices.SortFunc(refreshTokens, func(a, b models.RefreshToken) int {
+		if result := b.IssuedAt.Compare(a.IssuedAt); result != 0 {
+			return result
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	return refreshTokens, nil
+}
+
+// DeleteExpired implements RefreshTokenRepository.
+func (m *memoryRefreshTokenRepository) DeleteExpired(ctx context.Context, expiredBefore time.Time, revokedBefore time.Time, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deleted := 0
+	for id, refreshToken := range m.tokens {
+		if deleted == limit {
+			break
+		}
+		if refreshToken.Expires.Before(expiredBefore) || (!refreshToken.RevokedAt.IsZero() && refreshToken.RevokedAt.Before(revokedBefore)) {
+			delete(m.tokens, id)
+			delete(m.byJti, refreshToken.Jti)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// revoke keeps the time of the first revocation, like $min in Mongo.
+func revoke(refreshToken *models.RefreshToken, now time.Time) {
+	if !refreshToken.Revoked || refreshToken.RevokedAt.IsZero() {
+		refreshToken.RevokedAt = now
+	}
+	refreshToken.Revoked = true
+}
+
+func cloneRefreshToken(refreshToken *models.RefreshToken) models.RefreshToken {
+	clone := *refreshToken
+	clone.Audiences = slices.Clone(refreshToken.Audiences)
+	return clone
+}
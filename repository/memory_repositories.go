@@ -0,0 +1,834 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"users-microservice/models"
+
+	"github.com/google/uuid"
+)
+
+// In-memory implementations of the remaining repositories, so the service can
+// run without any database (STORAGE_BACKEND=memory). Data is lost on restart
+// and the TTL indexes of Mongo are not emulated, except for the DPoP proofs
+// and the idempotency keys.
+
+type memoryTransactionManager struct{}
+
+// NewMemoryTransactionManager runs fn without a transaction: the writes made
+// before fn fails are not rolled back.
+func NewMemoryTransactionManager() TransactionManager {
+	return memoryTransactionManager{}
+}
+
+// WithTransaction implements TransactionManager.
+func (memoryTransactionManager) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// pageLimit applies the default and maximum page sizes of the listings.
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultListLimit
+	}
+	return min(limit, MaxListLimit)
+}
+
+// newestFirst orders by time and then id, both descending, like the keyset
+// cursors of the listings.
+func newestFirst(aTime time.Time, aId string, bTime time.Time, bId string) int {
+	if result := bTime.Compare(aTime); result != 0 {
+		return result
+	}
+	return strings.Compare(bId, aId)
+}
+
+// decodeTimeCursor returns the time and id of a cursor of a newest first listing.
+func decodeTimeCursor(cursor string) (time.Time, string, error) {
+	position, err := decodeCursor(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, position.Value)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return timestamp, position.Id, nil
+}
+
+type memoryAuditRepository struct {
+	mu     sync.RWMutex
+	events []models.AuditEvent
+}
+
+func NewMemoryAuditRepository() AuditRepository {
+	return &memoryAuditRepository{}
+}
+
+// CreateEvent implements AuditRepository.
+func (m *memoryAuditRepository) CreateEvent(ctx context.Context, event *models.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if event.Sequence != 0 && slices.ContainsFunc(m.events, func(stored models.AuditEvent) bool {
+		return stored.Sequence == event.Sequence
+	}) {
+		return ErrAuditSequenceTaken
+	}
+	m.events = append(m.events, *event)
+	return nil
+}
+
+// LastEvent implements AuditRepository.
+func (m *memoryAuditRepository) LastEvent(ctx context.Context) (*models.AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var last *models.AuditEvent
+	for i := range m.events {
+		if m.events[i].Sequence != 0 && (last == nil || m.events[i].Sequence > last.Sequence) {
+			last = &m.events[i]
+		}
+	}
+	if last == nil {
+		return nil, ErrAuditEventNotFound
+	}
+	event := *last
+	return &event, nil
+}
+
+// ListEvents implements AuditRepository.
+func (m *memoryAuditRepository) ListEvents(ctx context.Context, filter AuditEventFilter) (*AuditEventPage, error) {
+	limit := pageLimit(filter.Limit)
+	var cursorTime time.Time
+	var cursorId string
+	if filter.Cursor != "" {
+		var err error
+		if cursorTime, cursorId, err = decodeTimeCursor(filter.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	m.mu.RLock()
+	var events []models.AuditEvent
+	for _, event := range m.events {
+		switch {
+		case filter.ActorId != "" && event.ActorId != filter.ActorId,
+			filter.TargetId != "" && event.TargetId != filter.TargetId,
+			filter.SubjectId != "" && event.ActorId != filter.SubjectId && event.TargetId != filter.SubjectId,
+			filter.Type != "" && event.Type != filter.Type,
+			filter.Outcome != "" && event.Outcome != filter.Outcome,
+			filter.From != nil && event.Timestamp.Before(*filter.From),
+			filter.To != nil && !event.Timestamp.Before(*filter.To),
+			filter.Cursor != "" && newestFirst(event.Timestamp, event.ID, cursorTime, cursorId) <= 0:
+			continue
+		}
+		events = append(events, event)
+	}
+	m.mu.RUnlock()
+	slices.SortFunc(events, func(a, b models.AuditEvent) int {
+		return newestFirst(a.Timestamp, a.ID, b.Timestamp, b.ID)
+	})
+	page := &AuditEventPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		last := page.Events[limit-1]
+		page.NextCursor = encodeKeysetCursor(last.Timestamp.UTC().Format(time.RFC3339Nano), last.ID)
+	}
+	return page, nil
+}
+
+// ListEventsAfterSequence implements AuditRepository.
+func (m *memoryAuditRepository) ListEventsAfterSequence(ctx context.Context, sequence int64, limit int) ([]models.AuditEvent, error) {
+	m.mu.RLock()
+	var events []models.AuditEvent
+	for _, event := range m.events {
+		if event.Sequence > sequence {
+			events = append(events, event)
+		}
+	}
+	m.mu.RUnlock()
+	slices.SortFunc(events, func(a, b models.AuditEvent) int {
+		return cmp.Compare(a.Sequence, b.Sequence)
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+type memoryExportJobRepository struct {
+	mu   sync.Mutex
+	jobs map[string]models.ExportJob
+}
+
+func NewMemoryExportJobRepository() ExportJobRepository {
+	return &memoryExportJobRepository{jobs: map[string]models.ExportJob{}}
+}
+
+// CreateJob implements ExportJobRepository.
+func (m *memoryExportJobRepository) CreateJob(ctx context.Context, job *models.ExportJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.ID] = *job
+	return nil
+}
+
+// FindJob implements ExportJobRepository.
+func (m *memoryExportJobRepository) FindJob(ctx context.Context, jobId string) (*models.ExportJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[jobId]
+	if !ok {
+		return nil, ErrExportJobNotFound
+	}
+	return &job, nil
+}
+
+// ClaimPendingJob implements ExportJobRepository.
+func (m *memoryExportJobRepository) ClaimPendingJob(ctx context.Context, now time.Time, lease time.Duration) (*models.ExportJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var oldest *models.ExportJob
+	for _, job := range m.jobs {
+		claimable := job.Status == models.ExportJobPending ||
+			(job.Status == models.ExportJobRunning && job.LeaseExpiresAt != nil && !job.LeaseExpiresAt.After(now))
+		if claimable && (oldest == nil || job.CreatedAt.Before(oldest.CreatedAt)) {
+			oldest = &job
+		}
+	}
+	if oldest == nil {
+		return nil, ErrExportJobNotFound
+	}
+	leaseExpiresAt := now.Add(lease)
+	oldest.Status = models.ExportJobRunning
+	oldest.ClaimId = uuid.NewString()
+	oldest.LeaseExpiresAt = &leaseExpiresAt
+	oldest.Attempts++
+	m.jobs[oldest.ID] = *oldest
+	return oldest, nil
+}
+
+// UpdateJob implements ExportJobRepository.
+func (m *memoryExportJobRepository) UpdateJob(ctx context.Context, job *models.ExportJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, ok := m.jobs[job.ID]; !ok || stored.ClaimId != job.ClaimId {
+		return ErrExportJobNotFound
+	}
+	m.jobs[job.ID] = *job
+	return nil
+}
+
+type memoryExportArchive struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+type memoryExportArchiveRepository struct {
+	mu       sync.Mutex
+	archives map[string]memoryExportArchive
+}
+
+func NewMemoryExportArchiveRepository() ExportArchiveRepository {
+	return &memoryExportArchiveRepository{archives: map[string]memoryExportArchive{}}
+}
+
+// SaveArchive implements ExportArchiveRepository.
+func (m *memoryExportArchiveRepository) SaveArchive(ctx context.Context, archiveId string, data []byte, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.archives[archiveId] = memoryExportArchive{data: slices.Clone(data), expiresAt: expiresAt}
+	return nil
+}
+
+// LoadArchive implements ExportArchiveRepository.
+func (m *memoryExportArchiveRepository) LoadArchive(ctx context.Context, archiveId string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	archive, ok := m.archives[archiveId]
+	if !ok {
+		return nil, ErrExportArchiveNotFound
+	}
+	return slices.Clone(archive.data), nil
+}
+
+// DeleteArchive implements ExportArchiveRepository.
+func (m *memoryExportArchiveRepository) DeleteArchive(ctx context.Context, archiveId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.archives[archiveId]; !ok {
+		return ErrExportArchiveNotFound
+	}
+	delete(m.archives, archiveId)
+	return nil
+}
+
+// DeleteExpiredArchives implements ExportArchiveRepository.
+func (m *memoryExportArchiveRepository) DeleteExpiredArchives(ctx context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deleted := 0
+	for archiveId, archive := range m.archives {
+		if !archive.expiresAt.After(now) {
+			delete(m.archives, archiveId)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type memoryGroupRepository struct {
+	mu     sync.RWMutex
+	groups map[string]models.Group
+}
+
+func NewMemoryGroupRepository() GroupRepository {
+	return &memoryGroupRepository{groups: map[string]models.Group{}}
+}
+
+// CreateGroup implements GroupRepository.
+func (m *memoryGroupRepository) CreateGroup(ctx context.Context, group *models.Group) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.groups[group.ID]; ok || m.nameTaken(group) {
+		return ErrGroupNameTaken
+	}
+	m.groups[group.ID] = cloneGroup(group)
+	return nil
+}
+
+// FindGroup implements GroupRepository.
+func (m *memoryGroupRepository) FindGroup(ctx context.Context, tenantId string, groupId string) (*models.Group, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	group, ok := m.groups[groupId]
+	if !ok || group.TenantId != tenantId {
+		return nil, ErrGroupNotFound
+	}
+	group = cloneGroup(&group)
+	return &group, nil
+}
+
+// ListGroups implements GroupRepository.
+func (m *memoryGroupRepository) ListGroups(ctx context.Context, tenantId string) ([]models.Group, error) {
+	m.mu.RLock()
+	var groups []models.Group
+	for _, group := range m.groups {
+		if group.TenantId == tenantId {
+			groups = append(groups, cloneGroup(&group))
+		}
+	}
+	m.mu.RUnlock()
+	slices.SortFunc(groups, func(a, b models.Group) int {
+		return -newestFirst(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+	return groups, nil
+}
+
+// UpdateGroup implements GroupRepository.
+func (m *memoryGroupRepository) UpdateGroup(ctx context.Context, group *models.Group) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.groups[group.ID]
+	if !ok || stored.TenantId != group.TenantId {
+		return ErrGroupNotFound
+	}
+	if m.nameTaken(group) {
+		return ErrGroupNameTaken
+	}
+	m.groups[group.ID] = cloneGroup(group)
+	return nil
+}
+
+// DeleteGroup implements GroupRepository.
+func (m *memoryGroupRepository) DeleteGroup(ctx context.Context, tenantId string, groupId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	group, ok := m.groups[groupId]
+	if !ok || group.TenantId != tenantId {
+		return ErrGroupNotFound
+	}
+	delete(m.groups, groupId)
+	return nil
+}
+
+// RemoveMember implements GroupRepository.
+func (m *memoryGroupRepository) RemoveMember(ctx context.Context, tenantId string, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, group := range m.groups {
+		if group.TenantId == tenantId && slices.Contains(group.Members, userId) {
+			group.Members = slices.DeleteFunc(slices.Clone(group.Members), func(member string) bool { return member == userId })
+			m.groups[id] = group
+		}
+	}
+	return nil
+}
+
+// nameTaken must be called with the mutex held.
+func (m *memoryGroupRepository) nameTaken(group *models.Group) bool {
+	for _, stored := range m.groups {
+		if stored.ID != group.ID && stored.TenantId == group.TenantId && stored.DisplayName == group.DisplayName {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneGroup(group *models.Group) models.Group {
+	clone := *group
+	clone.Members = slices.Clone(group.Members)
+	return clone
+}
+
+type memoryLoginHistoryRepository struct {
+	mu       sync.RWMutex
+	attempts []models.LoginAttempt
+}
+
+func NewMemoryLoginHistoryRepository() LoginHistoryRepository {
+	return &memoryLoginHistoryRepository{}
+}
+
+// CreateAttempt implements LoginHistoryRepository.
+func (m *memoryLoginHistoryRepository) CreateAttempt(ctx context.Context, attempt *models.LoginAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts = append(m.attempts, *attempt)
+	return nil
+}
+
+// ListAttempts implements LoginHistoryRepository.
+func (m *memoryLoginHistoryRepository) ListAttempts(ctx context.Context, userId string, cursor string, limit int) (*LoginAttemptPage, error) {
+	limit = pageLimit(limit)
+	var cursorTime time.Time
+	var cursorId string
+	if cursor != "" {
+		var err error
+		if cursorTime, cursorId, err = decodeTimeCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+	m.mu.RLock()
+	var attempts []models.LoginAttempt
+	for _, attempt := range m.attempts {
+		if attempt.UserId == userId && (cursor == "" || newestFirst(attempt.Timestamp, attempt.ID, cursorTime, cursorId) > 0) {
+			attempts = append(attempts, attempt)
+		}
+	}
+	m.mu.RUnlock()
+	slices.SortFunc(attempts, func(a, b models.LoginAttempt) int {
+		return newestFirst(a.Timestamp, a.ID, b.Timestamp, b.ID)
+	})
+	page := &LoginAttemptPage{Attempts: attempts}
+	if len(attempts) > limit {
+		page.Attempts = attempts[:limit]
+		last := page.Attempts[limit-1]
+		page.NextCursor = encodeKeysetCursor(last.Timestamp.UTC().Format(time.RFC3339Nano), last.ID)
+	}
+	return page, nil
+}
+
+type memoryOutboxRepository struct {
+	mu     sync.Mutex
+	events map[string]models.OutboxEvent
+}
+
+func NewMemoryOutboxRepository() OutboxRepository {
+	return &memoryOutboxRepository{events: map[string]models.OutboxEvent{}}
+}
+
+// AppendEvent implements OutboxRepository.
+func (m *memoryOutboxRepository) AppendEvent(ctx context.Context, event *models.OutboxEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events[event.ID] = *event
+	return nil
+}
+
+// FindPendingEvents implements OutboxRepository.
+func (m *memoryOutboxRepository) FindPendingEvents(ctx context.Context, now time.Time, limit int) ([]models.OutboxEvent, error) {
+	m.mu.Lock()
+	waiting := map[string]bool{}
+	for _, event := range m.events {
+		if event.NextAttemptAt != nil && event.NextAttemptAt.After(now) {
+			waiting[event.AggregateId] = true
+		}
+	}
+	var events []models.OutboxEvent
+	for _, event := range m.events {
+		if event.PublishedAt == nil && !waiting[event.AggregateId] {
+			events = append(events, event)
+		}
+	}
+	m.mu.Unlock()
+	slices.SortFunc(events, func(a, b models.OutboxEvent) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// MarkPublished implements OutboxRepository.
+func (m *memoryOutboxRepository) MarkPublished(ctx context.Context, eventId string, publishedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if event, ok := m.events[eventId]; ok {
+		event.PublishedAt = &publishedAt
+		event.LastError = ""
+		event.NextAttemptAt = nil
+		m.events[eventId] = event
+	}
+	return nil
+}
+
+// MarkFailed implements OutboxRepository.
+func (m *memoryOutboxRepository) MarkFailed(ctx context.Context, eventId string, reason string, nextAttemptAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if event, ok := m.events[eventId]; ok {
+		event.LastError = reason
+		event.Attempts++
+		event.NextAttemptAt = &nextAttemptAt
+		m.events[eventId] = event
+	}
+	return nil
+}
+
+// DeletePublishedBefore implements OutboxRepository.
+func (m *memoryOutboxRepository) DeletePublishedBefore(ctx context.Context, before time.Time, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deleted := 0
+	for eventId, event := range m.events {
+		if deleted == limit {
+			break
+		}
+		if event.PublishedAt != nil && event.PublishedAt.Before(before) {
+			delete(m.events, eventId)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type memoryWebhookRepository struct {
+	mu            sync.Mutex
+	subscriptions map[string]models.WebhookSubscription
+	deliveries    map[string]models.WebhookDelivery
+}
+
+func NewMemoryWebhookRepository() WebhookRepository {
+	return &memoryWebhookRepository{
+		subscriptions: map[string]models.WebhookSubscription{},
+		deliveries:    map[string]models.WebhookDelivery{},
+	}
+}
+
+// CreateSubscription implements WebhookRepository.
+func (m *memoryWebhookRepository) CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptions[subscription.ID] = *subscription
+	return nil
+}
+
+// FindSubscription implements WebhookRepository.
+func (m *memoryWebhookRepository) FindSubscription(ctx context.Context, subscriptionId string) (*models.WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subscription, ok := m.subscriptions[subscriptionId]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	return &subscription, nil
+}
+
+// ListSubscriptions implements WebhookRepository.
+func (m *memoryWebhookRepository) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	return m.findSubscriptions(func(*models.WebhookSubscription) bool { return true }), nil
+}
+
+// FindSubscriptionsForEvent implements WebhookRepository.
+func (m *memoryWebhookRepository) FindSubscriptionsForEvent(ctx context.Context, eventType string) ([]models.WebhookSubscription, error) {
+	return m.findSubscriptions(func(subscription *models.WebhookSubscription) bool {
+		return subscription.Active && (len(subscription.EventTypes) == 0 || slices.Contains(subscription.EventTypes, eventType))
+	}), nil
+}
+
+func (m *memoryWebhookRepository) findSubscriptions(match func(*models.WebhookSubscription) bool) []models.WebhookSubscription {
+	m.mu.Lock()
+	var subscriptions []models.WebhookSubscription
+	for _, subscription := range m.subscriptions {
+		if match(&subscription) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	m.mu.Unlock()
+	slices.SortFunc(subscriptions, func(a, b models.WebhookSubscription) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return subscriptions
+}
+
+// DeleteSubscription implements WebhookRepository.
+func (m *memoryWebhookRepository) DeleteSubscription(ctx context.Context, subscriptionId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subscriptions[subscriptionId]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(m.subscriptions, subscriptionId)
+	return nil
+}
+
+// CreateDelivery implements WebhookRepository.
+func (m *memoryWebhookRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deliveries[delivery.ID]; ok {
+		return ErrWebhookDeliveryExists
+	}
+	m.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+// FindDelivery implements WebhookRepository.
+func (m *memoryWebhookRepository) FindDelivery(ctx context.Context, deliveryId string) (*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery, ok := m.deliveries[deliveryId]
+	if !ok {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return &delivery, nil
+}
+
+// ClaimDueDelivery implements WebhookRepository. Like the Mongo version it
+// returns the delivery as it was before its lease was taken.
+func (m *memoryWebhookRepository) ClaimDueDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due *models.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.Status == models.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) &&
+			(due == nil || delivery.NextAttemptAt.Before(due.NextAttemptAt)) {
+			due = &delivery
+		}
+	}
+	if due == nil {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	leased := *due
+	leased.NextAttemptAt = now.Add(lease)
+	m.deliveries[due.ID] = leased
+	return due, nil
+}
+
+// UpdateDelivery implements WebhookRepository.
+func (m *memoryWebhookRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deliveries[delivery.ID]; !ok {
+		return ErrWebhookDeliveryNotFound
+	}
+	m.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+// ListDeliveries implements WebhookRepository.
+func (m *memoryWebhookRepository) ListDeliveries(ctx context.Context, filter WebhookDeliveryFilter) (*WebhookDeliveryPage, error) {
+	limit := pageLimit(filter.Limit)
+	var cursorTime time.Time
+	var cursorId string
+	if filter.Cursor != "" {
+		var err error
+		if cursorTime, cursorId, err = decodeTimeCursor(filter.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	m.mu.Lock()
+	var deliveries []models.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		switch {
+		case delivery.SubscriptionId != filter.SubscriptionId,
+			filter.Status != "" && delivery.Status != filter.Status,
+			filter.Cursor != "" && newestFirst(delivery.CreatedAt, delivery.ID, cursorTime, cursorId) <= 0:
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	m.mu.Unlock()
+	slices.SortFunc(deliveries, func(a, b models.WebhookDelivery) int {
+		return newestFirst(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+	page := &WebhookDeliveryPage{Deliveries: deliveries}
+	if len(deliveries) > limit {
+		page.Deliveries = deliveries[:limit]
+		last := page.Deliveries[limit-1]
+		page.NextCursor = encodeKeysetCursor(last.CreatedAt.UTC().Format(time.RFC3339Nano), last.ID)
+	}
+	return page, nil
+}
+
+type memoryOAuthRepository struct {
+	mu      sync.Mutex
+	clients map[string]models.OAuthClient
+	codes   map[string]models.AuthorizationCode
+}
+
+func NewMemoryOAuthRepository() OAuthRepository {
+	return &memoryOAuthRepository{
+		clients: map[string]models.OAuthClient{},
+		codes:   map[string]models.AuthorizationCode{},
+	}
+}
+
+// CreateClient implements OAuthRepository.
+func (m *memoryOAuthRepository) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clients[client.ID] = *client
+	return nil
+}
+
+// FindClient implements OAuthRepository.
+func (m *memoryOAuthRepository) FindClient(ctx context.Context, clientId string) (*models.OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.clients[clientId]
+	if !ok {
+		return nil, ErrOAuthClientNotFound
+	}
+	return &client, nil
+}
+
+// ListClients implements OAuthRepository.
+func (m *memoryOAuthRepository) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	m.mu.Lock()
+	var clients []models.OAuthClient
+	for _, client := range m.clients {
+		clients = append(clients, client)
+	}
+	m.mu.Unlock()
+	slices.SortFunc(clients, func(a, b models.OAuthClient) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return clients, nil
+}
+
+// DeleteClient implements OAuthRepository.
+func (m *memoryOAuthRepository) DeleteClient(ctx context.Context, clientId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.clients[clientId]; !ok {
+		return ErrOAuthClientNotFound
+	}
+	delete(m.clients, clientId)
+	return nil
+}
+
+// CreateAuthorizationCode implements OAuthRepository.
+func (m *memoryOAuthRepository) CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code.ID] = *code
+	return nil
+}
+
+// ConsumeAuthorizationCode implements OAuthRepository.
+func (m *memoryOAuthRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.codes[codeHash]
+	if !ok {
+		return nil, ErrAuthorizationCodeNotFound
+	}
+	delete(m.codes, codeHash)
+	return &code, nil
+}
+
+type memoryDPoPProofRepository struct {
+	mu     sync.Mutex
+	proofs map[string]time.Time
+}
+
+func NewMemoryDPoPProofRepository() DPoPProofRepository {
+	return &memoryDPoPProofRepository{proofs: map[string]time.Time{}}
+}
+
+// SaveProof implements DPoPProofRepository. Expired proofs are dropped on every
+// call, as the TTL index does in Mongo.
+func (m *memoryDPoPProofRepository) SaveProof(ctx context.Context, proof *models.DPoPProof) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for id, expiresAt := range m.proofs {
+		if now.After(expiresAt) {
+			delete(m.proofs, id)
+		}
+	}
+	if _, ok := m.proofs[proof.ID]; ok {
+		return ErrDPoPProofReplayed
+	}
+	m.proofs[proof.ID] = proof.ExpiresAt
+	return nil
+}
+
+type memoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]models.IdempotencyRecord
+}
+
+func NewMemoryIdempotencyRepository() IdempotencyRepository {
+	return &memoryIdempotencyRepository{records: map[string]models.IdempotencyRecord{}}
+}
+
+// Reserve implements IdempotencyRepository. Expired records are dropped on
+// every call, as the TTL index does in Mongo.
+func (m *memoryIdempotencyRepository) Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for key, stored := range m.records {
+		if now.After(stored.ExpiresAt) {
+			delete(m.records, key)
+		}
+	}
+	if stored, ok := m.records[record.Key]; ok {
+		return &stored, ErrIdempotencyKeyInUse
+	}
+	m.records[record.Key] = *record
+	return nil, nil
+}
+
+// Complete implements IdempotencyRepository.
+func (m *memoryIdempotencyRepository) Complete(ctx context.Context, record *models.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.records[record.Key]
+	if !ok || stored.Completed {
+		return nil
+	}
+	stored.Completed = true
+	stored.StatusCode = record.StatusCode
+	stored.Headers = record.Headers
+	stored.Body = record.Body
+	stored.ExpiresAt = record.ExpiresAt
+	m.records[record.Key] = stored
+	return nil
+}
+
+// Release implements IdempotencyRepository.
+func (m *memoryIdempotencyRepository) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, ok := m.records[key]; ok && !stored.Completed {
+		delete(m.records, key)
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"users-microservice/models"
+)
+
+// memoryUserRepository keeps the users in a map guarded by a mutex. Every
+// method returns copies, so callers cannot change the stored users.
+type memoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[string]models.User
+}
+
+// NewMemoryUserRepository returns an empty UserRepository that lives in the
+// process memory, for demos and tests. Emails are unique, including the ones
+// of soft deleted users.
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{
+		users: map[string]models.User{},
+	}
+}
+
+// CreateUser implements UserRepository.
+func (repo *memoryUserRepository) CreateUser(ctx context.Context, user *models.User) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if _, ok := repo.users[user.UserId]; ok {
+		return fmt.Errorf("user %s already exists", user.UserId)
+	}
+	if _, ok := repo.findByEmail(user.Email); ok {
+		return ErrEmailConflict
+	}
+	repo.users[user.UserId] = cloneUser(user)
+	return nil
+}
+
+// FindUser implements UserRepository.
+func (repo *memoryUserRepository) FindUser(ctx context.Context, email string) (*models.User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	user, ok := repo.findByEmail(email)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// FindUserByID implements UserRepository.
+func (repo *memoryUserRepository) FindUserByID(ctx context.Context, userId string) (*models.User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	user, ok := repo.users[userId]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user = cloneUser(&user)
+	return &user, nil
+}
+
+// UpdateUser implements UserRepository.
+func (repo *memoryUserRepository) UpdateUser(ctx context.Context, email string, user *models.User) (*models.User, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	current, ok := repo.findByEmail(email)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if current.Version != user.Version {
+		return nil, ErrVersionConflict
+	}
+	if other, ok := repo.findByEmail(user.Email); ok && other.UserId != current.UserId {
+		return nil, ErrEmailConflict
+	}
+	// Como en Mongo, el reemplazo conserva el _id del documento.
+	replacement := cloneUser(user)
+	replacement.UserId = current.UserId
+	replacement.Version++
+	repo.users[current.UserId] = replacement
+	updated := cloneUser(&replacement)
+	return &updated, nil
+}
+
+// DeleteUser implements UserRepository.
+func (repo *memoryUserRepository) DeleteUser(ctx context.Context, email string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	user, ok := repo.findByEmail(email)
+	if !ok || user.IsDeleted() {
+		return ErrUserNotFound
+	}
+	deletedAt := time.Now().UTC()
+	user.DeletedAt = &deletedAt
+	user.SessionVersion++
+	user.Version++
+	repo.users[user.UserId] = user
+	return nil
+}
+
+// UpdateField implements UserRepository. field is the bson name of the field,
+// as in the Mongo implementation.
+func (repo *memoryUserRepository) UpdateField(ctx context.Context, email string, newValue interface{}, field string) (*models.User, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	user, ok := repo.findByEmail(email)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if err := setFieldByBSONName(&user, field, newValue); err != nil {
+		return nil, err
+	}
+	if other, ok := repo.findByEmail(user.Email); ok && other.UserId != user.UserId {
+		return nil, ErrEmailConflict
+	}
+	user.Version++
+	repo.users[user.UserId] = user
+	updated := cloneUser(&user)
+	return &updated, nil
+}
+
+// ListUsers implements UserRepository.
+func (repo *memoryUserRepository) ListUsers(ctx context.Context, filter UserListFilter) (*UserPage, error) {
+	filter.normalize()
+	var position *listCursor
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if filter.SortBy == SortByCreatedAt {
+			if _, err := time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+				return nil, ErrInvalidCursor
+			}
+		}
+		position = cursor
+	}
+	repo.mu.RLock()
+	var users []models.User
+	for _, user := range repo.users {
+		if matchesUserFilter(&user, &filter) {
+			users = append(users, cloneUser(&user))
+		}
+	}
+	repo.mu.RUnlock()
+
+	slices.SortFunc(users, func(a, b models.User) int {
+		return compareUsers(&a, &b, &filter)
+	})
+	if position != nil {
+		users = slices.DeleteFunc(users, func(user models.User) bool {
+			return !afterCursor(&user, position, &filter)
+		})
+	}
+	page := &UserPage{Users: users}
+	if len(users) > filter.Limit {
+		page.Users = users[:filter.Limit]
+		page.NextCursor = encodeCursor(&page.Users[filter.Limit-1], filter.SortBy)
+	}
+	return page, nil
+}
+
+// FindTenantUsers implements UserRepository.
+func (repo *memoryUserRepository) FindTenantUsers(ctx context.Context, query TenantUserQuery) (*TenantUserPage, error) {
+	repo.mu.RLock()
+	var users []models.User
+	for _, user := range repo.users {
+		switch {
+		case user.IsDeleted(), user.TenantId != query.TenantId,
+			query.Email != "" && user.Email != query.Email,
+			query.ExternalId != "" && user.ExternalId != query.ExternalId,
+			query.UserId != "" && user.UserId != query.UserId:
+			continue
+		}
+		users = append(users, cloneUser(&user))
+	}
+	repo.mu.RUnlock()
+
+	slices.SortFunc(users, func(a, b models.User) int {
+		return compareUsers(&a, &b, &UserListFilter{SortBy: SortByCreatedAt})
+	})
+	page := &TenantUserPage{Total: len(users)}
+	if query.Limit > 0 && query.Offset < len(users) {
+		page.Users = users[query.Offset:min(query.Offset+query.Limit, len(users))]
+	}
+	return page, nil
+}
+
+// RestoreUser implements UserRepository.
+func (repo *memoryUserRepository) RestoreUser(ctx context.Context, userId string) (*models.User, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	user, ok := repo.users[userId]
+	if !ok || !user.IsDeleted() {
+		return nil, ErrUserNotFound
+	}
+	user.DeletedAt = nil
+	user.Version++
+	repo.users[userId] = user
+	restored := cloneUser(&user)
+	return &restored, nil
+}
+
+// FindUsersDeletedBefore implements UserRepository.
+func (repo *memoryUserRepository) FindUsersDeletedBefore(ctx context.Context, before time.Time, limit int) ([]models.User, error) {
+	repo.mu.RLock()
+	var users []models.User
+	for _, user := range repo.users {
+		if user.IsDeleted() && !user.DeletedAt.After(before) {
+			users = append(users, cloneUser(&user))
+		}
+	}
+	repo.mu.RUnlock()
+	slices.SortFunc(users, func(a, b models.User) int {
+		return a.DeletedAt.Compare(*b.DeletedAt)
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+// HardDeleteUser implements UserRepository.
+func (repo *memoryUserRepository) HardDeleteUser(ctx context.Context, userId string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	delete(repo.users, userId)
+	return nil
+}
+
+// ForcePasswordReset implements UserRepository.
+func (repo *memoryUserRepository) ForcePasswordReset(ctx context.Context, userId string, sessionVersion int) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	user, ok := repo.users[userId]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if user.SessionVersion != sessionVersion {
+		return ErrVersionConflict
+	}
+	user.PasswordResetRequired = true
+	user.SessionVersion++
+	user.Version++
+	repo.users[userId] = user
+	return nil
+}
+
+// SetPasswordHash implements UserRepository.
+func (repo *memoryUserRepository) SetPasswordHash(ctx context.Context, userId string, passwordHash string) (*models.User, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	user, ok := repo.users[userId]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user.PasswordHash = passwordHash
+	user.PasswordResetRequired = false
+	user.SessionVersion++
+	user.Version++
+	repo.users[userId] = user
+	updated := cloneUser(&user)
+	return &updated, nil
+}
+
+// findByEmail must be called with the mutex held.
+func (repo *memoryUserRepository) findByEmail(email string) (models.User, bool) {
+	for _, user := range repo.users {
+		if user.Email == email {
+			return cloneUser(&user), true
+		}
+	}
+	return models.User{}, false
+}
+
+func cloneUser(user *models.User) models.User {
+	clone := *user
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		clone.DeletedAt = &deletedAt
+	}
+	return clone
+}
+
+func matchesUserFilter(user *models.User, filter *UserListFilter) bool {
+	if user.IsDeleted() != filter.OnlyDeleted {
+		return false
+	}
+	if filter.Search != "" {
+		search := strings.ToLower(filter.Search)
+		if !strings.HasPrefix(strings.ToLower(user.Name), search) &&
+			!strings.HasPrefix(strings.ToLower(user.LastName), search) &&
+			!strings.HasPrefix(strings.ToLower(user.Email), search) {
+			return false
+		}
+	}
+	switch {
+	case filter.TenantId != "" && user.TenantId != filter.TenantId,
+		filter.Verified != nil && user.Verified != *filter.Verified,
+		filter.Locked != nil && user.Locked != *filter.Locked,
+		filter.Role != "" && user.Role != filter.Role,
+		filter.CreatedAfter != nil && !user.CreatedAt.After(*filter.CreatedAfter):
+		return false
+	}
+	return true
+}
+
+// compareUsers orders the users by the sort field and then by id, like the
+// keyset cursor of ListUsers.
+func compareUsers(a *models.User, b *models.User, filter *UserListFilter) int {
+	result := 0
+	if filter.SortBy == SortByCreatedAt {
+		result = a.CreatedAt.Compare(b.CreatedAt)
+	} else {
+		result = strings.Compare(sortValue(a, filter.SortBy), sortValue(b, filter.SortBy))
+	}
+	if result == 0 {
+		result = strings.Compare(a.UserId, b.UserId)
+	}
+	if filter.SortDesc {
+		return -result
+	}
+	return result
+}
+
+func afterCursor(user *models.User, position *listCursor, filter *UserListFilter) bool {
+	cursorUser := models.User{UserId: position.Id}
+	switch filter.SortBy {
+	case SortByEmail:
+		cursorUser.Email = position.Value
+	case SortByName:
+		cursorUser.Name = position.Value
+	case SortByLastName:
+		cursorUser.LastName = position.Value
+	default:
+		cursorUser.CreatedAt, _ = time.Parse(time.RFC3339Nano, position.Value)
+	}
+	return compareUsers(user, &cursorUser, filter) > 0
+}
+
+// setFieldByBSONName sets the field of user whose bson tag is name.
+func setFieldByBSONName(user *models.User, name string, value interface{}) error {
+	target := reflect.ValueOf(user).Elem()
+	for i := 0; i < target.NumField(); i++ {
+		tag, _, _ := strings.Cut(target.Type().Field(i).Tag.Get("bson"), ",")
+		if tag != name {
+			continue
+		}
+		field := target.Field(i)
+		newValue := reflect.ValueOf(value)
+		if !newValue.IsValid() {
+			field.SetZero()
+			return nil
+		}
+		if !newValue.Type().ConvertibleTo(field.Type()) {
+			return fmt.Errorf("field %s does not accept a %T", name, value)
+		}
+		field.Set(newValue.Convert(field.Type()))
+		return nil
+	}
+	return fmt.Errorf("unknown user field %s", name)
+}
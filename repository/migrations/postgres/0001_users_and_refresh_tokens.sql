@@ -0,0 +1,60 @@
+-- Tablas de usuarios y refresh tokens.
+--
+-- Los ids y los textos ordenables usan la collation "C" para ordenar por bytes,
+-- igual que Mongo, y que los cursores sean equivalentes.
+CREATE TABLE users (
+    id                      TEXT COLLATE "C" PRIMARY KEY,
+    name                    TEXT COLLATE "C" NOT NULL,
+    last_name               TEXT COLLATE "C" NOT NULL,
+    email                   TEXT COLLATE "C" NOT NULL,
+    password_hash           TEXT NOT NULL,
+    sessions                INTEGER NOT NULL DEFAULT 0,
+    role                    TEXT NOT NULL DEFAULT '',
+    verified                BOOLEAN NOT NULL DEFAULT FALSE,
+    locked                  BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at              TIMESTAMPTZ NOT NULL,
+    deleted_at              TIMESTAMPTZ,
+    password_reset_required BOOLEAN NOT NULL DEFAULT FALSE,
+    tenant_id               TEXT NOT NULL DEFAULT '',
+    external_id             TEXT NOT NULL DEFAULT '',
+    CONSTRAINT users_email_key UNIQUE (email)
+);
+
+-- Orden y filtros de ListUsers, con id como desempate del cursor.
+CREATE INDEX users_created_at_idx ON users (created_at, id);
+CREATE INDEX users_name_idx ON users (name, id);
+CREATE INDEX users_last_name_idx ON users (last_name, id);
+CREATE INDEX users_role_idx ON users (role, created_at);
+CREATE INDEX users_verified_locked_idx ON users (verified, locked, created_at);
+CREATE INDEX users_tenant_idx ON users (tenant_id, created_at) WHERE tenant_id <> '';
+-- Busqueda por prefijo sin distinguir mayusculas. lower() con la collation
+-- "C" solo convierte ASCII, por eso se usa la collation por defecto.
+CREATE INDEX users_name_search_idx ON users (lower(name COLLATE "default") text_pattern_ops);
+CREATE INDEX users_last_name_search_idx ON users (lower(last_name COLLATE "default") text_pattern_ops);
+CREATE INDEX users_email_search_idx ON users (lower(email COLLATE "default") text_pattern_ops);
+-- Usuarios pendientes de purga.
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE refresh_tokens (
+    id                 TEXT COLLATE "C" PRIMARY KEY,
+    user_id            TEXT NOT NULL,
+    jti                TEXT NOT NULL,
+    created_at         TIMESTAMPTZ NOT NULL,
+    expiry_time        TIMESTAMPTZ NOT NULL,
+    revoked            BOOLEAN NOT NULL DEFAULT FALSE,
+    session            INTEGER NOT NULL DEFAULT 0,
+    device_fingerprint TEXT NOT NULL DEFAULT '',
+    ip                 TEXT NOT NULL DEFAULT '',
+    user_agent         TEXT NOT NULL DEFAULT '',
+    client_id          TEXT NOT NULL DEFAULT '',
+    scope              TEXT NOT NULL DEFAULT '',
+    auth_time          TIMESTAMPTZ,
+    audiences          TEXT[] NOT NULL DEFAULT '{}',
+    remember_me        BOOLEAN NOT NULL DEFAULT FALSE,
+    revoked_reason     TEXT NOT NULL DEFAULT '',
+    dpop_jkt           TEXT NOT NULL DEFAULT '',
+    CONSTRAINT refresh_tokens_jti_key UNIQUE (jti)
+);
+
+CREATE INDEX refresh_tokens_user_idx ON refresh_tokens (user_id, created_at DESC);
+CREATE INDEX refresh_tokens_expiry_time_idx ON refresh_tokens (expiry_time);
@@ -0,0 +1,8 @@
+-- Emails sin espacios y en minusculas, como los guarda NormalizeEmail.
+--
+-- lower() usa la collation por defecto para convertir tambien lo que no es
+-- ASCII. Si dos usuarios solo difieren en mayusculas la migracion falla con una
+-- violacion de users_email_key y hay que unificarlos a mano antes de repetirla.
+UPDATE users
+SET email = lower(btrim(email) COLLATE "default")
+WHERE email <> lower(btrim(email) COLLATE "default");
@@ -0,0 +1,7 @@
+-- Momento de revocacion de los refresh tokens, para limpiar los revocados.
+--
+-- Los tokens revocados antes de esta migracion toman la hora actual, asi se
+-- conservan el tiempo de retencion completo para detectar su reutilizacion.
+ALTER TABLE refresh_tokens ADD COLUMN revoked_at TIMESTAMPTZ;
+UPDATE refresh_tokens SET revoked_at = now() WHERE revoked;
+CREATE INDEX refresh_tokens_revoked_at_idx ON refresh_tokens (revoked_at) WHERE revoked_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Version de los usuarios para el control de concurrencia optimista.
+--
+-- Cada escritura la incrementa y UpdateUser solo reemplaza la version leida.
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+-- Busqueda de los usuarios de un tenant SCIM por su external id.
+CREATE INDEX users_tenant_external_id_idx ON users (tenant_id, external_id) WHERE tenant_id <> '';
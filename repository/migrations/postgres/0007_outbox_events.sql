@@ -0,0 +1,22 @@
+-- Outbox de eventos de usuario.
+--
+-- Los eventos se escriben en la misma transaccion que la fila del usuario que
+-- describen, y el relay los publica despues.
+CREATE TABLE outbox_events (
+    id              TEXT COLLATE "C" PRIMARY KEY,
+    aggregate_id    TEXT NOT NULL,
+    type            TEXT NOT NULL,
+    data            JSONB NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    published_at    TIMESTAMPTZ,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ
+);
+
+-- Eventos pendientes del relay en orden de escritura: los ids son UUIDv7.
+CREATE INDEX outbox_events_pending_idx ON outbox_events (id) WHERE published_at IS NULL;
+-- Usuarios con un evento esperando su reintento.
+CREATE INDEX outbox_events_next_attempt_idx ON outbox_events (next_attempt_at, aggregate_id) WHERE next_attempt_at IS NOT NULL;
+-- Eventos publicados pendientes de purga.
+CREATE INDEX outbox_events_published_at_idx ON outbox_events (published_at) WHERE published_at IS NOT NULL;
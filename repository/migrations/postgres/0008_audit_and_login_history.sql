@@ -0,0 +1,40 @@
+-- Eventos de auditoria e historial de inicios de sesion.
+--
+-- Mongo los borra con indices TTL; en Postgres los borra PostgresCleaner cuando
+-- pasan AUDIT_RETENTION y LOGIN_HISTORY_RETENTION.
+CREATE TABLE audit_events (
+    id         TEXT COLLATE "C" PRIMARY KEY,
+    -- NULL en los eventos registrados sin la cadena de hashes.
+    sequence   BIGINT,
+    type       TEXT NOT NULL,
+    actor_id   TEXT NOT NULL DEFAULT '',
+    target_id  TEXT NOT NULL DEFAULT '',
+    ip         TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    outcome    TEXT NOT NULL,
+    details    JSONB,
+    prev_hash  TEXT NOT NULL DEFAULT '',
+    hash       TEXT NOT NULL DEFAULT '',
+    CONSTRAINT audit_events_sequence_key UNIQUE (sequence)
+);
+
+-- Listados de ListEvents, los mas recientes primero, y la purga por antiguedad.
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at DESC, id DESC);
+CREATE INDEX audit_events_actor_idx ON audit_events (actor_id, created_at DESC);
+CREATE INDEX audit_events_target_idx ON audit_events (target_id, created_at DESC);
+CREATE INDEX audit_events_type_idx ON audit_events (type, created_at DESC);
+
+CREATE TABLE login_attempts (
+    id             TEXT COLLATE "C" PRIMARY KEY,
+    user_id        TEXT NOT NULL,
+    method         TEXT NOT NULL,
+    success        BOOLEAN NOT NULL,
+    failure_reason TEXT NOT NULL DEFAULT '',
+    ip             TEXT NOT NULL DEFAULT '',
+    user_agent     TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX login_attempts_user_idx ON login_attempts (user_id, created_at DESC, id DESC);
+CREATE INDEX login_attempts_created_at_idx ON login_attempts (created_at);
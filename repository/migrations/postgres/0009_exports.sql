@@ -0,0 +1,31 @@
+-- Jobs de exportacion asincrona y sus archivos.
+--
+-- Los archivos van en su propia tabla como en Mongo, donde no caben en el
+-- documento del job. PostgresCleaner borra los jobs caducados y el worker de
+-- exportaciones los archivos.
+CREATE TABLE export_jobs (
+    id               TEXT COLLATE "C" PRIMARY KEY,
+    user_id          TEXT NOT NULL,
+    format           TEXT NOT NULL,
+    status           TEXT NOT NULL,
+    error            TEXT NOT NULL DEFAULT '',
+    archive_id       TEXT NOT NULL DEFAULT '',
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    claim_id         TEXT NOT NULL DEFAULT '',
+    lease_expires_at TIMESTAMPTZ,
+    created_at       TIMESTAMPTZ NOT NULL,
+    completed_at     TIMESTAMPTZ,
+    expires_at       TIMESTAMPTZ NOT NULL
+);
+
+-- Jobs que ClaimPendingJob puede reclamar, los mas antiguos primero.
+CREATE INDEX export_jobs_claim_idx ON export_jobs (status, created_at);
+CREATE INDEX export_jobs_expires_at_idx ON export_jobs (expires_at);
+
+CREATE TABLE export_archives (
+    id         TEXT COLLATE "C" PRIMARY KEY,
+    data       BYTEA NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX export_archives_expires_at_idx ON export_archives (expires_at);
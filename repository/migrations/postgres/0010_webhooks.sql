@@ -0,0 +1,35 @@
+-- Suscripciones de webhooks y registro de entregas.
+--
+-- Solo caducan las entregas terminadas, que tienen expires_at; PostgresCleaner
+-- las borra como el indice TTL de Mongo.
+CREATE TABLE webhook_subscriptions (
+    id          TEXT COLLATE "C" PRIMARY KEY,
+    url         TEXT NOT NULL,
+    -- Vacio para recibir todos los eventos.
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    secret      TEXT NOT NULL,
+    active      BOOLEAN NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+    id               TEXT COLLATE "C" PRIMARY KEY,
+    subscription_id  TEXT NOT NULL,
+    event_id         TEXT NOT NULL,
+    event_type       TEXT NOT NULL,
+    payload          TEXT NOT NULL,
+    status           TEXT NOT NULL,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ NOT NULL,
+    last_status_code INTEGER NOT NULL DEFAULT 0,
+    last_error       TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL,
+    delivered_at     TIMESTAMPTZ,
+    expires_at       TIMESTAMPTZ
+);
+
+-- Entregas pendientes que reclama el worker.
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt_at);
+-- Registro de entregas de una suscripcion, las mas recientes primero.
+CREATE INDEX webhook_deliveries_subscription_idx ON webhook_deliveries (subscription_id, created_at DESC, id DESC);
+CREATE INDEX webhook_deliveries_expires_at_idx ON webhook_deliveries (expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,16 @@
+-- Grupos SCIM de cada tenant.
+CREATE TABLE groups (
+    id           TEXT COLLATE "C" PRIMARY KEY,
+    tenant_id    TEXT NOT NULL,
+    display_name TEXT NOT NULL,
+    external_id  TEXT NOT NULL DEFAULT '',
+    -- Ids de los usuarios del grupo.
+    members      TEXT[] NOT NULL DEFAULT '{}',
+    created_at   TIMESTAMPTZ NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL,
+    CONSTRAINT groups_tenant_display_name_key UNIQUE (tenant_id, display_name)
+);
+
+CREATE INDEX groups_tenant_created_at_idx ON groups (tenant_id, created_at, id);
+-- Grupos de un usuario, para RemoveMember.
+CREATE INDEX groups_members_idx ON groups USING GIN (members);
@@ -0,0 +1,39 @@
+-- Clientes OAuth, codigos de autorizacion y pruebas DPoP ya usadas.
+--
+-- PostgresCleaner borra los codigos que nunca se canjearon y las pruebas que
+-- ya no se pueden repetir, como los indices TTL de Mongo.
+CREATE TABLE oauth_clients (
+    id            TEXT COLLATE "C" PRIMARY KEY,
+    name          TEXT NOT NULL,
+    type          TEXT NOT NULL,
+    secret_hash   TEXT NOT NULL DEFAULT '',
+    redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    scopes        TEXT[] NOT NULL DEFAULT '{}',
+    audiences     TEXT[] NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMPTZ NOT NULL
+);
+
+-- El id es el hash del codigo entregado al cliente.
+CREATE TABLE oauth_codes (
+    id                    TEXT COLLATE "C" PRIMARY KEY,
+    client_id             TEXT NOT NULL,
+    user_id               TEXT NOT NULL,
+    redirect_uri          TEXT NOT NULL,
+    redirect_uri_provided BOOLEAN NOT NULL DEFAULT FALSE,
+    scope                 TEXT NOT NULL,
+    code_challenge        TEXT NOT NULL,
+    code_challenge_method TEXT NOT NULL,
+    nonce                 TEXT NOT NULL DEFAULT '',
+    auth_time             TIMESTAMPTZ NOT NULL,
+    created_at            TIMESTAMPTZ NOT NULL,
+    expires_at            TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX oauth_codes_expires_at_idx ON oauth_codes (expires_at);
+
+CREATE TABLE dpop_proofs (
+    id         TEXT COLLATE "C" PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX dpop_proofs_expires_at_idx ON dpop_proofs (expires_at);
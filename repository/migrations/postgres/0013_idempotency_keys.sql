@@ -0,0 +1,17 @@
+-- Peticiones enviadas con Idempotency-Key y sus respuestas.
+--
+-- PostgresCleaner borra los registros caducados; Reserve reemplaza los que
+-- aun no borro.
+CREATE TABLE idempotency_keys (
+    -- Hash del usuario, la ruta y la clave enviada por el cliente.
+    id          TEXT COLLATE "C" PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    completed   BOOLEAN NOT NULL DEFAULT FALSE,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    headers     JSONB,
+    body        BYTEA,
+    created_at  TIMESTAMPTZ NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,8 @@
+-- Emails normalizados con NFKC, para EMAIL_NORMALIZE_NFKC.
+--
+-- Solo se aplica con EMAIL_NORMALIZE_NFKC; los emails guardados antes de
+-- activarlo se normalizan igual que NormalizeEmail. normalize() requiere
+-- PostgreSQL 13 y una base de datos en UTF8.
+UPDATE users
+SET email = lower(normalize(btrim(email), NFKC) COLLATE "default")
+WHERE email <> lower(normalize(btrim(email), NFKC) COLLATE "default");
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"users-microservice/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MongoMigrationNFKCEmails is the version of the migration that applies NFKC
+// to the stored emails. It is only part of MongoMigrations with nfkcEmails,
+// and EMAIL_NORMALIZE_NFKC requires it applied.
+const MongoMigrationNFKCEmails = "0007_normalize_emails_nfkc"
+
+// MongoMigrations returns the migrations of the users and refresh tokens
+// collections. New migrations are appended with the next version; applied
+// ones must not change. With nfkcEmails the list also has
+// MongoMigrationNFKCEmails, which applies NFKC to the stored emails.
+func MongoMigrations(usersCollection string, refreshTokensCollection string, nfkcEmails bool) []MongoMigration {
+	migrations := []MongoMigration{
+		{
+			Version:     "0001_user_indexes",
+			Description: "unique email and the ListUsers indexes",
+			Up: func(ctx context.Context, database *mongo.Database) error {
+				return EnsureUserIndexes(ctx, database.Client(), database.Name(), usersCollection)
+			},
+		},
+		{
+			Version:     "0002_refresh_token_indexes",
+			Description: "unique jti, tokens by user and TTL on expiry_time",
+			Up: func(ctx context.Context, database *mongo.Database) error {
+				return EnsureRefreshTokenIndexes(ctx, database.Client(), database.Name(), refreshTokensCollection)
+			},
+		},
+		{
+			Version:     "0003_backfill_user_role",
+			Description: "role user for the users created before roles existed",
+			Up: func(ctx context.Context, database *mongo.Database) error {
+				filter := bson.M{"$or": bson.A{bson.M{"role": bson.M{"$exists": false}}, bson.M{"role": ""}}}
+				update := bson.M{"$set": bson.M{"role": models.RoleUser}}
+				_, err := database.Collection(usersCollection).UpdateMany(ctx, filter, update)
+				return err
+			},
+		},
+		{
+			Version:     "0004_normalize_emails",
+			Description: "trimmed and lowercased emails, as NormalizeEmail stores them",
+			Up: func(ctx context.Context, database *mongo.Database) error {
+				return normalizeStoredEmails(ctx, database.Collection(usersCollection), false)
+			},
+		},
+		{
+			Version:     "0005_refresh_token_revoked_at",
+			Description: "revoked_at for the revoked tokens and its index, used by the cleanup worker",
+			Up: func(ctx context.Context, database *mongo.Database) error {
+				collection := database.Collection(refreshTokensCollection)
+				// Los tokens revocados antes se conservan la retencion completa desde ahora.
+				filter := bson.M{"revoked": true, "revoked_at": bson.M{"$exists": false}}
+				update := bson.M{"$set": bson.M{"revoked_at": time.Now().UTC()}}
+				if _, err := collection.UpdateMany(ctx, filter, update); err != nil {
+					return err
+				}
+				index := mongo.IndexModel{Keys: bson.D{{Key: "revoked_at", Value: 1}}, Options: options.Index().SetSparse(true)}
+				_, err := collection.Indexes().CreateOne(ctx, index)
+				return err
+			},
+		},
+		{
+			Version:     "0006_user_version",
+			Description: "version 1 for the users created before optimistic concurrency",
+			Up: func(ctx context.Context, database *mongo.Database) error {
+				filter := bson.M{"version": bson.M{"$exists": false}}
+				update := bson.M{"$set": bson.M{"version": 1}}
+				_, err := database.Collection(usersCollection).UpdateMany(ctx, filter, update)
+				return err
+			},
+		},
+		// 0007 es MongoMigrationNFKCEmails, que solo se incluye con nfkcEmails.
+		{
+			Version:     "0008_user_tenant_external_id",
+			Description: "index of the SCIM lookups by tenant and external id",
+			Up: func(ctx context.Context, database *mongo.Database) error {
+				keys := bson.D{{Key: "tenant_id", Value: 1}, {Key: "external_id", Value: 1}}
+				index := mongo.IndexModel{Keys: keys, Options: options.Index().SetSparse(true)}
+				_, err := database.Collection(usersCollection).Indexes().CreateOne(ctx, index)
+				return err
+			},
+		},
+	}
+	if nfkcEmails {
+		migrations = append(migrations, MongoMigration{
+			Version:     MongoMigrationNFKCEmails,
+			Description: "NFKC normalized emails, for EMAIL_NORMALIZE_NFKC",
+			Up: func(ctx context.Context, database *mongo.Database) error {
+				return normalizeStoredEmails(ctx, database.Collection(usersCollection), true)
+			},
+		})
+	}
+	return migrations
+}
+
+// normalizeStoredEmails rewrites the emails stored before NormalizeEmail
+// existed, or before nfkc was enabled. It runs in Go rather than with $toLower, which only folds ASCII.
+// Two users whose emails only differ in case make it fail with a duplicate
+// key error; they have to be merged by hand before migrating again.
+func normalizeStoredEmails(ctx context.Context, collection *mongo.Collection, nfkc bool) error {
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"email": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var user struct {
+			Id    string `bson:"_id"`
+			Email string `bson:"email"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		email := NormalizeEmail(user.Email, nfkc)
+		if email == user.Email {
+			continue
+		}
+		if _, err := collection.UpdateByID(ctx, user.Id, bson.M{"$set": bson.M{"email": email}}); err != nil {
+			return fmt.Errorf("normalizing the email of user %s: %w", user.Id, err)
+		}
+	}
+	return cursor.Err()
+}
+
+// backfillUserSearchFields stores the lowercased name and last name of the
+// users created before ListUsers searched them. Like normalizeStoredEmails it
+// lowercases in Go, as the repository does, rather than with $toLower.
+func backfillUserSearchFields(ctx context.Context, collection *mongo.Collection) error {
+	projection := bson.M{"name": 1, "last_name": 1}
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var user struct {
+			Id       string `bson:"_id"`
+			Name     string `bson:"name"`
+			LastName string `bson:"last_name"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		update := bson.M{"$set": bson.M{
+			"search_name":      strings.ToLower(user.Name),
+			"search_last_name": strings.ToLower(user.LastName),
+		}}
+		if _, err := collection.UpdateByID(ctx, user.Id, update); err != nil {
+			return fmt.Errorf("storing the search fields of user %s: %w", user.Id, err)
+		}
+	}
+	return cursor.Err()
+}
+
+// EnsureRefreshTokenIndexes makes jti unique, indexes the sessions of a user
+// newest first and lets MongoDB delete the tokens once they expire.
+func EnsureRefreshTokenIndexes(ctx context.Context, client *mongo.Client, dbName string, collectionName string) error {
+	collection := client.Database(dbName).Collection(collectionName)
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "jti", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "expiry_time", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
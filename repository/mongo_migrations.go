@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// mongoMigrationLockId is the document of the migrations collection that works
+// as a lock, so two instances starting at the same time do not run the same
+// migration.
+const mongoMigrationLockId = "migration_lock"
+
+// mongoMigrationLease is how long the lock is held before another instance can
+// take it, in case the one migrating dies.
+const mongoMigrationLease = 5 * time.Minute
+
+// MongoMigration is a versioned change of the indexes or the data of MongoDB.
+// Migrations run in Version order and are recorded once applied. Up must be
+// idempotent: index builds cannot run in a transaction, so a migration that
+// fails half way runs again from the start.
+type MongoMigration struct {
+	Version     string
+	Description string
+	Up          func(ctx context.Context, database *mongo.Database) error
+}
+
+// MigrationStatus is the state of a migration of MongoDB or PostgreSQL.
+// AppliedAt is nil while the migration is pending.
+type MigrationStatus struct {
+	Version     string
+	Description string
+	AppliedAt   *time.Time
+}
+
+type mongoMigrationRecord struct {
+	Version     string    `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+type MongoMigrator struct {
+	database   *mongo.Database
+	collection *mongo.Collection
+}
+
+// NewMongoMigrator records the applied migrations of dbName in collectionName.
+func NewMongoMigrator(client *mongo.Client, dbName string, collectionName string) *MongoMigrator {
+	database := client.Database(dbName)
+	return &MongoMigrator{
+		database:   database,
+		collection: database.Collection(collectionName),
+	}
+}
+
+// Migrate applies the pending migrations and returns their versions.
+func (m *MongoMigrator) Migrate(ctx context.Context, migrations []MongoMigration) ([]string, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+	statuses, err := m.Status(ctx, migrations)
+	if err != nil {
+		return nil, err
+	}
+	var applied []string
+	for i, migration := range sortedMigrations(migrations) {
+		if statuses[i].AppliedAt != nil {
+			continue
+		}
+		if err := migration.Up(ctx, m.database); err != nil {
+			return applied, fmt.Errorf("migration %s: %w", migration.Version, err)
+		}
+		_, err := m.collection.InsertOne(ctx, mongoMigrationRecord{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().UTC(),
+		})
+		if err != nil {
+			return applied, fmt.Errorf("recording migration %s: %w", migration.Version, err)
+		}
+		applied = append(applied, migration.Version)
+	}
+	return applied, nil
+}
+
+// Status returns the state of every migration, in the order they run.
+func (m *MongoMigrator) Status(ctx context.Context, migrations []MongoMigration) ([]MigrationStatus, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{"_id": bson.M{"$ne": mongoMigrationLockId}})
+	if err != nil {
+		return nil, err
+	}
+	var records []mongoMigrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	appliedAt := map[string]time.Time{}
+	for _, record := range records {
+		appliedAt[record.Version] = record.AppliedAt
+	}
+	var statuses []MigrationStatus
+	for _, migration := range sortedMigrations(migrations) {
+		status := MigrationStatus{Version: migration.Version, Description: migration.Description}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// lock waits until the lock is free or its lease expired and takes it.
+func (m *MongoMigrator) lock(ctx context.Context) error {
+	for {
+		now := time.Now().UTC()
+		filter := bson.M{"_id": mongoMigrationLockId, "locked_until": bson.M{"$lt": now}}
+		update := bson.M{"$set": bson.M{"locked_until": now.Add(mongoMigrationLease)}}
+		_, err := m.collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+		if err == nil {
+			return nil
+		}
+		// El upsert choca con el lock de otra instancia mientras no expire.
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for the migration lock: %w", ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (m *MongoMigrator) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	m.collection.DeleteOne(ctx, bson.M{"_id": mongoMigrationLockId})
+}
+
+func sortedMigrations(migrations []MongoMigration) []MongoMigration {
+	return slices.SortedFunc(slices.Values(migrations), func(a, b MongoMigration) int {
+		return strings.Compare(a.Version, b.Version)
+	})
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"users-microservice/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrOAuthClientNotFound = errors.New("oauth client not found")
+var ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
+
+type OAuthRepository interface {
+	CreateClient(ctx context.Context, client *models.OAuthClient) error
+	FindClient(ctx context.Context, clientId string) (*models.OAuthClient, error)
+	ListClients(ctx context.Context) ([]models.OAuthClient, error)
+	DeleteClient(ctx context.Context, clientId string) error
+	CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error
+	// ConsumeAuthorizationCode removes the code and returns it, so a code can
+	// only be exchanged once even with concurrent requests.
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error)
+}
+
+type mongoOAuthRepository struct {
+	clients *mongo.Collection
+	codes   *mongo.Collection
+}
+
+func NewOAuthRepository(client *mongo.Client, dbName string, clientsCollection string, codesCollection string) OAuthRepository {
+	database := client.Database(dbName)
+	return &mongoOAuthRepository{
+		clients: database.Collection(clientsCollection),
+		codes:   database.Collection(codesCollection),
+	}
+}
+
+// EnsureOAuthIndexes creates the TTL index that removes the authorization
+// codes that were never exchanged.
+func EnsureOAuthIndexes(ctx context.Context, client *mongo.Client, dbName string, codesCollection string) error {
+	_, err := client.Database(dbName).Collection(codesCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// CreateClient implements OAuthRepository.
+func (m *mongoOAuthRepository) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	_, err := m.clients.InsertOne(ctx, client)
+	return err
+}
+
+// FindClient implements OAuthRepository.
+func (m *mongoOAuthRepository) FindClient(ctx context.Context, clientId string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := m.clients.FindOne(ctx, bson.M{"_id": clientId}).Decode(&client)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOAuthClientNotFound
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+// ListClients implements OAuthRepository.
+func (m *mongoOAuthRepository) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	result, err := m.clients.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var clients []models.OAuthClient
+	if err := result.All(ctx, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteClient implements OAuthRepository.
+func (m *mongoOAuthRepository) DeleteClient(ctx context.Context, clientId string) error {
+	result, err := m.clients.DeleteOne(ctx, bson.M{"_id": clientId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+// CreateAuthorizationCode implements OAuthRepository.
+func (m *mongoOAuthRepository) CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	_, err := m.codes.InsertOne(ctx, code)
+	return err
+}
+
+// ConsumeAuthorizationCode implements OAuthRepository.
+func (m *mongoOAuthRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	var code models.AuthorizationCode
+	err := m.codes.FindOneAndDelete(ctx, bson.M{"_id": codeHash}).Decode(&code)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrAuthorizationCodeNotFound
+		}
+		return nil, err
+	}
+	return &code, nil
+}
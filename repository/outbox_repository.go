@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"users-microservice/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type OutboxRepository interface {
+	AppendEvent(ctx context.Context, event *models.OutboxEvent) error
+	// FindPendingEvents skips the users with an event waiting for its
+	// NextAttemptAt after now, so a failing user cannot starve the others.
+	FindPendingEvents(ctx context.Context, now time.Time, limit int) ([]models.OutboxEvent, error)
+	MarkPublished(ctx context.Context, eventId string, publishedAt time.Time) error
+	MarkFailed(ctx context.Context, eventId string, reason string, nextAttemptAt time.Time) error
+	// DeletePublishedBefore deletes up to limit events published before before
+	// and returns how many it deleted.
+	DeletePublishedBefore(ctx context.Context, before time.Time, limit int) (int, error)
+}
+
+type mongoOutboxRepository struct {
+	collection *mongo.Collection
+}
+
+func NewOutboxRepository(client *mongo.Client, dbName string, collectionName string) OutboxRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &mongoOutboxRepository{
+		collection: collection,
+	}
+}
+
+// EnsureOutboxIndexes creates the pending events index used by the relay, the
+// index of the events waiting for a retry and the TTL index removing published
+// events after retention.
+func EnsureOutboxIndexes(ctx context.Context, client *mongo.Client, dbName string, collectionName string, retention time.Duration) error {
+	collection := client.Database(dbName).Collection(collectionName)
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "published_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "next_attempt_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "published_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds()))},
+	}
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// AppendEvent implements OutboxRepository.
+func (m *mongoOutboxRepository) AppendEvent(ctx context.Context, event *models.OutboxEvent) error {
+	_, err := m.collection.InsertOne(ctx, event)
+	return err
+}
+
+// FindPendingEvents implements OutboxRepository. Event ids are UUIDv7, so
+// sorting by _id returns the events in the order they were written.
+func (m *mongoOutboxRepository) FindPendingEvents(ctx context.Context, now time.Time, limit int) ([]models.OutboxEvent, error) {
+	// Solo los eventos fallidos tienen next_attempt_at y MarkPublished lo borra.
+	var waiting []string
+	err := m.collection.Distinct(ctx, "aggregate_id", bson.M{"next_attempt_at": bson.M{"$gt": now}}).Decode(&waiting)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"published_at": bson.M{"$exists": false}, "aggregate_id": bson.M{"$nin": waiting}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var events []models.OutboxEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// MarkPublished implements OutboxRepository.
+func (m *mongoOutboxRepository) MarkPublished(ctx context.Context, eventId string, publishedAt time.Time) error {
+	update := bson.M{"$set": bson.M{"published_at": publishedAt}, "$unset": bson.M{"last_error": "", "next_attempt_at": ""}}
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": eventId}, update)
+	return err
+}
+
+// MarkFailed implements OutboxRepository.
+func (m *mongoOutboxRepository) MarkFailed(ctx context.Context, eventId string, reason string, nextAttemptAt time.Time) error {
+	update := bson.M{"$set": bson.M{"last_error": reason, "next_attempt_at": nextAttemptAt}, "$inc": bson.M{"attempts": 1}}
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": eventId}, update)
+	return err
+}
+
+// DeletePublishedBefore implements OutboxRepository. The TTL index created by
+// EnsureOutboxIndexes removes the published events too; this only matters when
+// OUTBOX_RETENTION changed since the index was created.
+func (m *mongoOutboxRepository) DeletePublishedBefore(ctx context.Context, before time.Time, limit int) (int, error) {
+	findOptions := options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(int64(limit))
+	cursor, err := m.collection.Find(ctx, bson.M{"published_at": bson.M{"$lt": before}}, findOptions)
+	if err != nil {
+		return 0, err
+	}
+	var published []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &published); err != nil {
+		return 0, err
+	}
+	if len(published) == 0 {
+		return 0, nil
+	}
+	ids := make(bson.A, 0, len(published))
+	for _, event := range published {
+		ids = append(ids, event.ID)
+	}
+	result, err := m.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/postgres/*.sql migrations/postgres/nfkc/*.sql
+var postgresMigrations embed.FS
+
+const postgresMigrationDir = "migrations/postgres"
+
+// postgresNFKCMigrationDir holds the migrations that only run with
+// EMAIL_NORMALIZE_NFKC.
+const postgresNFKCMigrationDir = "migrations/postgres/nfkc"
+
+// PostgresMigrationNFKCEmails is the version of the migration that applies
+// NFKC to the stored emails. EMAIL_NORMALIZE_NFKC requires it applied.
+const PostgresMigrationNFKCEmails = "0005_normalize_emails_nfkc"
+
+// postgresMigrationLock is the advisory lock held while migrating, so two
+// instances starting at the same time do not apply the same migration.
+const postgresMigrationLock = 7_142_031
+
+// pgUniqueViolation is the SQLSTATE of a unique constraint violation.
+const pgUniqueViolation = "23505"
+
+// MigratePostgres applies the migrations in migrations/postgres that are not
+// recorded in schema_migrations yet, in name order, and returns their
+// versions. Each migration runs in its own transaction. With nfkcEmails the
+// ones in migrations/postgres/nfkc are applied too.
+func MigratePostgres(ctx context.Context, pool *pgxpool.Pool, nfkcEmails bool) ([]string, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", postgresMigrationLock); err != nil {
+		return nil, err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", postgresMigrationLock)
+
+	files, err := postgresMigrationFiles(nfkcEmails)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := postgresMigrationStatus(ctx, conn, files)
+	if err != nil {
+		return nil, err
+	}
+	var applied []string
+	for i, status := range statuses {
+		if status.AppliedAt != nil {
+			continue
+		}
+		script, err := postgresMigrations.ReadFile(files[i])
+		if err != nil {
+			return applied, err
+		}
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, string(script)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", status.Version)
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %s: %w", status.Version, err)
+		}
+		applied = append(applied, status.Version)
+	}
+	return applied, nil
+}
+
+// PostgresMigrationStatus returns the state of every migration in
+// migrations/postgres, in the order they run. The description is the first
+// comment line of the script.
+func PostgresMigrationStatus(ctx context.Context, pool *pgxpool.Pool, nfkcEmails bool) ([]MigrationStatus, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+	files, err := postgresMigrationFiles(nfkcEmails)
+	if err != nil {
+		return nil, err
+	}
+	return postgresMigrationStatus(ctx, conn, files)
+}
+
+// postgresMigrationFiles returns the scripts to apply sorted by version.
+func postgresMigrationFiles(nfkcEmails bool) ([]string, error) {
+	files, err := fs.Glob(postgresMigrations, postgresMigrationDir+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	if nfkcEmails {
+		nfkcFiles, err := fs.Glob(postgresMigrations, postgresNFKCMigrationDir+"/*.sql")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, nfkcFiles...)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return path.Base(files[i]) < path.Base(files[j])
+	})
+	return files, nil
+}
+
+func postgresMigrationStatus(ctx context.Context, conn *pgxpool.Conn, files []string) ([]MigrationStatus, error) {
+	_, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := map[string]time.Time{}
+	var version string
+	var at time.Time
+	_, err = pgx.ForEachRow(rows, []any{&version, &at}, func() error {
+		appliedAt[version] = at.UTC()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, file := range files {
+		script, err := postgresMigrations.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		firstLine, _, _ := strings.Cut(string(script), "\n")
+		status := MigrationStatus{
+			Version:     strings.TrimSuffix(path.Base(file), ".sql"),
+			Description: strings.TrimSpace(strings.TrimPrefix(firstLine, "--")),
+		}
+		if at, ok := appliedAt[status.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+type postgresTxKey struct{}
+
+// postgresQuerier is the part of pgxpool.Pool and pgx.Tx used by the
+// repositories.
+type postgresQuerier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// postgresConn returns the transaction started by the postgres
+// TransactionManager in ctx, or the pool outside of a transaction.
+func postgresConn(ctx context.Context, pool *pgxpool.Pool) postgresQuerier {
+	if tx, ok := ctx.Value(postgresTxKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return pool
+}
+
+type postgresTransactionManager struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresTransactionManager(pool *pgxpool.Pool) TransactionManager {
+	return &postgresTransactionManager{
+		pool: pool,
+	}
+}
+
+// WithTransaction implements TransactionManager. A call inside another
+// transaction joins it.
+func (m *postgresTransactionManager) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(postgresTxKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	return pgx.BeginFunc(ctx, m.pool, func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, postgresTxKey{}, tx))
+	})
+}
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation && pgErr.ConstraintName == constraint
+}
+
+// utcTime converts an optional date read from Postgres to UTC, as the Mongo
+// driver returns them.
+func utcTime(value *time.Time) *time.Time {
+	if value == nil {
+		return nil
+	}
+	utc := value.UTC()
+	return &utc
+}
+
+// postgresTextArray returns values to store in a NOT NULL TEXT[] column, where
+// a nil slice would be NULL.
+func postgresTextArray(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"users-microservice/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const auditEventColumns = `id, COALESCE(sequence, 0), type, actor_id, target_id, ip, user_agent, created_at, outcome,
+	details, prev_hash, hash`
+
+type postgresAuditRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresAuditRepository stores the events in the audit_events table
+// created by MigratePostgres, with their timestamp in created_at. The events
+// recorded while the hash chain is disabled have a NULL sequence.
+func NewPostgresAuditRepository(pool *pgxpool.Pool) AuditRepository {
+	return &postgresAuditRepository{
+		pool: pool,
+	}
+}
+
+// CreateEvent implements AuditRepository.
+func (p *postgresAuditRepository) CreateEvent(ctx context.Context, event *models.AuditEvent) error {
+	var details any
+	if len(event.Details) > 0 {
+		details = event.Details
+	}
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO audit_events (id, sequence, type, actor_id, target_id, ip,
+			user_agent, created_at, outcome, details, prev_hash, hash)
+		VALUES ($1, NULLIF($2::bigint, 0), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		event.ID, event.Sequence, event.Type, event.ActorId, event.TargetId, event.IP, event.UserAgent,
+		event.Timestamp, event.Outcome, details, event.PrevHash, event.Hash)
+	if isUniqueViolation(err, "audit_events_sequence_key") {
+		return ErrAuditSequenceTaken
+	}
+	return err
+}
+
+// LastEvent implements AuditRepository. Only chained events are considered.
+func (p *postgresAuditRepository) LastEvent(ctx context.Context) (*models.AuditEvent, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+auditEventColumns+` FROM audit_events
+		WHERE sequence IS NOT NULL ORDER BY sequence DESC LIMIT 1`)
+	if err != nil {
+		return nil, err
+	}
+	event, err := pgx.CollectExactlyOneRow(rows, scanAuditEvent)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAuditEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// ListEvents implements AuditRepository. Events are returned newest first.
+func (p *postgresAuditRepository) ListEvents(ctx context.Context, filter AuditEventFilter) (*AuditEventPage, error) {
+	limit := pageLimit(filter.Limit)
+	conditions := []string{"TRUE"}
+	var args []any
+	addCondition := func(condition string, values ...any) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+	if filter.ActorId != "" {
+		addCondition("actor_id = ?", filter.ActorId)
+	}
+	if filter.TargetId != "" {
+		addCondition("target_id = ?", filter.TargetId)
+	}
+	if filter.SubjectId != "" {
+		addCondition("(actor_id = ? OR target_id = ?)", filter.SubjectId, filter.SubjectId)
+	}
+	if filter.Type != "" {
+		addCondition("type = ?", filter.Type)
+	}
+	if filter.Outcome != "" {
+		addCondition("outcome = ?", filter.Outcome)
+	}
+	if filter.From != nil {
+		addCondition("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		addCondition("created_at < ?", *filter.To)
+	}
+	if filter.Cursor != "" {
+		timestamp, id, err := decodeTimeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		addCondition("(created_at, id) < (?, ?)", timestamp, id)
+	}
+	// Se pide una fila extra para saber si existe una pagina siguiente.
+	args = append(args, limit+1)
+	query := fmt.Sprintf(`SELECT %s FROM audit_events WHERE %s ORDER BY created_at DESC, id DESC LIMIT $%d`,
+		auditEventColumns, strings.Join(conditions, " AND "), len(args))
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	events, err := pgx.CollectRows(rows, scanAuditEvent)
+	if err != nil {
+		return nil, err
+	}
+	page := &AuditEventPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		last := page.Events[limit-1]
+		page.NextCursor = encodeKeysetCursor(last.Timestamp.UTC().Format(time.RFC3339Nano), last.ID)
+	}
+	return page, nil
+}
+
+// ListEventsAfterSequence implements AuditRepository.
+func (p *postgresAuditRepository) ListEventsAfterSequence(ctx context.Context, sequence int64, limit int) ([]models.AuditEvent, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+auditEventColumns+` FROM audit_events
+		WHERE sequence > $1 ORDER BY sequence LIMIT $2`, sequence, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanAuditEvent)
+}
+
+func scanAuditEvent(row pgx.CollectableRow) (models.AuditEvent, error) {
+	var event models.AuditEvent
+	err := row.Scan(&event.ID, &event.Sequence, &event.Type, &event.ActorId, &event.TargetId, &event.IP, &event.UserAgent,
+		&event.Timestamp, &event.Outcome, &event.Details, &event.PrevHash, &event.Hash)
+	event.Timestamp = event.Timestamp.UTC()
+	return event, err
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresRetention is how long the rows without an expiry date of their own
+// are kept, as the TTL indexes of the Mongo backend do.
+type PostgresRetention struct {
+	Audit        time.Duration
+	LoginHistory time.Duration
+}
+
+// PostgresCleaner deletes the rows that Mongo removes with TTL indexes:
+// Postgres has no equivalent, so a worker has to call DeleteExpired.
+type PostgresCleaner struct {
+	pool      *pgxpool.Pool
+	retention PostgresRetention
+}
+
+func NewPostgresCleaner(pool *pgxpool.Pool, retention PostgresRetention) *PostgresCleaner {
+	return &PostgresCleaner{
+		pool:      pool,
+		retention: retention,
+	}
+}
+
+// DeleteExpired deletes up to limit expired rows of each table and returns how
+// many it deleted in total.
+func (c *PostgresCleaner) DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	expired := []struct {
+		table     string
+		condition string
+		before    time.Time
+	}{
+		{"audit_events", "created_at < $1", now.Add(-c.retention.Audit)},
+		{"login_attempts", "created_at < $1", now.Add(-c.retention.LoginHistory)},
+		{"export_jobs", "expires_at <= $1", now},
+		// Las entregas pendientes no tienen expires_at y no caducan.
+		{"webhook_deliveries", "expires_at <= $1", now},
+		{"oauth_codes", "expires_at <= $1", now},
+		{"dpop_proofs", "expires_at <= $1", now},
+		{"idempotency_keys", "expires_at <= $1", now},
+	}
+	deleted := 0
+	for _, rows := range expired {
+		tag, err := postgresConn(ctx, c.pool).Exec(ctx, `DELETE FROM `+rows.table+` WHERE id IN (
+			SELECT id FROM `+rows.table+` WHERE `+rows.condition+` LIMIT $2)`, rows.before, limit)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(tag.RowsAffected())
+	}
+	return deleted, nil
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"users-microservice/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const exportJobColumns = `id, user_id, format, status, error, archive_id, attempts, claim_id, lease_expires_at,
+	created_at, completed_at, expires_at`
+
+type postgresExportJobRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresExportJobRepository stores the jobs in the export_jobs table
+// created by MigratePostgres.
+func NewPostgresExportJobRepository(pool *pgxpool.Pool) ExportJobRepository {
+	return &postgresExportJobRepository{
+		pool: pool,
+	}
+}
+
+// CreateJob implements ExportJobRepository.
+func (p *postgresExportJobRepository) CreateJob(ctx context.Context, job *models.ExportJob) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO export_jobs (`+exportJobColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		job.ID, job.UserId, job.Format, job.Status, job.Error, job.ArchiveId, job.Attempts, job.ClaimId,
+		job.LeaseExpiresAt, job.CreatedAt, job.CompletedAt, job.ExpiresAt)
+	return err
+}
+
+// FindJob implements ExportJobRepository.
+func (p *postgresExportJobRepository) FindJob(ctx context.Context, jobId string) (*models.ExportJob, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+exportJobColumns+` FROM export_jobs WHERE id = $1`, jobId)
+	return collectExportJob(rows, err)
+}
+
+// ClaimPendingJob implements ExportJobRepository. SKIP LOCKED lets several
+// workers claim different jobs at the same time.
+func (p *postgresExportJobRepository) ClaimPendingJob(ctx context.Context, now time.Time, lease time.Duration) (*models.ExportJob, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `UPDATE export_jobs
+		SET status = $1, claim_id = $2, lease_expires_at = $3, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM export_jobs
+			WHERE status = $4 OR (status = $1 AND lease_expires_at <= $5)
+			ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED)
+		RETURNING `+exportJobColumns,
+		models.ExportJobRunning, uuid.NewString(), now.Add(lease), models.ExportJobPending, now)
+	return collectExportJob(rows, err)
+}
+
+// UpdateJob implements ExportJobRepository.
+func (p *postgresExportJobRepository) UpdateJob(ctx context.Context, job *models.ExportJob) error {
+	tag, err := postgresConn(ctx, p.pool).Exec(ctx, `UPDATE export_jobs
+		SET user_id = $3, format = $4, status = $5, error = $6, archive_id = $7, attempts = $8,
+			lease_expires_at = $9, created_at = $10, completed_at = $11, expires_at = $12
+		WHERE id = $1 AND claim_id = $2`,
+		job.ID, job.ClaimId, job.UserId, job.Format, job.Status, job.Error, job.ArchiveId, job.Attempts,
+		job.LeaseExpiresAt, job.CreatedAt, job.CompletedAt, job.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrExportJobNotFound
+	}
+	return nil
+}
+
+func collectExportJob(rows pgx.Rows, err error) (*models.ExportJob, error) {
+	if err != nil {
+		return nil, err
+	}
+	job, err := pgx.CollectExactlyOneRow(rows, scanExportJob)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrExportJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func scanExportJob(row pgx.CollectableRow) (models.ExportJob, error) {
+	var job models.ExportJob
+	err := row.Scan(&job.ID, &job.UserId, &job.Format, &job.Status, &job.Error, &job.ArchiveId, &job.Attempts,
+		&job.ClaimId, &job.LeaseExpiresAt, &job.CreatedAt, &job.CompletedAt, &job.ExpiresAt)
+	job.CreatedAt = job.CreatedAt.UTC()
+	job.ExpiresAt = job.ExpiresAt.UTC()
+	job.LeaseExpiresAt = utcTime(job.LeaseExpiresAt)
+	job.CompletedAt = utcTime(job.CompletedAt)
+	return job, err
+}
+
+type postgresExportArchiveRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresExportArchiveRepository stores the archives in the
+// export_archives table created by MigratePostgres.
+func NewPostgresExportArchiveRepository(pool *pgxpool.Pool) ExportArchiveRepository {
+	return &postgresExportArchiveRepository{
+		pool: pool,
+	}
+}
+
+// SaveArchive implements ExportArchiveRepository.
+func (p *postgresExportArchiveRepository) SaveArchive(ctx context.Context, archiveId string, data []byte, expiresAt time.Time) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO export_archives (id, data, expires_at)
+		VALUES ($1, $2, $3)`, archiveId, data, expiresAt)
+	return err
+}
+
+// LoadArchive implements ExportArchiveRepository.
+func (p *postgresExportArchiveRepository) LoadArchive(ctx context.Context, archiveId string) ([]byte, error) {
+	var data []byte
+	err := postgresConn(ctx, p.pool).QueryRow(ctx, `SELECT data FROM export_archives WHERE id = $1`, archiveId).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrExportArchiveNotFound
+	}
+	return data, err
+}
+
+// DeleteArchive implements ExportArchiveRepository.
+func (p *postgresExportArchiveRepository) DeleteArchive(ctx context.Context, archiveId string) error {
+	tag, err := postgresConn(ctx, p.pool).Exec(ctx, `DELETE FROM export_archives WHERE id = $1`, archiveId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrExportArchiveNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredArchives implements ExportArchiveRepository.
+func (p *postgresExportArchiveRepository) DeleteExpiredArchives(ctx context.Context, now time.Time) (int, error) {
+	tag, err := postgresConn(ctx, p.pool).Exec(ctx, `DELETE FROM export_archives WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"users-microservice/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const groupColumns = `id, tenant_id, display_name, external_id, members, created_at, updated_at`
+
+type postgresGroupRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresGroupRepository stores the groups in the groups table created by
+// MigratePostgres.
+func NewPostgresGroupRepository(pool *pgxpool.Pool) GroupRepository {
+	return &postgresGroupRepository{
+		pool: pool,
+	}
+}
+
+// CreateGroup implements GroupRepository. As in Mongo, a group id already in
+// use is reported as ErrGroupNameTaken too.
+func (p *postgresGroupRepository) CreateGroup(ctx context.Context, group *models.Group) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO groups (`+groupColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		group.ID, group.TenantId, group.DisplayName, group.ExternalId, postgresTextArray(group.Members), group.CreatedAt, group.UpdatedAt)
+	if isUniqueViolation(err, "groups_tenant_display_name_key") || isUniqueViolation(err, "groups_pkey") {
+		return ErrGroupNameTaken
+	}
+	return err
+}
+
+// FindGroup implements GroupRepository.
+func (p *postgresGroupRepository) FindGroup(ctx context.Context, tenantId string, groupId string) (*models.Group, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+groupColumns+` FROM groups
+		WHERE id = $1 AND tenant_id = $2`, groupId, tenantId)
+	if err != nil {
+		return nil, err
+	}
+	group, err := pgx.CollectExactlyOneRow(rows, scanGroup)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// ListGroups implements GroupRepository.
+func (p *postgresGroupRepository) ListGroups(ctx context.Context, tenantId string) ([]models.Group, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+groupColumns+` FROM groups
+		WHERE tenant_id = $1 ORDER BY created_at, id`, tenantId)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanGroup)
+}
+
+// UpdateGroup implements GroupRepository.
+func (p *postgresGroupRepository) UpdateGroup(ctx context.Context, group *models.Group) error {
+	tag, err := postgresConn(ctx, p.pool).Exec(ctx, `UPDATE groups
+		SET display_name = $3, external_id = $4, members = $5, created_at = $6, updated_at = $7
+		WHERE id = $1 AND tenant_id = $2`,
+		group.ID, group.TenantId, group.DisplayName, group.ExternalId, postgresTextArray(group.Members), group.CreatedAt, group.UpdatedAt)
+	if isUniqueViolation(err, "groups_tenant_display_name_key") {
+		return ErrGroupNameTaken
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// DeleteGroup implements GroupRepository.
+func (p *postgresGroupRepository) DeleteGroup(ctx context.Context, tenantId string, groupId string) error {
+	tag, err := postgresConn(ctx, p.pool).Exec(ctx, `DELETE FROM groups WHERE id = $1 AND tenant_id = $2`, groupId, tenantId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// RemoveMember implements GroupRepository. It drops the user from every group
+// of the tenant.
+func (p *postgresGroupRepository) RemoveMember(ctx context.Context, tenantId string, userId string) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `UPDATE groups SET members = array_remove(members, $2::text)
+		WHERE tenant_id = $1 AND members @> ARRAY[$2::text]`, tenantId, userId)
+	return err
+}
+
+func scanGroup(row pgx.CollectableRow) (models.Group, error) {
+	var group models.Group
+	err := row.Scan(&group.ID, &group.TenantId, &group.DisplayName, &group.ExternalId, &group.Members,
+		&group.CreatedAt, &group.UpdatedAt)
+	group.CreatedAt = group.CreatedAt.UTC()
+	group.UpdatedAt = group.UpdatedAt.UTC()
+	return group, err
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"users-microservice/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const idempotencyRecordColumns = `id, fingerprint, completed, status_code, headers, body, created_at, expires_at`
+
+type postgresIdempotencyRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresIdempotencyRepository stores the records in the idempotency_keys
+// table created by MigratePostgres.
+func NewPostgresIdempotencyRepository(pool *pgxpool.Pool) IdempotencyRepository {
+	return &postgresIdempotencyRepository{
+		pool: pool,
+	}
+}
+
+// Reserve implements IdempotencyRepository. An expired record that the
+// cleaner did not remove yet is replaced.
+func (p *postgresIdempotencyRepository) Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	conn := postgresConn(ctx, p.pool)
+	var headers any
+	if len(record.Headers) > 0 {
+		headers = record.Headers
+	}
+	tag, err := conn.Exec(ctx, `INSERT INTO idempotency_keys (`+idempotencyRecordColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, completed = EXCLUDED.completed,
+			status_code = EXCLUDED.status_code, headers = EXCLUDED.headers, body = EXCLUDED.body,
+			created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < $9`,
+		record.Key, record.Fingerprint, record.Completed, record.StatusCode, headers, record.Body, record.CreatedAt,
+		record.ExpiresAt, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, nil
+	}
+	// La clave tiene un registro vigente.
+	rows, err := conn.Query(ctx, `SELECT `+idempotencyRecordColumns+` FROM idempotency_keys WHERE id = $1`, record.Key)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := pgx.CollectExactlyOneRow(rows, scanIdempotencyRecord)
+	if err != nil {
+		return nil, err
+	}
+	return &stored, ErrIdempotencyKeyInUse
+}
+
+// Complete implements IdempotencyRepository.
+func (p *postgresIdempotencyRepository) Complete(ctx context.Context, record *models.IdempotencyRecord) error {
+	var headers any
+	if len(record.Headers) > 0 {
+		headers = record.Headers
+	}
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `UPDATE idempotency_keys
+		SET completed = TRUE, status_code = $2, headers = $3, body = $4, expires_at = $5
+		WHERE id = $1 AND NOT completed`,
+		record.Key, record.StatusCode, headers, record.Body, record.ExpiresAt)
+	return err
+}
+
+// Release implements IdempotencyRepository.
+func (p *postgresIdempotencyRepository) Release(ctx context.Context, key string) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `DELETE FROM idempotency_keys WHERE id = $1 AND NOT completed`, key)
+	return err
+}
+
+func scanIdempotencyRecord(row pgx.CollectableRow) (models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	err := row.Scan(&record.Key, &record.Fingerprint, &record.Completed, &record.StatusCode, &record.Headers,
+		&record.Body, &record.CreatedAt, &record.ExpiresAt)
+	record.CreatedAt = record.CreatedAt.UTC()
+	record.ExpiresAt = record.ExpiresAt.UTC()
+	return record, err
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"users-microservice/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const loginAttemptColumns = `id, user_id, method, success, failure_reason, ip, user_agent, created_at`
+
+type postgresLoginHistoryRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresLoginHistoryRepository stores the attempts in the login_attempts
+// table created by MigratePostgres, with their timestamp in created_at.
+func NewPostgresLoginHistoryRepository(pool *pgxpool.Pool) LoginHistoryRepository {
+	return &postgresLoginHistoryRepository{
+		pool: pool,
+	}
+}
+
+// CreateAttempt implements LoginHistoryRepository.
+func (p *postgresLoginHistoryRepository) CreateAttempt(ctx context.Context, attempt *models.LoginAttempt) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO login_attempts (`+loginAttemptColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		attempt.ID, attempt.UserId, attempt.Method, attempt.Success, attempt.FailureReason, attempt.IP,
+		attempt.UserAgent, attempt.Timestamp)
+	return err
+}
+
+// ListAttempts implements LoginHistoryRepository. Attempts are returned newest first.
+func (p *postgresLoginHistoryRepository) ListAttempts(ctx context.Context, userId string, cursor string, limit int) (*LoginAttemptPage, error) {
+	limit = pageLimit(limit)
+	query := `SELECT ` + loginAttemptColumns + ` FROM login_attempts WHERE user_id = $1`
+	args := []any{userId}
+	if cursor != "" {
+		timestamp, id, err := decodeTimeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query += ` AND (created_at, id) < ($2, $3)`
+		args = append(args, timestamp, id)
+	}
+	// Se pide una fila extra para saber si existe una pagina siguiente.
+	args = append(args, limit+1)
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d`, len(args))
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := pgx.CollectRows(rows, scanLoginAttempt)
+	if err != nil {
+		return nil, err
+	}
+	page := &LoginAttemptPage{Attempts: attempts}
+	if len(attempts) > limit {
+		page.Attempts = attempts[:limit]
+		last := page.Attempts[limit-1]
+		page.NextCursor = encodeKeysetCursor(last.Timestamp.UTC().Format(time.RFC3339Nano), last.ID)
+	}
+	return page, nil
+}
+
+func scanLoginAttempt(row pgx.CollectableRow) (models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := row.Scan(&attempt.ID, &attempt.UserId, &attempt.Method, &attempt.Success, &attempt.FailureReason, &attempt.IP,
+		&attempt.UserAgent, &attempt.Timestamp)
+	attempt.Timestamp = attempt.Timestamp.UTC()
+	return attempt, err
+}
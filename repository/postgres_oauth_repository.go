@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"users-microservice/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const oauthClientColumns = `id, name, type, secret_hash, redirect_uris, scopes, audiences, created_at`
+
+const authorizationCodeColumns = `id, client_id, user_id, redirect_uri, redirect_uri_provided, scope, code_challenge,
+	code_challenge_method, nonce, auth_time, created_at, expires_at`
+
+type postgresOAuthRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresOAuthRepository stores the clients and the authorization codes
+// in the oauth_clients and oauth_codes tables created by MigratePostgres.
+func NewPostgresOAuthRepository(pool *pgxpool.Pool) OAuthRepository {
+	return &postgresOAuthRepository{
+		pool: pool,
+	}
+}
+
+// CreateClient implements OAuthRepository.
+func (p *postgresOAuthRepository) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO oauth_clients (`+oauthClientColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		client.ID, client.Name, client.Type, client.SecretHash, postgresTextArray(client.RedirectURIs),
+		postgresTextArray(client.Scopes), postgresTextArray(client.Audiences), client.CreatedAt)
+	return err
+}
+
+// FindClient implements OAuthRepository.
+func (p *postgresOAuthRepository) FindClient(ctx context.Context, clientId string) (*models.OAuthClient, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+oauthClientColumns+` FROM oauth_clients WHERE id = $1`, clientId)
+	if err != nil {
+		return nil, err
+	}
+	client, err := pgx.CollectExactlyOneRow(rows, scanOAuthClient)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// ListClients implements OAuthRepository.
+func (p *postgresOAuthRepository) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+oauthClientColumns+` FROM oauth_clients ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanOAuthClient)
+}
+
+// DeleteClient implements OAuthRepository.
+func (p *postgresOAuthRepository) DeleteClient(ctx context.Context, clientId string) error {
+	tag, err := postgresConn(ctx, p.pool).Exec(ctx, `DELETE FROM oauth_clients WHERE id = $1`, clientId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+// CreateAuthorizationCode implements OAuthRepository.
+func (p *postgresOAuthRepository) CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO oauth_codes (`+authorizationCodeColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		code.ID, code.ClientId, code.UserId, code.RedirectURI, code.RedirectURIProvided, code.Scope, code.CodeChallenge,
+		code.CodeChallengeMethod, code.Nonce, code.AuthTime, code.CreatedAt, code.ExpiresAt)
+	return err
+}
+
+// ConsumeAuthorizationCode implements OAuthRepository. DELETE ... RETURNING
+// hands the code to a single caller.
+func (p *postgresOAuthRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `DELETE FROM oauth_codes WHERE id = $1
+		RETURNING `+authorizationCodeColumns, codeHash)
+	if err != nil {
+		return nil, err
+	}
+	code, err := pgx.CollectExactlyOneRow(rows, scanAuthorizationCode)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAuthorizationCodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func scanOAuthClient(row pgx.CollectableRow) (models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := row.Scan(&client.ID, &client.Name, &client.Type, &client.SecretHash, &client.RedirectURIs, &client.Scopes,
+		&client.Audiences, &client.CreatedAt)
+	client.CreatedAt = client.CreatedAt.UTC()
+	return client, err
+}
+
+func scanAuthorizationCode(row pgx.CollectableRow) (models.AuthorizationCode, error) {
+	var code models.AuthorizationCode
+	err := row.Scan(&code.ID, &code.ClientId, &code.UserId, &code.RedirectURI, &code.RedirectURIProvided, &code.Scope,
+		&code.CodeChallenge, &code.CodeChallengeMethod, &code.Nonce, &code.AuthTime, &code.CreatedAt, &code.ExpiresAt)
+	code.AuthTime = code.AuthTime.UTC()
+	code.CreatedAt = code.CreatedAt.UTC()
+	code.ExpiresAt = code.ExpiresAt.UTC()
+	return code, err
+}
+
+type postgresDPoPProofRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresDPoPProofRepository stores the proofs in the dpop_proofs table
+// created by MigratePostgres.
+func NewPostgresDPoPProofRepository(pool *pgxpool.Pool) DPoPProofRepository {
+	return &postgresDPoPProofRepository{
+		pool: pool,
+	}
+}
+
+// SaveProof implements DPoPProofRepository. An expired proof that the cleaner
+// did not remove yet is overwritten, as the TTL index would have dropped it in
+// Mongo.
+func (p *postgresDPoPProofRepository) SaveProof(ctx context.Context, proof *models.DPoPProof) error {
+	tag, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO dpop_proofs (id, expires_at) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET expires_at = EXCLUDED.expires_at WHERE dpop_proofs.expires_at < $3`,
+		proof.ID, proof.ExpiresAt, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDPoPProofReplayed
+	}
+	return nil
+}
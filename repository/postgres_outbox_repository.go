@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"users-microservice/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const outboxEventColumns = `id, aggregate_id, type, data, created_at, published_at, attempts, last_error, next_attempt_at`
+
+type postgresOutboxRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresOutboxRepository stores the events in the outbox_events table
+// created by MigratePostgres. AppendEvent joins the transaction in ctx, so the
+// event is committed with the user row it describes.
+func NewPostgresOutboxRepository(pool *pgxpool.Pool) OutboxRepository {
+	return &postgresOutboxRepository{
+		pool: pool,
+	}
+}
+
+// AppendEvent implements OutboxRepository.
+func (p *postgresOutboxRepository) AppendEvent(ctx context.Context, event *models.OutboxEvent) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO outbox_events (`+outboxEventColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		event.ID, event.AggregateId, event.Type, event.Data, event.CreatedAt, event.PublishedAt,
+		event.Attempts, event.LastError, event.NextAttemptAt)
+	return err
+}
+
+// FindPendingEvents implements OutboxRepository. Event ids are UUIDv7, so
+// sorting by id returns the events in the order they were written.
+func (p *postgresOutboxRepository) FindPendingEvents(ctx context.Context, now time.Time, limit int) ([]models.OutboxEvent, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+outboxEventColumns+` FROM outbox_events
+		WHERE published_at IS NULL
+			AND aggregate_id NOT IN (SELECT aggregate_id FROM outbox_events WHERE next_attempt_at > $1)
+		ORDER BY id LIMIT $2`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanOutboxEvent)
+}
+
+// MarkPublished implements OutboxRepository.
+func (p *postgresOutboxRepository) MarkPublished(ctx context.Context, eventId string, publishedAt time.Time) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `UPDATE outbox_events
+		SET published_at = $2, last_error = '', next_attempt_at = NULL WHERE id = $1`, eventId, publishedAt)
+	return err
+}
+
+// MarkFailed implements OutboxRepository.
+func (p *postgresOutboxRepository) MarkFailed(ctx context.Context, eventId string, reason string, nextAttemptAt time.Time) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `UPDATE outbox_events
+		SET last_error = $2, next_attempt_at = $3, attempts = attempts + 1 WHERE id = $1`, eventId, reason, nextAttemptAt)
+	return err
+}
+
+// DeletePublishedBefore implements OutboxRepository.
+func (p *postgresOutboxRepository) DeletePublishedBefore(ctx context.Context, before time.Time, limit int) (int, error) {
+	tag, err := postgresConn(ctx, p.pool).Exec(ctx, `DELETE FROM outbox_events WHERE id IN (
+		SELECT id FROM outbox_events WHERE published_at < $1 LIMIT $2)`, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func scanOutboxEvent(row pgx.CollectableRow) (models.OutboxEvent, error) {
+	var event models.OutboxEvent
+	err := row.Scan(&event.ID, &event.AggregateId, &event.Type, &event.Data, &event.CreatedAt, &event.PublishedAt,
+		&event.Attempts, &event.LastError, &event.NextAttemptAt)
+	event.CreatedAt = event.CreatedAt.UTC()
+	if event.PublishedAt != nil {
+		publishedAt := event.PublishedAt.UTC()
+		event.PublishedAt = &publishedAt
+	}
+	if event.NextAttemptAt != nil {
+		nextAttemptAt := event.NextAttemptAt.UTC()
+		event.NextAttemptAt = &nextAttemptAt
+	}
+	return event, err
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"users-microservice/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const refreshTokenColumns = `id, user_id, jti, created_at, expiry_time, revoked, session, device_fingerprint, ip,
+	user_agent, client_id, scope, auth_time, audiences, remember_me, revoked_reason, dpop_jkt, revoked_at`
+
+type postgresRefreshTokenRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresRefreshTokenRepository stores the refresh tokens in the
+// refresh_tokens table created by MigratePostgres.
+func NewPostgresRefreshTokenRepository(pool *pgxpool.Pool) RefreshTokenRepository {
+	return &postgresRefreshTokenRepository{
+		pool: pool,
+	}
+}
+
+// CreateRefreshToken implements RefreshTokenRepository.
+func (p *postgresRefreshTokenRepository) CreateRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error {
+	var authTime *time.Time
+	if !refreshToken.AuthTime.IsZero() {
+		authTime = &refreshToken.AuthTime
+	}
+	var revokedAt *time.Time
+	if !refreshToken.RevokedAt.IsZero() {
+		revokedAt = &refreshToken.RevokedAt
+	}
+	audiences := refreshToken.Audiences
+	if audiences == nil {
+		audiences = []string{}
+	}
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO refresh_tokens (`+refreshTokenColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+		refreshToken.ID, refreshToken.UserId, refreshToken.Jti, refreshToken.IssuedAt, refreshToken.Expires,
+		refreshToken.Revoked, refreshToken.SessionVersion, refreshToken.DeviceFingerprint, refreshToken.IP,
+		refreshToken.UserAgent, refreshToken.ClientId, refreshToken.Scope, authTime, audiences,
+		refreshToken.RememberMe, refreshToken.RevokedReason, refreshToken.DPoPJkt, revokedAt)
+	return err
+}
+
+// FindRefreshTokenByHash implements RefreshTokenRepository. Refresh tokens are
+// no longer stored by hash, so no token is ever found, as with Mongo.
+func (p *postgresRefreshTokenRepository) FindRefreshTokenByHash(ctx context.Context, hashToken string) (*models.RefreshToken, error) {
+	return nil, ErrRefreshTokenNotFound
+}
+
+// FindRefreshTokenByID implements RefreshTokenRepository.
+func (p *postgresRefreshTokenRepository) FindRefreshTokenByID(ctx context.Context, jti string) (*models.RefreshToken, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE jti = $1`, jti)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := pgx.CollectExactlyOneRow(rows, scanRefreshToken)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &refreshToken, nil
+}
+
+// RevokeToken implements RefreshTokenRepository.
+func (p *postgresRefreshTokenRepository) RevokeToken(ctx context.Context, tokenId string) error {
+	result, err := postgresConn(ctx, p.pool).Exec(ctx, `UPDATE refresh_tokens SET revoked = TRUE, revoked_at = COALESCE(revoked_at, $2) WHERE jti = $1`, tokenId, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// RevokeActiveToken implements RefreshTokenRepository.
+func (p *postgresRefreshTokenRepository) RevokeActiveToken(ctx context.Context, tokenId string) error {
+	conn := postgresConn(ctx, p.pool)
+	result, err := conn.Exec(ctx, `UPDATE refresh_tokens SET revoked = TRUE, revoked_at = $2 WHERE jti = $1 AND NOT revoked`, tokenId, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 1 {
+		return nil
+	}
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM refresh_tokens WHERE jti = $1)`, tokenId).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	return ErrRefreshTokenRevoked
+}
+
+// RevokeTokenWithReason implements RefreshTokenRepository.
+func (p *postgresRefreshTokenRepository) RevokeTokenWithReason(ctx context.Context, tokenId string, reason string) error {
+	result, err := postgresConn(ctx, p.pool).Exec(ctx,
+		`UPDATE refresh_tokens SET revoked = TRUE, revoked_reason = $2, revoked_at = COALESCE(revoked_at, $3) WHERE jti = $1`,
+		tokenId, reason, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// RevokeAllTokenFromUser implements RefreshTokenRepository.
+func (p *postgresRefreshTokenRepository) RevokeAllTokenFromUser(ctx context.Context, userId string) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `UPDATE refresh_tokens SET revoked = TRUE, revoked_at = COALESCE(revoked_at, $2) WHERE user_id = $1`, userId, time.Now().UTC())
+	return err
+}
+
+// DeleteAllTokensFromUser implements RefreshTokenRepository.
+func (p *postgresRefreshTokenRepository) DeleteAllTokensFromUser(ctx context.Context, userId string) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `DELETE FROM refresh_tokens WHERE user_id = $1`, userId)
+	return err
+}
+
+// FindTokensByUser implements RefreshTokenRepository. The newest tokens come
+// first.
+func (p *postgresRefreshTokenRepository) FindTokensByUser(ctx context.Context, userId string) ([]models.RefreshToken, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx,
+		`SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE user_id = $1 ORDER BY created_at DESC, id DESC`, userId)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanRefreshToken)
+}
+
+// DeleteExpired implements RefreshTokenRepository.
+func (p *postgresRefreshTokenRepository) DeleteExpired(ctx context.Context, expiredBefore time.Time, revokedBefore time.Time, limit int) (int, error) {
+	result, err := postgresConn(ctx, p.pool).Exec(ctx, `DELETE FROM refresh_tokens WHERE id IN (
+		SELECT id FROM refresh_tokens WHERE expiry_time < $1 OR revoked_at < $2 LIMIT $3
+	)`, expiredBefore, revokedBefore, limit)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+func scanRefreshToken(row pgx.CollectableRow) (models.RefreshToken, error) {
+	var refreshToken models.RefreshToken
+	var authTime, revokedAt *time.Time
+	err := row.Scan(&refreshToken.ID, &refreshToken.UserId, &refreshToken.Jti, &refreshToken.IssuedAt,
+		&refreshToken.Expires, &refreshToken.Revoked, &refreshToken.SessionVersion, &refreshToken.DeviceFingerprint,
+		&refreshToken.IP, &refreshToken.UserAgent, &refreshToken.ClientId, &refreshToken.Scope, &authTime,
+		&refreshToken.Audiences, &refreshToken.RememberMe, &refreshToken.RevokedReason, &refreshToken.DPoPJkt,
+		&revokedAt)
+	refreshToken.IssuedAt = refreshToken.IssuedAt.UTC()
+	refreshToken.Expires = refreshToken.Expires.UTC()
+	if authTime != nil {
+		refreshToken.AuthTime = authTime.UTC()
+	}
+	if revokedAt != nil {
+		refreshToken.RevokedAt = revokedAt.UTC()
+	}
+	// Las audiencias vacias se leen como nil, como en Mongo con omitempty.
+	if len(refreshToken.Audiences) == 0 {
+		refreshToken.Audiences = nil
+	}
+	return refreshToken, err
+}
@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"users-microservice/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const userColumns = `id, name, last_name, email, password_hash, sessions, role, verified, locked,
+	created_at, deleted_at, password_reset_required, tenant_id, external_id, version`
+
+// userFieldColumns maps the bson names accepted by UpdateField to their column.
+var userFieldColumns = map[string]string{
+	"name":                    "name",
+	"last_name":               "last_name",
+	"email":                   "email",
+	"password_hash":           "password_hash",
+	"sessions":                "sessions",
+	"role":                    "role",
+	"verified":                "verified",
+	"locked":                  "locked",
+	"password_reset_required": "password_reset_required",
+	"tenant_id":               "tenant_id",
+	"external_id":             "external_id",
+}
+
+type postgresUserRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresUserRepository stores the users in the users table created by
+// MigratePostgres. The methods join the transaction of the postgres
+// TransactionManager when they receive its ctx.
+func NewPostgresUserRepository(pool *pgxpool.Pool) UserRepository {
+	return &postgresUserRepository{
+		pool: pool,
+	}
+}
+
+// CreateUser implements UserRepository.
+func (repo *postgresUserRepository) CreateUser(ctx context.Context, user *models.User) error {
+	_, err := postgresConn(ctx, repo.pool).Exec(ctx, `INSERT INTO users (`+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		user.UserId, user.Name, user.LastName, user.Email, user.PasswordHash, user.SessionVersion, user.Role,
+		user.Verified, user.Locked, user.CreatedAt, user.DeletedAt, user.PasswordResetRequired, user.TenantId, user.ExternalId,
+		user.Version)
+	if isUniqueViolation(err, "users_email_key") {
+		return ErrEmailConflict
+	}
+	return err
+}
+
+// FindUser implements UserRepository.
+func (repo *postgresUserRepository) FindUser(ctx context.Context, email string) (*models.User, error) {
+	return repo.queryUser(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`, email)
+}
+
+// FindUserByID implements UserRepository.
+func (repo *postgresUserRepository) FindUserByID(ctx context.Context, userId string) (*models.User, error) {
+	return repo.queryUser(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, userId)
+}
+
+// UpdateUser implements UserRepository. Every column but the id is replaced,
+// so user must be a complete user as returned by FindUser.
+func (repo *postgresUserRepository) UpdateUser(ctx context.Context, email string, user *models.User) (*models.User, error) {
+	updated, err := repo.queryUser(ctx, `UPDATE users SET name = $2, last_name = $3, email = $4, password_hash = $5,
+			sessions = $6, role = $7, verified = $8, locked = $9, created_at = $10, deleted_at = $11,
+			password_reset_required = $12, tenant_id = $13, external_id = $14, version = version + 1
+		WHERE email = $1 AND version = $15
+		RETURNING `+userColumns,
+		email, user.Name, user.LastName, user.Email, user.PasswordHash, user.SessionVersion, user.Role,
+		user.Verified, user.Locked, user.CreatedAt, user.DeletedAt, user.PasswordResetRequired, user.TenantId, user.ExternalId,
+		user.Version)
+	if isUniqueViolation(err, "users_email_key") {
+		return nil, ErrEmailConflict
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		// Distingue un usuario inexistente de uno modificado desde que se leyo.
+		var exists bool
+		existsErr := postgresConn(ctx, repo.pool).QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, email).Scan(&exists)
+		if existsErr != nil {
+			return nil, existsErr
+		}
+		if exists {
+			return nil, ErrVersionConflict
+		}
+	}
+	return updated, err
+}
+
+// DeleteUser implements UserRepository. The user is only marked as deleted and
+// its session version is bumped in the same statement; HardDeleteUser removes
+// the row.
+func (repo *postgresUserRepository) DeleteUser(ctx context.Context, email string) error {
+	result, err := postgresConn(ctx, repo.pool).Exec(ctx,
+		`UPDATE users SET deleted_at = $2, sessions = sessions + 1, version = version + 1 WHERE email = $1 AND deleted_at IS NULL`,
+		email, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdateField implements UserRepository. field is the bson name of the field,
+// as in the Mongo implementation; only the fields of userFieldColumns can be
+// set.
+func (repo *postgresUserRepository) UpdateField(ctx context.Context, email string, newValue interface{}, field string) (*models.User, error) {
+	column, ok := userFieldColumns[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown user field %s", field)
+	}
+	updated, err := repo.queryUser(ctx, `UPDATE users SET `+column+` = $2, version = version + 1 WHERE email = $1 RETURNING `+userColumns, email, newValue)
+	if isUniqueViolation(err, "users_email_key") {
+		return nil, ErrEmailConflict
+	}
+	return updated, err
+}
+
+// ListUsers implements UserRepository.
+func (repo *postgresUserRepository) ListUsers(ctx context.Context, filter UserListFilter) (*UserPage, error) {
+	filter.normalize()
+	var sortColumn string
+	switch filter.SortBy {
+	case SortByCreatedAt, SortByEmail, SortByName, SortByLastName:
+		sortColumn = filter.SortBy
+	default:
+		return nil, fmt.Errorf("unsupported sort field %s", filter.SortBy)
+	}
+	var conditions []string
+	var args []any
+	addCondition := func(condition string, values ...any) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if filter.OnlyDeleted {
+		addCondition("deleted_at IS NOT NULL")
+	} else {
+		addCondition("deleted_at IS NULL")
+	}
+	if filter.Search != "" {
+		prefix := likeEscaper.Replace(strings.ToLower(filter.Search)) + "%"
+		addCondition(`(lower(name COLLATE "default") LIKE ? OR lower(last_name COLLATE "default") LIKE ?
+			OR lower(email COLLATE "default") LIKE ?)`, prefix, prefix, prefix)
+	}
+	if filter.TenantId != "" {
+		addCondition("tenant_id = ?", filter.TenantId)
+	}
+	if filter.Verified != nil {
+		addCondition("verified = ?", *filter.Verified)
+	}
+	if filter.Locked != nil {
+		addCondition("locked = ?", *filter.Locked)
+	}
+	if filter.Role != "" {
+		addCondition("role = ?", filter.Role)
+	}
+	if filter.CreatedAfter != nil {
+		addCondition("created_at > ?", *filter.CreatedAfter)
+	}
+	operator, direction := ">", "ASC"
+	if filter.SortDesc {
+		operator, direction = "<", "DESC"
+	}
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		var value any = cursor.Value
+		if filter.SortBy == SortByCreatedAt {
+			parsed, err := time.Parse(time.RFC3339Nano, cursor.Value)
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			value = parsed
+		}
+		addCondition("("+sortColumn+", id) "+operator+" (?, ?)", value, cursor.Id)
+	}
+
+	// Se pide una fila extra para saber si existe una pagina siguiente.
+	args = append(args, filter.Limit+1)
+	query := fmt.Sprintf(`SELECT %s FROM users WHERE %s ORDER BY %s %s, id %s LIMIT $%d`,
+		userColumns, strings.Join(conditions, " AND "), sortColumn, direction, direction, len(args))
+	users, err := repo.queryUsers(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &UserPage{Users: users}
+	if len(users) > filter.Limit {
+		page.Users = users[:filter.Limit]
+		page.NextCursor = encodeCursor(&page.Users[filter.Limit-1], filter.SortBy)
+	}
+	return page, nil
+}
+
+// FindTenantUsers implements UserRepository.
+func (repo *postgresUserRepository) FindTenantUsers(ctx context.Context, query TenantUserQuery) (*TenantUserPage, error) {
+	where := `tenant_id = $1 AND deleted_at IS NULL AND ($2::text = '' OR email = $2) AND ($3::text = '' OR external_id = $3) AND ($4::text = '' OR id = $4)`
+	args := []any{query.TenantId, query.Email, query.ExternalId, query.UserId}
+	page := &TenantUserPage{}
+	if err := postgresConn(ctx, repo.pool).QueryRow(ctx, `SELECT count(*) FROM users WHERE `+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+	if query.Limit <= 0 || query.Offset >= page.Total {
+		return page, nil
+	}
+	users, err := repo.queryUsers(ctx, `SELECT `+userColumns+` FROM users WHERE `+where+` ORDER BY created_at, id OFFSET $5 LIMIT $6`,
+		append(args, query.Offset, query.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	page.Users = users
+	return page, nil
+}
+
+// RestoreUser implements UserRepository.
+func (repo *postgresUserRepository) RestoreUser(ctx context.Context, userId string) (*models.User, error) {
+	return repo.queryUser(ctx, `UPDATE users SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL RETURNING `+userColumns, userId)
+}
+
+// FindUsersDeletedBefore implements UserRepository.
+func (repo *postgresUserRepository) FindUsersDeletedBefore(ctx context.Context, before time.Time, limit int) ([]models.User, error) {
+	return repo.queryUsers(ctx, `SELECT `+userColumns+` FROM users WHERE deleted_at <= $1 ORDER BY deleted_at LIMIT $2`, before, limit)
+}
+
+// HardDeleteUser implements UserRepository.
+func (repo *postgresUserRepository) HardDeleteUser(ctx context.Context, userId string) error {
+	_, err := postgresConn(ctx, repo.pool).Exec(ctx, `DELETE FROM users WHERE id = $1`, userId)
+	return err
+}
+
+// ForcePasswordReset implements UserRepository. Bumping the session version
+// invalidates every refresh token issued before.
+func (repo *postgresUserRepository) ForcePasswordReset(ctx context.Context, userId string, sessionVersion int) error {
+	conn := postgresConn(ctx, repo.pool)
+	result, err := conn.Exec(ctx,
+		`UPDATE users SET password_reset_required = TRUE, sessions = sessions + 1, version = version + 1
+		WHERE id = $1 AND sessions = $2`, userId, sessionVersion)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		var exists bool
+		if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userId).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return ErrVersionConflict
+		}
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// SetPasswordHash implements UserRepository. It also clears the reset flag and
+// bumps the session version.
+func (repo *postgresUserRepository) SetPasswordHash(ctx context.Context, userId string, passwordHash string) (*models.User, error) {
+	return repo.queryUser(ctx, `UPDATE users SET password_hash = $2, password_reset_required = FALSE, sessions = sessions + 1,
+			version = version + 1
+		WHERE id = $1 RETURNING `+userColumns, userId, passwordHash)
+}
+
+func (repo *postgresUserRepository) queryUser(ctx context.Context, query string, args ...any) (*models.User, error) {
+	rows, err := postgresConn(ctx, repo.pool).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	user, err := pgx.CollectExactlyOneRow(rows, scanUser)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (repo *postgresUserRepository) queryUsers(ctx context.Context, query string, args ...any) ([]models.User, error) {
+	rows, err := postgresConn(ctx, repo.pool).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanUser)
+}
+
+func scanUser(row pgx.CollectableRow) (models.User, error) {
+	var user models.User
+	err := row.Scan(&user.UserId, &user.Name, &user.LastName, &user.Email, &user.PasswordHash, &user.SessionVersion,
+		&user.Role, &user.Verified, &user.Locked, &user.CreatedAt, &user.DeletedAt, &user.PasswordResetRequired,
+		&user.TenantId, &user.ExternalId, &user.Version)
+	// Como el driver de Mongo, las fechas se devuelven en UTC.
+	user.CreatedAt = user.CreatedAt.UTC()
+	if user.DeletedAt != nil {
+		deletedAt := user.DeletedAt.UTC()
+		user.DeletedAt = &deletedAt
+	}
+	return user, err
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"users-microservice/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const webhookSubscriptionColumns = `id, url, event_types, secret, active, created_at`
+
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_status_code, last_error, created_at, delivered_at, expires_at`
+
+type postgresWebhookRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresWebhookRepository stores the subscriptions and their deliveries
+// in the webhook_subscriptions and webhook_deliveries tables created by
+// MigratePostgres.
+func NewPostgresWebhookRepository(pool *pgxpool.Pool) WebhookRepository {
+	return &postgresWebhookRepository{
+		pool: pool,
+	}
+}
+
+// CreateSubscription implements WebhookRepository.
+func (p *postgresWebhookRepository) CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO webhook_subscriptions (`+webhookSubscriptionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		subscription.ID, subscription.URL, postgresTextArray(subscription.EventTypes), subscription.Secret, subscription.Active, subscription.CreatedAt)
+	return err
+}
+
+// FindSubscription implements WebhookRepository.
+func (p *postgresWebhookRepository) FindSubscription(ctx context.Context, subscriptionId string) (*models.WebhookSubscription, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions
+		WHERE id = $1`, subscriptionId)
+	if err != nil {
+		return nil, err
+	}
+	subscription, err := pgx.CollectExactlyOneRow(rows, scanWebhookSubscription)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// ListSubscriptions implements WebhookRepository.
+func (p *postgresWebhookRepository) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions
+		ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanWebhookSubscription)
+}
+
+// FindSubscriptionsForEvent implements WebhookRepository.
+func (p *postgresWebhookRepository) FindSubscriptionsForEvent(ctx context.Context, eventType string) ([]models.WebhookSubscription, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions
+		WHERE active AND ($1 = ANY(event_types) OR cardinality(event_types) = 0)
+		ORDER BY created_at`, eventType)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanWebhookSubscription)
+}
+
+// DeleteSubscription implements WebhookRepository. The delivery log of the
+// subscription is kept until it expires.
+func (p *postgresWebhookRepository) DeleteSubscription(ctx context.Context, subscriptionId string) error {
+	tag, err := postgresConn(ctx, p.pool).Exec(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, subscriptionId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// CreateDelivery implements WebhookRepository.
+func (p *postgresWebhookRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	_, err := postgresConn(ctx, p.pool).Exec(ctx, `INSERT INTO webhook_deliveries (`+webhookDeliveryColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		delivery.ID, delivery.SubscriptionId, delivery.EventId, delivery.EventType, delivery.Payload, delivery.Status,
+		delivery.Attempts, delivery.NextAttemptAt, delivery.LastStatusCode, delivery.LastError, delivery.CreatedAt,
+		delivery.DeliveredAt, delivery.ExpiresAt)
+	if isUniqueViolation(err, "webhook_deliveries_pkey") {
+		return ErrWebhookDeliveryExists
+	}
+	return err
+}
+
+// FindDelivery implements WebhookRepository.
+func (p *postgresWebhookRepository) FindDelivery(ctx context.Context, deliveryId string) (*models.WebhookDelivery, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+		WHERE id = $1`, deliveryId)
+	return collectWebhookDelivery(rows, err)
+}
+
+// ClaimDueDelivery implements WebhookRepository. Like the Mongo version it
+// returns the delivery as it was before its lease was taken, and SKIP LOCKED
+// lets several workers claim different deliveries at the same time.
+func (p *postgresWebhookRepository) ClaimDueDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error) {
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, `WITH due AS (
+			SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_at <= $2
+			ORDER BY next_attempt_at LIMIT 1 FOR UPDATE SKIP LOCKED)
+		UPDATE webhook_deliveries AS delivery SET next_attempt_at = $3 FROM due
+		WHERE delivery.id = due.id
+		RETURNING due.*`, models.WebhookDeliveryPending, now, now.Add(lease))
+	return collectWebhookDelivery(rows, err)
+}
+
+// UpdateDelivery implements WebhookRepository.
+func (p *postgresWebhookRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	tag, err := postgresConn(ctx, p.pool).Exec(ctx, `UPDATE webhook_deliveries
+		SET subscription_id = $2, event_id = $3, event_type = $4, payload = $5, status = $6, attempts = $7,
+			next_attempt_at = $8, last_status_code = $9, last_error = $10, created_at = $11, delivered_at = $12,
+			expires_at = $13
+		WHERE id = $1`,
+		delivery.ID, delivery.SubscriptionId, delivery.EventId, delivery.EventType, delivery.Payload, delivery.Status,
+		delivery.Attempts, delivery.NextAttemptAt, delivery.LastStatusCode, delivery.LastError, delivery.CreatedAt,
+		delivery.DeliveredAt, delivery.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
+
+// ListDeliveries implements WebhookRepository. Deliveries are returned newest first.
+func (p *postgresWebhookRepository) ListDeliveries(ctx context.Context, filter WebhookDeliveryFilter) (*WebhookDeliveryPage, error) {
+	limit := pageLimit(filter.Limit)
+	conditions := []string{"subscription_id = $1"}
+	args := []any{filter.SubscriptionId}
+	addCondition := func(condition string, values ...any) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+	if filter.Status != "" {
+		addCondition("status = ?", filter.Status)
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeTimeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		addCondition("(created_at, id) < (?, ?)", createdAt, id)
+	}
+	// Se pide una fila extra para saber si existe una pagina siguiente.
+	args = append(args, limit+1)
+	query := fmt.Sprintf(`SELECT %s FROM webhook_deliveries WHERE %s ORDER BY created_at DESC, id DESC LIMIT $%d`,
+		webhookDeliveryColumns, strings.Join(conditions, " AND "), len(args))
+	rows, err := postgresConn(ctx, p.pool).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := pgx.CollectRows(rows, scanWebhookDelivery)
+	if err != nil {
+		return nil, err
+	}
+	page := &WebhookDeliveryPage{Deliveries: deliveries}
+	if len(deliveries) > limit {
+		page.Deliveries = deliveries[:limit]
+		last := page.Deliveries[limit-1]
+		page.NextCursor = encodeKeysetCursor(last.CreatedAt.UTC().Format(time.RFC3339Nano), last.ID)
+	}
+	return page, nil
+}
+
+func collectWebhookDelivery(rows pgx.Rows, err error) (*models.WebhookDelivery, error) {
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := pgx.CollectExactlyOneRow(rows, scanWebhookDelivery)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func scanWebhookSubscription(row pgx.CollectableRow) (models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	err := row.Scan(&subscription.ID, &subscription.URL, &subscription.EventTypes, &subscription.Secret,
+		&subscription.Active, &subscription.CreatedAt)
+	subscription.CreatedAt = subscription.CreatedAt.UTC()
+	return subscription, err
+}
+
+func scanWebhookDelivery(row pgx.CollectableRow) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := row.Scan(&delivery.ID, &delivery.SubscriptionId, &delivery.EventId, &delivery.EventType, &delivery.Payload,
+		&delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastStatusCode, &delivery.LastError,
+		&delivery.CreatedAt, &delivery.DeliveredAt, &delivery.ExpiresAt)
+	delivery.NextAttemptAt = delivery.NextAttemptAt.UTC()
+	delivery.CreatedAt = delivery.CreatedAt.UTC()
+	delivery.DeliveredAt = utcTime(delivery.DeliveredAt)
+	delivery.ExpiresAt = utcTime(delivery.ExpiresAt)
+	return delivery, err
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 	"users-microservice/models"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -9,12 +11,25 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+var ErrRefreshTokenRevoked = errors.New("refresh token already revoked")
+
 type RefreshTokenRepository interface {
 	CreateRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error
 	FindRefreshTokenByHash(ctx context.Context, hashToken string) (*models.RefreshToken, error)
 	FindRefreshTokenByID(ctx context.Context, tokenID string) (*models.RefreshToken, error)
 	RevokeToken(ctx context.Context, tokenId string) error
+	// RevokeActiveToken revokes the token only if it is not revoked yet, and
+	// returns ErrRefreshTokenRevoked otherwise: of several concurrent rotations
+	// of the same token only one succeeds.
+	RevokeActiveToken(ctx context.Context, tokenId string) error
+	RevokeTokenWithReason(ctx context.Context, tokenId string, reason string) error
 	RevokeAllTokenFromUser(ctx context.Context, userId string) error
+	DeleteAllTokensFromUser(ctx context.Context, userId string) error
+	FindTokensByUser(ctx context.Context, userId string) ([]models.RefreshToken, error)
+	// DeleteExpired deletes up to limit tokens that expired before expiredBefore
+	// or were revoked before revokedBefore, and returns how many it deleted.
+	DeleteExpired(ctx context.Context, expiredBefore time.Time, revokedBefore time.Time, limit int) (int, error)
 }
 
 type mongoRefreshTokenRepository struct {
@@ -27,6 +42,9 @@ func (m *mongoRefreshTokenRepository) FindRefreshTokenByID(ctx context.Context,
 	filter := bson.M{"jti": jti}
 	err := m.collection.FindOne(ctx, filter).Decode(&refreshToken)
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrRefreshTokenNotFound
+		}
 		return nil, err
 	}
 	return &refreshToken, nil
@@ -39,6 +57,9 @@ func (m *mongoRefreshTokenRepository) RevokeAllTokenFromUser(ctx context.Context
 		"$set": bson.M{
 			"revoked": true,
 		},
+		"$min": bson.M{
+			"revoked_at": time.Now().UTC(),
+		},
 	}
 	_, err := m.collection.UpdateMany(ctx, filter, update)
 	if err != nil {
@@ -69,6 +90,9 @@ func (m *mongoRefreshTokenRepository) FindRefreshTokenByHash(ctx context.Context
 	filter := bson.M{"token": hashToken}
 	err := m.collection.FindOne(ctx, filter).Decode(&refreshToken)
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrRefreshTokenNotFound
+		}
 		return nil, err
 	}
 	return &refreshToken, nil
@@ -82,6 +106,9 @@ func (m *mongoRefreshTokenRepository) RevokeToken(ctx context.Context, tokenId s
 		"$set": bson.M{
 			"revoked": true,
 		},
+		"$min": bson.M{
+			"revoked_at": time.Now().UTC(),
+		},
 	}
 	config := options.FindOneAndUpdate().SetReturnDocument(options.After)
 	err := m.collection.FindOneAndUpdate(ctx, filter, update, config).Decode(&refreshToken)
@@ -93,3 +120,99 @@ func (m *mongoRefreshTokenRepository) RevokeToken(ctx context.Context, tokenId s
 	}
 	return nil
 }
+
+// RevokeActiveToken implements RefreshTokenRepository.
+func (m *mongoRefreshTokenRepository) RevokeActiveToken(ctx context.Context, tokenId string) error {
+	filter := bson.M{"jti": tokenId, "revoked": false}
+	update := bson.M{"$set": bson.M{"revoked": true, "revoked_at": time.Now().UTC()}}
+	result, err := m.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 1 {
+		return nil
+	}
+	count, err := m.collection.CountDocuments(ctx, bson.M{"jti": tokenId})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+	return ErrRefreshTokenRevoked
+}
+
+// RevokeTokenWithReason implements RefreshTokenRepository.
+func (m *mongoRefreshTokenRepository) RevokeTokenWithReason(ctx context.Context, tokenId string, reason string) error {
+	filter := bson.M{"jti": tokenId}
+	update := bson.M{
+		"$set": bson.M{
+			"revoked":        true,
+			"revoked_reason": reason,
+		},
+		"$min": bson.M{
+			"revoked_at": time.Now().UTC(),
+		},
+	}
+	result, err := m.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteAllTokensFromUser implements RefreshTokenRepository.
+func (m *mongoRefreshTokenRepository) DeleteAllTokensFromUser(ctx context.Context, userId string) error {
+	_, err := m.collection.DeleteMany(ctx, bson.M{"user_id": userId})
+	return err
+}
+
+// FindTokensByUser implements RefreshTokenRepository. The newest tokens come
+// first.
+func (m *mongoRefreshTokenRepository) FindTokensByUser(ctx context.Context, userId string) ([]models.RefreshToken, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := m.collection.Find(ctx, bson.M{"user_id": userId}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var refreshTokens []models.RefreshToken
+	if err := cursor.All(ctx, &refreshTokens); err != nil {
+		return nil, err
+	}
+	return refreshTokens, nil
+}
+
+// DeleteExpired implements RefreshTokenRepository. Only revoked tokens have a
+// revoked_at, so the filter does not need to check revoked.
+func (m *mongoRefreshTokenRepository) DeleteExpired(ctx context.Context, expiredBefore time.Time, revokedBefore time.Time, limit int) (int, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"expiry_time": bson.M{"$lt": expiredBefore}},
+		bson.M{"revoked_at": bson.M{"$lt": revokedBefore}},
+	}}
+	findOptions := options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(int64(limit))
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return 0, err
+	}
+	var expired []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &expired); err != nil {
+		return 0, err
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	ids := make(bson.A, 0, len(expired))
+	for _, refreshToken := range expired {
+		ids = append(ids, refreshToken.ID)
+	}
+	result, err := m.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
@@ -0,0 +1,277 @@
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+// AuditRepositoryFactory returns an empty repository. It is called once per
+// test.
+type AuditRepositoryFactory func(t *testing.T) repository.AuditRepository
+
+// RunAuditRepositoryTests runs the AuditRepository suite against the
+// repositories returned by newRepository.
+func RunAuditRepositoryTests(t *testing.T, newRepository AuditRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.AuditRepository)
+	}{
+		{"CreateAndList", testCreateAndListAuditEvents},
+		{"Filters", testListAuditEventsFilters},
+		{"Pagination", testListAuditEventsPagination},
+		{"Sequence", testAuditEventSequence},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+func createAuditEvent(t *testing.T, repo repository.AuditRepository, event models.AuditEvent) models.AuditEvent {
+	t.Helper()
+	if err := repo.CreateEvent(context.Background(), &event); err != nil {
+		t.Fatalf("CreateEvent(%s): %v", event.ID, err)
+	}
+	return event
+}
+
+func listAuditEventIds(t *testing.T, repo repository.AuditRepository, filter repository.AuditEventFilter) ([]string, string) {
+	t.Helper()
+	page, err := repo.ListEvents(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("ListEvents(%+v): %v", filter, err)
+	}
+	var ids []string
+	for _, event := range page.Events {
+		ids = append(ids, event.ID)
+	}
+	return ids, page.NextCursor
+}
+
+func testCreateAndListAuditEvents(t *testing.T, repo repository.AuditRepository) {
+	full := createAuditEvent(t, repo, models.AuditEvent{
+		ID:        "event-1",
+		Sequence:  1,
+		Type:      models.AuditUserLogin,
+		ActorId:   "user-1",
+		TargetId:  "user-2",
+		IP:        "10.0.0.1",
+		UserAgent: "curl/8",
+		Timestamp: baseTime,
+		Outcome:   models.AuditOutcomeSuccess,
+		Details:   map[string]string{"method": "password"},
+		PrevHash:  "prev",
+		Hash:      "hash",
+	})
+	minimal := createAuditEvent(t, repo, models.AuditEvent{
+		ID:        "event-2",
+		Type:      models.AuditPasswordReset,
+		Timestamp: baseTime.Add(time.Minute),
+		Outcome:   models.AuditOutcomeFailure,
+	})
+
+	page, err := repo.ListEvents(context.Background(), repository.AuditEventFilter{})
+	if err != nil {
+		t.Fatalf("ListEvents: %v", err)
+	}
+	if len(page.Events) != 2 || page.NextCursor != "" {
+		t.Fatalf("ListEvents = %+v, want both events and no cursor", page)
+	}
+	// Los mas recientes primero.
+	for i, want := range []models.AuditEvent{minimal, full} {
+		got := page.Events[i]
+		if got.ID != want.ID || got.Sequence != want.Sequence || got.Type != want.Type || got.ActorId != want.ActorId ||
+			got.TargetId != want.TargetId || got.IP != want.IP || got.UserAgent != want.UserAgent ||
+			!got.Timestamp.Equal(want.Timestamp) || got.Outcome != want.Outcome || !maps.Equal(got.Details, want.Details) ||
+			got.PrevHash != want.PrevHash || got.Hash != want.Hash {
+			t.Fatalf("event %d = %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func testListAuditEventsFilters(t *testing.T, repo repository.AuditRepository) {
+	createAuditEvent(t, repo, models.AuditEvent{ID: "event-1", Type: models.AuditUserLogin, ActorId: "user-1",
+		Timestamp: baseTime, Outcome: models.AuditOutcomeSuccess})
+	createAuditEvent(t, repo, models.AuditEvent{ID: "event-2", Type: models.AuditPasswordReset, ActorId: "user-1",
+		Timestamp: baseTime.Add(time.Hour), Outcome: models.AuditOutcomeFailure})
+	createAuditEvent(t, repo, models.AuditEvent{ID: "event-3", Type: models.AuditUserLogin, ActorId: "admin",
+		TargetId: "user-1", Timestamp: baseTime.Add(2 * time.Hour), Outcome: models.AuditOutcomeSuccess})
+
+	from, to := baseTime.Add(time.Hour), baseTime.Add(2*time.Hour)
+	tests := []struct {
+		filter repository.AuditEventFilter
+		want   []string
+	}{
+		{repository.AuditEventFilter{ActorId: "user-1"}, []string{"event-2", "event-1"}},
+		{repository.AuditEventFilter{TargetId: "user-1"}, []string{"event-3"}},
+		{repository.AuditEventFilter{SubjectId: "user-1"}, []string{"event-3", "event-2", "event-1"}},
+		{repository.AuditEventFilter{Type: models.AuditUserLogin}, []string{"event-3", "event-1"}},
+		{repository.AuditEventFilter{Outcome: models.AuditOutcomeFailure}, []string{"event-2"}},
+		// From es inclusivo y To exclusivo.
+		{repository.AuditEventFilter{From: &from, To: &to}, []string{"event-2"}},
+	}
+	for _, test := range tests {
+		if got, _ := listAuditEventIds(t, repo, test.filter); !slices.Equal(got, test.want) {
+			t.Fatalf("ListEvents(%+v) = %v, want %v", test.filter, got, test.want)
+		}
+	}
+}
+
+func testListAuditEventsPagination(t *testing.T, repo repository.AuditRepository) {
+	// Dos eventos comparten fecha: el id decide el orden.
+	for _, event := range []models.AuditEvent{
+		{ID: "event-1", Timestamp: baseTime},
+		{ID: "event-2", Timestamp: baseTime.Add(time.Minute)},
+		{ID: "event-3", Timestamp: baseTime.Add(time.Minute)},
+		{ID: "event-4", Timestamp: baseTime.Add(2 * time.Minute)},
+	} {
+		event.Type, event.Outcome = models.AuditUserLogin, models.AuditOutcomeSuccess
+		createAuditEvent(t, repo, event)
+	}
+	var got []string
+	cursor := ""
+	for range 3 {
+		ids, next := listAuditEventIds(t, repo, repository.AuditEventFilter{Cursor: cursor, Limit: 2})
+		got = append(got, ids...)
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	if want := []string{"event-4", "event-3", "event-2", "event-1"}; !slices.Equal(got, want) || cursor != "" {
+		t.Fatalf("pages = %v (cursor %q), want %v", got, cursor, want)
+	}
+	if _, err := repo.ListEvents(context.Background(), repository.AuditEventFilter{Cursor: "not-a-cursor"}); !errors.Is(err, repository.ErrInvalidCursor) {
+		t.Fatalf("ListEvents with a bad cursor: error = %v, want %v", err, repository.ErrInvalidCursor)
+	}
+}
+
+func testAuditEventSequence(t *testing.T, repo repository.AuditRepository) {
+	ctx := context.Background()
+	if _, err := repo.LastEvent(ctx); !errors.Is(err, repository.ErrAuditEventNotFound) {
+		t.Fatalf("LastEvent on an empty log: error = %v, want %v", err, repository.ErrAuditEventNotFound)
+	}
+	for i, sequence := range []int64{1, 2, 0, 3, 0} {
+		createAuditEvent(t, repo, models.AuditEvent{
+			ID:        fmt.Sprintf("event-%d", i+1),
+			Sequence:  sequence,
+			Type:      models.AuditUserLogin,
+			Timestamp: baseTime.Add(time.Duration(i) * time.Minute),
+			Outcome:   models.AuditOutcomeSuccess,
+		})
+	}
+	taken := models.AuditEvent{ID: "event-6", Sequence: 2, Type: models.AuditUserLogin, Timestamp: baseTime,
+		Outcome: models.AuditOutcomeSuccess}
+	if err := repo.CreateEvent(ctx, &taken); !errors.Is(err, repository.ErrAuditSequenceTaken) {
+		t.Fatalf("CreateEvent with a taken sequence: error = %v, want %v", err, repository.ErrAuditSequenceTaken)
+	}
+
+	// Los eventos sin secuencia no forman parte de la cadena.
+	last, err := repo.LastEvent(ctx)
+	if err != nil || last.Sequence != 3 || last.ID != "event-4" {
+		t.Fatalf("LastEvent = %+v, %v; want event-4 with sequence 3", last, err)
+	}
+	events, err := repo.ListEventsAfterSequence(ctx, 1, 10)
+	if err != nil {
+		t.Fatalf("ListEventsAfterSequence: %v", err)
+	}
+	var sequences []int64
+	for _, event := range events {
+		sequences = append(sequences, event.Sequence)
+	}
+	if !slices.Equal(sequences, []int64{2, 3}) {
+		t.Fatalf("ListEventsAfterSequence(1) = %v, want [2 3]", sequences)
+	}
+	if events, err := repo.ListEventsAfterSequence(ctx, 0, 1); err != nil || len(events) != 1 || events[0].Sequence != 1 {
+		t.Fatalf("ListEventsAfterSequence(0, 1) = %+v, %v; want the first event", events, err)
+	}
+}
+
+// LoginHistoryRepositoryFactory returns an empty repository. It is called
+// once per test.
+type LoginHistoryRepositoryFactory func(t *testing.T) repository.LoginHistoryRepository
+
+// RunLoginHistoryRepositoryTests runs the LoginHistoryRepository suite
+// against the repositories returned by newRepository.
+func RunLoginHistoryRepositoryTests(t *testing.T, newRepository LoginHistoryRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.LoginHistoryRepository)
+	}{
+		{"CreateAndList", testCreateAndListLoginAttempts},
+		{"Pagination", testListLoginAttemptsPagination},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+func testCreateAndListLoginAttempts(t *testing.T, repo repository.LoginHistoryRepository) {
+	ctx := context.Background()
+	attempts := []models.LoginAttempt{
+		{ID: "attempt-1", UserId: "user-1", Method: models.LoginMethodPassword, Success: false,
+			FailureReason: "invalid_password", IP: "10.0.0.1", UserAgent: "curl/8", Timestamp: baseTime},
+		{ID: "attempt-2", UserId: "user-1", Method: models.LoginMethodRefresh, Success: true,
+			Timestamp: baseTime.Add(time.Minute)},
+		{ID: "attempt-3", UserId: "user-2", Method: models.LoginMethodPassword, Success: true, Timestamp: baseTime},
+	}
+	for _, attempt := range attempts {
+		if err := repo.CreateAttempt(ctx, &attempt); err != nil {
+			t.Fatalf("CreateAttempt(%s): %v", attempt.ID, err)
+		}
+	}
+	page, err := repo.ListAttempts(ctx, "user-1", "", 10)
+	if err != nil {
+		t.Fatalf("ListAttempts: %v", err)
+	}
+	if len(page.Attempts) != 2 || page.NextCursor != "" {
+		t.Fatalf("ListAttempts = %+v, want the 2 attempts of user-1", page)
+	}
+	for i, want := range []models.LoginAttempt{attempts[1], attempts[0]} {
+		got := page.Attempts[i]
+		if got.ID != want.ID || got.UserId != want.UserId || got.Method != want.Method || got.Success != want.Success ||
+			got.FailureReason != want.FailureReason || got.IP != want.IP || got.UserAgent != want.UserAgent ||
+			!got.Timestamp.Equal(want.Timestamp) {
+			t.Fatalf("attempt %d = %+v, want %+v", i, got, want)
+		}
+	}
+	if page, err := repo.ListAttempts(ctx, "user-3", "", 10); err != nil || len(page.Attempts) != 0 {
+		t.Fatalf("ListAttempts of a user without attempts = %+v, %v", page, err)
+	}
+}
+
+func testListLoginAttemptsPagination(t *testing.T, repo repository.LoginHistoryRepository) {
+	ctx := context.Background()
+	for i, id := range []string{"attempt-1", "attempt-2", "attempt-3"} {
+		// attempt-2 y attempt-3 comparten fecha: el id decide el orden.
+		attempt := models.LoginAttempt{ID: id, UserId: "user-1", Method: models.LoginMethodPassword, Success: true,
+			Timestamp: baseTime.Add(time.Duration(min(i, 1)) * time.Minute)}
+		if err := repo.CreateAttempt(ctx, &attempt); err != nil {
+			t.Fatalf("CreateAttempt: %v", err)
+		}
+	}
+	first, err := repo.ListAttempts(ctx, "user-1", "", 2)
+	if err != nil || len(first.Attempts) != 2 || first.NextCursor == "" {
+		t.Fatalf("first page = %+v, %v", first, err)
+	}
+	second, err := repo.ListAttempts(ctx, "user-1", first.NextCursor, 2)
+	if err != nil || len(second.Attempts) != 1 || second.NextCursor != "" {
+		t.Fatalf("second page = %+v, %v", second, err)
+	}
+	got := []string{first.Attempts[0].ID, first.Attempts[1].ID, second.Attempts[0].ID}
+	if want := []string{"attempt-3", "attempt-2", "attempt-1"}; !slices.Equal(got, want) {
+		t.Fatalf("pages = %v, want %v", got, want)
+	}
+	if _, err := repo.ListAttempts(ctx, "user-1", "not-a-cursor", 2); !errors.Is(err, repository.ErrInvalidCursor) {
+		t.Fatalf("ListAttempts with a bad cursor: error = %v, want %v", err, repository.ErrInvalidCursor)
+	}
+}
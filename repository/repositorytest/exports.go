@@ -0,0 +1,220 @@
+package repositorytest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+// ExportJobRepositoryFactory returns an empty repository. It is called once
+// per test.
+type ExportJobRepositoryFactory func(t *testing.T) repository.ExportJobRepository
+
+// RunExportJobRepositoryTests runs the ExportJobRepository suite against the
+// repositories returned by newRepository.
+func RunExportJobRepositoryTests(t *testing.T, newRepository ExportJobRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.ExportJobRepository)
+	}{
+		{"CreateAndFind", testCreateAndFindExportJob},
+		{"ClaimOldestFirst", testClaimPendingExportJobs},
+		{"ReclaimExpiredLease", testReclaimExportJob},
+		{"UpdateRequiresTheClaim", testUpdateExportJob},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+func newExportJob(id string, createdAt time.Time) *models.ExportJob {
+	return &models.ExportJob{
+		ID:        id,
+		UserId:    "user-1",
+		Format:    "json",
+		Status:    models.ExportJobPending,
+		CreatedAt: createdAt,
+		ExpiresAt: createdAt.Add(24 * time.Hour),
+	}
+}
+
+func createExportJob(t *testing.T, repo repository.ExportJobRepository, job *models.ExportJob) {
+	t.Helper()
+	if err := repo.CreateJob(context.Background(), job); err != nil {
+		t.Fatalf("CreateJob(%s): %v", job.ID, err)
+	}
+}
+
+func claimExportJob(t *testing.T, repo repository.ExportJobRepository, now time.Time) *models.ExportJob {
+	t.Helper()
+	job, err := repo.ClaimPendingJob(context.Background(), now, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimPendingJob: %v", err)
+	}
+	return job
+}
+
+func testCreateAndFindExportJob(t *testing.T, repo repository.ExportJobRepository) {
+	ctx := context.Background()
+	leaseExpiresAt, completedAt := baseTime.Add(time.Minute), baseTime.Add(2*time.Minute)
+	full := newExportJob("job-1", baseTime)
+	full.Status = models.ExportJobCompleted
+	full.Error = "none"
+	full.ArchiveId = "archive-1"
+	full.Attempts = 2
+	full.ClaimId = "claim-1"
+	full.LeaseExpiresAt = &leaseExpiresAt
+	full.CompletedAt = &completedAt
+	createExportJob(t, repo, full)
+	minimal := newExportJob("job-2", baseTime)
+	createExportJob(t, repo, minimal)
+
+	for _, want := range []*models.ExportJob{full, minimal} {
+		got, err := repo.FindJob(ctx, want.ID)
+		if err != nil {
+			t.Fatalf("FindJob(%s): %v", want.ID, err)
+		}
+		if got.ID != want.ID || got.UserId != want.UserId || got.Format != want.Format || got.Status != want.Status ||
+			got.Error != want.Error || got.ArchiveId != want.ArchiveId || got.Attempts != want.Attempts ||
+			got.ClaimId != want.ClaimId || !equalTimes(got.LeaseExpiresAt, want.LeaseExpiresAt) ||
+			!got.CreatedAt.Equal(want.CreatedAt) || !equalTimes(got.CompletedAt, want.CompletedAt) ||
+			!got.ExpiresAt.Equal(want.ExpiresAt) {
+			t.Fatalf("FindJob(%s) = %+v, want %+v", want.ID, got, want)
+		}
+	}
+	if _, err := repo.FindJob(ctx, "missing"); !errors.Is(err, repository.ErrExportJobNotFound) {
+		t.Fatalf("FindJob of a missing job: error = %v, want %v", err, repository.ErrExportJobNotFound)
+	}
+}
+
+func testClaimPendingExportJobs(t *testing.T, repo repository.ExportJobRepository) {
+	createExportJob(t, repo, newExportJob("job-2", baseTime.Add(time.Minute)))
+	createExportJob(t, repo, newExportJob("job-1", baseTime))
+	done := newExportJob("job-0", baseTime.Add(-time.Minute))
+	done.Status = models.ExportJobCompleted
+	createExportJob(t, repo, done)
+
+	first := claimExportJob(t, repo, baseTime)
+	if first.ID != "job-1" || first.Status != models.ExportJobRunning || first.Attempts != 1 || first.ClaimId == "" ||
+		first.LeaseExpiresAt == nil || !first.LeaseExpiresAt.Equal(baseTime.Add(time.Minute)) {
+		t.Fatalf("first claim = %+v, want job-1 running with a lease", first)
+	}
+	if second := claimExportJob(t, repo, baseTime); second.ID != "job-2" {
+		t.Fatalf("second claim = %+v, want job-2", second)
+	}
+	if job, err := repo.ClaimPendingJob(context.Background(), baseTime, time.Minute); !errors.Is(err, repository.ErrExportJobNotFound) {
+		t.Fatalf("ClaimPendingJob with every job claimed = %+v, %v; want %v", job, err, repository.ErrExportJobNotFound)
+	}
+}
+
+func testReclaimExportJob(t *testing.T, repo repository.ExportJobRepository) {
+	createExportJob(t, repo, newExportJob("job-1", baseTime))
+	first := claimExportJob(t, repo, baseTime)
+	if _, err := repo.ClaimPendingJob(context.Background(), baseTime.Add(59*time.Second), time.Minute); !errors.Is(err, repository.ErrExportJobNotFound) {
+		t.Fatalf("ClaimPendingJob before the lease expired: error = %v, want %v", err, repository.ErrExportJobNotFound)
+	}
+	// El worker que lo tenia murio: al vencer el lease otro lo reclama.
+	second := claimExportJob(t, repo, baseTime.Add(time.Minute))
+	if second.ID != first.ID || second.Attempts != 2 || second.ClaimId == first.ClaimId {
+		t.Fatalf("reclaimed job = %+v, want job-1 with a new claim", second)
+	}
+	first.Status = models.ExportJobCompleted
+	if err := repo.UpdateJob(context.Background(), first); !errors.Is(err, repository.ErrExportJobNotFound) {
+		t.Fatalf("UpdateJob with the old claim: error = %v, want %v", err, repository.ErrExportJobNotFound)
+	}
+}
+
+func testUpdateExportJob(t *testing.T, repo repository.ExportJobRepository) {
+	ctx := context.Background()
+	createExportJob(t, repo, newExportJob("job-1", baseTime))
+	job := claimExportJob(t, repo, baseTime)
+	completedAt := baseTime.Add(time.Second)
+	job.Status = models.ExportJobCompleted
+	job.ArchiveId = "archive-1"
+	job.CompletedAt = &completedAt
+	if err := repo.UpdateJob(ctx, job); err != nil {
+		t.Fatalf("UpdateJob: %v", err)
+	}
+	stored, err := repo.FindJob(ctx, job.ID)
+	if err != nil || stored.Status != models.ExportJobCompleted || stored.ArchiveId != "archive-1" ||
+		!equalTimes(stored.CompletedAt, &completedAt) || stored.ClaimId != job.ClaimId {
+		t.Fatalf("FindJob after UpdateJob = %+v, %v", stored, err)
+	}
+	// Un job terminado no se vuelve a reclamar aunque venza su lease.
+	if _, err := repo.ClaimPendingJob(ctx, baseTime.Add(time.Hour), time.Minute); !errors.Is(err, repository.ErrExportJobNotFound) {
+		t.Fatalf("ClaimPendingJob after the job completed: error = %v, want %v", err, repository.ErrExportJobNotFound)
+	}
+	missing := newExportJob("missing", baseTime)
+	if err := repo.UpdateJob(ctx, missing); !errors.Is(err, repository.ErrExportJobNotFound) {
+		t.Fatalf("UpdateJob of a missing job: error = %v, want %v", err, repository.ErrExportJobNotFound)
+	}
+}
+
+// ExportArchiveRepositoryFactory returns an empty repository. It is called
+// once per test.
+type ExportArchiveRepositoryFactory func(t *testing.T) repository.ExportArchiveRepository
+
+// RunExportArchiveRepositoryTests runs the ExportArchiveRepository suite
+// against the repositories returned by newRepository.
+func RunExportArchiveRepositoryTests(t *testing.T, newRepository ExportArchiveRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.ExportArchiveRepository)
+	}{
+		{"SaveLoadAndDelete", testSaveLoadAndDeleteExportArchive},
+		{"DeleteExpired", testDeleteExpiredExportArchives},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+func testSaveLoadAndDeleteExportArchive(t *testing.T, repo repository.ExportArchiveRepository) {
+	ctx := context.Background()
+	// Mas grande que un chunk de GridFS.
+	data := bytes.Repeat([]byte("export;"), 64*1024)
+	if err := repo.SaveArchive(ctx, "archive-1", data, baseTime); err != nil {
+		t.Fatalf("SaveArchive: %v", err)
+	}
+	loaded, err := repo.LoadArchive(ctx, "archive-1")
+	if err != nil || !bytes.Equal(loaded, data) {
+		t.Fatalf("LoadArchive = %d bytes, %v; want the %d saved", len(loaded), err, len(data))
+	}
+	if err := repo.DeleteArchive(ctx, "archive-1"); err != nil {
+		t.Fatalf("DeleteArchive: %v", err)
+	}
+	if _, err := repo.LoadArchive(ctx, "archive-1"); !errors.Is(err, repository.ErrExportArchiveNotFound) {
+		t.Fatalf("LoadArchive after DeleteArchive: error = %v, want %v", err, repository.ErrExportArchiveNotFound)
+	}
+	if err := repo.DeleteArchive(ctx, "archive-1"); !errors.Is(err, repository.ErrExportArchiveNotFound) {
+		t.Fatalf("DeleteArchive twice: error = %v, want %v", err, repository.ErrExportArchiveNotFound)
+	}
+}
+
+func testDeleteExpiredExportArchives(t *testing.T, repo repository.ExportArchiveRepository) {
+	ctx := context.Background()
+	for i, id := range []string{"archive-1", "archive-2", "archive-3"} {
+		if err := repo.SaveArchive(ctx, id, []byte(id), baseTime.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("SaveArchive: %v", err)
+		}
+	}
+	// Caduca justo al llegar expiresAt.
+	deleted, err := repo.DeleteExpiredArchives(ctx, baseTime.Add(time.Hour))
+	if err != nil || deleted != 2 {
+		t.Fatalf("DeleteExpiredArchives = %d, %v; want 2", deleted, err)
+	}
+	if _, err := repo.LoadArchive(ctx, "archive-2"); !errors.Is(err, repository.ErrExportArchiveNotFound) {
+		t.Fatalf("LoadArchive of an expired archive: error = %v, want %v", err, repository.ErrExportArchiveNotFound)
+	}
+	if data, err := repo.LoadArchive(ctx, "archive-3"); err != nil || string(data) != "archive-3" {
+		t.Fatalf("LoadArchive of a live archive = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,171 @@
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+// GroupRepositoryFactory returns an empty repository. It is called once per
+// test.
+type GroupRepositoryFactory func(t *testing.T) repository.GroupRepository
+
+// RunGroupRepositoryTests runs the GroupRepository suite against the
+// repositories returned by newRepository.
+func RunGroupRepositoryTests(t *testing.T, newRepository GroupRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.GroupRepository)
+	}{
+		{"CreateAndFind", testCreateAndFindGroup},
+		{"DisplayNameUniquePerTenant", testGroupDisplayNameTaken},
+		{"ListGroups", testListGroups},
+		{"UpdateAndDelete", testUpdateAndDeleteGroup},
+		{"RemoveMember", testRemoveGroupMember},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+func newGroup(id string, tenantId string, displayName string, members ...string) *models.Group {
+	return &models.Group{
+		ID:          id,
+		TenantId:    tenantId,
+		DisplayName: displayName,
+		Members:     members,
+		CreatedAt:   baseTime,
+		UpdatedAt:   baseTime,
+	}
+}
+
+func createGroup(t *testing.T, repo repository.GroupRepository, group *models.Group) {
+	t.Helper()
+	if err := repo.CreateGroup(context.Background(), group); err != nil {
+		t.Fatalf("CreateGroup(%s): %v", group.ID, err)
+	}
+}
+
+func findGroup(t *testing.T, repo repository.GroupRepository, tenantId string, groupId string) *models.Group {
+	t.Helper()
+	group, err := repo.FindGroup(context.Background(), tenantId, groupId)
+	if err != nil {
+		t.Fatalf("FindGroup(%s): %v", groupId, err)
+	}
+	return group
+}
+
+func testCreateAndFindGroup(t *testing.T, repo repository.GroupRepository) {
+	want := newGroup("group-1", "tenant-1", "Admins", "user-1", "user-2")
+	want.ExternalId = "external-1"
+	want.UpdatedAt = baseTime.Add(time.Minute)
+	createGroup(t, repo, want)
+
+	got := findGroup(t, repo, "tenant-1", want.ID)
+	if got.ID != want.ID || got.TenantId != want.TenantId || got.DisplayName != want.DisplayName ||
+		got.ExternalId != want.ExternalId || !slices.Equal(got.Members, want.Members) ||
+		!got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Fatalf("FindGroup = %+v, want %+v", got, want)
+	}
+	// Un grupo de otro tenant no existe para este.
+	if _, err := repo.FindGroup(context.Background(), "tenant-2", want.ID); !errors.Is(err, repository.ErrGroupNotFound) {
+		t.Fatalf("FindGroup from another tenant: error = %v, want %v", err, repository.ErrGroupNotFound)
+	}
+	createGroup(t, repo, newGroup("group-2", "tenant-1", "Empty"))
+	if got := findGroup(t, repo, "tenant-1", "group-2"); len(got.Members) != 0 {
+		t.Fatalf("members of an empty group = %v", got.Members)
+	}
+}
+
+func testGroupDisplayNameTaken(t *testing.T, repo repository.GroupRepository) {
+	ctx := context.Background()
+	createGroup(t, repo, newGroup("group-1", "tenant-1", "Admins"))
+	createGroup(t, repo, newGroup("group-2", "tenant-2", "Admins"))
+	if err := repo.CreateGroup(ctx, newGroup("group-3", "tenant-1", "Admins")); !errors.Is(err, repository.ErrGroupNameTaken) {
+		t.Fatalf("CreateGroup with a taken name: error = %v, want %v", err, repository.ErrGroupNameTaken)
+	}
+	createGroup(t, repo, newGroup("group-3", "tenant-1", "Support"))
+	if err := repo.UpdateGroup(ctx, newGroup("group-3", "tenant-1", "Admins")); !errors.Is(err, repository.ErrGroupNameTaken) {
+		t.Fatalf("UpdateGroup to a taken name: error = %v, want %v", err, repository.ErrGroupNameTaken)
+	}
+}
+
+func testListGroups(t *testing.T, repo repository.GroupRepository) {
+	second := newGroup("group-b", "tenant-1", "Support")
+	second.CreatedAt = baseTime.Add(time.Minute)
+	createGroup(t, repo, second)
+	createGroup(t, repo, newGroup("group-c", "tenant-1", "Admins"))
+	createGroup(t, repo, newGroup("group-a", "tenant-1", "Billing"))
+	createGroup(t, repo, newGroup("group-d", "tenant-2", "Admins"))
+
+	groups, err := repo.ListGroups(context.Background(), "tenant-1")
+	if err != nil {
+		t.Fatalf("ListGroups: %v", err)
+	}
+	var ids []string
+	for _, group := range groups {
+		ids = append(ids, group.ID)
+	}
+	// Los mas antiguos primero y, con la misma fecha, por id.
+	if want := []string{"group-a", "group-c", "group-b"}; !slices.Equal(ids, want) {
+		t.Fatalf("ListGroups = %v, want %v", ids, want)
+	}
+}
+
+func testUpdateAndDeleteGroup(t *testing.T, repo repository.GroupRepository) {
+	ctx := context.Background()
+	group := newGroup("group-1", "tenant-1", "Admins", "user-1")
+	createGroup(t, repo, group)
+	group.DisplayName = "Owners"
+	group.Members = []string{"user-2", "user-3"}
+	group.UpdatedAt = baseTime.Add(time.Hour)
+	if err := repo.UpdateGroup(ctx, group); err != nil {
+		t.Fatalf("UpdateGroup: %v", err)
+	}
+	if got := findGroup(t, repo, "tenant-1", group.ID); got.DisplayName != "Owners" ||
+		!slices.Equal(got.Members, group.Members) || !got.UpdatedAt.Equal(group.UpdatedAt) {
+		t.Fatalf("FindGroup after UpdateGroup = %+v", got)
+	}
+	if err := repo.UpdateGroup(ctx, newGroup(group.ID, "tenant-2", "Owners")); !errors.Is(err, repository.ErrGroupNotFound) {
+		t.Fatalf("UpdateGroup from another tenant: error = %v, want %v", err, repository.ErrGroupNotFound)
+	}
+	if err := repo.DeleteGroup(ctx, "tenant-2", group.ID); !errors.Is(err, repository.ErrGroupNotFound) {
+		t.Fatalf("DeleteGroup from another tenant: error = %v, want %v", err, repository.ErrGroupNotFound)
+	}
+	if err := repo.DeleteGroup(ctx, "tenant-1", group.ID); err != nil {
+		t.Fatalf("DeleteGroup: %v", err)
+	}
+	if _, err := repo.FindGroup(ctx, "tenant-1", group.ID); !errors.Is(err, repository.ErrGroupNotFound) {
+		t.Fatalf("FindGroup after DeleteGroup: error = %v, want %v", err, repository.ErrGroupNotFound)
+	}
+}
+
+func testRemoveGroupMember(t *testing.T, repo repository.GroupRepository) {
+	createGroup(t, repo, newGroup("group-1", "tenant-1", "Admins", "user-1", "user-2"))
+	createGroup(t, repo, newGroup("group-2", "tenant-1", "Support", "user-1"))
+	createGroup(t, repo, newGroup("group-3", "tenant-2", "Admins", "user-1"))
+	if err := repo.RemoveMember(context.Background(), "tenant-1", "user-1"); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	tests := []struct {
+		tenantId string
+		groupId  string
+		want     []string
+	}{
+		{"tenant-1", "group-1", []string{"user-2"}},
+		{"tenant-1", "group-2", nil},
+		// Los grupos de otros tenants no cambian.
+		{"tenant-2", "group-3", []string{"user-1"}},
+	}
+	for _, test := range tests {
+		if got := findGroup(t, repo, test.tenantId, test.groupId).Members; !slices.Equal(got, test.want) {
+			t.Fatalf("members of %s = %v, want %v", test.groupId, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+// IdempotencyRepositoryFactory returns an empty repository. It is called once
+// per test.
+type IdempotencyRepositoryFactory func(t *testing.T) repository.IdempotencyRepository
+
+// RunIdempotencyRepositoryTests runs the IdempotencyRepository suite against
+// the repositories returned by newRepository. The repositories compare the
+// expiry with the clock, so the records expire around time.Now.
+func RunIdempotencyRepositoryTests(t *testing.T, newRepository IdempotencyRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.IdempotencyRepository)
+	}{
+		{"ReserveAndComplete", testReserveAndCompleteIdempotencyKey},
+		{"Release", testReleaseIdempotencyKey},
+		{"ExpiredRecordIsReplaced", testExpiredIdempotencyRecord},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+func newIdempotencyRecord(key string, fingerprint string, expiresAt time.Time) *models.IdempotencyRecord {
+	return &models.IdempotencyRecord{
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   time.Now().UTC().Truncate(time.Millisecond),
+		ExpiresAt:   expiresAt.UTC().Truncate(time.Millisecond),
+	}
+}
+
+func reserveIdempotencyKey(t *testing.T, repo repository.IdempotencyRepository, record *models.IdempotencyRecord) {
+	t.Helper()
+	if stored, err := repo.Reserve(context.Background(), record); err != nil || stored != nil {
+		t.Fatalf("Reserve(%s) = %+v, %v; want the key reserved", record.Key, stored, err)
+	}
+}
+
+func testReserveAndCompleteIdempotencyKey(t *testing.T, repo repository.IdempotencyRepository) {
+	ctx := context.Background()
+	reserved := newIdempotencyRecord("key-1", "fingerprint-1", time.Now().Add(time.Minute))
+	reserveIdempotencyKey(t, repo, reserved)
+
+	// Mientras la peticion esta en curso se devuelve el registro sin respuesta.
+	stored, err := repo.Reserve(ctx, newIdempotencyRecord("key-1", "fingerprint-2", time.Now().Add(time.Minute)))
+	if !errors.Is(err, repository.ErrIdempotencyKeyInUse) || stored == nil || stored.Fingerprint != "fingerprint-1" ||
+		stored.Completed || !stored.CreatedAt.Equal(reserved.CreatedAt) {
+		t.Fatalf("Reserve of a key in flight = %+v, %v; want the reserved record", stored, err)
+	}
+
+	completed := *reserved
+	completed.StatusCode = 201
+	completed.Headers = map[string]string{"Content-Type": "application/json", "Location": "/users/1"}
+	completed.Body = []byte(`{"id":"1"}`)
+	completed.ExpiresAt = time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+	if err := repo.Complete(ctx, &completed); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	// Un segundo Complete no cambia la respuesta guardada.
+	overwrite := completed
+	overwrite.StatusCode = 500
+	if err := repo.Complete(ctx, &overwrite); err != nil {
+		t.Fatalf("Complete twice: %v", err)
+	}
+	stored, err = repo.Reserve(ctx, newIdempotencyRecord("key-1", "fingerprint-1", time.Now().Add(time.Minute)))
+	if !errors.Is(err, repository.ErrIdempotencyKeyInUse) || stored == nil || !stored.Completed || stored.StatusCode != 201 ||
+		!maps.Equal(stored.Headers, completed.Headers) || string(stored.Body) != string(completed.Body) ||
+		!stored.ExpiresAt.Equal(completed.ExpiresAt) {
+		t.Fatalf("Reserve of a completed key = %+v, %v; want the stored response", stored, err)
+	}
+
+	// Una respuesta guardada sin cuerpo ni cabeceras.
+	reserveIdempotencyKey(t, repo, newIdempotencyRecord("key-2", "fingerprint-1", time.Now().Add(time.Minute)))
+	empty := newIdempotencyRecord("key-2", "fingerprint-1", time.Now().Add(time.Hour))
+	empty.StatusCode = 204
+	if err := repo.Complete(ctx, empty); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if stored, err := repo.Reserve(ctx, newIdempotencyRecord("key-2", "fingerprint-1", time.Now())); !errors.Is(err, repository.ErrIdempotencyKeyInUse) ||
+		stored.StatusCode != 204 || len(stored.Body) != 0 || len(stored.Headers) != 0 {
+		t.Fatalf("Reserve of a completed key without body = %+v, %v", stored, err)
+	}
+}
+
+func testReleaseIdempotencyKey(t *testing.T, repo repository.IdempotencyRepository) {
+	ctx := context.Background()
+	reserveIdempotencyKey(t, repo, newIdempotencyRecord("key-1", "fingerprint-1", time.Now().Add(time.Minute)))
+	if err := repo.Release(ctx, "key-1"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	reserveIdempotencyKey(t, repo, newIdempotencyRecord("key-1", "fingerprint-2", time.Now().Add(time.Minute)))
+
+	// Una respuesta ya guardada no se libera.
+	completed := newIdempotencyRecord("key-1", "fingerprint-2", time.Now().Add(time.Hour))
+	completed.StatusCode = 201
+	if err := repo.Complete(ctx, completed); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if err := repo.Release(ctx, "key-1"); err != nil {
+		t.Fatalf("Release of a completed key: %v", err)
+	}
+	if stored, err := repo.Reserve(ctx, newIdempotencyRecord("key-1", "fingerprint-2", time.Now())); !errors.Is(err, repository.ErrIdempotencyKeyInUse) || !stored.Completed {
+		t.Fatalf("Reserve after releasing a completed key = %+v, %v; want the stored response", stored, err)
+	}
+	if err := repo.Release(ctx, "missing"); err != nil {
+		t.Fatalf("Release of a missing key: %v", err)
+	}
+}
+
+func testExpiredIdempotencyRecord(t *testing.T, repo repository.IdempotencyRepository) {
+	reserveIdempotencyKey(t, repo, newIdempotencyRecord("key-1", "fingerprint-1", time.Now().Add(-time.Second)))
+	reserveIdempotencyKey(t, repo, newIdempotencyRecord("key-1", "fingerprint-2", time.Now().Add(time.Minute)))
+	stored, err := repo.Reserve(context.Background(), newIdempotencyRecord("key-1", "fingerprint-3", time.Now().Add(time.Minute)))
+	if !errors.Is(err, repository.ErrIdempotencyKeyInUse) || stored.Fingerprint != "fingerprint-2" {
+		t.Fatalf("Reserve after replacing the expired record = %+v, %v; want the new record", stored, err)
+	}
+}
@@ -0,0 +1,178 @@
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+// OAuthRepositoryFactory returns an empty repository. It is called once per
+// test.
+type OAuthRepositoryFactory func(t *testing.T) repository.OAuthRepository
+
+// RunOAuthRepositoryTests runs the OAuthRepository suite against the
+// repositories returned by newRepository.
+func RunOAuthRepositoryTests(t *testing.T, newRepository OAuthRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.OAuthRepository)
+	}{
+		{"Clients", testOAuthClients},
+		{"ConsumeAuthorizationCode", testConsumeAuthorizationCode},
+		{"ConcurrentConsume", testConcurrentConsumeAuthorizationCode},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+func newAuthorizationCode(id string) *models.AuthorizationCode {
+	return &models.AuthorizationCode{
+		ID:                  id,
+		ClientId:            "client-1",
+		UserId:              "user-1",
+		RedirectURI:         "https://app.example.com/callback",
+		Scope:               "openid profile",
+		CodeChallenge:       "challenge",
+		CodeChallengeMethod: "S256",
+		AuthTime:            baseTime.Add(-time.Minute),
+		CreatedAt:           baseTime,
+		ExpiresAt:           baseTime.Add(time.Minute),
+	}
+}
+
+func testOAuthClients(t *testing.T, repo repository.OAuthRepository) {
+	ctx := context.Background()
+	confidential := &models.OAuthClient{
+		ID:           "client-2",
+		Name:         "Backend",
+		Type:         models.OAuthClientConfidential,
+		SecretHash:   "hash",
+		RedirectURIs: []string{"https://app.example.com/callback", "https://app.example.com/other"},
+		Scopes:       []string{"openid", "profile"},
+		Audiences:    []string{"contacts-service"},
+		CreatedAt:    baseTime.Add(time.Minute),
+	}
+	public := &models.OAuthClient{ID: "client-1", Name: "SPA", Type: models.OAuthClientPublic,
+		RedirectURIs: []string{"https://spa.example.com/callback"}, Scopes: []string{"openid"}, CreatedAt: baseTime}
+	for _, client := range []*models.OAuthClient{confidential, public} {
+		if err := repo.CreateClient(ctx, client); err != nil {
+			t.Fatalf("CreateClient(%s): %v", client.ID, err)
+		}
+	}
+
+	got, err := repo.FindClient(ctx, confidential.ID)
+	if err != nil || got.ID != confidential.ID || got.Name != confidential.Name || got.Type != confidential.Type ||
+		got.SecretHash != confidential.SecretHash || !slices.Equal(got.RedirectURIs, confidential.RedirectURIs) ||
+		!slices.Equal(got.Scopes, confidential.Scopes) || !slices.Equal(got.Audiences, confidential.Audiences) ||
+		!got.CreatedAt.Equal(confidential.CreatedAt) {
+		t.Fatalf("FindClient = %+v, %v; want %+v", got, err, confidential)
+	}
+	if got, err := repo.FindClient(ctx, public.ID); err != nil || got.SecretHash != "" || len(got.Audiences) != 0 {
+		t.Fatalf("FindClient of the public client = %+v, %v", got, err)
+	}
+	clients, err := repo.ListClients(ctx)
+	if err != nil || len(clients) != 2 || clients[0].ID != public.ID || clients[1].ID != confidential.ID {
+		t.Fatalf("ListClients = %+v, %v; want the oldest first", clients, err)
+	}
+	if err := repo.DeleteClient(ctx, public.ID); err != nil {
+		t.Fatalf("DeleteClient: %v", err)
+	}
+	if _, err := repo.FindClient(ctx, public.ID); !errors.Is(err, repository.ErrOAuthClientNotFound) {
+		t.Fatalf("FindClient after DeleteClient: error = %v, want %v", err, repository.ErrOAuthClientNotFound)
+	}
+	if err := repo.DeleteClient(ctx, public.ID); !errors.Is(err, repository.ErrOAuthClientNotFound) {
+		t.Fatalf("DeleteClient twice: error = %v, want %v", err, repository.ErrOAuthClientNotFound)
+	}
+}
+
+func testConsumeAuthorizationCode(t *testing.T, repo repository.OAuthRepository) {
+	ctx := context.Background()
+	want := newAuthorizationCode("code-1")
+	want.Nonce = "nonce"
+	want.RedirectURIProvided = true
+	if err := repo.CreateAuthorizationCode(ctx, want); err != nil {
+		t.Fatalf("CreateAuthorizationCode: %v", err)
+	}
+	got, err := repo.ConsumeAuthorizationCode(ctx, want.ID)
+	if err != nil {
+		t.Fatalf("ConsumeAuthorizationCode: %v", err)
+	}
+	if got.ID != want.ID || got.ClientId != want.ClientId || got.UserId != want.UserId || got.RedirectURI != want.RedirectURI ||
+		got.Scope != want.Scope || got.CodeChallenge != want.CodeChallenge || got.CodeChallengeMethod != want.CodeChallengeMethod ||
+		got.Nonce != want.Nonce || !got.AuthTime.Equal(want.AuthTime) || !got.CreatedAt.Equal(want.CreatedAt) ||
+		!got.ExpiresAt.Equal(want.ExpiresAt) || got.RedirectURIProvided != want.RedirectURIProvided {
+		t.Fatalf("ConsumeAuthorizationCode = %+v, want %+v", got, want)
+	}
+	if _, err := repo.ConsumeAuthorizationCode(ctx, want.ID); !errors.Is(err, repository.ErrAuthorizationCodeNotFound) {
+		t.Fatalf("ConsumeAuthorizationCode twice: error = %v, want %v", err, repository.ErrAuthorizationCodeNotFound)
+	}
+}
+
+func testConcurrentConsumeAuthorizationCode(t *testing.T, repo repository.OAuthRepository) {
+	if err := repo.CreateAuthorizationCode(context.Background(), newAuthorizationCode("code-1")); err != nil {
+		t.Fatalf("CreateAuthorizationCode: %v", err)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	consumed := 0
+	for range concurrency {
+		wg.Go(func() {
+			_, err := repo.ConsumeAuthorizationCode(context.Background(), "code-1")
+			if err != nil && !errors.Is(err, repository.ErrAuthorizationCodeNotFound) {
+				t.Errorf("ConsumeAuthorizationCode: %v", err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				consumed++
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	if consumed != 1 {
+		t.Fatalf("the code was consumed %d times, want 1", consumed)
+	}
+}
+
+// DPoPProofRepositoryFactory returns an empty repository. It is called once
+// per test.
+type DPoPProofRepositoryFactory func(t *testing.T) repository.DPoPProofRepository
+
+// RunDPoPProofRepositoryTests runs the DPoPProofRepository suite against the
+// repositories returned by newRepository.
+func RunDPoPProofRepositoryTests(t *testing.T, newRepository DPoPProofRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.DPoPProofRepository)
+	}{
+		{"Replay", testDPoPProofReplay},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+func testDPoPProofReplay(t *testing.T, repo repository.DPoPProofRepository) {
+	ctx := context.Background()
+	proof := &models.DPoPProof{ID: "proof-1", ExpiresAt: time.Now().Add(time.Minute).UTC().Truncate(time.Millisecond)}
+	if err := repo.SaveProof(ctx, proof); err != nil {
+		t.Fatalf("SaveProof: %v", err)
+	}
+	if err := repo.SaveProof(ctx, proof); !errors.Is(err, repository.ErrDPoPProofReplayed) {
+		t.Fatalf("SaveProof twice: error = %v, want %v", err, repository.ErrDPoPProofReplayed)
+	}
+	if err := repo.SaveProof(ctx, &models.DPoPProof{ID: "proof-2", ExpiresAt: proof.ExpiresAt}); err != nil {
+		t.Fatalf("SaveProof of another proof: %v", err)
+	}
+}
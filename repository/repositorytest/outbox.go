@@ -0,0 +1,165 @@
+package repositorytest
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/google/uuid"
+)
+
+// OutboxRepositoryFactory returns an empty repository. It is called once per
+// test.
+type OutboxRepositoryFactory func(t *testing.T) repository.OutboxRepository
+
+// RunOutboxRepositoryTests runs the OutboxRepository suite against the
+// repositories returned by newRepository.
+func RunOutboxRepositoryTests(t *testing.T, newRepository OutboxRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.OutboxRepository)
+	}{
+		{"AppendAndFindPending", testAppendAndFindPendingEvents},
+		{"MarkPublished", testMarkEventPublished},
+		{"MarkFailedHoldsTheUser", testMarkEventFailed},
+		{"DeletePublishedBefore", testDeletePublishedEvents},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+// appendEvents writes count events of userId, in write order.
+func appendEvents(t *testing.T, repo repository.OutboxRepository, userId string, count int) []models.OutboxEvent {
+	t.Helper()
+	var events []models.OutboxEvent
+	for range count {
+		event := models.OutboxEvent{
+			ID:          uuid.Must(uuid.NewV7()).String(),
+			AggregateId: userId,
+			Type:        models.EventUserUpdated,
+			Data: models.UserEventData{
+				UserId:        userId,
+				Email:         userId + "@example.com",
+				Verified:      true,
+				ChangedFields: []string{"name"},
+			},
+			CreatedAt: baseTime,
+		}
+		if err := repo.AppendEvent(context.Background(), &event); err != nil {
+			t.Fatalf("AppendEvent: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func pendingIds(t *testing.T, repo repository.OutboxRepository, now time.Time, limit int) []string {
+	t.Helper()
+	events, err := repo.FindPendingEvents(context.Background(), now, limit)
+	if err != nil {
+		t.Fatalf("FindPendingEvents: %v", err)
+	}
+	var ids []string
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func eventIds(events ...models.OutboxEvent) []string {
+	var ids []string
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func testAppendAndFindPendingEvents(t *testing.T, repo repository.OutboxRepository) {
+	first := appendEvents(t, repo, "user-1", 2)
+	second := appendEvents(t, repo, "user-2", 1)
+
+	events, err := repo.FindPendingEvents(context.Background(), baseTime, 10)
+	if err != nil {
+		t.Fatalf("FindPendingEvents: %v", err)
+	}
+	want := append(slices.Clone(first), second...)
+	if len(events) != len(want) {
+		t.Fatalf("FindPendingEvents returned %d events, want %d", len(events), len(want))
+	}
+	for i := range want {
+		got := events[i]
+		if got.ID != want[i].ID || got.AggregateId != want[i].AggregateId || got.Type != want[i].Type ||
+			!got.CreatedAt.Equal(want[i].CreatedAt) || got.Data.Email != want[i].Data.Email ||
+			!got.Data.Verified || !slices.Equal(got.Data.ChangedFields, want[i].Data.ChangedFields) ||
+			got.PublishedAt != nil || got.NextAttemptAt != nil || got.Attempts != 0 {
+			t.Fatalf("event %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+	if got := pendingIds(t, repo, baseTime, 2); !slices.Equal(got, eventIds(first...)) {
+		t.Fatalf("FindPendingEvents with limit 2 = %v, want %v", got, eventIds(first...))
+	}
+}
+
+func testMarkEventPublished(t *testing.T, repo repository.OutboxRepository) {
+	events := appendEvents(t, repo, "user-1", 2)
+	if err := repo.MarkFailed(context.Background(), events[0].ID, "broker down", baseTime.Add(-time.Second)); err != nil {
+		t.Fatalf("MarkFailed: %v", err)
+	}
+	if err := repo.MarkPublished(context.Background(), events[0].ID, baseTime); err != nil {
+		t.Fatalf("MarkPublished: %v", err)
+	}
+	if got := pendingIds(t, repo, baseTime, 10); !slices.Equal(got, eventIds(events[1])) {
+		t.Fatalf("FindPendingEvents after MarkPublished = %v, want %v", got, eventIds(events[1]))
+	}
+}
+
+func testMarkEventFailed(t *testing.T, repo repository.OutboxRepository) {
+	held := appendEvents(t, repo, "user-1", 2)
+	other := appendEvents(t, repo, "user-2", 1)
+	retryAt := baseTime.Add(time.Minute)
+	if err := repo.MarkFailed(context.Background(), held[0].ID, "broker down", retryAt); err != nil {
+		t.Fatalf("MarkFailed: %v", err)
+	}
+
+	// Hasta el reintento no sale ningun evento del usuario, pero si los de otros.
+	if got := pendingIds(t, repo, baseTime, 10); !slices.Equal(got, eventIds(other...)) {
+		t.Fatalf("FindPendingEvents before the retry = %v, want %v", got, eventIds(other...))
+	}
+	events, err := repo.FindPendingEvents(context.Background(), retryAt, 10)
+	if err != nil {
+		t.Fatalf("FindPendingEvents: %v", err)
+	}
+	if got, want := eventIds(events...), eventIds(append(slices.Clone(held), other...)...); !slices.Equal(got, want) {
+		t.Fatalf("FindPendingEvents at the retry = %v, want %v", got, want)
+	}
+	failed := events[0]
+	if failed.Attempts != 1 || failed.LastError != "broker down" || failed.NextAttemptAt == nil || !failed.NextAttemptAt.Equal(retryAt) {
+		t.Fatalf("failed event = %+v", failed)
+	}
+}
+
+func testDeletePublishedEvents(t *testing.T, repo repository.OutboxRepository) {
+	ctx := context.Background()
+	events := appendEvents(t, repo, "user-1", 4)
+	for i, event := range events[:3] {
+		if err := repo.MarkPublished(ctx, event.ID, baseTime.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("MarkPublished: %v", err)
+		}
+	}
+	deleted, err := repo.DeletePublishedBefore(ctx, baseTime.Add(90*time.Minute), 10)
+	if err != nil {
+		t.Fatalf("DeletePublishedBefore: %v", err)
+	}
+	if deleted != 2 {
+		t.Fatalf("DeletePublishedBefore = %d, want 2", deleted)
+	}
+	if got := pendingIds(t, repo, baseTime, 10); !slices.Equal(got, eventIds(events[3])) {
+		t.Fatalf("FindPendingEvents after DeletePublishedBefore = %v, want %v", got, eventIds(events[3]))
+	}
+}
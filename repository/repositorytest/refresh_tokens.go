@@ -0,0 +1,366 @@
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/google/uuid"
+)
+
+// RefreshTokenRepositoryFactory returns an empty repository. It is called once
+// per test.
+type RefreshTokenRepositoryFactory func(t *testing.T) repository.RefreshTokenRepository
+
+// RunRefreshTokenRepositoryTests runs the RefreshTokenRepository suite against
+// the repositories returned by newRepository.
+func RunRefreshTokenRepositoryTests(t *testing.T, newRepository RefreshTokenRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.RefreshTokenRepository)
+	}{
+		{"CreateAndFind", testCreateAndFindRefreshToken},
+		{"NotFound", testRefreshTokenNotFound},
+		{"UserWithoutTokens", testUserWithoutTokens},
+		{"Revoke", testRevokeRefreshToken},
+		{"RevokeAndDeleteAllFromUser", testRevokeAndDeleteAllFromUser},
+		{"FindTokensByUserOrdering", testFindTokensByUserOrdering},
+		{"DeleteExpired", testDeleteExpired},
+		{"DeleteExpiredLimit", testDeleteExpiredLimit},
+		{"ConcurrentCreateAndRevoke", testConcurrentCreateAndRevoke},
+		{"RevokeActiveToken", testRevokeActiveToken},
+		{"ConcurrentRevokeActiveToken", testConcurrentRevokeActiveToken},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+func newRefreshToken(userId string, issuedAt time.Time) *models.RefreshToken {
+	return &models.RefreshToken{
+		ID:             uuid.NewString(),
+		UserId:         userId,
+		Jti:            uuid.NewString(),
+		IssuedAt:       issuedAt,
+		Expires:        issuedAt.Add(24 * time.Hour),
+		SessionVersion: 1,
+	}
+}
+
+func createRefreshToken(t *testing.T, repo repository.RefreshTokenRepository, refreshToken *models.RefreshToken) {
+	t.Helper()
+	if err := repo.CreateRefreshToken(context.Background(), refreshToken); err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+}
+
+func findRefreshToken(t *testing.T, repo repository.RefreshTokenRepository, jti string) *models.RefreshToken {
+	t.Helper()
+	refreshToken, err := repo.FindRefreshTokenByID(context.Background(), jti)
+	if err != nil {
+		t.Fatalf("FindRefreshTokenByID: %v", err)
+	}
+	return refreshToken
+}
+
+func testCreateAndFindRefreshToken(t *testing.T, repo repository.RefreshTokenRepository) {
+	full := newRefreshToken(uuid.NewString(), baseTime)
+	full.DeviceFingerprint = "fingerprint"
+	full.IP = "203.0.113.7"
+	full.UserAgent = "agent"
+	full.ClientId = "client"
+	full.Scope = "openid profile"
+	full.AuthTime = baseTime.Add(-time.Hour)
+	full.Audiences = []string{"contacts-service", "billing"}
+	full.RememberMe = true
+	full.DPoPJkt = "thumbprint"
+	minimal := newRefreshToken(uuid.NewString(), baseTime)
+
+	for _, want := range []*models.RefreshToken{full, minimal} {
+		createRefreshToken(t, repo, want)
+		got := findRefreshToken(t, repo, want.Jti)
+		if got.ID != want.ID || got.UserId != want.UserId || got.Jti != want.Jti || !got.IssuedAt.Equal(want.IssuedAt) ||
+			!got.Expires.Equal(want.Expires) || got.Revoked || got.SessionVersion != want.SessionVersion ||
+			got.DeviceFingerprint != want.DeviceFingerprint || got.IP != want.IP || got.UserAgent != want.UserAgent ||
+			got.ClientId != want.ClientId || got.Scope != want.Scope || !got.AuthTime.Equal(want.AuthTime) ||
+			!slices.Equal(got.Audiences, want.Audiences) || got.RememberMe != want.RememberMe ||
+			got.RevokedReason != "" || got.DPoPJkt != want.DPoPJkt {
+			t.Fatalf("refresh token = %+v, want %+v", got, want)
+		}
+	}
+	if got := findRefreshToken(t, repo, minimal.Jti); !got.AuthTime.IsZero() || !got.RevokedAt.IsZero() {
+		t.Fatalf("a token without auth time or revocation was read with one: %+v", got)
+	}
+}
+
+func testRefreshTokenNotFound(t *testing.T, repo repository.RefreshTokenRepository) {
+	ctx := context.Background()
+	_, err := repo.FindRefreshTokenByID(ctx, uuid.NewString())
+	assertErrorIs(t, "FindRefreshTokenByID", err, repository.ErrRefreshTokenNotFound)
+	_, err = repo.FindRefreshTokenByHash(ctx, "hash")
+	assertErrorIs(t, "FindRefreshTokenByHash", err, repository.ErrRefreshTokenNotFound)
+	// Las revocaciones de un token inexistente devuelven ErrUserNotFound, como
+	// siempre lo hizo la implementacion de Mongo.
+	assertErrorIs(t, "RevokeToken", repo.RevokeToken(ctx, uuid.NewString()), repository.ErrUserNotFound)
+	assertErrorIs(t, "RevokeTokenWithReason", repo.RevokeTokenWithReason(ctx, uuid.NewString(), "reason"), repository.ErrUserNotFound)
+	assertErrorIs(t, "RevokeActiveToken", repo.RevokeActiveToken(ctx, uuid.NewString()), repository.ErrUserNotFound)
+}
+
+func testUserWithoutTokens(t *testing.T, repo repository.RefreshTokenRepository) {
+	ctx := context.Background()
+	userId := uuid.NewString()
+	if err := repo.RevokeAllTokenFromUser(ctx, userId); err != nil {
+		t.Fatalf("RevokeAllTokenFromUser without tokens: %v", err)
+	}
+	if err := repo.DeleteAllTokensFromUser(ctx, userId); err != nil {
+		t.Fatalf("DeleteAllTokensFromUser without tokens: %v", err)
+	}
+	refreshTokens, err := repo.FindTokensByUser(ctx, userId)
+	if err != nil || len(refreshTokens) != 0 {
+		t.Fatalf("FindTokensByUser without tokens = %v, %v", refreshTokens, err)
+	}
+}
+
+func testRevokeRefreshToken(t *testing.T, repo repository.RefreshTokenRepository) {
+	ctx := context.Background()
+	rotated, evicted := newRefreshToken(uuid.NewString(), baseTime), newRefreshToken(uuid.NewString(), baseTime)
+	createRefreshToken(t, repo, rotated)
+	createRefreshToken(t, repo, evicted)
+
+	if err := repo.RevokeToken(ctx, rotated.Jti); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	got := findRefreshToken(t, repo, rotated.Jti)
+	if !got.Revoked || got.RevokedReason != "" || got.RevokedAt.IsZero() {
+		t.Fatalf("after RevokeToken token = %+v", got)
+	}
+	revokedAt := got.RevokedAt
+	if err := repo.RevokeTokenWithReason(ctx, evicted.Jti, models.RefreshTokenRevokedSessionLimit); err != nil {
+		t.Fatalf("RevokeTokenWithReason: %v", err)
+	}
+	if got := findRefreshToken(t, repo, evicted.Jti); !got.Revoked || got.RevokedReason != models.RefreshTokenRevokedSessionLimit || got.RevokedAt.IsZero() {
+		t.Fatalf("after RevokeTokenWithReason token = %+v", got)
+	}
+	// Revocar otra vez no es un error y conserva el momento de la primera revocacion.
+	time.Sleep(5 * time.Millisecond)
+	if err := repo.RevokeToken(ctx, rotated.Jti); err != nil {
+		t.Fatalf("RevokeToken twice: %v", err)
+	}
+	if got := findRefreshToken(t, repo, rotated.Jti).RevokedAt; !got.Equal(revokedAt) {
+		t.Fatalf("revoking twice changed revoked_at from %v to %v", revokedAt, got)
+	}
+}
+
+func testRevokeAndDeleteAllFromUser(t *testing.T, repo repository.RefreshTokenRepository) {
+	ctx := context.Background()
+	userId, otherUserId := uuid.NewString(), uuid.NewString()
+	var tokens []*models.RefreshToken
+	for i := range 3 {
+		refreshToken := newRefreshToken(userId, baseTime.Add(time.Duration(i)*time.Minute))
+		createRefreshToken(t, repo, refreshToken)
+		tokens = append(tokens, refreshToken)
+	}
+	other := newRefreshToken(otherUserId, baseTime)
+	createRefreshToken(t, repo, other)
+
+	if err := repo.RevokeAllTokenFromUser(ctx, userId); err != nil {
+		t.Fatalf("RevokeAllTokenFromUser: %v", err)
+	}
+	for _, refreshToken := range tokens {
+		if got := findRefreshToken(t, repo, refreshToken.Jti); !got.Revoked || got.RevokedAt.IsZero() {
+			t.Fatalf("RevokeAllTokenFromUser left token %s active", refreshToken.Jti)
+		}
+	}
+	if findRefreshToken(t, repo, other.Jti).Revoked {
+		t.Fatalf("RevokeAllTokenFromUser revoked the token of another user")
+	}
+
+	if err := repo.DeleteAllTokensFromUser(ctx, userId); err != nil {
+		t.Fatalf("DeleteAllTokensFromUser: %v", err)
+	}
+	_, err := repo.FindRefreshTokenByID(ctx, tokens[0].Jti)
+	assertErrorIs(t, "FindRefreshTokenByID after DeleteAllTokensFromUser", err, repository.ErrRefreshTokenNotFound)
+	if remaining, _ := repo.FindTokensByUser(ctx, otherUserId); len(remaining) != 1 {
+		t.Fatalf("DeleteAllTokensFromUser deleted the tokens of another user")
+	}
+}
+
+func testFindTokensByUserOrdering(t *testing.T, repo repository.RefreshTokenRepository) {
+	userId := uuid.NewString()
+	var want []*models.RefreshToken
+	// Se insertan desordenados, con dos tokens del mismo instante.
+	for _, minutes := range []int{2, 0, 3, 2, 1} {
+		refreshToken := newRefreshToken(userId, baseTime.Add(time.Duration(minutes)*time.Minute))
+		createRefreshToken(t, repo, refreshToken)
+		want = append(want, refreshToken)
+	}
+	createRefreshToken(t, repo, newRefreshToken(uuid.NewString(), baseTime))
+	slices.SortFunc(want, func(a, b *models.RefreshToken) int {
+		if result := b.IssuedAt.Compare(a.IssuedAt); result != 0 {
+			return result
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+
+	got, err := repo.FindTokensByUser(context.Background(), userId)
+	if err != nil {
+		t.Fatalf("FindTokensByUser: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("FindTokensByUser returned %d tokens, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID {
+			t.Fatalf("token %d = %s (%v), want %s (%v): tokens must be newest first, then by id",
+				i, got[i].ID, got[i].IssuedAt, want[i].ID, want[i].IssuedAt)
+		}
+	}
+}
+
+func testDeleteExpired(t *testing.T, repo repository.RefreshTokenRepository) {
+	ctx := context.Background()
+	userId := uuid.NewString()
+	expired := newRefreshToken(userId, baseTime.Add(-48*time.Hour))
+	active := newRefreshToken(userId, baseTime)
+	revoked := newRefreshToken(userId, baseTime)
+	for _, refreshToken := range []*models.RefreshToken{expired, active, revoked} {
+		createRefreshToken(t, repo, refreshToken)
+	}
+	if err := repo.RevokeToken(ctx, revoked.Jti); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+
+	// Los revocados se conservan mientras dure la retencion.
+	deleted, err := repo.DeleteExpired(ctx, baseTime, time.Now().Add(-time.Hour), 10)
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteExpired = %d, %v, want the expired token", deleted, err)
+	}
+	_, err = repo.FindRefreshTokenByID(ctx, expired.Jti)
+	assertErrorIs(t, "FindRefreshTokenByID of the expired token", err, repository.ErrRefreshTokenNotFound)
+	findRefreshToken(t, repo, revoked.Jti)
+
+	deleted, err = repo.DeleteExpired(ctx, baseTime, time.Now().Add(time.Hour), 10)
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteExpired = %d, %v, want the revoked token", deleted, err)
+	}
+	_, err = repo.FindRefreshTokenByID(ctx, revoked.Jti)
+	assertErrorIs(t, "FindRefreshTokenByID of the revoked token", err, repository.ErrRefreshTokenNotFound)
+	if got := findRefreshToken(t, repo, active.Jti); got.Revoked {
+		t.Fatalf("the active token changed: %+v", got)
+	}
+}
+
+func testDeleteExpiredLimit(t *testing.T, repo repository.RefreshTokenRepository) {
+	ctx := context.Background()
+	userId := uuid.NewString()
+	for i := range 5 {
+		createRefreshToken(t, repo, newRefreshToken(userId, baseTime.Add(time.Duration(i)*time.Minute)))
+	}
+	total := 0
+	for _, want := range []int{2, 2, 1, 0} {
+		deleted, err := repo.DeleteExpired(ctx, time.Now(), time.Now(), 2)
+		if err != nil || deleted != want {
+			t.Fatalf("DeleteExpired = %d, %v, want %d", deleted, err, want)
+		}
+		total += deleted
+	}
+	if remaining, _ := repo.FindTokensByUser(ctx, userId); len(remaining) != 0 || total != 5 {
+		t.Fatalf("DeleteExpired left %d tokens after deleting %d", len(remaining), total)
+	}
+}
+
+func testConcurrentCreateAndRevoke(t *testing.T, repo repository.RefreshTokenRepository) {
+	ctx := context.Background()
+	userId := uuid.NewString()
+	tokens := make([]*models.RefreshToken, concurrency)
+	errs := make([]error, concurrency)
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		tokens[i] = newRefreshToken(userId, baseTime.Add(time.Duration(i)*time.Second))
+		wg.Go(func() {
+			errs[i] = repo.CreateRefreshToken(ctx, tokens[i])
+		})
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("CreateRefreshToken: %v", err)
+		}
+	}
+	for i := range concurrency {
+		wg.Go(func() {
+			errs[i] = repo.RevokeTokenWithReason(ctx, tokens[i].Jti, fmt.Sprintf("reason-%d", i))
+		})
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("RevokeTokenWithReason: %v", err)
+		}
+	}
+	stored, err := repo.FindTokensByUser(ctx, userId)
+	if err != nil {
+		t.Fatalf("FindTokensByUser: %v", err)
+	}
+	if len(stored) != concurrency {
+		t.Fatalf("FindTokensByUser returned %d tokens, want %d", len(stored), concurrency)
+	}
+	for _, refreshToken := range stored {
+		if !refreshToken.Revoked {
+			t.Fatalf("token %s was not revoked", refreshToken.Jti)
+		}
+	}
+}
+
+func testRevokeActiveToken(t *testing.T, repo repository.RefreshTokenRepository) {
+	ctx := context.Background()
+	refreshToken := newRefreshToken(uuid.NewString(), baseTime)
+	createRefreshToken(t, repo, refreshToken)
+	if err := repo.RevokeActiveToken(ctx, refreshToken.Jti); err != nil {
+		t.Fatalf("RevokeActiveToken: %v", err)
+	}
+	got := findRefreshToken(t, repo, refreshToken.Jti)
+	if !got.Revoked || got.RevokedAt.IsZero() {
+		t.Fatalf("after RevokeActiveToken token = %+v", got)
+	}
+	// A diferencia de RevokeToken, la segunda revocacion es un error.
+	assertErrorIs(t, "RevokeActiveToken twice", repo.RevokeActiveToken(ctx, refreshToken.Jti), repository.ErrRefreshTokenRevoked)
+	if revokedAt := findRefreshToken(t, repo, refreshToken.Jti).RevokedAt; !revokedAt.Equal(got.RevokedAt) {
+		t.Fatalf("revoking twice changed revoked_at from %v to %v", got.RevokedAt, revokedAt)
+	}
+}
+
+func testConcurrentRevokeActiveToken(t *testing.T, repo repository.RefreshTokenRepository) {
+	ctx := context.Background()
+	refreshToken := newRefreshToken(uuid.NewString(), baseTime)
+	createRefreshToken(t, repo, refreshToken)
+	errs := make([]error, concurrency)
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		wg.Go(func() {
+			errs[i] = repo.RevokeActiveToken(ctx, refreshToken.Jti)
+		})
+	}
+	wg.Wait()
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, repository.ErrRefreshTokenRevoked):
+			t.Fatalf("RevokeActiveToken: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d concurrent RevokeActiveToken calls succeeded, want 1", succeeded)
+	}
+}
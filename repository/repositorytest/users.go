@@ -0,0 +1,728 @@
+// Package repositorytest is a conformance suite for the storage backends: every
+// repository implementation must pass it, so the services behave the same
+// whatever STORAGE_BACKEND is selected.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/google/uuid"
+)
+
+// concurrency is the number of goroutines of the concurrency tests.
+const concurrency = 20
+
+// baseTime is truncated to milliseconds, the precision Mongo stores, so the
+// times read back compare equal on every backend.
+var baseTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// equalTimes compares two optional times.
+func equalTimes(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// UserRepositoryFactory returns an empty repository. It is called once per
+// test.
+type UserRepositoryFactory func(t *testing.T) repository.UserRepository
+
+// RunUserRepositoryTests runs the UserRepository suite against the
+// repositories returned by newRepository.
+func RunUserRepositoryTests(t *testing.T, newRepository UserRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.UserRepository)
+	}{
+		{"CreateAndFind", testCreateAndFindUser},
+		{"NotFound", testUserNotFound},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"UpdateUser", testUpdateUser},
+		{"UpdateField", testUpdateField},
+		{"SoftDeleteAndRestore", testSoftDeleteAndRestore},
+		{"SessionVersionBumps", testSessionVersionBumps},
+		{"ListUsersOrdering", testListUsersOrdering},
+		{"ListUsersFilters", testListUsersFilters},
+		{"SearchAfterUpdate", testSearchAfterUpdate},
+		{"FindTenantUsers", testFindTenantUsers},
+		{"FindUsersDeletedBefore", testFindUsersDeletedBefore},
+		{"ConcurrentDuplicateEmail", testConcurrentDuplicateEmail},
+		{"ConcurrentSessionBumps", testConcurrentSessionBumps},
+		{"VersionBumps", testVersionBumps},
+		{"StaleUpdateUser", testStaleUpdateUser},
+		{"ConcurrentUpdateUser", testConcurrentUpdateUser},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+func newUser(index int) *models.User {
+	return &models.User{
+		UserId:         uuid.NewString(),
+		Name:           fmt.Sprintf("Name%02d", index),
+		LastName:       fmt.Sprintf("LastName%02d", index),
+		Email:          fmt.Sprintf("user%02d-%s@example.com", index, uuid.NewString()[:8]),
+		PasswordHash:   "hash",
+		SessionVersion: 1,
+		Role:           models.RoleUser,
+		Version:        1,
+		CreatedAt:      baseTime.Add(time.Duration(index) * time.Minute),
+	}
+}
+
+func createUser(t *testing.T, repo repository.UserRepository, user *models.User) {
+	t.Helper()
+	if err := repo.CreateUser(context.Background(), user); err != nil {
+		t.Fatalf("CreateUser(%s): %v", user.Email, err)
+	}
+}
+
+func assertSameUser(t *testing.T, got *models.User, want *models.User) {
+	t.Helper()
+	if got.UserId != want.UserId || got.Name != want.Name || got.LastName != want.LastName ||
+		got.Email != want.Email || got.PasswordHash != want.PasswordHash || got.SessionVersion != want.SessionVersion ||
+		got.Role != want.Role || got.Verified != want.Verified || got.Locked != want.Locked ||
+		got.PasswordResetRequired != want.PasswordResetRequired || got.TenantId != want.TenantId ||
+		got.ExternalId != want.ExternalId || !got.CreatedAt.Equal(want.CreatedAt) || got.IsDeleted() != want.IsDeleted() ||
+		got.Version != want.Version {
+		t.Fatalf("user = %+v, want %+v", got, want)
+	}
+	if got.IsDeleted() && !got.DeletedAt.Equal(*want.DeletedAt) {
+		t.Fatalf("deleted_at = %v, want %v", got.DeletedAt, want.DeletedAt)
+	}
+}
+
+func assertErrorIs(t *testing.T, operation string, err error, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Fatalf("%s: error = %v, want %v", operation, err, want)
+	}
+}
+
+func testCreateAndFindUser(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(1)
+	user.Verified = true
+	user.TenantId = "tenant"
+	user.ExternalId = "external"
+	createUser(t, repo, user)
+
+	found, err := repo.FindUser(ctx, user.Email)
+	if err != nil {
+		t.Fatalf("FindUser: %v", err)
+	}
+	assertSameUser(t, found, user)
+	found, err = repo.FindUserByID(ctx, user.UserId)
+	if err != nil {
+		t.Fatalf("FindUserByID: %v", err)
+	}
+	assertSameUser(t, found, user)
+
+	// Los usuarios devueltos son copias.
+	found.Name = "Changed"
+	if again, _ := repo.FindUserByID(ctx, user.UserId); again.Name != user.Name {
+		t.Fatalf("changing a returned user changed the stored one")
+	}
+}
+
+func testUserNotFound(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	missing := newUser(1)
+	_, err := repo.FindUser(ctx, missing.Email)
+	assertErrorIs(t, "FindUser", err, repository.ErrUserNotFound)
+	_, err = repo.FindUserByID(ctx, missing.UserId)
+	assertErrorIs(t, "FindUserByID", err, repository.ErrUserNotFound)
+	_, err = repo.UpdateUser(ctx, missing.Email, missing)
+	assertErrorIs(t, "UpdateUser", err, repository.ErrUserNotFound)
+	_, err = repo.UpdateField(ctx, missing.Email, "New", "name")
+	assertErrorIs(t, "UpdateField", err, repository.ErrUserNotFound)
+	err = repo.DeleteUser(ctx, missing.Email)
+	assertErrorIs(t, "DeleteUser", err, repository.ErrUserNotFound)
+	_, err = repo.RestoreUser(ctx, missing.UserId)
+	assertErrorIs(t, "RestoreUser", err, repository.ErrUserNotFound)
+	err = repo.ForcePasswordReset(ctx, missing.UserId, missing.SessionVersion)
+	assertErrorIs(t, "ForcePasswordReset", err, repository.ErrUserNotFound)
+	_, err = repo.SetPasswordHash(ctx, missing.UserId, "hash")
+	assertErrorIs(t, "SetPasswordHash", err, repository.ErrUserNotFound)
+	if err := repo.HardDeleteUser(ctx, missing.UserId); err != nil {
+		t.Fatalf("HardDeleteUser of a missing user: %v", err)
+	}
+}
+
+func testDuplicateEmail(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	first, second := newUser(1), newUser(2)
+	createUser(t, repo, first)
+	createUser(t, repo, second)
+
+	duplicate := newUser(3)
+	duplicate.Email = first.Email
+	assertErrorIs(t, "CreateUser", repo.CreateUser(ctx, duplicate), repository.ErrEmailConflict)
+	if _, err := repo.FindUserByID(ctx, duplicate.UserId); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("the duplicate user was stored: %v", err)
+	}
+
+	// Un usuario borrado sigue reservando su email.
+	if err := repo.DeleteUser(ctx, second.Email); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	duplicate.Email = second.Email
+	assertErrorIs(t, "CreateUser with the email of a deleted user", repo.CreateUser(ctx, duplicate), repository.ErrEmailConflict)
+
+	_, err := repo.UpdateField(ctx, first.Email, second.Email, "email")
+	assertErrorIs(t, "UpdateField", err, repository.ErrEmailConflict)
+	changed := *first
+	changed.Email = second.Email
+	_, err = repo.UpdateUser(ctx, first.Email, &changed)
+	assertErrorIs(t, "UpdateUser", err, repository.ErrEmailConflict)
+	found, err := repo.FindUserByID(ctx, first.UserId)
+	if err != nil || found.Email != first.Email {
+		t.Fatalf("a rejected update changed the email: %+v %v", found, err)
+	}
+}
+
+func testUpdateUser(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(1)
+	createUser(t, repo, user)
+
+	changed := *user
+	changed.Name = "Changed"
+	changed.Email = "changed-" + user.Email
+	changed.Locked = true
+	updated, err := repo.UpdateUser(ctx, user.Email, &changed)
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	changed.Version++
+	assertSameUser(t, updated, &changed)
+	if _, err := repo.FindUser(ctx, user.Email); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("the old email still finds the user: %v", err)
+	}
+	found, err := repo.FindUser(ctx, changed.Email)
+	if err != nil {
+		t.Fatalf("FindUser: %v", err)
+	}
+	assertSameUser(t, found, &changed)
+}
+
+func testUpdateField(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(1)
+	createUser(t, repo, user)
+
+	updated, err := repo.UpdateField(ctx, user.Email, "Renamed", "name")
+	if err != nil {
+		t.Fatalf("UpdateField(name): %v", err)
+	}
+	want := *user
+	want.Name = "Renamed"
+	want.Version++
+	assertSameUser(t, updated, &want)
+
+	newEmail := "new-" + user.Email
+	if _, err := repo.UpdateField(ctx, user.Email, newEmail, "email"); err != nil {
+		t.Fatalf("UpdateField(email): %v", err)
+	}
+	want.Email = newEmail
+	want.Version++
+	found, err := repo.FindUser(ctx, newEmail)
+	if err != nil {
+		t.Fatalf("FindUser: %v", err)
+	}
+	assertSameUser(t, found, &want)
+}
+
+func testSoftDeleteAndRestore(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(1)
+	createUser(t, repo, user)
+
+	if err := repo.DeleteUser(ctx, user.Email); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	deleted, err := repo.FindUser(ctx, user.Email)
+	if err != nil {
+		t.Fatalf("FindUser of a deleted user: %v", err)
+	}
+	if !deleted.IsDeleted() || deleted.SessionVersion != user.SessionVersion+1 {
+		t.Fatalf("deleted user = %+v, want deleted_at set and the session version bumped", deleted)
+	}
+	assertErrorIs(t, "DeleteUser twice", repo.DeleteUser(ctx, user.Email), repository.ErrUserNotFound)
+
+	restored, err := repo.RestoreUser(ctx, user.UserId)
+	if err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+	if restored.IsDeleted() {
+		t.Fatalf("restored user is still deleted")
+	}
+	_, err = repo.RestoreUser(ctx, user.UserId)
+	assertErrorIs(t, "RestoreUser of an active user", err, repository.ErrUserNotFound)
+
+	if err := repo.HardDeleteUser(ctx, user.UserId); err != nil {
+		t.Fatalf("HardDeleteUser: %v", err)
+	}
+	_, err = repo.FindUserByID(ctx, user.UserId)
+	assertErrorIs(t, "FindUserByID after HardDeleteUser", err, repository.ErrUserNotFound)
+}
+
+func testSessionVersionBumps(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(1)
+	createUser(t, repo, user)
+
+	if err := repo.ForcePasswordReset(ctx, user.UserId, user.SessionVersion); err != nil {
+		t.Fatalf("ForcePasswordReset: %v", err)
+	}
+	found, _ := repo.FindUserByID(ctx, user.UserId)
+	if !found.PasswordResetRequired || found.SessionVersion != user.SessionVersion+1 {
+		t.Fatalf("after ForcePasswordReset user = %+v", found)
+	}
+	// La version leida ya no es la actual: el enlace que la llevaba ya se uso.
+	err := repo.ForcePasswordReset(ctx, user.UserId, user.SessionVersion)
+	assertErrorIs(t, "ForcePasswordReset with a stale session version", err, repository.ErrVersionConflict)
+	updated, err := repo.SetPasswordHash(ctx, user.UserId, "new-hash")
+	if err != nil {
+		t.Fatalf("SetPasswordHash: %v", err)
+	}
+	if updated.PasswordResetRequired || updated.PasswordHash != "new-hash" || updated.SessionVersion != user.SessionVersion+2 {
+		t.Fatalf("after SetPasswordHash user = %+v", updated)
+	}
+}
+
+func testListUsersOrdering(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	// Nombres repetidos y fechas iguales para probar el desempate por id.
+	var users []models.User
+	for i := range 7 {
+		user := newUser(i)
+		user.Name = []string{"Carla", "ana", "Bruno", "Ana", "Carla", "Émile", "Zoe"}[i]
+		if i%3 == 0 {
+			user.CreatedAt = baseTime
+		}
+		createUser(t, repo, user)
+		users = append(users, *user)
+	}
+
+	for _, sortBy := range []string{repository.SortByCreatedAt, repository.SortByEmail, repository.SortByName, repository.SortByLastName} {
+		for _, desc := range []bool{false, true} {
+			want := slices.Clone(users)
+			slices.SortFunc(want, func(a, b models.User) int {
+				result := 0
+				if sortBy == repository.SortByCreatedAt {
+					result = a.CreatedAt.Compare(b.CreatedAt)
+				} else {
+					result = strings.Compare(sortField(&a, sortBy), sortField(&b, sortBy))
+				}
+				if result == 0 {
+					result = strings.Compare(a.UserId, b.UserId)
+				}
+				if desc {
+					return -result
+				}
+				return result
+			})
+
+			var got []string
+			filter := repository.UserListFilter{SortBy: sortBy, SortDesc: desc, Limit: 3}
+			for pages := 0; ; pages++ {
+				if pages > len(users) {
+					t.Fatalf("sort %s desc=%v: the cursor never ends", sortBy, desc)
+				}
+				page, err := repo.ListUsers(ctx, filter)
+				if err != nil {
+					t.Fatalf("ListUsers: %v", err)
+				}
+				for _, user := range page.Users {
+					got = append(got, user.UserId)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				filter.Cursor = page.NextCursor
+			}
+			var wantIds []string
+			for _, user := range want {
+				wantIds = append(wantIds, user.UserId)
+			}
+			if !slices.Equal(got, wantIds) {
+				t.Fatalf("sort %s desc=%v: got %v, want %v", sortBy, desc, got, wantIds)
+			}
+		}
+	}
+
+	_, err := repo.ListUsers(ctx, repository.UserListFilter{Cursor: "not-a-cursor"})
+	assertErrorIs(t, "ListUsers with an invalid cursor", err, repository.ErrInvalidCursor)
+}
+
+func sortField(user *models.User, sortBy string) string {
+	switch sortBy {
+	case repository.SortByEmail:
+		return user.Email
+	case repository.SortByName:
+		return user.Name
+	default:
+		return user.LastName
+	}
+}
+
+func testListUsersFilters(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	active, locked, admin, deleted, tenant := newUser(1), newUser(2), newUser(3), newUser(4), newUser(5)
+	active.Name = "Searchable"
+	locked.Locked = true
+	admin.Role = models.RoleAdmin
+	admin.Verified = true
+	tenant.TenantId = "tenant-a"
+	for _, user := range []*models.User{active, locked, admin, deleted, tenant} {
+		createUser(t, repo, user)
+	}
+	if err := repo.DeleteUser(ctx, deleted.Email); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	verified, isLocked := true, true
+	createdAfter := admin.CreatedAt
+	tests := []struct {
+		name   string
+		filter repository.UserListFilter
+		want   []*models.User
+	}{
+		{"active users", repository.UserListFilter{}, []*models.User{active, locked, admin, tenant}},
+		{"deleted users", repository.UserListFilter{OnlyDeleted: true}, []*models.User{deleted}},
+		{"search is a case-insensitive prefix", repository.UserListFilter{Search: "sEARCH"}, []*models.User{active}},
+		{"search does not match the middle", repository.UserListFilter{Search: "archable"}, nil},
+		{"search escapes wildcards", repository.UserListFilter{Search: "S%"}, nil},
+		{"role", repository.UserListFilter{Role: models.RoleAdmin}, []*models.User{admin}},
+		{"verified", repository.UserListFilter{Verified: &verified}, []*models.User{admin}},
+		{"locked", repository.UserListFilter{Locked: &isLocked}, []*models.User{locked}},
+		{"tenant", repository.UserListFilter{TenantId: "tenant-a"}, []*models.User{tenant}},
+		{"created after", repository.UserListFilter{CreatedAfter: &createdAfter}, []*models.User{tenant}},
+	}
+	for _, test := range tests {
+		page, err := repo.ListUsers(ctx, test.filter)
+		if err != nil {
+			t.Fatalf("%s: ListUsers: %v", test.name, err)
+		}
+		var got, want []string
+		for _, user := range page.Users {
+			got = append(got, user.UserId)
+		}
+		for _, user := range test.want {
+			want = append(want, user.UserId)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("%s: got %v, want %v", test.name, got, want)
+		}
+	}
+}
+
+// testSearchAfterUpdate comprueba que la busqueda sigue a los cambios de
+// nombre y apellido hechos con UpdateField y UpdateUser.
+func testSearchAfterUpdate(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(1)
+	createUser(t, repo, user)
+	search := func(text string) int {
+		t.Helper()
+		page, err := repo.ListUsers(ctx, repository.UserListFilter{Search: text})
+		if err != nil {
+			t.Fatalf("ListUsers(%q): %v", text, err)
+		}
+		return len(page.Users)
+	}
+
+	updated, err := repo.UpdateField(ctx, user.Email, "Zebra", "name")
+	if err != nil {
+		t.Fatalf("UpdateField(name): %v", err)
+	}
+	if search("zEB") != 1 || search("Name01") != 0 {
+		t.Fatal("the search does not follow the name set with UpdateField")
+	}
+	updated.LastName = "Quokka"
+	if _, err := repo.UpdateUser(ctx, updated.Email, updated); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if search("QUO") != 1 || search("zeb") != 1 {
+		t.Fatal("the search does not follow the last name set with UpdateUser")
+	}
+}
+
+func testFindTenantUsers(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	var users []*models.User
+	for i := range 5 {
+		user := newUser(i)
+		user.TenantId = "tenant-a"
+		user.ExternalId = fmt.Sprintf("external-%d", i%2)
+		createUser(t, repo, user)
+		users = append(users, user)
+	}
+	other, deleted := newUser(5), newUser(6)
+	other.TenantId = "tenant-b"
+	other.ExternalId = "external-0"
+	deleted.TenantId = "tenant-a"
+	for _, user := range []*models.User{other, deleted} {
+		createUser(t, repo, user)
+	}
+	if err := repo.DeleteUser(ctx, deleted.Email); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     repository.TenantUserQuery
+		want      []*models.User
+		wantTotal int
+	}{
+		{"whole tenant", repository.TenantUserQuery{TenantId: "tenant-a", Limit: 10}, users, 5},
+		{"offset and limit", repository.TenantUserQuery{TenantId: "tenant-a", Offset: 1, Limit: 2}, users[1:3], 5},
+		{"offset past the end", repository.TenantUserQuery{TenantId: "tenant-a", Offset: 5, Limit: 2}, nil, 5},
+		{"zero limit only counts", repository.TenantUserQuery{TenantId: "tenant-a"}, nil, 5},
+		{"email", repository.TenantUserQuery{TenantId: "tenant-a", Email: users[2].Email, Limit: 10}, users[2:3], 1},
+		{"email of another tenant", repository.TenantUserQuery{TenantId: "tenant-a", Email: other.Email, Limit: 10}, nil, 0},
+		{"external id", repository.TenantUserQuery{TenantId: "tenant-a", ExternalId: "external-1", Limit: 10}, []*models.User{users[1], users[3]}, 2},
+		{"id and external id", repository.TenantUserQuery{TenantId: "tenant-a", UserId: users[1].UserId, ExternalId: "external-0", Limit: 10}, nil, 0},
+		{"deleted user", repository.TenantUserQuery{TenantId: "tenant-a", UserId: deleted.UserId, Limit: 10}, nil, 0},
+	}
+	for _, test := range tests {
+		page, err := repo.FindTenantUsers(ctx, test.query)
+		if err != nil {
+			t.Fatalf("%s: FindTenantUsers: %v", test.name, err)
+		}
+		var got, want []string
+		for _, user := range page.Users {
+			got = append(got, user.UserId)
+		}
+		for _, user := range test.want {
+			want = append(want, user.UserId)
+		}
+		if !slices.Equal(got, want) || page.Total != test.wantTotal {
+			t.Fatalf("%s: got %v (total %d), want %v (total %d)", test.name, got, page.Total, want, test.wantTotal)
+		}
+	}
+}
+
+func testFindUsersDeletedBefore(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	var deleted []*models.User
+	for i := range 4 {
+		user := newUser(i)
+		// Se crean en orden inverso al de borrado para probar el orden.
+		deletedAt := baseTime.Add(time.Duration(4-i) * time.Hour)
+		user.DeletedAt = &deletedAt
+		createUser(t, repo, user)
+		deleted = append(deleted, user)
+	}
+	createUser(t, repo, newUser(5))
+
+	users, err := repo.FindUsersDeletedBefore(ctx, baseTime.Add(3*time.Hour), 2)
+	if err != nil {
+		t.Fatalf("FindUsersDeletedBefore: %v", err)
+	}
+	if len(users) != 2 || users[0].UserId != deleted[3].UserId || users[1].UserId != deleted[2].UserId {
+		t.Fatalf("FindUsersDeletedBefore returned %+v, want the two oldest deletions first", users)
+	}
+	// El limite es inclusivo.
+	users, _ = repo.FindUsersDeletedBefore(ctx, baseTime.Add(3*time.Hour), 10)
+	if len(users) != 3 {
+		t.Fatalf("FindUsersDeletedBefore returned %d users, want 3", len(users))
+	}
+}
+
+func testConcurrentDuplicateEmail(t *testing.T, repo repository.UserRepository) {
+	email := newUser(0).Email
+	errs := make([]error, concurrency)
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		wg.Go(func() {
+			user := newUser(i)
+			user.Email = email
+			errs[i] = repo.CreateUser(context.Background(), user)
+		})
+	}
+	wg.Wait()
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, repository.ErrEmailConflict):
+			t.Fatalf("CreateUser: error = %v, want %v", err, repository.ErrEmailConflict)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("%d users were created with the same email, want 1", created)
+	}
+}
+
+func testConcurrentSessionBumps(t *testing.T, repo repository.UserRepository) {
+	user := newUser(1)
+	createUser(t, repo, user)
+	errs := make([]error, concurrency)
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		wg.Go(func() {
+			if i%2 == 0 {
+				errs[i] = repo.ForcePasswordReset(context.Background(), user.UserId, user.SessionVersion)
+			} else {
+				_, errs[i] = repo.SetPasswordHash(context.Background(), user.UserId, "hash")
+			}
+		})
+	}
+	wg.Wait()
+	// Todos los SetPasswordHash suben la version; de los ForcePasswordReset con
+	// la misma version leida, como mucho uno.
+	bumps, forced := 0, 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			bumps++
+			if i%2 == 0 {
+				forced++
+			}
+		case i%2 != 0 || !errors.Is(err, repository.ErrVersionConflict):
+			t.Fatalf("session bump: %v", err)
+		}
+	}
+	if forced > 1 {
+		t.Fatalf("%d ForcePasswordReset calls with the same session version succeeded, want at most 1", forced)
+	}
+	found, err := repo.FindUserByID(context.Background(), user.UserId)
+	if err != nil {
+		t.Fatalf("FindUserByID: %v", err)
+	}
+	if found.SessionVersion != user.SessionVersion+bumps {
+		t.Fatalf("session version = %d, want %d: a concurrent bump was lost", found.SessionVersion, user.SessionVersion+bumps)
+	}
+}
+
+func testVersionBumps(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(1)
+	createUser(t, repo, user)
+	writes := []struct {
+		name  string
+		write func() error
+	}{
+		{"UpdateUser", func() error {
+			current, err := repo.FindUserByID(ctx, user.UserId)
+			if err != nil {
+				return err
+			}
+			current.Name = "Changed"
+			_, err = repo.UpdateUser(ctx, current.Email, current)
+			return err
+		}},
+		{"UpdateField", func() error {
+			_, err := repo.UpdateField(ctx, user.Email, "Renamed", "name")
+			return err
+		}},
+		{"DeleteUser", func() error { return repo.DeleteUser(ctx, user.Email) }},
+		{"RestoreUser", func() error {
+			_, err := repo.RestoreUser(ctx, user.UserId)
+			return err
+		}},
+		{"ForcePasswordReset", func() error {
+			current, err := repo.FindUserByID(ctx, user.UserId)
+			if err != nil {
+				return err
+			}
+			return repo.ForcePasswordReset(ctx, user.UserId, current.SessionVersion)
+		}},
+		{"SetPasswordHash", func() error {
+			_, err := repo.SetPasswordHash(ctx, user.UserId, "new-hash")
+			return err
+		}},
+	}
+	version := user.Version
+	for _, write := range writes {
+		if err := write.write(); err != nil {
+			t.Fatalf("%s: %v", write.name, err)
+		}
+		found, err := repo.FindUserByID(ctx, user.UserId)
+		if err != nil {
+			t.Fatalf("FindUserByID: %v", err)
+		}
+		if found.Version != version+1 {
+			t.Fatalf("after %s version = %d, want %d", write.name, found.Version, version+1)
+		}
+		version = found.Version
+	}
+}
+
+func testStaleUpdateUser(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(1)
+	createUser(t, repo, user)
+	stale, err := repo.FindUserByID(ctx, user.UserId)
+	if err != nil {
+		t.Fatalf("FindUserByID: %v", err)
+	}
+	if err := repo.ForcePasswordReset(ctx, user.UserId, stale.SessionVersion); err != nil {
+		t.Fatalf("ForcePasswordReset: %v", err)
+	}
+
+	// Reemplazar con lo leido antes del reset desharia el aumento de sesion.
+	stale.Name = "Stale"
+	_, err = repo.UpdateUser(ctx, stale.Email, stale)
+	assertErrorIs(t, "UpdateUser with a stale version", err, repository.ErrVersionConflict)
+	found, err := repo.FindUserByID(ctx, user.UserId)
+	if err != nil {
+		t.Fatalf("FindUserByID: %v", err)
+	}
+	if found.Name != user.Name || found.SessionVersion != user.SessionVersion+1 || !found.PasswordResetRequired {
+		t.Fatalf("a rejected update changed the user: %+v", found)
+	}
+
+	found.Name = "Fresh"
+	updated, err := repo.UpdateUser(ctx, found.Email, found)
+	if err != nil {
+		t.Fatalf("UpdateUser with the current version: %v", err)
+	}
+	if updated.Name != "Fresh" || updated.Version != found.Version+1 || updated.SessionVersion != found.SessionVersion {
+		t.Fatalf("UpdateUser = %+v", updated)
+	}
+}
+
+func testConcurrentUpdateUser(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := newUser(1)
+	createUser(t, repo, user)
+	errs := make([]error, concurrency)
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		changed := *user
+		changed.Name = fmt.Sprintf("Name%02d", i)
+		wg.Go(func() {
+			_, errs[i] = repo.UpdateUser(ctx, user.Email, &changed)
+		})
+	}
+	wg.Wait()
+	updated := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			updated++
+		case !errors.Is(err, repository.ErrVersionConflict):
+			t.Fatalf("UpdateUser: error = %v, want %v", err, repository.ErrVersionConflict)
+		}
+	}
+	if updated != 1 {
+		t.Fatalf("%d concurrent updates of the same version succeeded, want 1", updated)
+	}
+}
@@ -0,0 +1,254 @@
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+// WebhookRepositoryFactory returns an empty repository. It is called once per
+// test.
+type WebhookRepositoryFactory func(t *testing.T) repository.WebhookRepository
+
+// RunWebhookRepositoryTests runs the WebhookRepository suite against the
+// repositories returned by newRepository.
+func RunWebhookRepositoryTests(t *testing.T, newRepository WebhookRepositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.WebhookRepository)
+	}{
+		{"Subscriptions", testWebhookSubscriptions},
+		{"SubscriptionsForEvent", testFindSubscriptionsForEvent},
+		{"CreateAndFindDelivery", testCreateAndFindWebhookDelivery},
+		{"ClaimDueDelivery", testClaimDueWebhookDelivery},
+		{"UpdateDelivery", testUpdateWebhookDelivery},
+		{"ListDeliveries", testListWebhookDeliveries},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+func createWebhookSubscription(t *testing.T, repo repository.WebhookRepository, id string, eventTypes []string, active bool, createdAt time.Time) models.WebhookSubscription {
+	t.Helper()
+	subscription := models.WebhookSubscription{
+		ID:         id,
+		URL:        "https://example.com/hooks/" + id,
+		EventTypes: eventTypes,
+		Secret:     "secret-" + id,
+		Active:     active,
+		CreatedAt:  createdAt,
+	}
+	if err := repo.CreateSubscription(context.Background(), &subscription); err != nil {
+		t.Fatalf("CreateSubscription(%s): %v", id, err)
+	}
+	return subscription
+}
+
+func subscriptionIds(subscriptions []models.WebhookSubscription) []string {
+	var ids []string
+	for _, subscription := range subscriptions {
+		ids = append(ids, subscription.ID)
+	}
+	return ids
+}
+
+func newWebhookDelivery(id string, subscriptionId string, nextAttemptAt time.Time) *models.WebhookDelivery {
+	return &models.WebhookDelivery{
+		ID:             id,
+		SubscriptionId: subscriptionId,
+		EventId:        "event-" + id,
+		EventType:      models.EventUserCreated,
+		Payload:        `{"user_id":"user-1"}`,
+		Status:         models.WebhookDeliveryPending,
+		NextAttemptAt:  nextAttemptAt,
+		CreatedAt:      baseTime,
+	}
+}
+
+func createWebhookDelivery(t *testing.T, repo repository.WebhookRepository, delivery *models.WebhookDelivery) {
+	t.Helper()
+	if err := repo.CreateDelivery(context.Background(), delivery); err != nil {
+		t.Fatalf("CreateDelivery(%s): %v", delivery.ID, err)
+	}
+}
+
+func testWebhookSubscriptions(t *testing.T, repo repository.WebhookRepository) {
+	ctx := context.Background()
+	second := createWebhookSubscription(t, repo, "subscription-2", []string{models.EventUserCreated, models.EventUserDeleted}, true, baseTime.Add(time.Minute))
+	first := createWebhookSubscription(t, repo, "subscription-1", []string{}, false, baseTime)
+
+	got, err := repo.FindSubscription(ctx, second.ID)
+	if err != nil || got.ID != second.ID || got.URL != second.URL || !slices.Equal(got.EventTypes, second.EventTypes) ||
+		got.Secret != second.Secret || got.Active != second.Active || !got.CreatedAt.Equal(second.CreatedAt) {
+		t.Fatalf("FindSubscription = %+v, %v; want %+v", got, err, second)
+	}
+	subscriptions, err := repo.ListSubscriptions(ctx)
+	if err != nil {
+		t.Fatalf("ListSubscriptions: %v", err)
+	}
+	if ids := subscriptionIds(subscriptions); !slices.Equal(ids, []string{first.ID, second.ID}) {
+		t.Fatalf("ListSubscriptions = %v, want the oldest first", ids)
+	}
+	if err := repo.DeleteSubscription(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteSubscription: %v", err)
+	}
+	if _, err := repo.FindSubscription(ctx, first.ID); !errors.Is(err, repository.ErrWebhookNotFound) {
+		t.Fatalf("FindSubscription after DeleteSubscription: error = %v, want %v", err, repository.ErrWebhookNotFound)
+	}
+	if err := repo.DeleteSubscription(ctx, first.ID); !errors.Is(err, repository.ErrWebhookNotFound) {
+		t.Fatalf("DeleteSubscription twice: error = %v, want %v", err, repository.ErrWebhookNotFound)
+	}
+}
+
+func testFindSubscriptionsForEvent(t *testing.T, repo repository.WebhookRepository) {
+	createWebhookSubscription(t, repo, "all-events", []string{}, true, baseTime)
+	createWebhookSubscription(t, repo, "created", []string{models.EventUserCreated}, true, baseTime.Add(time.Minute))
+	createWebhookSubscription(t, repo, "inactive", []string{models.EventUserCreated}, false, baseTime.Add(2*time.Minute))
+	tests := []struct {
+		eventType string
+		want      []string
+	}{
+		{models.EventUserCreated, []string{"all-events", "created"}},
+		{models.EventUserDeleted, []string{"all-events"}},
+	}
+	for _, test := range tests {
+		subscriptions, err := repo.FindSubscriptionsForEvent(context.Background(), test.eventType)
+		if err != nil {
+			t.Fatalf("FindSubscriptionsForEvent(%s): %v", test.eventType, err)
+		}
+		if ids := subscriptionIds(subscriptions); !slices.Equal(ids, test.want) {
+			t.Fatalf("FindSubscriptionsForEvent(%s) = %v, want %v", test.eventType, ids, test.want)
+		}
+	}
+}
+
+func testCreateAndFindWebhookDelivery(t *testing.T, repo repository.WebhookRepository) {
+	ctx := context.Background()
+	deliveredAt, expiresAt := baseTime.Add(time.Minute), baseTime.Add(24*time.Hour)
+	want := newWebhookDelivery("delivery-1", "subscription-1", baseTime)
+	want.Status = models.WebhookDeliveryDelivered
+	want.Attempts = 2
+	want.LastStatusCode = 200
+	want.LastError = "timeout"
+	want.DeliveredAt = &deliveredAt
+	want.ExpiresAt = &expiresAt
+	createWebhookDelivery(t, repo, want)
+	if err := repo.CreateDelivery(ctx, newWebhookDelivery(want.ID, "subscription-1", baseTime)); !errors.Is(err, repository.ErrWebhookDeliveryExists) {
+		t.Fatalf("CreateDelivery twice: error = %v, want %v", err, repository.ErrWebhookDeliveryExists)
+	}
+
+	got, err := repo.FindDelivery(ctx, want.ID)
+	if err != nil {
+		t.Fatalf("FindDelivery: %v", err)
+	}
+	if got.ID != want.ID || got.SubscriptionId != want.SubscriptionId || got.EventId != want.EventId ||
+		got.EventType != want.EventType || got.Payload != want.Payload || got.Status != want.Status ||
+		got.Attempts != want.Attempts || !got.NextAttemptAt.Equal(want.NextAttemptAt) ||
+		got.LastStatusCode != want.LastStatusCode || got.LastError != want.LastError || !got.CreatedAt.Equal(want.CreatedAt) ||
+		!equalTimes(got.DeliveredAt, want.DeliveredAt) || !equalTimes(got.ExpiresAt, want.ExpiresAt) {
+		t.Fatalf("FindDelivery = %+v, want %+v", got, want)
+	}
+	if _, err := repo.FindDelivery(ctx, "missing"); !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+		t.Fatalf("FindDelivery of a missing delivery: error = %v, want %v", err, repository.ErrWebhookDeliveryNotFound)
+	}
+}
+
+func testClaimDueWebhookDelivery(t *testing.T, repo repository.WebhookRepository) {
+	ctx := context.Background()
+	createWebhookDelivery(t, repo, newWebhookDelivery("later", "subscription-1", baseTime))
+	createWebhookDelivery(t, repo, newWebhookDelivery("earlier", "subscription-1", baseTime.Add(-time.Minute)))
+	createWebhookDelivery(t, repo, newWebhookDelivery("future", "subscription-1", baseTime.Add(time.Minute)))
+	delivered := newWebhookDelivery("delivered", "subscription-1", baseTime.Add(-time.Hour))
+	delivered.Status = models.WebhookDeliveryDelivered
+	createWebhookDelivery(t, repo, delivered)
+
+	claimed, err := repo.ClaimDueDelivery(ctx, baseTime, 30*time.Second)
+	if err != nil {
+		t.Fatalf("ClaimDueDelivery: %v", err)
+	}
+	// Se devuelve como estaba antes de tomar el lease.
+	if claimed.ID != "earlier" || !claimed.NextAttemptAt.Equal(baseTime.Add(-time.Minute)) {
+		t.Fatalf("ClaimDueDelivery = %+v, want the earlier delivery before its lease", claimed)
+	}
+	if stored, err := repo.FindDelivery(ctx, "earlier"); err != nil || !stored.NextAttemptAt.Equal(baseTime.Add(30*time.Second)) {
+		t.Fatalf("FindDelivery after the claim = %+v, %v; want the next attempt after the lease", stored, err)
+	}
+	if claimed, err := repo.ClaimDueDelivery(ctx, baseTime, 30*time.Second); err != nil || claimed.ID != "later" {
+		t.Fatalf("second ClaimDueDelivery = %+v, %v; want the later delivery", claimed, err)
+	}
+	if claimed, err := repo.ClaimDueDelivery(ctx, baseTime, 30*time.Second); !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+		t.Fatalf("ClaimDueDelivery with nothing due = %+v, %v; want %v", claimed, err, repository.ErrWebhookDeliveryNotFound)
+	}
+}
+
+func testUpdateWebhookDelivery(t *testing.T, repo repository.WebhookRepository) {
+	ctx := context.Background()
+	delivery := newWebhookDelivery("delivery-1", "subscription-1", baseTime)
+	createWebhookDelivery(t, repo, delivery)
+	deliveredAt, expiresAt := baseTime.Add(time.Second), baseTime.Add(24*time.Hour)
+	delivery.Status = models.WebhookDeliveryDelivered
+	delivery.Attempts = 1
+	delivery.LastStatusCode = 204
+	delivery.DeliveredAt = &deliveredAt
+	delivery.ExpiresAt = &expiresAt
+	if err := repo.UpdateDelivery(ctx, delivery); err != nil {
+		t.Fatalf("UpdateDelivery: %v", err)
+	}
+	stored, err := repo.FindDelivery(ctx, delivery.ID)
+	if err != nil || stored.Status != models.WebhookDeliveryDelivered || stored.Attempts != 1 || stored.LastStatusCode != 204 ||
+		!equalTimes(stored.DeliveredAt, &deliveredAt) || !equalTimes(stored.ExpiresAt, &expiresAt) {
+		t.Fatalf("FindDelivery after UpdateDelivery = %+v, %v", stored, err)
+	}
+	if _, err := repo.ClaimDueDelivery(ctx, baseTime.Add(time.Hour), time.Minute); !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+		t.Fatalf("ClaimDueDelivery of a delivered delivery: error = %v, want %v", err, repository.ErrWebhookDeliveryNotFound)
+	}
+	if err := repo.UpdateDelivery(ctx, newWebhookDelivery("missing", "subscription-1", baseTime)); !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+		t.Fatalf("UpdateDelivery of a missing delivery: error = %v, want %v", err, repository.ErrWebhookDeliveryNotFound)
+	}
+}
+
+func testListWebhookDeliveries(t *testing.T, repo repository.WebhookRepository) {
+	ctx := context.Background()
+	for i, id := range []string{"delivery-1", "delivery-2", "delivery-3"} {
+		delivery := newWebhookDelivery(id, "subscription-1", baseTime)
+		// delivery-2 y delivery-3 comparten fecha: el id decide el orden.
+		delivery.CreatedAt = baseTime.Add(time.Duration(min(i, 1)) * time.Minute)
+		if id == "delivery-2" {
+			delivery.Status = models.WebhookDeliveryDeadLetter
+		}
+		createWebhookDelivery(t, repo, delivery)
+	}
+	createWebhookDelivery(t, repo, newWebhookDelivery("other", "subscription-2", baseTime))
+
+	list := func(filter repository.WebhookDeliveryFilter) ([]string, string) {
+		t.Helper()
+		page, err := repo.ListDeliveries(ctx, filter)
+		if err != nil {
+			t.Fatalf("ListDeliveries(%+v): %v", filter, err)
+		}
+		var ids []string
+		for _, delivery := range page.Deliveries {
+			ids = append(ids, delivery.ID)
+		}
+		return ids, page.NextCursor
+	}
+	first, cursor := list(repository.WebhookDeliveryFilter{SubscriptionId: "subscription-1", Limit: 2})
+	second, last := list(repository.WebhookDeliveryFilter{SubscriptionId: "subscription-1", Limit: 2, Cursor: cursor})
+	if got, want := append(first, second...), []string{"delivery-3", "delivery-2", "delivery-1"}; !slices.Equal(got, want) || last != "" {
+		t.Fatalf("pages = %v (cursor %q), want %v", got, last, want)
+	}
+	filtered, _ := list(repository.WebhookDeliveryFilter{SubscriptionId: "subscription-1", Status: models.WebhookDeliveryPending})
+	if want := []string{"delivery-3", "delivery-1"}; !slices.Equal(filtered, want) {
+		t.Fatalf("ListDeliveries of the pending deliveries = %v, want %v", filtered, want)
+	}
+	if _, err := repo.ListDeliveries(ctx, repository.WebhookDeliveryFilter{SubscriptionId: "subscription-1", Cursor: "not-a-cursor"}); !errors.Is(err, repository.ErrInvalidCursor) {
+		t.Fatalf("ListDeliveries with a bad cursor: error = %v, want %v", err, repository.ErrInvalidCursor)
+	}
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// TransactionManager runs fn in a transaction. Repositories join it when they
+// receive the ctx passed to fn.
+type TransactionManager interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type mongoTransactionManager struct {
+	client *mongo.Client
+}
+
+// NewMongoTransactionManager requires MongoDB to run as a replica set.
+func NewMongoTransactionManager(client *mongo.Client) TransactionManager {
+	return &mongoTransactionManager{
+		client: client,
+	}
+}
+
+// WithTransaction implements TransactionManager.
+func (m *mongoTransactionManager) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := m.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		return nil, fn(txCtx)
+	})
+	return err
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// EnsureUserIndexes creates the unique email index and the indexes used by
+// ListUsers: one per sortable field (with _id as tie breaker for the keyset
+// cursor, not needed for the unique email) plus the filters, and the
+// deleted_at index the purge worker scans. SCIM lists the users of a tenant
+// through the tenant_id index.
+func EnsureUserIndexes(ctx context.Context, client *mongo.Client, dbName string, collectionName string) error {
+	collection := client.Database(dbName).Collection(collectionName)
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "last_name", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "role", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "verified", Value: 1}, {Key: "locked", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	}
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// EnsureUserSearchIndexes creates the indexes of the lowercased name and last
+// name ListUsers searches by prefix; the email one is the unique index.
+func EnsureUserSearchIndexes(ctx context.Context, client *mongo.Client, dbName string, collectionName string) error {
+	collection := client.Database(dbName).Collection(collectionName)
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "search_name", Value: 1}}},
+		{Keys: bson.D{{Key: "search_last_name", Value: 1}}},
+	}
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
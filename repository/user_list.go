@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+	"users-microservice/models"
+)
+
+const (
+	SortByCreatedAt = "created_at"
+	SortByEmail     = "email"
+	SortByName      = "name"
+	SortByLastName  = "last_name"
+
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// UserListFilter describes a page request for ListUsers. Search is matched as
+// a case-insensitive prefix against name, last name and email. Soft deleted
+// users are only returned when OnlyDeleted is set. TenantId restricts the page
+// to the users provisioned by that SCIM tenant.
+type UserListFilter struct {
+	TenantId     string
+	Search       string
+	Verified     *bool
+	Locked       *bool
+	Role         string
+	CreatedAfter *time.Time
+	OnlyDeleted  bool
+	SortBy       string
+	SortDesc     bool
+	Cursor       string
+	Limit        int
+}
+
+type UserPage struct {
+	Users      []models.User
+	NextCursor string
+}
+
+// TenantUserQuery is a lookup of the active users of a SCIM tenant by exact
+// email, external id or id; empty fields match every user. The users come
+// oldest first, Offset of them are skipped and at most Limit returned, so a
+// zero Limit only counts them.
+type TenantUserQuery struct {
+	TenantId   string
+	Email      string
+	ExternalId string
+	UserId     string
+	Offset     int
+	Limit      int
+}
+
+// TenantUserPage is a page of FindTenantUsers. Total counts every user that
+// matches the query, not just the ones of the page.
+type TenantUserPage struct {
+	Users []models.User
+	Total int
+}
+
+// listCursor is the keyset position of the last user of a page: the value of
+// the sort field plus the id to break ties.
+type listCursor struct {
+	Value string `json:"v"`
+	Id    string `json:"id"`
+}
+
+func (filter *UserListFilter) normalize() {
+	if filter.SortBy == "" {
+		filter.SortBy = SortByCreatedAt
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultListLimit
+	}
+	if filter.Limit > MaxListLimit {
+		filter.Limit = MaxListLimit
+	}
+}
+
+func sortValue(user *models.User, sortBy string) string {
+	switch sortBy {
+	case SortByEmail:
+		return user.Email
+	case SortByName:
+		return user.Name
+	case SortByLastName:
+		return user.LastName
+	default:
+		return user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+func encodeCursor(user *models.User, sortBy string) string {
+	return encodeKeysetCursor(sortValue(user, sortBy), user.UserId)
+}
+
+func encodeKeysetCursor(value string, id string) string {
+	raw, _ := json.Marshal(listCursor{Value: value, Id: id})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string) (*listCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var decoded listCursor
+	if err := json.Unmarshal(raw, &decoded); err != nil || decoded.Id == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &decoded, nil
+}
@@ -3,6 +3,9 @@ package repository
 import (
 	"context"
 	"errors"
+	"regexp"
+	"strings"
+	"time"
 	"users-microservice/models"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -14,15 +17,51 @@ type UserRepository interface {
 	CreateUser(ctx context.Context, user *models.User) error
 	FindUser(ctx context.Context, email string) (*models.User, error)
 	FindUserByID(ctx context.Context, userId string) (*models.User, error)
+	// UpdateUser replaces the user only if its version is still user.Version,
+	// and returns ErrVersionConflict otherwise. Every write bumps the version.
 	UpdateUser(ctx context.Context, email string, user *models.User) (*models.User, error)
 	DeleteUser(ctx context.Context, email string) error
 	UpdateField(ctx context.Context, email string, newValue interface{}, field string) (*models.User, error)
+	ListUsers(ctx context.Context, filter UserListFilter) (*UserPage, error)
+	FindTenantUsers(ctx context.Context, query TenantUserQuery) (*TenantUserPage, error)
+	RestoreUser(ctx context.Context, userId string) (*models.User, error)
+	FindUsersDeletedBefore(ctx context.Context, before time.Time, limit int) ([]models.User, error)
+	HardDeleteUser(ctx context.Context, userId string) error
+	// ForcePasswordReset only applies while the session version of the user is
+	// still sessionVersion, and returns ErrVersionConflict otherwise.
+	ForcePasswordReset(ctx context.Context, userId string, sessionVersion int) error
+	SetPasswordHash(ctx context.Context, userId string, passwordHash string) (*models.User, error)
 }
 
 type mongoUserRepository struct {
 	collection *mongo.Collection
 }
 
+// mongoUserDocument is the stored form of a user: the user plus its name and
+// last name lowercased, so ListUsers can search them with an anchored,
+// case-sensitive prefix that MongoDB answers from their indexes. Emails are
+// already stored lowercased. Decoding into models.User ignores the extra fields.
+type mongoUserDocument struct {
+	models.User    `bson:",inline"`
+	SearchName     string `bson:"search_name"`
+	SearchLastName string `bson:"search_last_name"`
+}
+
+// mongoUserSearchFields maps the fields UpdateField can change to the
+// lowercased copy that has to change with them.
+var mongoUserSearchFields = map[string]string{
+	"name":      "search_name",
+	"last_name": "search_last_name",
+}
+
+func newMongoUserDocument(user models.User) mongoUserDocument {
+	return mongoUserDocument{
+		User:           user,
+		SearchName:     strings.ToLower(user.Name),
+		SearchLastName: strings.ToLower(user.LastName),
+	}
+}
+
 // FindUserByID implements UserRepository.
 func (repo *mongoUserRepository) FindUserByID(ctx context.Context, userId string) (*models.User, error) {
 	var user models.User
@@ -40,6 +79,8 @@ func (repo *mongoUserRepository) FindUserByID(ctx context.Context, userId string
 // UpdateField implements UserRepository.
 
 var ErrUserNotFound = errors.New("user not found")
+var ErrEmailConflict = errors.New("email is already registered")
+var ErrVersionConflict = errors.New("user was modified by another request")
 
 func NewMongoUserRepository(client *mongo.Client, dbName string, collectionName string) UserRepository {
 	collection := client.Database(dbName).Collection(collectionName)
@@ -50,14 +91,65 @@ func NewMongoUserRepository(client *mongo.Client, dbName string, collectionName
 
 // CreateUser implements UserRepository.
 func (repo *mongoUserRepository) CreateUser(ctx context.Context, user *models.User) error {
-	_, err := repo.collection.InsertOne(ctx, user)
+	_, err := repo.collection.InsertOne(ctx, newMongoUserDocument(*user))
+	if isDuplicateEmail(err) {
+		return ErrEmailConflict
+	}
 	return err
 }
 
-// DeleteUser implements UserRepository.
+// DeleteUser implements UserRepository. The user is only marked as deleted and
+// its session version is bumped; HardDeleteUser removes the document.
 func (repo *mongoUserRepository) DeleteUser(ctx context.Context, email string) error {
-	filter := bson.M{"email": email}
-	_, err := repo.collection.DeleteOne(ctx, filter)
+	filter := bson.M{"email": email, "deleted_at": bson.M{"$exists": false}}
+	update := bson.M{
+		"$set": bson.M{"deleted_at": time.Now().UTC()},
+		"$inc": bson.M{"sessions": 1, "version": 1},
+	}
+	result, err := repo.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// RestoreUser implements UserRepository.
+func (repo *mongoUserRepository) RestoreUser(ctx context.Context, userId string) (*models.User, error) {
+	var user models.User
+	filter := bson.M{"_id": userId, "deleted_at": bson.M{"$exists": true}}
+	update := bson.M{"$unset": bson.M{"deleted_at": ""}, "$inc": bson.M{"version": 1}}
+	config := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := repo.collection.FindOneAndUpdate(ctx, filter, update, config).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindUsersDeletedBefore implements UserRepository.
+func (repo *mongoUserRepository) FindUsersDeletedBefore(ctx context.Context, before time.Time, limit int) ([]models.User, error) {
+	filter := bson.M{"deleted_at": bson.M{"$lte": before}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := repo.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// HardDeleteUser implements UserRepository.
+func (repo *mongoUserRepository) HardDeleteUser(ctx context.Context, userId string) error {
+	_, err := repo.collection.DeleteOne(ctx, bson.M{"_id": userId})
 	return err
 }
 
@@ -75,19 +167,30 @@ func (repo *mongoUserRepository) FindUser(ctx context.Context, email string) (*m
 	return &user, nil
 }
 
-// UpdateUser implements UserRepository.
+// UpdateUser implements UserRepository. The whole document is replaced, so
+// user must be a complete user as returned by FindUser.
 func (repo *mongoUserRepository) UpdateUser(ctx context.Context, email string, user *models.User) (*models.User, error) {
 	var userUpdated models.User
-	filter := bson.M{"email": email}
-	replacement := models.User{
-		Name:         user.Name,
-		Email:        user.Email,
-		LastName:     user.LastName,
-		PasswordHash: user.PasswordHash,
-		UserId:       user.UserId}
+	filter := bson.M{"email": email, "version": user.Version}
+	replacement := newMongoUserDocument(*user)
+	replacement.Version++
 	config := options.FindOneAndReplace().SetReturnDocument(options.After)
 	mongoErr := repo.collection.FindOneAndReplace(ctx, filter, replacement, config).Decode(&userUpdated)
 	if mongoErr != nil {
+		if mongoErr == mongo.ErrNoDocuments {
+			// Distingue un usuario inexistente de uno modificado desde que se leyo.
+			count, countErr := repo.collection.CountDocuments(ctx, bson.M{"email": email})
+			if countErr != nil {
+				return nil, countErr
+			}
+			if count > 0 {
+				return nil, ErrVersionConflict
+			}
+			return nil, ErrUserNotFound
+		}
+		if isDuplicateEmail(mongoErr) {
+			return nil, ErrEmailConflict
+		}
 		return nil, mongoErr
 	}
 	return &userUpdated, nil
@@ -96,13 +199,175 @@ func (repo *mongoUserRepository) UpdateUser(ctx context.Context, email string, u
 func (repo *mongoUserRepository) UpdateField(ctx context.Context, email string, newValue interface{}, field string) (*models.User, error) {
 	var user models.User
 	filter := bson.M{"email": email}
+	set := bson.M{field: newValue}
+	if searchField, ok := mongoUserSearchFields[field]; ok {
+		value, _ := newValue.(string)
+		set[searchField] = strings.ToLower(value)
+	}
 	update := bson.M{
-		"$set": bson.M{
-			field: newValue,
-		},
+		"$set": set,
+		"$inc": bson.M{"version": 1},
 	}
 	config := options.FindOneAndUpdate().SetReturnDocument(options.After)
 	err := repo.collection.FindOneAndUpdate(ctx, filter, update, config).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		if isDuplicateEmail(err) {
+			return nil, ErrEmailConflict
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsers implements UserRepository.
+func (repo *mongoUserRepository) ListUsers(ctx context.Context, filter UserListFilter) (*UserPage, error) {
+	filter.normalize()
+	conditions := bson.A{bson.M{"deleted_at": bson.M{"$exists": filter.OnlyDeleted}}}
+	if filter.Search != "" {
+		// Sin la opcion "i" el prefijo anclado usa los indices de cada campo.
+		prefix := bson.Regex{Pattern: "^" + regexp.QuoteMeta(strings.ToLower(filter.Search))}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"search_name": prefix},
+			bson.M{"search_last_name": prefix},
+			bson.M{"email": prefix},
+		}})
+	}
+	if filter.TenantId != "" {
+		conditions = append(conditions, bson.M{"tenant_id": filter.TenantId})
+	}
+	if filter.Verified != nil {
+		conditions = append(conditions, bson.M{"verified": *filter.Verified})
+	}
+	if filter.Locked != nil {
+		conditions = append(conditions, bson.M{"locked": *filter.Locked})
+	}
+	if filter.Role != "" {
+		conditions = append(conditions, bson.M{"role": filter.Role})
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, bson.M{"created_at": bson.M{"$gt": *filter.CreatedAfter}})
+	}
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{} = cursor.Value
+		if filter.SortBy == SortByCreatedAt {
+			parsed, err := time.Parse(time.RFC3339Nano, cursor.Value)
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			value = parsed
+		}
+		operator := "$gt"
+		if filter.SortDesc {
+			operator = "$lt"
+		}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{filter.SortBy: bson.M{operator: value}},
+			bson.M{filter.SortBy: value, "_id": bson.M{operator: cursor.Id}},
+		}})
+	}
+	query := bson.M{"$and": conditions}
+
+	direction := 1
+	if filter.SortDesc {
+		direction = -1
+	}
+	// Se pide un documento extra para saber si existe una pagina siguiente.
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: filter.SortBy, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(filter.Limit + 1))
+	cursor, err := repo.collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	page := &UserPage{Users: users}
+	if len(users) > filter.Limit {
+		page.Users = users[:filter.Limit]
+		page.NextCursor = encodeCursor(&page.Users[filter.Limit-1], filter.SortBy)
+	}
+	return page, nil
+}
+
+// FindTenantUsers implements UserRepository.
+func (repo *mongoUserRepository) FindTenantUsers(ctx context.Context, query TenantUserQuery) (*TenantUserPage, error) {
+	filter := bson.M{"tenant_id": query.TenantId, "deleted_at": bson.M{"$exists": false}}
+	if query.Email != "" {
+		filter["email"] = query.Email
+	}
+	if query.ExternalId != "" {
+		filter["external_id"] = query.ExternalId
+	}
+	if query.UserId != "" {
+		filter["_id"] = query.UserId
+	}
+	total, err := repo.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	page := &TenantUserPage{Total: int(total)}
+	// Limit 0 en Find significa sin limite, asi que solo se cuenta.
+	if query.Limit <= 0 || query.Offset >= page.Total {
+		return page, nil
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(query.Offset)).
+		SetLimit(int64(query.Limit))
+	cursor, err := repo.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &page.Users); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// ForcePasswordReset implements UserRepository. Bumping the session version
+// invalidates every refresh token issued before.
+func (repo *mongoUserRepository) ForcePasswordReset(ctx context.Context, userId string, sessionVersion int) error {
+	update := bson.M{
+		"$set": bson.M{"password_reset_required": true},
+		"$inc": bson.M{"sessions": 1, "version": 1},
+	}
+	result, err := repo.collection.UpdateOne(ctx, bson.M{"_id": userId, "sessions": sessionVersion}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		count, err := repo.collection.CountDocuments(ctx, bson.M{"_id": userId})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrVersionConflict
+		}
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// SetPasswordHash implements UserRepository. It also clears the reset flag and
+// bumps the session version.
+func (repo *mongoUserRepository) SetPasswordHash(ctx context.Context, userId string, passwordHash string) (*models.User, error) {
+	var user models.User
+	update := bson.M{
+		"$set": bson.M{"password_hash": passwordHash, "password_reset_required": false},
+		"$inc": bson.M{"sessions": 1, "version": 1},
+	}
+	config := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := repo.collection.FindOneAndUpdate(ctx, bson.M{"_id": userId}, update, config).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, ErrUserNotFound
@@ -111,3 +376,9 @@ func (repo *mongoUserRepository) UpdateField(ctx context.Context, email string,
 	}
 	return &user, nil
 }
+
+// isDuplicateEmail reports whether err violates the unique email index created
+// by EnsureUserIndexes.
+func isDuplicateEmail(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "email")
+}
@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"users-microservice/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrWebhookNotFound = errors.New("webhook subscription not found")
+var ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+var ErrWebhookDeliveryExists = errors.New("webhook delivery already exists")
+
+type WebhookDeliveryFilter struct {
+	SubscriptionId string
+	Status         string
+	Cursor         string
+	Limit          int
+}
+
+type WebhookDeliveryPage struct {
+	Deliveries []models.WebhookDelivery
+	NextCursor string
+}
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error
+	FindSubscription(ctx context.Context, subscriptionId string) (*models.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	FindSubscriptionsForEvent(ctx context.Context, eventType string) ([]models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, subscriptionId string) error
+	CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	FindDelivery(ctx context.Context, deliveryId string) (*models.WebhookDelivery, error)
+	ClaimDueDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	ListDeliveries(ctx context.Context, filter WebhookDeliveryFilter) (*WebhookDeliveryPage, error)
+}
+
+type mongoWebhookRepository struct {
+	subscriptions *mongo.Collection
+	deliveries    *mongo.Collection
+}
+
+func NewWebhookRepository(client *mongo.Client, dbName string, subscriptionsCollection string, deliveriesCollection string) WebhookRepository {
+	database := client.Database(dbName)
+	return &mongoWebhookRepository{
+		subscriptions: database.Collection(subscriptionsCollection),
+		deliveries:    database.Collection(deliveriesCollection),
+	}
+}
+
+// legacyWebhookLogTTLIndex is the TTL index on created_at of earlier versions,
+// which also deleted the deliveries still pending.
+const legacyWebhookLogTTLIndex = "created_at_1"
+
+// EnsureWebhookIndexes creates the index used by the delivery worker, the
+// delivery log index and the TTL index on expires_at, which only the delivered
+// and dead lettered deliveries have. It replaces the TTL index on created_at
+// of earlier versions and gives the finished deliveries stored before an
+// expires_at retention after their creation.
+func EnsureWebhookIndexes(ctx context.Context, client *mongo.Client, dbName string, subscriptionsCollection string, deliveriesCollection string, retention time.Duration) error {
+	database := client.Database(dbName)
+	_, err := database.Collection(subscriptionsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "active", Value: 1}, {Key: "event_types", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "subscription_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+	deliveries := database.Collection(deliveriesCollection)
+	if _, err := deliveries.Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+	var commandErr mongo.CommandError
+	if err := deliveries.Indexes().DropOne(ctx, legacyWebhookLogTTLIndex); err != nil && !(errors.As(err, &commandErr) && commandErr.Name == "IndexNotFound") {
+		return err
+	}
+	filter := bson.M{
+		"status":     bson.M{"$in": bson.A{models.WebhookDeliveryDelivered, models.WebhookDeliveryDeadLetter}},
+		"expires_at": bson.M{"$exists": false},
+	}
+	backfill := mongo.Pipeline{{{Key: "$set", Value: bson.M{"expires_at": bson.M{"$add": bson.A{"$created_at", retention.Milliseconds()}}}}}}
+	_, err = deliveries.UpdateMany(ctx, filter, backfill)
+	return err
+}
+
+// CreateSubscription implements WebhookRepository.
+func (m *mongoWebhookRepository) CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	_, err := m.subscriptions.InsertOne(ctx, subscription)
+	return err
+}
+
+// FindSubscription implements WebhookRepository.
+func (m *mongoWebhookRepository) FindSubscription(ctx context.Context, subscriptionId string) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	err := m.subscriptions.FindOne(ctx, bson.M{"_id": subscriptionId}).Decode(&subscription)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// ListSubscriptions implements WebhookRepository.
+func (m *mongoWebhookRepository) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	return m.findSubscriptions(ctx, bson.M{})
+}
+
+// FindSubscriptionsForEvent implements WebhookRepository.
+func (m *mongoWebhookRepository) FindSubscriptionsForEvent(ctx context.Context, eventType string) ([]models.WebhookSubscription, error) {
+	return m.findSubscriptions(ctx, bson.M{
+		"active": true,
+		"$or": bson.A{
+			bson.M{"event_types": eventType},
+			bson.M{"event_types": bson.M{"$size": 0}},
+		},
+	})
+}
+
+func (m *mongoWebhookRepository) findSubscriptions(ctx context.Context, filter bson.M) ([]models.WebhookSubscription, error) {
+	result, err := m.subscriptions.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var subscriptions []models.WebhookSubscription
+	if err := result.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// DeleteSubscription implements WebhookRepository. The delivery log of the
+// subscription is kept until it expires.
+func (m *mongoWebhookRepository) DeleteSubscription(ctx context.Context, subscriptionId string) error {
+	result, err := m.subscriptions.DeleteOne(ctx, bson.M{"_id": subscriptionId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// CreateDelivery implements WebhookRepository.
+func (m *mongoWebhookRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	_, err := m.deliveries.InsertOne(ctx, delivery)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrWebhookDeliveryExists
+	}
+	return err
+}
+
+// FindDelivery implements WebhookRepository.
+func (m *mongoWebhookRepository) FindDelivery(ctx context.Context, deliveryId string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := m.deliveries.FindOne(ctx, bson.M{"_id": deliveryId}).Decode(&delivery)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ClaimDueDelivery implements WebhookRepository. The next attempt of the
+// claimed delivery is pushed lease into the future, so another worker only
+// picks it up again if this one dies before saving the result.
+func (m *mongoWebhookRepository) ClaimDueDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	filter := bson.M{"status": models.WebhookDeliveryPending, "next_attempt_at": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}}
+	config := options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}})
+	err := m.deliveries.FindOneAndUpdate(ctx, filter, update, config).Decode(&delivery)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// UpdateDelivery implements WebhookRepository.
+func (m *mongoWebhookRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	result, err := m.deliveries.ReplaceOne(ctx, bson.M{"_id": delivery.ID}, delivery)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
+
+// ListDeliveries implements WebhookRepository. Deliveries are returned newest first.
+func (m *mongoWebhookRepository) ListDeliveries(ctx context.Context, filter WebhookDeliveryFilter) (*WebhookDeliveryPage, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+	query := bson.M{"subscription_id": filter.SubscriptionId}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.Cursor != "" {
+		position, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		createdAt, err := time.Parse(time.RFC3339Nano, position.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		query["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$lt": createdAt}},
+			bson.M{"created_at": createdAt, "_id": bson.M{"$lt": position.Id}},
+		}
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit + 1))
+	result, err := m.deliveries.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []models.WebhookDelivery
+	if err := result.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	page := &WebhookDeliveryPage{Deliveries: deliveries}
+	if len(deliveries) > limit {
+		page.Deliveries = deliveries[:limit]
+		last := page.Deliveries[limit-1]
+		page.NextCursor = encodeKeysetCursor(last.CreatedAt.UTC().Format(time.RFC3339Nano), last.ID)
+	}
+	return page, nil
+}
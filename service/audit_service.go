@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"users-microservice/config"
+	"users-microservice/dto"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/google/uuid"
+)
+
+const maxAuditChainRetries = 5
+
+type AuditService struct {
+	auditRepository repository.AuditRepository
+	config          config.Config
+}
+
+func NewAuditService(auditRepo repository.AuditRepository, config *config.Config) *AuditService {
+	return &AuditService{
+		auditRepository: auditRepo,
+		config:          *config,
+	}
+}
+
+// Record stores an audit event, filling the id, timestamp and the request
+// metadata found in ctx. An authenticated actor in ctx takes precedence over
+// event.ActorId, which is the fallback for anonymous calls such as login.
+// Failures are logged and never abort the audited operation. A nil
+// AuditService records nothing.
+func (service *AuditService) Record(ctx context.Context, event models.AuditEvent) {
+	if service == nil {
+		return
+	}
+	metadata := RequestMetadataFromContext(ctx)
+	if metadata.ActorId != "" {
+		event.ActorId = metadata.ActorId
+	}
+	event.IP = metadata.IP
+	event.UserAgent = metadata.UserAgent
+	if len(event.Details) == 0 {
+		event.Details = nil
+	}
+	// Mongo guarda milisegundos; se trunca para que el hash se pueda verificar.
+	event.Timestamp = time.Now().UTC().Truncate(time.Millisecond)
+	if err := service.append(ctx, event); err != nil {
+		log.Printf("audit: recording %s failed: %v", event.Type, err)
+	}
+}
+
+func (service *AuditService) append(ctx context.Context, event models.AuditEvent) error {
+	eventId, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+	event.ID = eventId.String()
+	if !service.config.AUDIT_CONFIG.HASH_CHAIN {
+		return service.auditRepository.CreateEvent(ctx, &event)
+	}
+	for attempt := 0; attempt < maxAuditChainRetries; attempt++ {
+		last, err := service.auditRepository.LastEvent(ctx)
+		switch {
+		case errors.Is(err, repository.ErrAuditEventNotFound):
+			event.Sequence = 1
+			event.PrevHash = ""
+		case err != nil:
+			return err
+		default:
+			event.Sequence = last.Sequence + 1
+			event.PrevHash = last.Hash
+		}
+		event.Hash = hashAuditEvent(&event)
+		err = service.auditRepository.CreateEvent(ctx, &event)
+		if !errors.Is(err, repository.ErrAuditSequenceTaken) {
+			return err
+		}
+	}
+	return fmt.Errorf("could not append to the audit chain after %d attempts", maxAuditChainRetries)
+}
+
+func (service *AuditService) ListEventsService(ctx context.Context, query *dto.AuditEventQueryDTO) (*dto.AuditEventListDTO, error) {
+	page, err := service.auditRepository.ListEvents(ctx, repository.AuditEventFilter{
+		ActorId:  query.ActorId,
+		TargetId: query.TargetId,
+		Type:     query.Type,
+		Outcome:  query.Outcome,
+		From:     query.From,
+		To:       query.To,
+		Cursor:   query.Cursor,
+		Limit:    query.Limit,
+	})
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	response := dto.AuditEventListDTO{Events: page.Events, NextCursor: page.NextCursor}
+	if response.Events == nil {
+		response.Events = []models.AuditEvent{}
+	}
+	return &response, nil
+}
+
+// VerifyChainService recomputes every hash of the chain. Events removed by the
+// retention index are not an error: verification starts at the oldest event
+// still stored.
+func (service *AuditService) VerifyChainService(ctx context.Context) (*dto.AuditChainVerificationDTO, error) {
+	result := &dto.AuditChainVerificationDTO{Valid: true}
+	var previous *models.AuditEvent
+	var sequence int64
+	for {
+		events, err := service.auditRepository.ListEventsAfterSequence(ctx, sequence, repository.MaxListLimit)
+		if err != nil {
+			return nil, fmt.Errorf("error: db error: %w", err)
+		}
+		for i := range events {
+			event := &events[i]
+			brokenLink := previous != nil && (event.Sequence != previous.Sequence+1 || event.PrevHash != previous.Hash)
+			if brokenLink || hashAuditEvent(event) != event.Hash {
+				result.Valid = false
+				result.BrokenAt = event.Sequence
+				return result, nil
+			}
+			result.Checked++
+			previous = event
+			sequence = event.Sequence
+		}
+		if len(events) < repository.MaxListLimit {
+			return result, nil
+		}
+	}
+}
+
+func hashAuditEvent(event *models.AuditEvent) string {
+	canonical, _ := json.Marshal(struct {
+		ID        string            `json:"id"`
+		Sequence  int64             `json:"sequence"`
+		Type      string            `json:"type"`
+		ActorId   string            `json:"actor_id"`
+		TargetId  string            `json:"target_id"`
+		IP        string            `json:"ip"`
+		UserAgent string            `json:"user_agent"`
+		Timestamp time.Time         `json:"timestamp"`
+		Outcome   string            `json:"outcome"`
+		Details   map[string]string `json:"details"`
+		PrevHash  string            `json:"prev_hash"`
+	}{
+		event.ID, event.Sequence, event.Type, event.ActorId, event.TargetId, event.IP,
+		event.UserAgent, event.Timestamp.UTC(), event.Outcome, event.Details, event.PrevHash,
+	})
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+type auditExportSource struct {
+	auditRepository repository.AuditRepository
+}
+
+func NewAuditExportSource(auditRepo repository.AuditRepository) ExportSource {
+	return &auditExportSource{auditRepository: auditRepo}
+}
+
+func (source *auditExportSource) Name() string {
+	return "audit_events"
+}
+
+func (source *auditExportSource) Export(ctx context.Context, userId string) (interface{}, error) {
+	events := []models.AuditEvent{}
+	filter := repository.AuditEventFilter{SubjectId: userId, Limit: repository.MaxListLimit}
+	for {
+		page, err := source.auditRepository.ListEvents(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page.Events...)
+		if page.NextCursor == "" {
+			return events, nil
+		}
+		filter.Cursor = page.NextCursor
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"users-microservice/config"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+// tamperedAuditRepository devuelve modificado el evento con la secuencia
+// tampered, como si alguien lo hubiera editado en la base de datos.
+type tamperedAuditRepository struct {
+	repository.AuditRepository
+	tampered int64
+	edit     func(event *models.AuditEvent)
+}
+
+func (repo *tamperedAuditRepository) ListEventsAfterSequence(ctx context.Context, sequence int64, limit int) ([]models.AuditEvent, error) {
+	events, err := repo.AuditRepository.ListEventsAfterSequence(ctx, sequence, limit)
+	for i := range events {
+		if events[i].Sequence == repo.tampered {
+			repo.edit(&events[i])
+		}
+	}
+	return events, err
+}
+
+func TestVerifyChainService(t *testing.T) {
+	tests := []struct {
+		name         string
+		edit         func(event *models.AuditEvent)
+		wantBrokenAt int64
+	}{
+		{name: "field changed", edit: func(event *models.AuditEvent) { event.Outcome = models.AuditOutcomeSuccess }, wantBrokenAt: 2},
+		{name: "details added", edit: func(event *models.AuditEvent) { event.Details = map[string]string{"jti": "other"} }, wantBrokenAt: 2},
+		// Recalcular el hash del evento no basta: el siguiente enlaza con el original.
+		{name: "hash recomputed", edit: func(event *models.AuditEvent) {
+			event.ActorId = "someone-else"
+			event.Hash = hashAuditEvent(event)
+		}, wantBrokenAt: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := &tamperedAuditRepository{AuditRepository: repository.NewMemoryAuditRepository(), edit: test.edit}
+			service := NewAuditService(repo, &config.Config{AUDIT_CONFIG: config.AuditConfig{HASH_CHAIN: true}})
+			ctx := context.Background()
+			for _, userId := range []string{"user-1", "user-2", "user-3", "user-4"} {
+				service.Record(ctx, models.AuditEvent{Type: models.AuditUserLogin, ActorId: userId, TargetId: userId, Outcome: models.AuditOutcomeFailure})
+			}
+
+			result, err := service.VerifyChainService(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Valid || result.Checked != 4 || result.BrokenAt != 0 {
+				t.Fatalf("VerifyChainService of the untouched chain = %+v", result)
+			}
+
+			repo.tampered = 2
+			result, err = service.VerifyChainService(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Valid || result.BrokenAt != test.wantBrokenAt || result.Checked != int(test.wantBrokenAt)-1 {
+				t.Fatalf("VerifyChainService after tampering = %+v, want broken at %d", result, test.wantBrokenAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+	"users-microservice/config"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const dpopProofType = "dpop+jwt"
+
+var ErrInvalidDPoPProof = errors.New("invalid_dpop_proof")
+var ErrDPoPNonceRequired = errors.New("use_dpop_nonce")
+
+// DPoPService verifies the DPoP proofs of RFC 9449. A valid proof binds the
+// tokens issued by the request to the public key that signed it: access tokens
+// carry the key thumbprint as cnf.jkt and refresh token sessions store it, so a
+// stolen token is useless without the private key.
+type DPoPService struct {
+	proofRepository repository.DPoPProofRepository
+	config          config.Config
+}
+
+func NewDPoPService(proofRepo repository.DPoPProofRepository, config *config.Config) *DPoPService {
+	return &DPoPService{
+		proofRepository: proofRepo,
+		config:          *config,
+	}
+}
+
+// ProofKeyService verifies the DPoP proof of the request in ctx and returns the
+// thumbprint of its key, or "" when the request has no proof. accessToken is
+// the token the proof must be bound to through ath; it is empty on the
+// endpoints that issue tokens.
+func (service *DPoPService) ProofKeyService(ctx context.Context, accessToken string) (string, error) {
+	metadata := RequestMetadataFromContext(ctx)
+	if service == nil || metadata.DPoPProof == "" {
+		return "", nil
+	}
+	jkt := ""
+	token, err := jwt.Parse(metadata.DPoPProof, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != dpopProofType {
+			return nil, fmt.Errorf("typ must be %s", dpopProofType)
+		}
+		jwk, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("missing jwk header")
+		}
+		key, thumbprint, err := parsePublicJWK(jwk)
+		if err != nil {
+			return nil, err
+		}
+		jkt = thumbprint
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg(), jwt.SigningMethodRS256.Alg()}))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidDPoPProof, err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", ErrInvalidDPoPProof
+	}
+	if err := service.checkProofClaims(claims, metadata, accessToken); err != nil {
+		return "", err
+	}
+	jti, _ := claims["jti"].(string)
+	proofId := sha256.Sum256([]byte(jkt + ":" + jti))
+	issuedAt, _ := claims.GetIssuedAt()
+	err = service.proofRepository.SaveProof(ctx, &models.DPoPProof{
+		ID:        base64.RawURLEncoding.EncodeToString(proofId[:]),
+		ExpiresAt: issuedAt.Add(service.config.DPOP_CONFIG.PROOF_MAX_AGE),
+	})
+	if errors.Is(err, repository.ErrDPoPProofReplayed) {
+		return "", fmt.Errorf("%w: the proof was already used", ErrInvalidDPoPProof)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error: db error: %w", err)
+	}
+	return jkt, nil
+}
+
+// NonceService returns the nonce that proofs must include when
+// DPOP_REQUIRE_NONCE is set. Nonces are not stored: they are the HMAC of the
+// current NONCE_TTL window, and the nonce of the previous window is still
+// accepted.
+func (service *DPoPService) NonceService() string {
+	return service.nonce(service.nonceWindow(time.Now()))
+}
+
+func (service *DPoPService) NonceRequired() bool {
+	return service != nil && service.config.DPOP_CONFIG.REQUIRE_NONCE
+}
+
+func (service *DPoPService) checkProofClaims(claims jwt.MapClaims, metadata RequestMetadata, accessToken string) error {
+	if jti, _ := claims["jti"].(string); jti == "" {
+		return fmt.Errorf("%w: missing jti", ErrInvalidDPoPProof)
+	}
+	if method, _ := claims["htm"].(string); method != metadata.Method {
+		return fmt.Errorf("%w: htm does not match the request method", ErrInvalidDPoPProof)
+	}
+	if htu, _ := claims["htu"].(string); !sameTargetURI(htu, service.config.PUBLIC_BASE_URL+metadata.Path) {
+		return fmt.Errorf("%w: htu does not match the request URL", ErrInvalidDPoPProof)
+	}
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		return fmt.Errorf("%w: missing iat", ErrInvalidDPoPProof)
+	}
+	maxAge := service.config.DPOP_CONFIG.PROOF_MAX_AGE
+	if age := time.Since(issuedAt.Time); age > maxAge || age < -maxAge {
+		return fmt.Errorf("%w: the proof is too old or issued in the future", ErrInvalidDPoPProof)
+	}
+	if accessToken != "" {
+		hash := sha256.Sum256([]byte(accessToken))
+		if ath, _ := claims["ath"].(string); ath != base64.RawURLEncoding.EncodeToString(hash[:]) {
+			return fmt.Errorf("%w: ath does not match the access token", ErrInvalidDPoPProof)
+		}
+	}
+	if service.config.DPOP_CONFIG.REQUIRE_NONCE {
+		nonce, _ := claims["nonce"].(string)
+		window := service.nonceWindow(time.Now())
+		if !hmac.Equal([]byte(nonce), []byte(service.nonce(window))) && !hmac.Equal([]byte(nonce), []byte(service.nonce(window-1))) {
+			return ErrDPoPNonceRequired
+		}
+	}
+	return nil
+}
+
+// nonceWindow numbers the NONCE_TTL windows since the Unix epoch.
+func (service *DPoPService) nonceWindow(now time.Time) int64 {
+	return now.UnixNano() / int64(service.config.DPOP_CONFIG.NONCE_TTL)
+}
+
+func (service *DPoPService) nonce(window int64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(window))
+	mac := hmac.New(sha256.New, []byte("dpop-nonce:"+service.config.JWT_SECRET_KEY))
+	mac.Write(message)
+	return base64.RawURLEncoding.EncodeToString(append(message, mac.Sum(nil)[:16]...))
+}
+
+// checkDPoPBinding requires a proof signed with the key a token or a session is
+// bound to. Unbound tokens (boundJkt empty) accept requests with or without
+// proof.
+func checkDPoPBinding(boundJkt string, proofJkt string) error {
+	if boundJkt != "" && proofJkt != boundJkt {
+		return fmt.Errorf("%w: the token is bound to another key", ErrInvalidDPoPProof)
+	}
+	return nil
+}
+
+// dpopTokenType is the token_type of the tokens bound to jkt.
+func dpopTokenType(jkt string) string {
+	if jkt != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+// addConfirmationClaim binds an access token to the DPoP key jkt (RFC 9449 6.1).
+func addConfirmationClaim(claims jwt.MapClaims, jkt string) jwt.MapClaims {
+	if jkt == "" {
+		return claims
+	}
+	if claims == nil {
+		claims = jwt.MapClaims{}
+	}
+	claims["cnf"] = map[string]string{"jkt": jkt}
+	return claims
+}
+
+// sameTargetURI compares the htu of a proof with the URL of the request,
+// ignoring the query and the fragment (RFC 9449 4.3).
+func sameTargetURI(htu string, expected string) bool {
+	proofURL, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	requestURL, err := url.Parse(expected)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(proofURL.Scheme, requestURL.Scheme) &&
+		strings.EqualFold(proofURL.Host, requestURL.Host) &&
+		proofURL.EscapedPath() == requestURL.EscapedPath()
+}
+
+// parsePublicJWK returns the public key of a P-256 or RSA JWK and its RFC 7638
+// thumbprint. Keys with private members are rejected.
+func parsePublicJWK(jwk map[string]interface{}) (crypto.PublicKey, string, error) {
+	if _, ok := jwk["d"]; ok {
+		return nil, "", fmt.Errorf("the jwk must not contain a private key")
+	}
+	switch jwk["kty"] {
+	case "EC":
+		if jwk["crv"] != "P-256" {
+			return nil, "", fmt.Errorf("unsupported curve")
+		}
+		x, xErr := decodeJWKMember(jwk, "x")
+		y, yErr := decodeJWKMember(jwk, "y")
+		if xErr != nil || yErr != nil || len(x) != 32 || len(y) != 32 {
+			return nil, "", fmt.Errorf("invalid EC key")
+		}
+		// ecdh valida que el punto pertenezca a la curva.
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, "", fmt.Errorf("invalid EC key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return key, ecThumbprint(x, y), nil
+	case "RSA":
+		n, nErr := decodeJWKMember(jwk, "n")
+		e, eErr := decodeJWKMember(jwk, "e")
+		if nErr != nil || eErr != nil || len(e) == 0 || len(e) > 4 {
+			return nil, "", fmt.Errorf("invalid RSA key")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < 2048 {
+			return nil, "", fmt.Errorf("RSA keys must have at least 2048 bits")
+		}
+		return key, rsaThumbprint(key), nil
+	default:
+		return nil, "", fmt.Errorf("unsupported key type")
+	}
+}
+
+func decodeJWKMember(jwk map[string]interface{}, name string) ([]byte, error) {
+	value, ok := jwk[name].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing %s", name)
+	}
+	return base64.RawURLEncoding.DecodeString(value)
+}
+
+// ecThumbprint is the RFC 7638 thumbprint of a P-256 key.
+func ecThumbprint(x []byte, y []byte) string {
+	canonical := fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":%q,"y":%q}`,
+		base64.RawURLEncoding.EncodeToString(x), base64.RawURLEncoding.EncodeToString(y))
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+	"users-microservice/config"
+	"users-microservice/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const testAccessToken = "access-token"
+
+func newTestDPoPService(requireNonce bool, nonceTTL time.Duration) *DPoPService {
+	return NewDPoPService(repository.NewMemoryDPoPProofRepository(), &config.Config{
+		PUBLIC_BASE_URL: "https://users.example.com",
+		JWT_SECRET_KEY:  "secret",
+		DPOP_CONFIG: config.DPoPConfig{
+			PROOF_MAX_AGE: time.Minute,
+			REQUIRE_NONCE: requireNonce,
+			NONCE_TTL:     nonceTTL,
+		},
+	})
+}
+
+func publicJWK(key *ecdsa.PublicKey) map[string]interface{} {
+	return map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func accessTokenHash(accessToken string) string {
+	hash := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// signProof firma con key una prueba DPoP valida para POST /refresh, a la que
+// edit puede cambiar la cabecera o los claims.
+func signProof(t *testing.T, key *ecdsa.PrivateKey, edit func(header map[string]interface{}, claims jwt.MapClaims)) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"jti": uuid.NewString(),
+		"htm": "POST",
+		"htu": "https://users.example.com/refresh",
+		"iat": time.Now().Unix(),
+		"ath": accessTokenHash(testAccessToken),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = publicJWK(&key.PublicKey)
+	if edit != nil {
+		edit(token.Header, claims)
+	}
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func proofContext(proof string) context.Context {
+	return WithRequestMetadata(context.Background(), RequestMetadata{
+		DPoPProof: proof,
+		Method:    "POST",
+		Path:      "/refresh",
+	})
+}
+
+func TestProofKeyService(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := publicJWK(&key.PublicKey)
+	x, _ := base64.RawURLEncoding.DecodeString(jwk["x"].(string))
+	y, _ := base64.RawURLEncoding.DecodeString(jwk["y"].(string))
+	thumbprint := ecThumbprint(x, y)
+
+	tests := []struct {
+		name          string
+		edit          func(header map[string]interface{}, claims jwt.MapClaims)
+		noAccessToken bool
+		wantErr       error
+	}{
+		{name: "valid proof"},
+		{name: "query and fragment are ignored", edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			claims["htu"] = "https://USERS.example.com/refresh?x=1#y"
+		}},
+		{name: "no ath on endpoints that issue tokens", noAccessToken: true, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			delete(claims, "ath")
+		}},
+		{name: "wrong typ", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			header["typ"] = "JWT"
+		}},
+		{name: "missing jwk", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			delete(header, "jwk")
+		}},
+		{name: "jwk of another key", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			header["jwk"] = publicJWK(&otherKey.PublicKey)
+		}},
+		{name: "jwk with a private key", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			private := publicJWK(&key.PublicKey)
+			private["d"] = base64.RawURLEncoding.EncodeToString(key.D.Bytes())
+			header["jwk"] = private
+		}},
+		{name: "unsupported curve", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			header["jwk"].(map[string]interface{})["crv"] = "P-384"
+		}},
+		{name: "point off the curve", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			header["jwk"].(map[string]interface{})["y"] = jwk["x"]
+		}},
+		{name: "missing jti", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			delete(claims, "jti")
+		}},
+		{name: "wrong htm", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			claims["htm"] = "GET"
+		}},
+		{name: "wrong htu path", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			claims["htu"] = "https://users.example.com/users/login"
+		}},
+		{name: "wrong htu host", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			claims["htu"] = "https://evil.example.com/refresh"
+		}},
+		{name: "missing iat", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			delete(claims, "iat")
+		}},
+		{name: "old iat", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			claims["iat"] = time.Now().Add(-2 * time.Minute).Unix()
+		}},
+		{name: "iat in the future", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			claims["iat"] = time.Now().Add(2 * time.Minute).Unix()
+		}},
+		{name: "missing ath", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			delete(claims, "ath")
+		}},
+		{name: "ath of another token", wantErr: ErrInvalidDPoPProof, edit: func(header map[string]interface{}, claims jwt.MapClaims) {
+			claims["ath"] = accessTokenHash("other-token")
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := newTestDPoPService(false, time.Minute)
+			accessToken := testAccessToken
+			if test.noAccessToken {
+				accessToken = ""
+			}
+			jkt, err := service.ProofKeyService(proofContext(signProof(t, key, test.edit)), accessToken)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("ProofKeyService error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProofKeyService: %v", err)
+			}
+			if jkt != thumbprint {
+				t.Fatalf("ProofKeyService = %q, want %q", jkt, thumbprint)
+			}
+		})
+	}
+}
+
+func TestProofKeyServiceWithoutProof(t *testing.T) {
+	jkt, err := newTestDPoPService(true, time.Minute).ProofKeyService(proofContext(""), testAccessToken)
+	if err != nil || jkt != "" {
+		t.Fatalf("ProofKeyService = %q, %v; want no key", jkt, err)
+	}
+}
+
+func TestProofKeyServiceRejectsOtherAlgorithms(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"jti": uuid.NewString(),
+		"htm": "POST",
+		"htu": "https://users.example.com/refresh",
+		"iat": time.Now().Unix(),
+	})
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = publicJWK(&key.PublicKey)
+	proof, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestDPoPService(false, time.Minute).ProofKeyService(proofContext(proof), ""); !errors.Is(err, ErrInvalidDPoPProof) {
+		t.Fatalf("ProofKeyService error = %v, want %v", err, ErrInvalidDPoPProof)
+	}
+}
+
+func TestProofKeyServiceRejectsReplays(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := newTestDPoPService(false, time.Minute)
+	ctx := proofContext(signProof(t, key, nil))
+	if _, err := service.ProofKeyService(ctx, testAccessToken); err != nil {
+		t.Fatalf("first ProofKeyService: %v", err)
+	}
+	if _, err := service.ProofKeyService(ctx, testAccessToken); !errors.Is(err, ErrInvalidDPoPProof) {
+		t.Fatalf("replayed ProofKeyService error = %v, want %v", err, ErrInvalidDPoPProof)
+	}
+}
+
+func TestProofKeyServiceNonce(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := newTestDPoPService(true, 5*time.Minute)
+	window := service.nonceWindow(time.Now())
+	tests := []struct {
+		name    string
+		nonce   string
+		wantErr error
+	}{
+		{name: "missing nonce", wantErr: ErrDPoPNonceRequired},
+		{name: "forged nonce", nonce: "nonce", wantErr: ErrDPoPNonceRequired},
+		{name: "current nonce", nonce: service.NonceService()},
+		{name: "previous nonce", nonce: service.nonce(window - 1)},
+		{name: "expired nonce", nonce: service.nonce(window - 2), wantErr: ErrDPoPNonceRequired},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proof := signProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) {
+				if test.nonce != "" {
+					claims["nonce"] = test.nonce
+				}
+			})
+			_, err := service.ProofKeyService(proofContext(proof), testAccessToken)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("ProofKeyService error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// Las ventanas de menos de un segundo no deben dividir por cero.
+func TestNonceServiceShortTTL(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := newTestDPoPService(true, 500*time.Millisecond)
+	proof := signProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) {
+		claims["nonce"] = service.NonceService()
+	})
+	if _, err := service.ProofKeyService(proofContext(proof), testAccessToken); err != nil {
+		t.Fatalf("ProofKeyService: %v", err)
+	}
+}
@@ -0,0 +1,418 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"users-microservice/config"
+	"users-microservice/dto"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ExportFormatJSON = "json"
+	ExportFormatZIP  = "zip"
+)
+
+// exportMaxAttempts is how many times a job is claimed before it is marked
+// failed, so an export that keeps bringing its worker down is not retried
+// forever.
+const exportMaxAttempts = 3
+
+var ErrExportJobNotFound = errors.New("export job not found")
+var ErrExportNotReady = errors.New("export is not ready")
+
+// ExportSource contributes one section of the personal data export. Each
+// subsystem that stores data about a user registers its own source.
+type ExportSource interface {
+	Name() string
+	Export(ctx context.Context, userId string) (interface{}, error)
+}
+
+type ExportArchive struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+type ExportService struct {
+	userService             *UserService
+	exportJobRepository     repository.ExportJobRepository
+	exportArchiveRepository repository.ExportArchiveRepository
+	sources                 []ExportSource
+	config                  config.Config
+}
+
+func NewExportService(userService *UserService, exportJobRepo repository.ExportJobRepository, exportArchiveRepo repository.ExportArchiveRepository, config *config.Config) *ExportService {
+	return &ExportService{
+		userService:             userService,
+		exportJobRepository:     exportJobRepo,
+		exportArchiveRepository: exportArchiveRepo,
+		config:                  *config,
+	}
+}
+
+func (service *ExportService) RegisterSource(source ExportSource) {
+	service.sources = append(service.sources, source)
+}
+
+// ExportUserDataService builds the archive synchronously.
+func (service *ExportService) ExportUserDataService(ctx context.Context, userId string, format string) (*ExportArchive, error) {
+	if _, err := service.userService.FindUserByIDService(ctx, userId); err != nil {
+		return nil, err
+	}
+	sections := make(map[string]interface{}, len(service.sources))
+	for _, source := range service.sources {
+		data, err := source.Export(ctx, userId)
+		if err != nil {
+			return nil, fmt.Errorf("error: exporting %s: %w", source.Name(), err)
+		}
+		sections[source.Name()] = data
+	}
+	return buildArchive(userId, format, sections)
+}
+
+func (service *ExportService) CreateExportJobService(ctx context.Context, userId string, format string) (*dto.ExportJobDTO, error) {
+	if _, err := service.userService.FindUserByIDService(ctx, userId); err != nil {
+		return nil, err
+	}
+	jobId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error: error generating job_id: %w", err)
+	}
+	now := time.Now().UTC()
+	job := models.ExportJob{
+		ID:        jobId.String(),
+		UserId:    userId,
+		Format:    defaultFormat(format),
+		Status:    models.ExportJobPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(service.config.EXPORT_CONFIG.RETENTION),
+	}
+	if err := service.exportJobRepository.CreateJob(ctx, &job); err != nil {
+		return nil, fmt.Errorf("error: creating export job: %w", err)
+	}
+	return mapExportJobToDTO(&job), nil
+}
+
+func (service *ExportService) FindExportJobService(ctx context.Context, userId string, jobId string) (*dto.ExportJobDTO, error) {
+	job, err := service.findUserJob(ctx, userId, jobId)
+	if err != nil {
+		return nil, err
+	}
+	return mapExportJobToDTO(job), nil
+}
+
+func (service *ExportService) DownloadExportJobService(ctx context.Context, userId string, jobId string) (*ExportArchive, error) {
+	job, err := service.findUserJob(ctx, userId, jobId)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.ExportJobCompleted {
+		return nil, ErrExportNotReady
+	}
+	data, err := service.exportArchiveRepository.LoadArchive(ctx, job.ArchiveId)
+	if errors.Is(err, repository.ErrExportArchiveNotFound) {
+		// El archivo ya caduco aunque el job siga guardado.
+		return nil, ErrExportJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	return &ExportArchive{
+		FileName:    archiveFileName(job.UserId, job.Format),
+		ContentType: archiveContentType(job.Format),
+		Data:        data,
+	}, nil
+}
+
+// ProcessNextExportJobService runs the oldest pending job, or a running one
+// whose worker did not finish it within EXPORT_LEASE. It returns false when
+// there was nothing to process.
+func (service *ExportService) ProcessNextExportJobService(ctx context.Context) (bool, error) {
+	job, err := service.exportJobRepository.ClaimPendingJob(ctx, time.Now().UTC(), service.config.EXPORT_CONFIG.LEASE)
+	if errors.Is(err, repository.ErrExportJobNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error: claiming export job: %w", err)
+	}
+	var exportErr error
+	if job.Attempts > exportMaxAttempts {
+		exportErr = fmt.Errorf("error: the export did not finish after %d attempts", exportMaxAttempts)
+	} else {
+		exportErr = service.saveArchive(ctx, job)
+	}
+	completedAt := time.Now().UTC()
+	job.CompletedAt = &completedAt
+	job.LeaseExpiresAt = nil
+	if exportErr != nil {
+		job.Status = models.ExportJobFailed
+		job.Error = exportErr.Error()
+	} else {
+		job.Status = models.ExportJobCompleted
+	}
+	if err := service.exportJobRepository.UpdateJob(ctx, job); err != nil {
+		// El archivo no queda referenciado por ningun job.
+		if job.ArchiveId != "" {
+			service.exportArchiveRepository.DeleteArchive(ctx, job.ArchiveId)
+		}
+		if errors.Is(err, repository.ErrExportJobNotFound) {
+			return true, fmt.Errorf("error: export job %s was reclaimed after its lease expired", job.ID)
+		}
+		return true, fmt.Errorf("error: saving export job %s: %w", job.ID, err)
+	}
+	return true, nil
+}
+
+// saveArchive builds the archive of job and stores it until the job expires.
+func (service *ExportService) saveArchive(ctx context.Context, job *models.ExportJob) error {
+	archive, err := service.ExportUserDataService(ctx, job.UserId, job.Format)
+	if err != nil {
+		return err
+	}
+	archiveId := uuid.NewString()
+	if err := service.exportArchiveRepository.SaveArchive(ctx, archiveId, archive.Data, job.ExpiresAt); err != nil {
+		return fmt.Errorf("error: saving export archive: %w", err)
+	}
+	job.ArchiveId = archiveId
+	return nil
+}
+
+// PurgeExpiredArchivesService removes the archives of the expired jobs. The
+// jobs themselves are removed by the TTL index of the backend.
+func (service *ExportService) PurgeExpiredArchivesService(ctx context.Context) (int, error) {
+	deleted, err := service.exportArchiveRepository.DeleteExpiredArchives(ctx, time.Now().UTC())
+	if err != nil {
+		return deleted, fmt.Errorf("error: purging export archives: %w", err)
+	}
+	return deleted, nil
+}
+
+func (service *ExportService) findUserJob(ctx context.Context, userId string, jobId string) (*models.ExportJob, error) {
+	job, err := service.exportJobRepository.FindJob(ctx, jobId)
+	if errors.Is(err, repository.ErrExportJobNotFound) || (err == nil && job.UserId != userId) {
+		return nil, ErrExportJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	return job, nil
+}
+
+func buildArchive(userId string, format string, sections map[string]interface{}) (*ExportArchive, error) {
+	format = defaultFormat(format)
+	manifest := map[string]interface{}{
+		"user_id":     userId,
+		"exported_at": time.Now().UTC(),
+	}
+	var data []byte
+	var err error
+	if format == ExportFormatZIP {
+		data, err = buildZipArchive(manifest, sections)
+	} else {
+		document := map[string]interface{}{}
+		for name, section := range sections {
+			document[name] = section
+		}
+		for key, value := range manifest {
+			document[key] = value
+		}
+		data, err = json.MarshalIndent(document, "", "  ")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: building export archive: %w", err)
+	}
+	return &ExportArchive{
+		FileName:    archiveFileName(userId, format),
+		ContentType: archiveContentType(format),
+		Data:        data,
+	}, nil
+}
+
+func buildZipArchive(manifest map[string]interface{}, sections map[string]interface{}) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	writer := zip.NewWriter(buffer)
+	files := map[string]interface{}{"manifest": manifest}
+	for name, section := range sections {
+		files[name] = section
+	}
+	for name, content := range files {
+		file, err := writer.Create(name + ".json")
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func defaultFormat(format string) string {
+	if format == ExportFormatZIP {
+		return ExportFormatZIP
+	}
+	return ExportFormatJSON
+}
+
+func archiveFileName(userId string, format string) string {
+	return fmt.Sprintf("user-data-%s.%s", userId, defaultFormat(format))
+}
+
+func archiveContentType(format string) string {
+	if format == ExportFormatZIP {
+		return "application/zip"
+	}
+	return "application/json"
+}
+
+func mapExportJobToDTO(job *models.ExportJob) *dto.ExportJobDTO {
+	return &dto.ExportJobDTO{
+		JobId:       job.ID,
+		Status:      job.Status,
+		Format:      job.Format,
+		Error:       job.Error,
+		CreatedAt:   job.CreatedAt,
+		CompletedAt: job.CompletedAt,
+		ExpiresAt:   job.ExpiresAt,
+	}
+}
+
+type profileExportSource struct {
+	userService *UserService
+}
+
+func NewProfileExportSource(userService *UserService) ExportSource {
+	return &profileExportSource{userService: userService}
+}
+
+func (source *profileExportSource) Name() string {
+	return "profile"
+}
+
+func (source *profileExportSource) Export(ctx context.Context, userId string) (interface{}, error) {
+	user, err := source.userService.FindUserByIDService(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return dto.ProfileExportDTO{
+		UserId:    user.UserId,
+		Name:      user.Name,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Role:      user.Role,
+		Verified:  user.Verified,
+		Locked:    user.Locked,
+		CreatedAt: user.CreatedAt,
+		DeletedAt: user.DeletedAt,
+	}, nil
+}
+
+type sessionsExportSource struct {
+	refreshTokenRepository repository.RefreshTokenRepository
+}
+
+func NewSessionsExportSource(refreshTokenRepo repository.RefreshTokenRepository) ExportSource {
+	return &sessionsExportSource{refreshTokenRepository: refreshTokenRepo}
+}
+
+func (source *sessionsExportSource) Name() string {
+	return "sessions"
+}
+
+func (source *sessionsExportSource) Export(ctx context.Context, userId string) (interface{}, error) {
+	refreshTokens, err := source.refreshTokenRepository.FindTokensByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]dto.SessionExportDTO, 0, len(refreshTokens))
+	for _, refreshToken := range refreshTokens {
+		sessions = append(sessions, dto.SessionExportDTO{
+			SessionId: refreshToken.ID,
+			IssuedAt:  refreshToken.IssuedAt,
+			ExpiresAt: refreshToken.Expires,
+			Revoked:   refreshToken.Revoked,
+			IP:        refreshToken.IP,
+			UserAgent: refreshToken.UserAgent,
+		})
+	}
+	return sessions, nil
+}
+
+type consentsExportSource struct {
+	refreshTokenRepository repository.RefreshTokenRepository
+	oauthRepository        repository.OAuthRepository
+}
+
+// NewConsentsExportSource exports the consents of the user. They are not kept
+// in a store of their own: the consent page is approved on every
+// authorization and the approval lives in the sessions issued to the client,
+// so each client with a stored session is one consent with the union of its
+// scopes.
+func NewConsentsExportSource(refreshTokenRepo repository.RefreshTokenRepository, oauthRepo repository.OAuthRepository) ExportSource {
+	return &consentsExportSource{refreshTokenRepository: refreshTokenRepo, oauthRepository: oauthRepo}
+}
+
+func (source *consentsExportSource) Name() string {
+	return "consents"
+}
+
+func (source *consentsExportSource) Export(ctx context.Context, userId string) (interface{}, error) {
+	refreshTokens, err := source.refreshTokenRepository.FindTokensByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	consents := []dto.ConsentExportDTO{}
+	byClient := map[string]int{}
+	for _, refreshToken := range refreshTokens {
+		if refreshToken.ClientId == "" {
+			continue
+		}
+		grantedAt := refreshToken.AuthTime
+		if grantedAt.IsZero() {
+			grantedAt = refreshToken.IssuedAt
+		}
+		index, ok := byClient[refreshToken.ClientId]
+		if !ok {
+			index = len(consents)
+			byClient[refreshToken.ClientId] = index
+			consent := dto.ConsentExportDTO{ClientId: refreshToken.ClientId, Scopes: []string{}, GrantedAt: grantedAt}
+			client, err := source.oauthRepository.FindClient(ctx, refreshToken.ClientId)
+			if err == nil {
+				consent.ClientName = client.Name
+			} else if !errors.Is(err, repository.ErrOAuthClientNotFound) {
+				return nil, err
+			}
+			consents = append(consents, consent)
+		}
+		consent := &consents[index]
+		for _, scope := range strings.Fields(refreshToken.Scope) {
+			if !slices.Contains(consent.Scopes, scope) {
+				consent.Scopes = append(consent.Scopes, scope)
+			}
+		}
+		if grantedAt.Before(consent.GrantedAt) {
+			consent.GrantedAt = grantedAt
+		}
+		if !refreshToken.Revoked && refreshToken.Expires.After(now) {
+			consent.Active = true
+		}
+	}
+	return consents, nil
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+	"users-microservice/config"
+	"users-microservice/dto"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+func newTestExportService(t *testing.T) (*ExportService, repository.ExportJobRepository, repository.ExportArchiveRepository) {
+	t.Helper()
+	userRepository := repository.NewMemoryUserRepository()
+	user := &models.User{UserId: "user-1", Name: "John", LastName: "Doe", Email: "john@example.com", CreatedAt: time.Now().UTC()}
+	if err := userRepository.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	config := &config.Config{EXPORT_CONFIG: config.ExportConfig{RETENTION: time.Hour, LEASE: time.Minute}}
+	userService := NewUserService(userRepository, nil, nil, nil, config)
+	jobRepository := repository.NewMemoryExportJobRepository()
+	archiveRepository := repository.NewMemoryExportArchiveRepository()
+	service := NewExportService(userService, jobRepository, archiveRepository, config)
+	service.RegisterSource(NewProfileExportSource(userService))
+	return service, jobRepository, archiveRepository
+}
+
+func TestProcessNextExportJobServiceStoresTheArchiveApart(t *testing.T) {
+	service, jobRepository, _ := newTestExportService(t)
+	ctx := context.Background()
+	created, err := service.CreateExportJobService(ctx, "user-1", ExportFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed, err := service.ProcessNextExportJobService(ctx); !processed || err != nil {
+		t.Fatalf("ProcessNextExportJobService = %v, %v", processed, err)
+	}
+	job, err := jobRepository.FindJob(ctx, created.JobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != models.ExportJobCompleted || job.ArchiveId == "" || job.LeaseExpiresAt != nil {
+		t.Fatalf("after processing job = %+v", job)
+	}
+	archive, err := service.DownloadExportJobService(ctx, "user-1", created.JobId)
+	if err != nil {
+		t.Fatalf("DownloadExportJobService: %v", err)
+	}
+	if len(archive.Data) == 0 {
+		t.Fatal("the archive is empty")
+	}
+	if _, err := service.DownloadExportJobService(ctx, "user-2", created.JobId); !errors.Is(err, ErrExportJobNotFound) {
+		t.Fatalf("download of another user error = %v, want %v", err, ErrExportJobNotFound)
+	}
+}
+
+// Un worker que se cae deja el job en "running": otro lo reclama cuando vence
+// el lease y el primero ya no puede guardarlo.
+func TestProcessNextExportJobServiceReclaimsExpiredLeases(t *testing.T) {
+	service, jobRepository, _ := newTestExportService(t)
+	ctx := context.Background()
+	created, err := service.CreateExportJobService(ctx, "user-1", ExportFormatZIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed, err := jobRepository.ClaimPendingJob(ctx, time.Now().UTC(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed, err := service.ProcessNextExportJobService(ctx); processed || err != nil {
+		t.Fatalf("ProcessNextExportJobService during the lease = %v, %v", processed, err)
+	}
+
+	if _, err := jobRepository.ClaimPendingJob(ctx, time.Now().UTC().Add(2*time.Minute), time.Minute); err != nil {
+		t.Fatalf("ClaimPendingJob after the lease: %v", err)
+	}
+	crashed.Status = models.ExportJobFailed
+	if err := jobRepository.UpdateJob(ctx, crashed); !errors.Is(err, repository.ErrExportJobNotFound) {
+		t.Fatalf("UpdateJob with a stale claim error = %v, want %v", err, repository.ErrExportJobNotFound)
+	}
+	job, err := jobRepository.FindJob(ctx, created.JobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != models.ExportJobRunning || job.Attempts != 2 {
+		t.Fatalf("after the reclaim job = %+v", job)
+	}
+}
+
+func TestProcessNextExportJobServiceGivesUp(t *testing.T) {
+	service, jobRepository, _ := newTestExportService(t)
+	ctx := context.Background()
+	created, err := service.CreateExportJobService(ctx, "user-1", ExportFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Add(-time.Hour)
+	for range exportMaxAttempts {
+		if _, err := jobRepository.ClaimPendingJob(ctx, now, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(2 * time.Minute)
+	}
+	if processed, err := service.ProcessNextExportJobService(ctx); !processed || err != nil {
+		t.Fatalf("ProcessNextExportJobService = %v, %v", processed, err)
+	}
+	job, err := jobRepository.FindJob(ctx, created.JobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != models.ExportJobFailed || job.ArchiveId != "" {
+		t.Fatalf("after %d attempts job = %+v", exportMaxAttempts+1, job)
+	}
+}
+
+func TestPurgeExpiredArchivesService(t *testing.T) {
+	service, _, archiveRepository := newTestExportService(t)
+	ctx := context.Background()
+	if err := archiveRepository.SaveArchive(ctx, "expired", []byte("{}"), time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := archiveRepository.SaveArchive(ctx, "current", []byte("{}"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := service.PurgeExpiredArchivesService(ctx); deleted != 1 || err != nil {
+		t.Fatalf("PurgeExpiredArchivesService = %d, %v; want 1", deleted, err)
+	}
+	if _, err := archiveRepository.LoadArchive(ctx, "expired"); !errors.Is(err, repository.ErrExportArchiveNotFound) {
+		t.Fatalf("LoadArchive(expired) error = %v, want %v", err, repository.ErrExportArchiveNotFound)
+	}
+	if _, err := archiveRepository.LoadArchive(ctx, "current"); err != nil {
+		t.Fatalf("LoadArchive(current): %v", err)
+	}
+}
+
+func TestConsentsExportSource(t *testing.T) {
+	ctx := context.Background()
+	refreshTokenRepository := repository.NewMemoryRefreshTokenRepository()
+	oauthRepository := repository.NewMemoryOAuthRepository()
+	if err := oauthRepository.CreateClient(ctx, &models.OAuthClient{ID: "app", Name: "App"}); err != nil {
+		t.Fatal(err)
+	}
+	grantedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := time.Now().UTC()
+	tokens := []models.RefreshToken{
+		{ID: "1", Jti: "1", UserId: "user-1", ClientId: "app", Scope: "openid profile", AuthTime: grantedAt, IssuedAt: grantedAt, Expires: now.Add(-time.Hour)},
+		{ID: "2", Jti: "2", UserId: "user-1", ClientId: "app", Scope: "openid email", AuthTime: grantedAt.Add(time.Hour), IssuedAt: now, Expires: now.Add(time.Hour)},
+		{ID: "3", Jti: "3", UserId: "user-1", ClientId: "deleted-app", Scope: "openid", IssuedAt: grantedAt, Expires: now.Add(time.Hour), Revoked: true},
+		{ID: "4", Jti: "4", UserId: "user-1", IssuedAt: now, Expires: now.Add(time.Hour)},
+		{ID: "5", Jti: "5", UserId: "user-2", ClientId: "app", Scope: "admin", IssuedAt: now, Expires: now.Add(time.Hour)},
+	}
+	for i := range tokens {
+		if err := refreshTokenRepository.CreateRefreshToken(ctx, &tokens[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exported, err := NewConsentsExportSource(refreshTokenRepository, oauthRepository).Export(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	consents := exported.([]dto.ConsentExportDTO)
+	slices.SortFunc(consents, func(a, b dto.ConsentExportDTO) int { return len(b.Scopes) - len(a.Scopes) })
+	if len(consents) != 2 {
+		t.Fatalf("consents = %+v, want one per client", consents)
+	}
+	app, deleted := consents[0], consents[1]
+	slices.Sort(app.Scopes)
+	if app.ClientName != "App" || !slices.Equal(app.Scopes, []string{"email", "openid", "profile"}) || !app.GrantedAt.Equal(grantedAt) || !app.Active {
+		t.Fatalf("consent of app = %+v", app)
+	}
+	if deleted.ClientId != "deleted-app" || deleted.ClientName != "" || deleted.Active {
+		t.Fatalf("consent of a deleted client = %+v", deleted)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+	"users-microservice/config"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+// idempotencyLockTimeout is how long a request holds its key. If the instance
+// dies while handling it, the key can be used again after that.
+const idempotencyLockTimeout = time.Minute
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+var ErrIdempotencyRequestInProgress = errors.New("a request with this idempotency key is in progress")
+
+// IdempotencyService lets clients retry a POST with the same Idempotency-Key
+// header: the first request runs and its response is kept for
+// IDEMPOTENCY_TTL, the retries get that response again.
+type IdempotencyService struct {
+	idempotencyRepository repository.IdempotencyRepository
+	config                config.Config
+}
+
+func NewIdempotencyService(idempotencyRepo repository.IdempotencyRepository, config *config.Config) *IdempotencyService {
+	return &IdempotencyService{
+		idempotencyRepository: idempotencyRepo,
+		config:                *config,
+	}
+}
+
+// BeginService reserves key for the request with body. scope tells apart the
+// same key sent by different users or to different endpoints. It
+// returns the stored record when the request already completed, nil when it
+// must run, ErrIdempotencyRequestInProgress while the first request is still
+// running and ErrIdempotencyKeyReused when the key was used for another
+// request.
+func (service *IdempotencyService) BeginService(ctx context.Context, scope string, key string, body []byte) (*models.IdempotencyRecord, error) {
+	fingerprint := service.fingerprint(body)
+	now := time.Now().UTC()
+	record := models.IdempotencyRecord{
+		Key:         idempotencyRecordKey(scope, key),
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(idempotencyLockTimeout),
+	}
+	stored, err := service.idempotencyRepository.Reserve(ctx, &record)
+	if errors.Is(err, repository.ErrIdempotencyKeyInUse) {
+		switch {
+		case stored.Fingerprint != fingerprint:
+			return nil, ErrIdempotencyKeyReused
+		case !stored.Completed:
+			return nil, ErrIdempotencyRequestInProgress
+		}
+		return stored, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: reserving the idempotency key: %w", err)
+	}
+	return nil, nil
+}
+
+// CompleteService stores the response of the request reserved with
+// BeginService. body is nil for the responses that must not be stored.
+func (service *IdempotencyService) CompleteService(ctx context.Context, scope string, key string, statusCode int, headers map[string]string, body []byte) error {
+	err := service.idempotencyRepository.Complete(ctx, &models.IdempotencyRecord{
+		Key:        idempotencyRecordKey(scope, key),
+		StatusCode: statusCode,
+		Headers:    headers,
+		Body:       body,
+		ExpiresAt:  time.Now().UTC().Add(service.config.IDEMPOTENCY_TTL),
+	})
+	if err != nil {
+		return fmt.Errorf("error: storing the idempotent response: %w", err)
+	}
+	return nil
+}
+
+// ReleaseService frees the key of a request that failed, so it can be retried.
+func (service *IdempotencyService) ReleaseService(ctx context.Context, scope string, key string) error {
+	if err := service.idempotencyRepository.Release(ctx, idempotencyRecordKey(scope, key)); err != nil {
+		return fmt.Errorf("error: releasing the idempotency key: %w", err)
+	}
+	return nil
+}
+
+// fingerprint is an HMAC of body keyed with the server secret, so the stored
+// fingerprint of a request that carried a password cannot be used to guess it.
+func (service *IdempotencyService) fingerprint(body []byte) string {
+	mac := hmac.New(sha256.New, []byte("idempotency:"+service.config.JWT_SECRET_KEY))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func idempotencyRecordKey(scope string, key string) string {
+	sum := sha256.Sum256([]byte(scope + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"users-microservice/dto"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/google/uuid"
+)
+
+type LoginHistoryService struct {
+	loginHistoryRepository repository.LoginHistoryRepository
+}
+
+func NewLoginHistoryService(loginHistoryRepo repository.LoginHistoryRepository) *LoginHistoryService {
+	return &LoginHistoryService{
+		loginHistoryRepository: loginHistoryRepo,
+	}
+}
+
+// Record stores a sign-in attempt of a known user with the IP and user agent
+// of ctx; an empty failureReason means the attempt succeeded. Like the audit
+// log it never fails the login and a nil LoginHistoryService records nothing.
+func (service *LoginHistoryService) Record(ctx context.Context, userId string, method string, failureReason string) {
+	if service == nil || userId == "" {
+		return
+	}
+	attemptId, err := uuid.NewRandom()
+	if err != nil {
+		log.Printf("login history: %v", err)
+		return
+	}
+	metadata := RequestMetadataFromContext(ctx)
+	attempt := models.LoginAttempt{
+		ID:            attemptId.String(),
+		UserId:        userId,
+		Method:        method,
+		Success:       failureReason == "",
+		FailureReason: failureReason,
+		IP:            metadata.IP,
+		UserAgent:     metadata.UserAgent,
+		Timestamp:     time.Now().UTC(),
+	}
+	if err := service.loginHistoryRepository.CreateAttempt(ctx, &attempt); err != nil {
+		log.Printf("login history: recording attempt of %s failed: %v", userId, err)
+	}
+}
+
+func (service *LoginHistoryService) ListLoginsService(ctx context.Context, userId string, query *dto.LoginHistoryQueryDTO) (*dto.LoginHistoryDTO, error) {
+	page, err := service.loginHistoryRepository.ListAttempts(ctx, userId, query.Cursor, query.Limit)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	response := dto.LoginHistoryDTO{Logins: page.Attempts, NextCursor: page.NextCursor}
+	if response.Logins == nil {
+		response.Logins = []models.LoginAttempt{}
+	}
+	return &response, nil
+}
+
+type loginHistoryExportSource struct {
+	loginHistoryRepository repository.LoginHistoryRepository
+}
+
+func NewLoginHistoryExportSource(loginHistoryRepo repository.LoginHistoryRepository) ExportSource {
+	return &loginHistoryExportSource{loginHistoryRepository: loginHistoryRepo}
+}
+
+func (source *loginHistoryExportSource) Name() string {
+	return "login_history"
+}
+
+func (source *loginHistoryExportSource) Export(ctx context.Context, userId string) (interface{}, error) {
+	attempts := []models.LoginAttempt{}
+	cursor := ""
+	for {
+		page, err := source.loginHistoryRepository.ListAttempts(ctx, userId, cursor, repository.MaxListLimit)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, page.Attempts...)
+		if page.NextCursor == "" {
+			return attempts, nil
+		}
+		cursor = page.NextCursor
+	}
+}
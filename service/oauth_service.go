@@ -0,0 +1,426 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"users-microservice/config"
+	"users-microservice/dto"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+	PKCEMethodS256             = "S256"
+)
+
+// Los errores OAuth tienen como mensaje el codigo de error de RFC 6749, que el
+// handler devuelve al cliente.
+var ErrOAuthInvalidRequest = errors.New("invalid_request")
+var ErrOAuthInvalidClient = errors.New("invalid_client")
+var ErrOAuthInvalidGrant = errors.New("invalid_grant")
+var ErrOAuthUnauthorizedClient = errors.New("unauthorized_client")
+var ErrOAuthUnsupportedGrantType = errors.New("unsupported_grant_type")
+var ErrOAuthUnsupportedResponseType = errors.New("unsupported_response_type")
+var ErrOAuthInvalidScope = errors.New("invalid_scope")
+var ErrOAuthAccessDenied = errors.New("access_denied")
+
+var ErrOAuthClientNotFound = errors.New("oauth client not found")
+var ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+
+// OAuthService is the OAuth 2.0 authorization server: it registers clients,
+// issues authorization codes bound to a PKCE challenge and exchanges them for
+// the same access and refresh tokens as a password login.
+type OAuthService struct {
+	oauthRepository     repository.OAuthRepository
+	userService         *UserService
+	refreshTokenService *RefreshTokenService
+	config              config.Config
+	AuditService        *AuditService
+	// Con OIDCService los intercambios con scope openid devuelven un id_token.
+	OIDCService *OIDCService
+}
+
+func NewOAuthService(oauthRepo repository.OAuthRepository, userService *UserService, refreshTokenService *RefreshTokenService, config *config.Config) *OAuthService {
+	return &OAuthService{
+		oauthRepository:     oauthRepo,
+		userService:         userService,
+		refreshTokenService: refreshTokenService,
+		config:              *config,
+	}
+}
+
+func (service *OAuthService) CreateClientService(ctx context.Context, request *dto.OAuthClientRequestDTO) (*dto.OAuthClientCreatedDTO, error) {
+	for _, redirectURI := range request.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			return nil, err
+		}
+	}
+	clientId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error: error generating client_id: %w", err)
+	}
+	scopes := request.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	audiences := request.Audiences
+	if audiences == nil {
+		audiences = []string{}
+	}
+	client := models.OAuthClient{
+		ID:           clientId.String(),
+		Name:         request.Name,
+		Type:         request.ClientType,
+		RedirectURIs: request.RedirectURIs,
+		Scopes:       scopes,
+		Audiences:    audiences,
+		CreatedAt:    time.Now().UTC(),
+	}
+	var secret string
+	if client.Type == models.OAuthClientConfidential {
+		if secret, err = randomToken(); err != nil {
+			return nil, fmt.Errorf("error: error generating client secret: %w", err)
+		}
+		client.SecretHash = hashOpaqueToken(secret)
+	}
+	if err := service.oauthRepository.CreateClient(ctx, &client); err != nil {
+		return nil, fmt.Errorf("error: creating oauth client: %w", err)
+	}
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditOAuthClientCreated,
+		TargetId: client.ID,
+		Outcome:  models.AuditOutcomeSuccess,
+		Details:  map[string]string{"name": client.Name, "client_type": client.Type},
+	})
+	return &dto.OAuthClientCreatedDTO{OAuthClient: client, ClientSecret: secret}, nil
+}
+
+func (service *OAuthService) ListClientsService(ctx context.Context) (*dto.OAuthClientListDTO, error) {
+	clients, err := service.oauthRepository.ListClients(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	if clients == nil {
+		clients = []models.OAuthClient{}
+	}
+	return &dto.OAuthClientListDTO{Clients: clients}, nil
+}
+
+func (service *OAuthService) DeleteClientService(ctx context.Context, clientId string) error {
+	err := service.oauthRepository.DeleteClient(ctx, clientId)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error: db error: %w", err)
+	}
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditOAuthClientDeleted,
+		TargetId: clientId,
+		Outcome:  models.AuditOutcomeSuccess,
+	})
+	return nil
+}
+
+// ValidateAuthorizationRequestService checks an /oauth/authorize request and
+// fills the redirect URI and scope defaults in place, recording whether the
+// redirect URI was sent. ErrOAuthInvalidClient and
+// ErrInvalidRedirectURI must be shown to the user: every other error can be
+// sent back to the redirect URI.
+func (service *OAuthService) ValidateAuthorizationRequestService(ctx context.Context, request *dto.AuthorizationRequestDTO) (*models.OAuthClient, error) {
+	client, err := service.oauthRepository.FindClient(ctx, request.ClientId)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return nil, fmt.Errorf("%w: unknown client_id", ErrOAuthInvalidClient)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	// Solo se acepta una coincidencia exacta con una URI registrada.
+	request.RedirectURIProvided = request.RedirectURI != ""
+	if request.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		request.RedirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, request.RedirectURI) {
+		return nil, fmt.Errorf("%w: redirect_uri is not registered for this client", ErrInvalidRedirectURI)
+	}
+	if request.ResponseType != "code" {
+		return client, fmt.Errorf("%w: only the code response type is supported", ErrOAuthUnsupportedResponseType)
+	}
+	if request.CodeChallenge == "" || request.CodeChallengeMethod != PKCEMethodS256 {
+		return client, fmt.Errorf("%w: a S256 code_challenge is required", ErrOAuthInvalidRequest)
+	}
+	if request.Scope, err = resolveScope(client, request.Scope); err != nil {
+		return client, err
+	}
+	return client, nil
+}
+
+// AuthorizeService signs the user in on the consent page and issues an
+// authorization code. The request must have been checked by
+// ValidateAuthorizationRequestService.
+func (service *OAuthService) AuthorizeService(ctx context.Context, client *models.OAuthClient, request *dto.AuthorizationRequestDTO, email string, password string) (string, error) {
+	user, err := service.userService.VerifyCredentialsService(ctx, email, password)
+	if err != nil {
+		return "", err
+	}
+	service.userService.SecurityService.CheckNewDevice(ctx, user)
+	code, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("error: error generating authorization code: %w", err)
+	}
+	now := time.Now().UTC()
+	authorizationCode := models.AuthorizationCode{
+		ID:                  hashOpaqueToken(code),
+		ClientId:            client.ID,
+		UserId:              user.UserId,
+		RedirectURI:         request.RedirectURI,
+		RedirectURIProvided: request.RedirectURIProvided,
+		Scope:               request.Scope,
+		CodeChallenge:       request.CodeChallenge,
+		CodeChallengeMethod: request.CodeChallengeMethod,
+		Nonce:               request.Nonce,
+		AuthTime:            now,
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(service.config.OAUTH_CONFIG.AUTHORIZATION_CODE_TTL),
+	}
+	if err := service.oauthRepository.CreateAuthorizationCode(ctx, &authorizationCode); err != nil {
+		return "", fmt.Errorf("error: storing authorization code: %w", err)
+	}
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditOAuthAuthorizationGrant,
+		ActorId:  user.UserId,
+		TargetId: user.UserId,
+		Outcome:  models.AuditOutcomeSuccess,
+		Details:  map[string]string{"client_id": client.ID, "scope": request.Scope},
+	})
+	return code, nil
+}
+
+// ExchangeTokenService implements the token endpoint. clientId and secret come
+// from HTTP Basic authentication or, when absent, from the request body.
+func (service *OAuthService) ExchangeTokenService(ctx context.Context, request *dto.TokenRequestDTO) (*dto.TokenResponseDTO, error) {
+	client, err := service.authenticateClient(ctx, request.ClientId, request.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	// Con una prueba DPoP los tokens emitidos quedan ligados a su clave.
+	jkt, err := service.refreshTokenService.DPoPService.ProofKeyService(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	switch request.GrantType {
+	case GrantTypeAuthorizationCode:
+		return service.exchangeAuthorizationCode(ctx, client, request, jkt)
+	case GrantTypeRefreshToken:
+		if request.RefreshToken == "" {
+			return nil, fmt.Errorf("%w: refresh_token is required", ErrOAuthInvalidRequest)
+		}
+		tokens, err := service.refreshTokenService.RotateRefreshTokenService(ctx, request.RefreshToken, client.ID, jkt)
+		if errors.Is(err, ErrInvalidToken) {
+			return nil, fmt.Errorf("%w: the refresh token is invalid, expired or revoked", ErrOAuthInvalidGrant)
+		}
+		return tokens, err
+	case GrantTypeClientCredentials:
+		return service.exchangeClientCredentials(client, request, jkt)
+	case "":
+		return nil, fmt.Errorf("%w: grant_type is required", ErrOAuthInvalidRequest)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrOAuthUnsupportedGrantType, request.GrantType)
+}
+
+func (service *OAuthService) exchangeAuthorizationCode(ctx context.Context, client *models.OAuthClient, request *dto.TokenRequestDTO, jkt string) (*dto.TokenResponseDTO, error) {
+	if request.Code == "" || request.CodeVerifier == "" {
+		return nil, fmt.Errorf("%w: code and code_verifier are required", ErrOAuthInvalidRequest)
+	}
+	code, err := service.oauthRepository.ConsumeAuthorizationCode(ctx, hashOpaqueToken(request.Code))
+	if errors.Is(err, repository.ErrAuthorizationCodeNotFound) {
+		return nil, fmt.Errorf("%w: the authorization code is invalid or was already used", ErrOAuthInvalidGrant)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	switch {
+	case time.Now().After(code.ExpiresAt):
+		return nil, fmt.Errorf("%w: the authorization code expired", ErrOAuthInvalidGrant)
+	case code.ClientId != client.ID:
+		return nil, fmt.Errorf("%w: the authorization code was issued to another client", ErrOAuthInvalidGrant)
+	// RFC 6749 4.1.3: redirect_uri solo es obligatorio si se envio a /oauth/authorize,
+	// pero si llega tiene que coincidir.
+	case (code.RedirectURIProvided || request.RedirectURI != "") && code.RedirectURI != request.RedirectURI:
+		return nil, fmt.Errorf("%w: redirect_uri does not match the authorization request", ErrOAuthInvalidGrant)
+	case !verifyCodeChallenge(code.CodeChallenge, request.CodeVerifier):
+		return nil, fmt.Errorf("%w: the code_verifier does not match the code_challenge", ErrOAuthInvalidGrant)
+	}
+	user, err := service.userService.userService.FindUserByID(ctx, code.UserId)
+	if errors.Is(err, repository.ErrUserNotFound) || (err == nil && (user.IsDeleted() || user.Locked)) {
+		return nil, fmt.Errorf("%w: the user is no longer active", ErrOAuthInvalidGrant)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	// Las sesiones de los clientes OAuth cuentan para el mismo limite que los logins.
+	if _, err := service.refreshTokenService.EnforceSessionLimitService(ctx, user); err != nil {
+		if errors.Is(err, ErrSessionLimitReached) {
+			return nil, fmt.Errorf("%w: %w", ErrOAuthInvalidGrant, err)
+		}
+		return nil, err
+	}
+	tokens, err := service.refreshTokenService.IssueTokenPairService(ctx, user, client.ID, code.Scope, client.Audiences, code.AuthTime, jkt)
+	if err != nil {
+		return nil, err
+	}
+	if service.OIDCService != nil && slices.Contains(strings.Fields(code.Scope), ScopeOpenID) {
+		if tokens.IDToken, err = service.OIDCService.SignIDTokenService(user, client.ID, code.Scope, code.Nonce, code.AuthTime); err != nil {
+			return nil, fmt.Errorf("error: signing id_token: %w", err)
+		}
+	}
+	return tokens, nil
+}
+
+// exchangeClientCredentials issues a service token with the client as subject.
+// The requested scopes and audiences default to every one the client was
+// registered for; no refresh token is issued.
+func (service *OAuthService) exchangeClientCredentials(client *models.OAuthClient, request *dto.TokenRequestDTO, jkt string) (*dto.TokenResponseDTO, error) {
+	if client.Type != models.OAuthClientConfidential {
+		return nil, fmt.Errorf("%w: only confidential clients can use client_credentials", ErrOAuthUnauthorizedClient)
+	}
+	scope, err := resolveScope(client, request.Scope)
+	if err != nil {
+		return nil, err
+	}
+	audiences := request.Audience
+	if len(audiences) == 0 {
+		audiences = client.Audiences
+	}
+	if len(audiences) == 0 {
+		return nil, fmt.Errorf("%w: the client has no audience registered", ErrOAuthUnauthorizedClient)
+	}
+	for _, audience := range audiences {
+		if !slices.Contains(client.Audiences, audience) {
+			return nil, fmt.Errorf("%w: audience %s is not allowed for this client", ErrOAuthInvalidRequest, audience)
+		}
+	}
+	return service.refreshTokenService.IssueClientTokenService(client.ID, audiences, scope, jkt)
+}
+
+// authenticateClient requires the secret of confidential clients. Public
+// clients only identify themselves and rely on PKCE.
+func (service *OAuthService) authenticateClient(ctx context.Context, clientId string, secret string) (*models.OAuthClient, error) {
+	if clientId == "" {
+		return nil, fmt.Errorf("%w: client_id is required", ErrOAuthInvalidClient)
+	}
+	client, err := service.oauthRepository.FindClient(ctx, clientId)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return nil, fmt.Errorf("%w: unknown client", ErrOAuthInvalidClient)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	if client.Type == models.OAuthClientPublic {
+		if secret != "" {
+			return nil, fmt.Errorf("%w: public clients have no secret", ErrOAuthInvalidClient)
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashOpaqueToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, fmt.Errorf("%w: client authentication failed", ErrOAuthInvalidClient)
+	}
+	return client, nil
+}
+
+// resolveScope defaults an empty scope to every scope of the client and
+// rejects the scopes the client was not registered for.
+func resolveScope(client *models.OAuthClient, scope string) (string, error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return strings.Join(client.Scopes, " "), nil
+	}
+	for _, name := range requested {
+		if !slices.Contains(client.Scopes, name) {
+			return "", fmt.Errorf("%w: %s is not allowed for this client", ErrOAuthInvalidScope, name)
+		}
+	}
+	return strings.Join(requested, " "), nil
+}
+
+// validateRedirectURI accepts absolute URIs without fragment: https, http on
+// the loopback interface and the private-use schemes of native apps, which
+// must be reverse domain names such as com.example.app (RFC 8252 7.1). That
+// rules out javascript:, data: and the other schemes a browser would run.
+func validateRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || parsed.Scheme == "" || parsed.Fragment != "" || strings.Contains(redirectURI, "#") {
+		return fmt.Errorf("%w: %s", ErrInvalidRedirectURI, redirectURI)
+	}
+	switch parsed.Scheme {
+	case "https":
+		if parsed.Host == "" {
+			return fmt.Errorf("%w: %s", ErrInvalidRedirectURI, redirectURI)
+		}
+	case "http":
+		if host := parsed.Hostname(); host != "localhost" && host != "127.0.0.1" && host != "::1" {
+			return fmt.Errorf("%w: http is only allowed for loopback addresses: %s", ErrInvalidRedirectURI, redirectURI)
+		}
+	default:
+		if !isReverseDomainName(parsed.Scheme) {
+			return fmt.Errorf("%w: private-use schemes must be reverse domain names: %s", ErrInvalidRedirectURI, redirectURI)
+		}
+	}
+	return nil
+}
+
+// isReverseDomainName reports whether scheme has at least two non-empty labels
+// separated by dots, like com.example.app.
+func isReverseDomainName(scheme string) bool {
+	labels := strings.Split(scheme, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyCodeChallenge checks BASE64URL(SHA256(code_verifier)) against the
+// challenge sent to /oauth/authorize (RFC 7636).
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func randomToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// hashOpaqueToken is used for the high entropy values the server generates
+// (client secrets, authorization codes), so a plain SHA-256 is enough.
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"users-microservice/dto"
+	"users-microservice/models"
+)
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		redirectURI string
+		valid       bool
+	}{
+		{"https://app.example.com/callback", true},
+		{"http://127.0.0.1:8400/callback", true},
+		{"http://localhost/callback", true},
+		{"com.example.app:/oauth2redirect", true},
+		{"com.example.app://callback", true},
+		{"https:///callback", false},
+		{"http://app.example.com/callback", false},
+		{"https://app.example.com/callback#fragment", false},
+		{"/callback", false},
+		{"javascript:alert(document.cookie)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"myapp:/callback", false},
+		{"com..example:/callback", false},
+		{"com.example.:/callback", false},
+	}
+	for _, test := range tests {
+		t.Run(test.redirectURI, func(t *testing.T) {
+			err := validateRedirectURI(test.redirectURI)
+			if test.valid && err != nil {
+				t.Fatalf("validateRedirectURI: %v", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidRedirectURI) {
+				t.Fatalf("validateRedirectURI error = %v, want %v", err, ErrInvalidRedirectURI)
+			}
+		})
+	}
+}
+
+func TestExchangeAuthorizationCodeRedirectURI(t *testing.T) {
+	oauthService, _, oauthRepository, user := newTestOIDCService(t)
+	ctx := context.Background()
+	const registered = "https://app.example.com/callback"
+
+	// Con una sola URI registrada /oauth/authorize puede omitirla.
+	request := &dto.AuthorizationRequestDTO{ResponseType: "code", ClientId: testClientId, CodeChallenge: "challenge", CodeChallengeMethod: PKCEMethodS256}
+	if _, err := oauthService.ValidateAuthorizationRequestService(ctx, request); err != nil {
+		t.Fatal(err)
+	}
+	if request.RedirectURI != registered || request.RedirectURIProvided {
+		t.Fatalf("authorization request without redirect_uri = %+v", request)
+	}
+	request.RedirectURI = registered
+	if _, err := oauthService.ValidateAuthorizationRequestService(ctx, request); err != nil || !request.RedirectURIProvided {
+		t.Fatalf("authorization request with redirect_uri = %+v, %v", request, err)
+	}
+
+	challenge := sha256.Sum256([]byte(testCodeVerifier))
+	tests := []struct {
+		name            string
+		provided        bool
+		tokenRedirect   string
+		wantInvalidCode bool
+	}{
+		{name: "omitted in both", provided: false, tokenRedirect: ""},
+		{name: "omitted at authorize, sent to token", provided: false, tokenRedirect: registered},
+		{name: "omitted at authorize, another one sent to token", provided: false, tokenRedirect: "https://evil.example.com/callback", wantInvalidCode: true},
+		{name: "sent to both", provided: true, tokenRedirect: registered},
+		{name: "sent to authorize only", provided: true, tokenRedirect: "", wantInvalidCode: true},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code := fmt.Sprintf("redirect-code-%d", i)
+			err := oauthRepository.CreateAuthorizationCode(ctx, &models.AuthorizationCode{
+				ID:                  hashOpaqueToken(code),
+				ClientId:            testClientId,
+				UserId:              user.UserId,
+				RedirectURI:         registered,
+				RedirectURIProvided: test.provided,
+				Scope:               ScopeProfile,
+				CodeChallenge:       base64.RawURLEncoding.EncodeToString(challenge[:]),
+				CodeChallengeMethod: PKCEMethodS256,
+				AuthTime:            time.Now(),
+				ExpiresAt:           time.Now().Add(time.Minute),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = oauthService.ExchangeTokenService(ctx, &dto.TokenRequestDTO{
+				GrantType:    GrantTypeAuthorizationCode,
+				ClientId:     testClientId,
+				Code:         code,
+				CodeVerifier: testCodeVerifier,
+				RedirectURI:  test.tokenRedirect,
+			})
+			if test.wantInvalidCode != errors.Is(err, ErrOAuthInvalidGrant) || (!test.wantInvalidCode && err != nil) {
+				t.Fatalf("ExchangeTokenService error = %v, want invalid_grant %v", err, test.wantInvalidCode)
+			}
+		})
+	}
+}
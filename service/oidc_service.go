@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"users-microservice/config"
+	"users-microservice/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var ErrInsufficientScope = errors.New("insufficient scope")
+
+// OIDCService adds OpenID Connect on top of the OAuth service: it signs the
+// id_tokens, serves the userinfo claims and publishes the discovery document
+// and the public signing key. id_tokens are signed with RS256 so that any
+// client can verify them with the JWKS, unlike the HS256 access tokens.
+type OIDCService struct {
+	userService *UserService
+	signingKey  *rsa.PrivateKey
+	keyId       string
+	config      config.Config
+}
+
+func NewOIDCService(userService *UserService, signingKey *rsa.PrivateKey, config *config.Config) *OIDCService {
+	return &OIDCService{
+		userService: userService,
+		signingKey:  signingKey,
+		keyId:       rsaThumbprint(&signingKey.PublicKey),
+		config:      *config,
+	}
+}
+
+// LoadOIDCSigningKey reads a PEM encoded RSA private key (PKCS#1 or PKCS#8).
+// Without a path an ephemeral key is generated: id_tokens then stop verifying
+// after a restart and are not shared between replicas.
+func LoadOIDCSigningKey(path string) (*rsa.PrivateKey, error) {
+	if path == "" {
+		log.Printf("oidc: OIDC_SIGNING_KEY_FILE not set, using an ephemeral signing key")
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("oidc: %s is not a PEM file", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: parsing %s: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("oidc: %s is not an RSA key", path)
+	}
+	return key, nil
+}
+
+// SignIDTokenService issues the id_token of an authorization code exchange.
+// The profile and email claims are only included for their scopes.
+func (service *OIDCService) SignIDTokenService(user *models.User, clientId string, scope string, nonce string, authTime time.Time) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":       service.config.OIDC_CONFIG.ISSUER,
+		"sub":       user.UserId,
+		"aud":       clientId,
+		"azp":       clientId,
+		"iat":       now.Unix(),
+		"exp":       now.Add(service.config.OIDC_CONFIG.ID_TOKEN_TTL).Unix(),
+		"auth_time": authTime.Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	for name, value := range userClaims(user, scope) {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = service.keyId
+	return token.SignedString(service.signingKey)
+}
+
+// UserInfoService returns the claims of the user allowed by the scope of the
+// access token, which must include openid.
+func (service *OIDCService) UserInfoService(ctx context.Context, userId string, scope string) (map[string]interface{}, error) {
+	if !slices.Contains(strings.Fields(scope), ScopeOpenID) {
+		return nil, ErrInsufficientScope
+	}
+	user, err := service.userService.FindUserByIDService(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	claims := userClaims(user, scope)
+	claims["sub"] = user.UserId
+	return claims, nil
+}
+
+// DiscoveryService returns the /.well-known/openid-configuration document.
+func (service *OIDCService) DiscoveryService() map[string]interface{} {
+	issuer := service.config.OIDC_CONFIG.ISSUER
+	return map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeClientCredentials},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{jwt.SigningMethodRS256.Alg()},
+		"scopes_supported":                      []string{ScopeOpenID, ScopeProfile, ScopeEmail},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{PKCEMethodS256},
+		"dpop_signing_alg_values_supported":     []string{jwt.SigningMethodES256.Alg(), jwt.SigningMethodRS256.Alg()},
+		"claims_supported": []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+			"name", "given_name", "family_name", "email", "email_verified",
+		},
+	}
+}
+
+// JWKSService returns the public key that verifies the id_tokens.
+func (service *OIDCService) JWKSService() map[string]interface{} {
+	key := rsaJWK(&service.signingKey.PublicKey)
+	key["kid"] = service.keyId
+	key["use"] = "sig"
+	key["alg"] = jwt.SigningMethodRS256.Alg()
+	return map[string]interface{}{"keys": []map[string]interface{}{key}}
+}
+
+func userClaims(user *models.User, scope string) map[string]interface{} {
+	claims := map[string]interface{}{}
+	scopes := strings.Fields(scope)
+	if slices.Contains(scopes, ScopeProfile) {
+		claims["name"] = strings.TrimSpace(user.Name + " " + user.LastName)
+		claims["given_name"] = user.Name
+		claims["family_name"] = user.LastName
+	}
+	if slices.Contains(scopes, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.Verified
+	}
+	return claims
+}
+
+func rsaJWK(key *rsa.PublicKey) map[string]interface{} {
+	return map[string]interface{}{
+		"kty": "RSA",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// rsaThumbprint is the RFC 7638 thumbprint of the key, used as its kid.
+func rsaThumbprint(key *rsa.PublicKey) string {
+	jwk := rsaJWK(key)
+	canonical := fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk["e"], jwk["n"])
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
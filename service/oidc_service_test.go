@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+	"users-microservice/config"
+	"users-microservice/dto"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "https://users.example.com"
+
+// testCodeVerifier cumple el minimo de 43 caracteres de RFC 7636.
+const testCodeVerifier = "dBjftJeZ4CVP-mJ92K9qQ7Os4Rw4tPqhVyoIfeRkWeAQ"
+
+func newTestOIDCService(t *testing.T) (*OAuthService, *OIDCService, repository.OAuthRepository, *models.User) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &config.Config{
+		JWT_SECRET_KEY: "secret",
+		TOKEN_CONFIG:   config.TokenConfig{ISSUER: "users-microservice", AUDIENCE: "users-microservice", ACCESS_TOKEN_TTL: time.Minute},
+		REFRESH_TOKEN_CONFIG: config.RefreshTokenConfig{
+			EXPIRY_TIME:       time.Hour,
+			IDLE_TIMEOUT:      time.Hour,
+			ABSOLUTE_LIFETIME: time.Hour,
+		},
+		OIDC_CONFIG: config.OIDCConfig{ISSUER: testIssuer, ID_TOKEN_TTL: time.Hour},
+	}
+	userRepository := repository.NewMemoryUserRepository()
+	user := &models.User{UserId: "user-1", Name: "Ana", LastName: "Perez", Email: "ana@example.com", Verified: true, SessionVersion: 1, Role: models.RoleUser}
+	if err := userRepository.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	refreshTokenService := NewRefreshTokenService(repository.NewMemoryRefreshTokenRepository(), config)
+	userService := NewUserService(userRepository, nil, nil, refreshTokenService, config)
+	refreshTokenService.UserService = userService
+	oauthRepository := repository.NewMemoryOAuthRepository()
+	client := &models.OAuthClient{
+		ID:           testClientId,
+		Name:         "App",
+		Type:         models.OAuthClientPublic,
+		RedirectURIs: []string{"https://app.example.com/callback"},
+		Scopes:       []string{ScopeOpenID, ScopeProfile, ScopeEmail},
+	}
+	if err := oauthRepository.CreateClient(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	oidcService := NewOIDCService(userService, key, config)
+	oauthService := NewOAuthService(oauthRepository, userService, refreshTokenService, config)
+	oauthService.OIDCService = oidcService
+	return oauthService, oidcService, oauthRepository, user
+}
+
+// storeAuthorizationCode guarda un codigo de user para el cliente de prueba,
+// como lo haria AuthorizeService, y devuelve el codigo que recibe el cliente.
+func storeAuthorizationCode(t *testing.T, oauthRepository repository.OAuthRepository, user *models.User, scope string, nonce string, authTime time.Time) string {
+	t.Helper()
+	challenge := sha256.Sum256([]byte(testCodeVerifier))
+	code := "code-" + scope + "-" + nonce
+	err := oauthRepository.CreateAuthorizationCode(context.Background(), &models.AuthorizationCode{
+		ID:                  hashOpaqueToken(code),
+		ClientId:            testClientId,
+		UserId:              user.UserId,
+		RedirectURI:         "https://app.example.com/callback",
+		Scope:               scope,
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(challenge[:]),
+		CodeChallengeMethod: PKCEMethodS256,
+		Nonce:               nonce,
+		AuthTime:            authTime,
+		CreatedAt:           authTime,
+		ExpiresAt:           time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// parseIDToken verifica el id_token con la clave publicada en el JWKS.
+func parseIDToken(t *testing.T, oidcService *OIDCService, idToken string) jwt.MapClaims {
+	t.Helper()
+	keys := oidcService.JWKSService()["keys"].([]map[string]interface{})
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["kid"] != keys[0]["kid"] {
+			return nil, errors.New("unknown kid")
+		}
+		return &oidcService.signingKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithIssuer(testIssuer), jwt.WithAudience(testClientId))
+	if err != nil {
+		t.Fatalf("parsing the id_token: %v", err)
+	}
+	return token.Claims.(jwt.MapClaims)
+}
+
+func TestExchangeAuthorizationCodeIDToken(t *testing.T) {
+	oauthService, oidcService, oauthRepository, user := newTestOIDCService(t)
+	authTime := time.Now().Add(-5 * time.Minute).UTC().Truncate(time.Second)
+	tests := []struct {
+		name       string
+		scope      string
+		nonce      string
+		wantClaims []string
+		noClaims   []string
+	}{
+		{name: "openid only", scope: "openid", wantClaims: []string{"sub", "auth_time"}, noClaims: []string{"nonce", "email", "email_verified", "name"}},
+		{name: "nonce and email", scope: "openid email", nonce: "n-0S6_WzA2Mj", wantClaims: []string{"nonce", "email", "email_verified"}, noClaims: []string{"name"}},
+		{name: "profile", scope: "openid profile", nonce: "n-1", wantClaims: []string{"name", "given_name", "family_name"}, noClaims: []string{"email", "email_verified"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code := storeAuthorizationCode(t, oauthRepository, user, test.scope, test.nonce, authTime)
+			tokens, err := oauthService.ExchangeTokenService(context.Background(), &dto.TokenRequestDTO{
+				GrantType:    GrantTypeAuthorizationCode,
+				ClientId:     testClientId,
+				Code:         code,
+				CodeVerifier: testCodeVerifier,
+				RedirectURI:  "https://app.example.com/callback",
+			})
+			if err != nil {
+				t.Fatalf("ExchangeTokenService: %v", err)
+			}
+			claims := parseIDToken(t, oidcService, tokens.IDToken)
+			for _, name := range test.wantClaims {
+				if _, ok := claims[name]; !ok {
+					t.Fatalf("id_token claims %v, missing %s", slices.Collect(maps.Keys(claims)), name)
+				}
+			}
+			for _, name := range test.noClaims {
+				if _, ok := claims[name]; ok {
+					t.Fatalf("id_token claims %v, unexpected %s for scope %q", slices.Collect(maps.Keys(claims)), name, test.scope)
+				}
+			}
+			if claims["sub"] != user.UserId || claims["azp"] != testClientId || int64(claims["auth_time"].(float64)) != authTime.Unix() {
+				t.Fatalf("id_token claims = %v", claims)
+			}
+			if test.nonce != "" && claims["nonce"] != test.nonce {
+				t.Fatalf("nonce = %v, want %q", claims["nonce"], test.nonce)
+			}
+			if _, ok := claims["email"]; ok && (claims["email"] != user.Email || claims["email_verified"] != true) {
+				t.Fatalf("email claims = %v, %v", claims["email"], claims["email_verified"])
+			}
+		})
+	}
+
+	// Sin el scope openid no hay id_token.
+	code := storeAuthorizationCode(t, oauthRepository, user, "profile", "", authTime)
+	tokens, err := oauthService.ExchangeTokenService(context.Background(), &dto.TokenRequestDTO{
+		GrantType: GrantTypeAuthorizationCode, ClientId: testClientId, Code: code, CodeVerifier: testCodeVerifier, RedirectURI: "https://app.example.com/callback",
+	})
+	if err != nil || tokens.IDToken != "" {
+		t.Fatalf("ExchangeTokenService without openid = %+v, %v; want no id_token", tokens, err)
+	}
+}
+
+func TestSignIDTokenServiceEmailVerified(t *testing.T) {
+	_, oidcService, _, user := newTestOIDCService(t)
+	unverified := *user
+	unverified.Verified = false
+	idToken, err := oidcService.SignIDTokenService(&unverified, testClientId, "openid email", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims := parseIDToken(t, oidcService, idToken); claims["email_verified"] != false {
+		t.Fatalf("email_verified of an unverified user = %v", claims["email_verified"])
+	}
+}
+
+func TestUserInfoService(t *testing.T) {
+	_, oidcService, _, user := newTestOIDCService(t)
+	tests := []struct {
+		scope   string
+		want    map[string]interface{}
+		wantErr error
+	}{
+		{scope: "openid", want: map[string]interface{}{"sub": user.UserId}},
+		{scope: "openid email", want: map[string]interface{}{"sub": user.UserId, "email": user.Email, "email_verified": true}},
+		{scope: "openid profile", want: map[string]interface{}{"sub": user.UserId, "name": "Ana Perez", "given_name": "Ana", "family_name": "Perez"}},
+		{scope: "profile email", wantErr: ErrInsufficientScope},
+		{scope: "", wantErr: ErrInsufficientScope},
+	}
+	for _, test := range tests {
+		t.Run(test.scope, func(t *testing.T) {
+			claims, err := oidcService.UserInfoService(context.Background(), user.UserId, test.scope)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("UserInfoService error = %v, want %v", err, test.wantErr)
+			}
+			if !maps.Equal(claims, test.want) {
+				t.Fatalf("UserInfoService = %v, want %v", claims, test.want)
+			}
+		})
+	}
+}
+
+func TestDiscoveryService(t *testing.T) {
+	_, oidcService, _, _ := newTestOIDCService(t)
+	document := oidcService.DiscoveryService()
+	endpoints := map[string]string{
+		"issuer":                 testIssuer,
+		"authorization_endpoint": testIssuer + "/oauth/authorize",
+		"token_endpoint":         testIssuer + "/oauth/token",
+		"userinfo_endpoint":      testIssuer + "/userinfo",
+		"jwks_uri":               testIssuer + "/.well-known/jwks.json",
+	}
+	for name, want := range endpoints {
+		if document[name] != want {
+			t.Fatalf("%s = %v, want %s", name, document[name], want)
+		}
+	}
+	lists := map[string][]string{
+		"response_types_supported":              {"code"},
+		"id_token_signing_alg_values_supported": {"RS256"},
+		"scopes_supported":                      {"openid", "profile", "email"},
+		"code_challenge_methods_supported":      {"S256"},
+	}
+	for name, want := range lists {
+		if got, _ := document[name].([]string); !slices.Equal(got, want) {
+			t.Fatalf("%s = %v, want %v", name, document[name], want)
+		}
+	}
+	claims, _ := document["claims_supported"].([]string)
+	for _, name := range []string{"nonce", "auth_time", "email_verified"} {
+		if !slices.Contains(claims, name) {
+			t.Fatalf("claims_supported = %v, missing %s", claims, name)
+		}
+	}
+	// La clave del JWKS es la que firma los id_tokens.
+	keys := oidcService.JWKSService()["keys"].([]map[string]interface{})
+	if len(keys) != 1 || keys[0]["kid"] != oidcService.keyId || keys[0]["alg"] != "RS256" || keys[0]["kty"] != "RSA" {
+		t.Fatalf("JWKS keys = %v", keys)
+	}
+}
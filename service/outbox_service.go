@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"users-microservice/config"
+	"users-microservice/events"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/google/uuid"
+)
+
+// OutboxService relays the events written by UserService to the publisher.
+type OutboxService struct {
+	outboxRepository repository.OutboxRepository
+	publisher        events.Publisher
+	config           config.Config
+}
+
+func NewOutboxService(outboxRepo repository.OutboxRepository, publisher events.Publisher, config *config.Config) *OutboxService {
+	return &OutboxService{
+		outboxRepository: outboxRepo,
+		publisher:        publisher,
+		config:           *config,
+	}
+}
+
+// RelayPendingEventsService publishes up to batchSize pending events in the
+// order they were written. Delivery is at-least-once: an event is marked as
+// published only after the publisher accepted it. When an event fails, it is
+// retried with exponential backoff and the later events of the same user are
+// held back until then to keep the per user order; the other users go on.
+func (service *OutboxService) RelayPendingEventsService(ctx context.Context, batchSize int) (int, error) {
+	pending, err := service.outboxRepository.FindPendingEvents(ctx, time.Now().UTC(), batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("error: loading pending events: %w", err)
+	}
+	blocked := map[string]bool{}
+	published := 0
+	for i := range pending {
+		event := &pending[i]
+		if blocked[event.AggregateId] {
+			continue
+		}
+		if publishErr := service.publisher.Publish(ctx, event); publishErr != nil {
+			blocked[event.AggregateId] = true
+			backoff := exponentialBackoff(event.Attempts+1, service.config.OUTBOX_CONFIG.BACKOFF_BASE, service.config.OUTBOX_CONFIG.BACKOFF_MAX)
+			if markErr := service.outboxRepository.MarkFailed(ctx, event.ID, publishErr.Error(), time.Now().UTC().Add(backoff)); markErr != nil {
+				return published, fmt.Errorf("error: marking event %s as failed: %w", event.ID, markErr)
+			}
+			continue
+		}
+		if markErr := service.outboxRepository.MarkPublished(ctx, event.ID, time.Now().UTC()); markErr != nil {
+			return published, fmt.Errorf("error: marking event %s as published: %w", event.ID, markErr)
+		}
+		published++
+	}
+	return published, nil
+}
+
+// PurgePublishedEventsService deletes up to batchSize events published more
+// than OUTBOX_RETENTION ago, for the backends without TTL indexes.
+func (service *OutboxService) PurgePublishedEventsService(ctx context.Context, batchSize int) (int, error) {
+	before := time.Now().UTC().Add(-service.config.OUTBOX_CONFIG.RETENTION)
+	deleted, err := service.outboxRepository.DeletePublishedBefore(ctx, before, batchSize)
+	if err != nil {
+		return deleted, fmt.Errorf("error: purging published events: %w", err)
+	}
+	return deleted, nil
+}
+
+// newUserOutboxEvent uses UUIDv7 ids so the outbox can be read in write order.
+func newUserOutboxEvent(eventType string, user *models.User, changedFields ...string) (*models.OutboxEvent, error) {
+	eventId, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("error generating event id: %w", err)
+	}
+	return &models.OutboxEvent{
+		ID:          eventId.String(),
+		AggregateId: user.UserId,
+		Type:        eventType,
+		Data: models.UserEventData{
+			UserId:        user.UserId,
+			Email:         user.Email,
+			Name:          user.Name,
+			LastName:      user.LastName,
+			Role:          user.Role,
+			Verified:      user.Verified,
+			Locked:        user.Locked,
+			DeletedAt:     user.DeletedAt,
+			ChangedFields: changedFields,
+		},
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	"users-microservice/config"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+// failingPublisher rechaza los eventos de los usuarios de failing y guarda el
+// orden de los que publica.
+type failingPublisher struct {
+	mu        sync.Mutex
+	failing   map[string]bool
+	published []string
+}
+
+func (publisher *failingPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+	if publisher.failing[event.AggregateId] {
+		return errors.New("broker unavailable")
+	}
+	publisher.published = append(publisher.published, event.ID)
+	return nil
+}
+
+func (publisher *failingPublisher) Close() error {
+	return nil
+}
+
+func appendTestEvents(t *testing.T, outboxRepository repository.OutboxRepository, userId string, count int) []string {
+	t.Helper()
+	var ids []string
+	for range count {
+		event, err := newUserOutboxEvent(models.EventUserUpdated, &models.User{UserId: userId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := outboxRepository.AppendEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestRelayPendingEventsServiceDoesNotStarve(t *testing.T) {
+	outboxRepository := repository.NewMemoryOutboxRepository()
+	publisher := &failingPublisher{failing: map[string]bool{"failing-user": true}}
+	service := NewOutboxService(outboxRepository, publisher, &config.Config{
+		OUTBOX_CONFIG: config.OutboxConfig{BACKOFF_BASE: 50 * time.Millisecond, BACKOFF_MAX: time.Minute},
+	})
+	// Los eventos del usuario que falla son los mas antiguos y llenan el lote.
+	failingIds := appendTestEvents(t, outboxRepository, "failing-user", 3)
+	otherIds := appendTestEvents(t, outboxRepository, "other-user", 3)
+	const batchSize = 2
+
+	published, err := service.RelayPendingEventsService(context.Background(), batchSize)
+	if err != nil || published != 0 {
+		t.Fatalf("first relay = %d, %v; want 0 events", published, err)
+	}
+	for range 2 {
+		if _, err := service.RelayPendingEventsService(context.Background(), batchSize); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(publisher.published, otherIds) {
+		t.Fatalf("published %v while the failing user backs off, want %v", publisher.published, otherIds)
+	}
+
+	// Pasada la espera, los eventos retenidos salen en el orden en que se escribieron.
+	publisher.failing = nil
+	publisher.published = nil
+	time.Sleep(60 * time.Millisecond)
+	published, err = service.RelayPendingEventsService(context.Background(), len(failingIds))
+	if err != nil || published != len(failingIds) {
+		t.Fatalf("relay after the backoff = %d, %v; want %d events", published, err, len(failingIds))
+	}
+	if !slices.Equal(publisher.published, failingIds) {
+		t.Fatalf("published %v, want %v", publisher.published, failingIds)
+	}
+}
+
+func TestRelayPendingEventsServiceBackoff(t *testing.T) {
+	outboxRepository := repository.NewMemoryOutboxRepository()
+	publisher := &failingPublisher{failing: map[string]bool{"failing-user": true}}
+	service := NewOutboxService(outboxRepository, publisher, &config.Config{
+		OUTBOX_CONFIG: config.OutboxConfig{BACKOFF_BASE: time.Minute, BACKOFF_MAX: 4 * time.Minute},
+	})
+	appendTestEvents(t, outboxRepository, "failing-user", 1)
+	before := time.Now()
+	if _, err := service.RelayPendingEventsService(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	if waiting, _ := outboxRepository.FindPendingEvents(context.Background(), time.Now(), 10); len(waiting) != 0 {
+		t.Fatalf("FindPendingEvents during the backoff = %v", waiting)
+	}
+	pending, err := outboxRepository.FindPendingEvents(context.Background(), time.Now().Add(time.Hour), 10)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("FindPendingEvents after the backoff = %v, %v", pending, err)
+	}
+	event := pending[0]
+	if event.Attempts != 1 || event.LastError == "" || event.NextAttemptAt == nil ||
+		event.NextAttemptAt.Before(before.Add(time.Minute)) || event.NextAttemptAt.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("after a failure event = %+v, want the next attempt in 1m", event)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 3, want: 4 * time.Second},
+		{attempts: 4, want: 5 * time.Second},
+		{attempts: 100, want: 5 * time.Second},
+	}
+	for _, test := range tests {
+		if got := exponentialBackoff(test.attempts, time.Second, 5*time.Second); got != test.want {
+			t.Errorf("exponentialBackoff(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
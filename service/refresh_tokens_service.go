@@ -2,8 +2,11 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strconv"
 	"time"
 	"users-microservice/config"
 	"users-microservice/dto"
@@ -14,10 +17,19 @@ import (
 	"github.com/google/uuid"
 )
 
+var ErrInvalidToken = errors.New("invalid token")
+var ErrInvalidAudience = errors.New("audience not allowed")
+var ErrSessionLimitReached = errors.New("session limit reached")
+var ErrTokenReuse = errors.New("token reuse detected — all tokens revoked")
+var ErrSessionEvicted = errors.New("session signed out: a newer sign-in exceeded the session limit")
+
 type RefreshTokenService struct {
 	RefreshTokenRepository repository.RefreshTokenRepository
 	UserService            *UserService
 	config                 config.Config
+	AuditService           *AuditService
+	LoginHistoryService    *LoginHistoryService
+	DPoPService            *DPoPService
 }
 
 func NewRefreshTokenService(RefreshTokenRepo repository.RefreshTokenRepository, config *config.Config) *RefreshTokenService {
@@ -34,18 +46,32 @@ func (service *RefreshTokenService) CreateRefreshTokenService(ctx context.Contex
 		return fmt.Errorf("error: error generating token_id: %w", errId)
 	}
 	user, findUserErr := service.UserService.FindUserByIDService(ctx, refreshToken.UserId)
-	refreshTokenModel := models.RefreshToken{
-		ID:             Id.String(),
-		UserId:         refreshToken.UserId,
-		Jti: 			refreshToken.Jti,
-		IssuedAt:       timeNow,
-		Expires:        refreshToken.ExpiresAt,
-		Revoked:        false,
-		SessionVersion: user.SessionVersion,
-	}
 	if findUserErr != nil {
 		return ErrUserNotFound
 	}
+	metadata := RequestMetadataFromContext(ctx)
+	authTime := refreshToken.AuthTime
+	if authTime.IsZero() {
+		authTime = timeNow
+	}
+	refreshTokenModel := models.RefreshToken{
+		ID:                Id.String(),
+		UserId:            refreshToken.UserId,
+		Jti: 			refreshToken.Jti,
+		ClientId:          refreshToken.ClientId,
+		Scope:             refreshToken.Scope,
+		AuthTime:          authTime,
+		RememberMe:        refreshToken.RememberMe,
+		DPoPJkt:           refreshToken.DPoPJkt,
+		Audiences:         refreshToken.Audiences,
+		IssuedAt:          timeNow,
+		Expires:           service.refreshTokenExpiry(authTime, refreshToken.RememberMe),
+		Revoked:           false,
+		SessionVersion:    user.SessionVersion,
+		DeviceFingerprint: deviceFingerprint(metadata),
+		IP:                metadata.IP,
+		UserAgent:         metadata.UserAgent,
+	}
 
 	err := service.RefreshTokenRepository.CreateRefreshToken(ctx, &refreshTokenModel)
 	if err != nil {
@@ -58,7 +84,8 @@ func (service *RefreshTokenService) RefreshAccessToken(ctx context.Context, jwtS
 	// 1. Obtener usuario
 	// 2. Obtener el id del usuario
 	// 3. Obtener los claims del jwt
-	claims, verifyClaim := extractClaims(jwtString, service.config)
+	// El access token puede haber expirado: la duracion de la sesion la limita el refresh token.
+	claims, verifyClaim := extractAccessClaims(jwtString, service.config, jwt.WithoutClaimsValidation())
 	if !verifyClaim {
 		return uuid.Nil.String(), fmt.Errorf("token validation failed")
 	}
@@ -74,63 +101,392 @@ func (service *RefreshTokenService) RefreshAccessToken(ctx context.Context, jwtS
 	}
 	// Obtener el usuario
 	user, userFindErr := service.UserService.userService.FindUserByID(ctx, userId)
-	if userFindErr != nil {
+	if userFindErr != nil || user.IsDeleted() {
 		return uuid.Nil.String(), fmt.Errorf("find user err")
 	}
 	//	Buscar el refresh token que este vinculado al user id
 	refreshTokenUser, findTokenErr := service.RefreshTokenRepository.FindRefreshTokenByID(ctx, jti)
 	if findTokenErr != nil {
+		service.LoginHistoryService.Record(ctx, userId, models.LoginMethodRefresh, "token_not_found")
 		return uuid.Nil.String(), fmt.Errorf("token validation failed")
 	}
-	// Obtener la fecha de expiracion
-	tokenExpiryTime, tokenExpiryTimeErr := claims.GetExpirationTime()
-	if tokenExpiryTimeErr != nil {
-		return uuid.Nil.String(), fmt.Errorf("token with no due date")
+	if refreshTokenUser.UserId != userId {
+		return uuid.Nil.String(), fmt.Errorf("token validation failed")
+	}
+	// Las sesiones ligadas a una clave DPoP exigen una prueba firmada con ella.
+	jkt, proofErr := service.DPoPService.ProofKeyService(ctx, jwtString)
+	if proofErr != nil {
+		return uuid.Nil.String(), proofErr
+	}
+	if bindingErr := checkDPoPBinding(refreshTokenUser.DPoPJkt, jkt); bindingErr != nil {
+		service.LoginHistoryService.Record(ctx, userId, models.LoginMethodRefresh, "dpop_key_mismatch")
+		return uuid.Nil.String(), bindingErr
+	}
+	// Verificar que la sesion siga vigente
+	if sessionErr := service.checkRefreshSession(ctx, refreshTokenUser, user); sessionErr != nil {
+		return uuid.Nil.String(), sessionErr
+	}
+	if limitErr := service.checkSessionLimits(ctx, refreshTokenUser); limitErr != nil {
+		return uuid.Nil.String(), limitErr
+	}
+	// Revoke the old refresh token
+	if revokeTokenErr := service.revokeRotatedToken(ctx, refreshTokenUser, user); revokeTokenErr != nil {
+		return uuid.Nil.String(), revokeTokenErr
+	}
+	// El nuevo access token comparte el jti con el nuevo refresh token de la sesion
+	refreshTokenPlain, uuidErr := uuid.NewRandom()
+	if uuidErr != nil {
+		return uuid.Nil.String(), fmt.Errorf("error: error generating token_id: %w", uuidErr)
+	}
+	newJwt, createJwtErr := service.signAccessToken(user, refreshTokenPlain.String(), refreshTokenUser.Audiences, addConfirmationClaim(nil, jkt))
+	if createJwtErr != nil {
+		return uuid.Nil.String(), fmt.Errorf("new token err")
 	}
-	// Verificar que el token no este expirado
-	if refreshTokenUser.SessionVersion < user.SessionVersion {
-		return uuid.Nil.String(), fmt.Errorf("invalid token")
+	// Crear el nuevo refresh token con el inicio de sesion y la politica del anterior
+	newRefreshToken := dto.RefreshTokenCreateDTO{
+		UserId:     userId,
+		Jti: refreshTokenPlain.String(),
+		AuthTime:   sessionStart(refreshTokenUser),
+		RememberMe: refreshTokenUser.RememberMe,
+		Audiences:  refreshTokenUser.Audiences,
+		DPoPJkt:    jkt,
 	}
+	if createErr := service.CreateRefreshTokenService(ctx, &newRefreshToken); createErr != nil {
+		return uuid.Nil.String(), createErr
+	}
+	service.LoginHistoryService.Record(ctx, userId, models.LoginMethodRefresh, "")
+	return newJwt, nil
+}
 
-	if refreshTokenUser.Revoked {
-	revokeErr := service.RefreshTokenRepository.RevokeAllTokenFromUser(ctx, refreshTokenUser.UserId)
-	if revokeErr != nil {
-		return uuid.Nil.String(), fmt.Errorf("error revoking all tokens: %w", revokeErr)
+// DeleteExpiredTokensService deletes up to batchSize refresh tokens that
+// expired or were revoked longer than the retention ago. Revoked tokens are
+// kept until then so that presenting them again is still detected as reuse.
+func (service *RefreshTokenService) DeleteExpiredTokensService(ctx context.Context, batchSize int) (int, error) {
+	now := time.Now().UTC()
+	revokedBefore := now.Add(-service.config.REFRESH_TOKEN_CLEANUP_CONFIG.REVOKED_RETENTION)
+	deleted, err := service.RefreshTokenRepository.DeleteExpired(ctx, now, revokedBefore, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("error: deleting expired refresh tokens: %w", err)
 	}
-	return uuid.Nil.String(), fmt.Errorf("token reuse detected — all tokens revoked")
+	return deleted, nil
 }
 
-	if time.Now().After(tokenExpiryTime.Time) {
-		return uuid.Nil.String(), fmt.Errorf("token expired")
-	} else {
-		// Crear nuevo JWT
-		newJwt, createJwtErr := createJwtToken(user, service)
-		if createJwtErr != nil {
-			return uuid.Nil.String(), fmt.Errorf("new token err")
+// EnforceSessionLimitService makes room for a new session of the user when
+// the limit of concurrent sessions of the user role is reached: the sign-in
+// is rejected with ErrSessionLimitReached or the oldest sessions are revoked,
+// depending on the policy. It returns the number of revoked sessions.
+func (service *RefreshTokenService) EnforceSessionLimitService(ctx context.Context, user *models.User) (int, error) {
+	limits := service.config.SESSION_LIMIT_CONFIG
+	maxSessions, ok := limits.ROLE_MAX_SESSIONS[user.Role]
+	if !ok {
+		maxSessions = limits.MAX_SESSIONS
+	}
+	if maxSessions == 0 {
+		return 0, nil
+	}
+	refreshTokens, err := service.RefreshTokenRepository.FindTokensByUser(ctx, user.UserId)
+	if err != nil {
+		return 0, fmt.Errorf("error: db error: %w", err)
+	}
+	// FindTokensByUser devuelve primero las sesiones mas recientes.
+	var activeSessions []models.RefreshToken
+	for _, refreshToken := range refreshTokens {
+		if !refreshToken.Revoked && refreshToken.SessionVersion >= user.SessionVersion && time.Now().Before(refreshToken.Expires) {
+			activeSessions = append(activeSessions, refreshToken)
 		}
-		refreshTokenPlain, uuidErr := uuid.NewRandom()
-		if uuidErr != nil {
+	}
+	if len(activeSessions) < maxSessions {
+		return 0, nil
+	}
+	if limits.POLICY == config.SessionLimitReject {
+		return 0, fmt.Errorf("%w: %d active sessions allowed, sign out of another device first", ErrSessionLimitReached, maxSessions)
+	}
+	evicted := 0
+	for _, refreshToken := range activeSessions[maxSessions-1:] {
+		if err := service.RefreshTokenRepository.RevokeTokenWithReason(ctx, refreshToken.Jti, models.RefreshTokenRevokedSessionLimit); err != nil {
+			return evicted, fmt.Errorf("error: db error: %w", err)
 		}
-		// Crear el DTO del nuevo refresh token
-		newRefreshToken := dto.RefreshTokenCreateDTO{
-			UserId:     userId,
-			Jti: refreshTokenPlain.String(),
-			ExpiresAt:  time.Now().Add(service.config.REFRESH_TOKEN_CONFIG.EXPIRY_TIME),
+		service.AuditService.Record(ctx, models.AuditEvent{
+			Type:     models.AuditSessionEvicted,
+			ActorId:  user.UserId,
+			TargetId: user.UserId,
+			Outcome:  models.AuditOutcomeSuccess,
+			Details:  map[string]string{"jti": refreshToken.Jti, "max_sessions": strconv.Itoa(maxSessions)},
+		})
+		evicted++
+	}
+	return evicted, nil
+}
+
+// checkSessionLimits ends the sessions that were idle for longer than their
+// idle timeout or reached their absolute lifetime, however often they were
+// refreshed.
+func (service *RefreshTokenService) checkSessionLimits(ctx context.Context, refreshToken *models.RefreshToken) error {
+	_, absoluteLifetime := service.sessionPolicy(refreshToken.RememberMe)
+	if time.Now().After(sessionStart(refreshToken).Add(absoluteLifetime)) {
+		service.LoginHistoryService.Record(ctx, refreshToken.UserId, models.LoginMethodRefresh, "session_expired")
+		return fmt.Errorf("session expired, sign in again")
+	}
+	if time.Now().After(refreshToken.Expires) {
+		service.LoginHistoryService.Record(ctx, refreshToken.UserId, models.LoginMethodRefresh, "session_idle_timeout")
+		return fmt.Errorf("session ended after inactivity, sign in again")
+	}
+	return nil
+}
+
+// sessionPolicy returns the idle timeout and the absolute lifetime of a
+// session; "remember me" logins get the longer ones.
+func (service *RefreshTokenService) sessionPolicy(rememberMe bool) (time.Duration, time.Duration) {
+	sessions := service.config.REFRESH_TOKEN_CONFIG
+	if rememberMe {
+		return sessions.REMEMBER_ME_IDLE_TIMEOUT, sessions.REMEMBER_ME_ABSOLUTE_LIFETIME
+	}
+	return min(sessions.IDLE_TIMEOUT, sessions.EXPIRY_TIME), sessions.ABSOLUTE_LIFETIME
+}
+
+// refreshTokenExpiry slides the expiry of a session by its idle timeout, never
+// beyond the absolute lifetime counted from the login.
+func (service *RefreshTokenService) refreshTokenExpiry(authTime time.Time, rememberMe bool) time.Time {
+	idleTimeout, absoluteLifetime := service.sessionPolicy(rememberMe)
+	expiry := time.Now().Add(idleTimeout)
+	if limit := authTime.Add(absoluteLifetime); expiry.After(limit) {
+		return limit
+	}
+	return expiry
+}
+
+// sessionStart is the login time of the session. Tokens issued before it was
+// stored fall back to their own issue time.
+func sessionStart(refreshToken *models.RefreshToken) time.Time {
+	if refreshToken.AuthTime.IsZero() {
+		return refreshToken.IssuedAt
+	}
+	return refreshToken.AuthTime
+}
+
+// checkRefreshSession rejects the refresh tokens of an older session version.
+// Presenting a revoked token means it was stolen or replayed, so every session
+// of the user is revoked.
+func (service *RefreshTokenService) checkRefreshSession(ctx context.Context, refreshToken *models.RefreshToken, user *models.User) error {
+	if refreshToken.SessionVersion < user.SessionVersion {
+		service.LoginHistoryService.Record(ctx, user.UserId, models.LoginMethodRefresh, "session_invalidated")
+		return fmt.Errorf("invalid token")
+	}
+	if !refreshToken.Revoked {
+		return nil
+	}
+	// Las sesiones cerradas por el limite no son una reutilizacion del token.
+	if refreshToken.RevokedReason == models.RefreshTokenRevokedSessionLimit {
+		service.LoginHistoryService.Record(ctx, user.UserId, models.LoginMethodRefresh, "session_evicted")
+		return ErrSessionEvicted
+	}
+	revokeErr := service.RefreshTokenRepository.RevokeAllTokenFromUser(ctx, refreshToken.UserId)
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditTokenReuseDetected,
+		ActorId:  refreshToken.UserId,
+		TargetId: refreshToken.UserId,
+		Outcome:  models.AuditOutcomeFailure,
+		Details:  map[string]string{"jti": refreshToken.Jti},
+	})
+	service.LoginHistoryService.Record(ctx, user.UserId, models.LoginMethodRefresh, "token_reuse")
+	if revokeErr != nil {
+		return fmt.Errorf("error revoking all tokens: %w", revokeErr)
+	}
+	return ErrTokenReuse
+}
+
+// revokeRotatedToken revokes the refresh token being rotated. The update only
+// matches a token that is not revoked yet, so when two requests rotate the same
+// token at once the second one is handled as a reuse.
+func (service *RefreshTokenService) revokeRotatedToken(ctx context.Context, refreshToken *models.RefreshToken, user *models.User) error {
+	err := service.RefreshTokenRepository.RevokeActiveToken(ctx, refreshToken.Jti)
+	if errors.Is(err, repository.ErrRefreshTokenRevoked) {
+		revoked := *refreshToken
+		if current, findErr := service.RefreshTokenRepository.FindRefreshTokenByID(ctx, refreshToken.Jti); findErr == nil {
+			revoked = *current
 		}
-		// Crear el nuevo refresh token
-		service.CreateRefreshTokenService(ctx, &newRefreshToken)
-		// Revoke the old refresh token
-		revokeTokenErr := service.RefreshTokenRepository.RevokeToken(ctx, refreshTokenUser.Jti)
-		if revokeTokenErr != nil {
-			return uuid.Nil.String(), fmt.Errorf("revoke token failed")
+		revoked.Revoked = true
+		return service.checkRefreshSession(ctx, &revoked, user)
+	}
+	if err != nil {
+		return fmt.Errorf("error: revoking refresh token: %w", err)
+	}
+	return nil
+}
+
+// IssueTokenPairService signs an access token for audiences and starts a
+// refresh token session for the user, who authenticated at authTime. The
+// refresh token handed to the client is the jti of the stored session, an
+// opaque value. Both are bound to the DPoP key jkt when it is not empty.
+func (service *RefreshTokenService) IssueTokenPairService(ctx context.Context, user *models.User, clientId string, scope string, audiences []string, authTime time.Time, jkt string) (*dto.TokenResponseDTO, error) {
+	accessTokenId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error: error generating token_id: %w", err)
+	}
+	claims := jwt.MapClaims{"client_id": clientId}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	accessToken, err := service.signAccessToken(user, accessTokenId.String(), audiences, addConfirmationClaim(claims, jkt))
+	if err != nil {
+		return nil, fmt.Errorf("error: signing access token: %w", err)
+	}
+	refreshTokenId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error: error generating token_id: %w", err)
+	}
+	err = service.CreateRefreshTokenService(ctx, &dto.RefreshTokenCreateDTO{
+		UserId:    user.UserId,
+		Jti:       refreshTokenId.String(),
+		ClientId:  clientId,
+		Scope:     scope,
+		AuthTime:  authTime,
+		Audiences: audiences,
+		DPoPJkt:   jkt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dto.TokenResponseDTO{
+		AccessToken:  accessToken,
+		TokenType:    dpopTokenType(jkt),
+		ExpiresIn:    int64(service.config.TOKEN_CONFIG.ACCESS_TOKEN_TTL.Seconds()),
+		RefreshToken: refreshTokenId.String(),
+		Scope:        scope,
+	}, nil
+}
+
+// IssueClientTokenService signs a service token whose subject is an OAuth
+// client instead of a user. It has no user claims and no refresh token.
+func (service *RefreshTokenService) IssueClientTokenService(clientId string, audiences []string, scope string, jkt string) (*dto.TokenResponseDTO, error) {
+	tokenId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error: error generating token_id: %w", err)
+	}
+	ttl := service.config.OAUTH_CONFIG.CLIENT_CREDENTIALS_TTL
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":       clientId,
+		"client_id": clientId,
+		"jti":       tokenId.String(),
+		"iss":       service.config.TOKEN_CONFIG.ISSUER,
+		"aud":       audienceClaim(audiences),
+		"iat":       now.Unix(),
+		"exp":       now.Add(ttl).Unix(),
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, addConfirmationClaim(claims, jkt)).SignedString([]byte(service.config.JWT_SECRET_KEY))
+	if err != nil {
+		return nil, fmt.Errorf("error: signing access token: %w", err)
+	}
+	return &dto.TokenResponseDTO{
+		AccessToken: accessToken,
+		TokenType:   dpopTokenType(jkt),
+		ExpiresIn:   int64(ttl.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// RotateRefreshTokenService exchanges a refresh token issued to clientId for a
+// new token pair with the same scope and revokes it. jkt is the key of the DPoP
+// proof of the request, required when the session is bound to a key.
+func (service *RefreshTokenService) RotateRefreshTokenService(ctx context.Context, token string, clientId string, jkt string) (*dto.TokenResponseDTO, error) {
+	refreshToken, err := service.RefreshTokenRepository.FindRefreshTokenByID(ctx, token)
+	if err != nil || refreshToken.ClientId != clientId {
+		return nil, ErrInvalidToken
+	}
+	if bindingErr := checkDPoPBinding(refreshToken.DPoPJkt, jkt); bindingErr != nil {
+		service.LoginHistoryService.Record(ctx, refreshToken.UserId, models.LoginMethodRefresh, "dpop_key_mismatch")
+		return nil, bindingErr
+	}
+	user, err := service.UserService.userService.FindUserByID(ctx, refreshToken.UserId)
+	if err != nil || user.IsDeleted() || user.Locked {
+		return nil, ErrInvalidToken
+	}
+	if sessionErr := service.checkRefreshSession(ctx, refreshToken, user); sessionErr != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, sessionErr)
+	}
+	if limitErr := service.checkSessionLimits(ctx, refreshToken); limitErr != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, limitErr)
+	}
+	if err := service.revokeRotatedToken(ctx, refreshToken, user); err != nil {
+		if errors.Is(err, ErrTokenReuse) || errors.Is(err, ErrSessionEvicted) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
 		}
-		return newJwt, nil
+		return nil, err
+	}
+	tokens, err := service.IssueTokenPairService(ctx, user, refreshToken.ClientId, refreshToken.Scope, refreshToken.Audiences, sessionStart(refreshToken), jkt)
+	if err != nil {
+		return nil, err
 	}
-	//	~ Hacer un script de limpieza de todos los token revokados (Se hace en el main. Talvez haga una funcion en el
-	// 	  repo de refresh token para mantener el orden en mi codigo)
+	service.LoginHistoryService.Record(ctx, user.UserId, models.LoginMethodRefresh, "")
+	return tokens, nil
 }
 
-func extractClaims(tokenStr string, config config.Config) (jwt.MapClaims, bool) {
+// ResolveAudiences returns the default audiences when none are requested and
+// rejects the audiences that are neither default nor allowed. JWT_AUDIENCE is
+// always allowed, as every user token includes it anyway.
+func (service *RefreshTokenService) ResolveAudiences(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return service.config.TOKEN_CONFIG.DEFAULT_AUDIENCES, nil
+	}
+	for _, audience := range requested {
+		if audience != service.config.TOKEN_CONFIG.AUDIENCE && !slices.Contains(service.config.TOKEN_CONFIG.DEFAULT_AUDIENCES, audience) && !slices.Contains(service.config.TOKEN_CONFIG.ALLOWED_AUDIENCES, audience) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAudience, audience)
+		}
+	}
+	return slices.Compact(slices.Sorted(slices.Values(requested))), nil
+}
+
+// CheckAccessTokenBindingService verifies the DPoP proof of a request made
+// with an access token. Tokens bound to a key (cnf.jkt) must be sent with the
+// DPoP scheme and a proof of that key, and the DPoP scheme is only accepted for
+// bound tokens.
+func (service *RefreshTokenService) CheckAccessTokenBindingService(ctx context.Context, claims jwt.MapClaims, accessToken string, dpopScheme bool) error {
+	confirmation, _ := claims["cnf"].(map[string]interface{})
+	boundJkt, _ := confirmation["jkt"].(string)
+	if dpopScheme != (boundJkt != "") {
+		return fmt.Errorf("%w: DPoP bound tokens must use the DPoP authorization scheme", ErrInvalidDPoPProof)
+	}
+	if !dpopScheme {
+		return nil
+	}
+	jkt, err := service.DPoPService.ProofKeyService(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	return checkDPoPBinding(boundJkt, jkt)
+}
+
+// ValidateAccessToken verifies the signature, expiry, issuer and audience of
+// an access token and returns its claims. Only tokens issued for
+// JWT_AUDIENCE are accepted, so a token minted for another service cannot be
+// used here.
+func (service *RefreshTokenService) ValidateAccessToken(tokenString string) (jwt.MapClaims, error) {
+	tokens := service.config.TOKEN_CONFIG
+	claims, ok := extractAccessClaims(tokenString, service.config, jwt.WithAudience(tokens.AUDIENCE), jwt.WithIssuer(tokens.ISSUER))
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// extractAccessClaims rejects the single purpose tokens (emailed links) that
+// are signed with the same key as the access tokens.
+func extractAccessClaims(tokenStr string, config config.Config, options ...jwt.ParserOption) (jwt.MapClaims, bool) {
+	claims, ok := extractClaims(tokenStr, config, options...)
+	if !ok {
+		return nil, false
+	}
+	if _, hasPurpose := claims["purpose"]; hasPurpose {
+		return nil, false
+	}
+	return claims, true
+}
+
+func extractClaims(tokenStr string, config config.Config, options ...jwt.ParserOption) (jwt.MapClaims, bool) {
 	hmacSecretString := config.JWT_SECRET_KEY
 	hmacSecret := []byte(hmacSecretString)
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
@@ -139,7 +495,7 @@ func extractClaims(tokenStr string, config config.Config) (jwt.MapClaims, bool)
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return hmacSecret, nil
-	})
+	}, options...)
 	if err != nil {
 		return nil, false
 	}
@@ -152,28 +508,46 @@ func extractClaims(tokenStr string, config config.Config) (jwt.MapClaims, bool)
 	}
 }
 
-func createJwtToken(user *models.User, service *RefreshTokenService) (string, error) {
-	tokenId, err := uuid.NewRandom()
-	if err != nil {
-		return	"", nil
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"name":  user.Name,
-			"email": user.Email,
-			"sub":   user.UserId,
-			"jti":   tokenId,
-			"exp":   time.Now().Add(time.Hour * 24).Unix(),
-			"iss":   "users-microservice",
-			"iat":   time.Now().Unix(),
-			"aud":   "contacts-service",
-		})
-
-	jwtToken, signErr := token.SignedString([]byte(service.config.JWT_SECRET_KEY))
+// signAccessToken signs an access token for user. Without audiences the token
+// is valid for the default ones, and it is always valid for JWT_AUDIENCE so
+// the user can call this service with it. extraClaims, such as the OAuth
+// client_id and scope, are added to the standard claims.
+func (service *RefreshTokenService) signAccessToken(user *models.User, jti string, audiences []string, extraClaims jwt.MapClaims) (string, error) {
+	if len(audiences) == 0 {
+		audiences = service.config.TOKEN_CONFIG.DEFAULT_AUDIENCES
+	}
+	if !slices.Contains(audiences, service.config.TOKEN_CONFIG.AUDIENCE) {
+		audiences = append(slices.Clone(audiences), service.config.TOKEN_CONFIG.AUDIENCE)
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"name":  user.Name,
+		"email": user.Email,
+		"sub":   user.UserId,
+		"jti":   jti,
+		"exp":   now.Add(service.config.TOKEN_CONFIG.ACCESS_TOKEN_TTL).Unix(),
+		"iss":   service.config.TOKEN_CONFIG.ISSUER,
+		"iat":   now.Unix(),
+		"aud":   audienceClaim(audiences),
+		"role":  user.Role,
+	}
+	for name, value := range extraClaims {
+		claims[name] = value
+	}
+	jwtToken, signErr := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(service.config.JWT_SECRET_KEY))
 	if signErr != nil {
 		return "Error al firmar el token", signErr
 	}
 	return jwtToken, nil
 }
 
+// audienceClaim keeps the single audience tokens as a string, as before
+// multiple audiences were supported.
+func audienceClaim(audiences []string) interface{} {
+	if len(audiences) == 1 {
+		return audiences[0]
+	}
+	return audiences
+}
+
 // TODO: Dividir por funciones el metodo de refresh token, minimo 3
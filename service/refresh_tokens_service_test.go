@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"users-microservice/config"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+const testClientId = "app"
+
+func newTestRefreshTokenService(t *testing.T, limits config.SessionLimitConfig) (*RefreshTokenService, *models.User) {
+	t.Helper()
+	userRepository := repository.NewMemoryUserRepository()
+	user := &models.User{UserId: "user-1", Name: "John", LastName: "Doe", Email: "john@example.com", SessionVersion: 1, Role: models.RoleUser}
+	if err := userRepository.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	config := &config.Config{
+		JWT_SECRET_KEY: "secret",
+		TOKEN_CONFIG:   config.TokenConfig{ISSUER: "users-microservice", AUDIENCE: "users-microservice", ACCESS_TOKEN_TTL: time.Minute},
+		REFRESH_TOKEN_CONFIG: config.RefreshTokenConfig{
+			EXPIRY_TIME:                   time.Hour,
+			IDLE_TIMEOUT:                  time.Hour,
+			ABSOLUTE_LIFETIME:             3 * time.Hour,
+			REMEMBER_ME_IDLE_TIMEOUT:      24 * time.Hour,
+			REMEMBER_ME_ABSOLUTE_LIFETIME: 72 * time.Hour,
+		},
+		SESSION_LIMIT_CONFIG: limits,
+	}
+	service := NewRefreshTokenService(repository.NewMemoryRefreshTokenRepository(), config)
+	service.UserService = NewUserService(userRepository, nil, nil, service, config)
+	return service, user
+}
+
+// startSession guarda una sesion de user iniciada en authTime y emitida en
+// issuedAt, que decide su antiguedad frente al limite de sesiones.
+func startSession(t *testing.T, service *RefreshTokenService, user *models.User, jti string, authTime time.Time, issuedAt time.Time) {
+	t.Helper()
+	err := service.RefreshTokenRepository.CreateRefreshToken(context.Background(), &models.RefreshToken{
+		ID:             "id-" + jti,
+		UserId:         user.UserId,
+		Jti:            jti,
+		ClientId:       testClientId,
+		AuthTime:       authTime,
+		IssuedAt:       issuedAt,
+		Expires:        issuedAt.Add(time.Hour),
+		SessionVersion: user.SessionVersion,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startSessions guarda count sesiones de user, de la mas antigua a la mas reciente.
+func startSessions(t *testing.T, service *RefreshTokenService, user *models.User, count int) []string {
+	t.Helper()
+	now := time.Now()
+	var jtis []string
+	for i := range count {
+		jti := fmt.Sprintf("session-%d", i)
+		startSession(t, service, user, jti, now, now.Add(time.Duration(i-count)*time.Minute))
+		jtis = append(jtis, jti)
+	}
+	return jtis
+}
+
+func isRevoked(t *testing.T, service *RefreshTokenService, jti string) bool {
+	t.Helper()
+	refreshToken, err := service.RefreshTokenRepository.FindRefreshTokenByID(context.Background(), jti)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return refreshToken.Revoked
+}
+
+func TestEnforceSessionLimitServiceRejects(t *testing.T) {
+	service, user := newTestRefreshTokenService(t, config.SessionLimitConfig{MAX_SESSIONS: 2, POLICY: config.SessionLimitReject})
+	ctx := context.Background()
+	jtis := startSessions(t, service, user, 1)
+	if evicted, err := service.EnforceSessionLimitService(ctx, user); evicted != 0 || err != nil {
+		t.Fatalf("EnforceSessionLimitService below the limit = %d, %v", evicted, err)
+	}
+	startSession(t, service, user, "session-1", time.Now(), time.Now())
+	jtis = append(jtis, "session-1")
+	if _, err := service.EnforceSessionLimitService(ctx, user); !errors.Is(err, ErrSessionLimitReached) {
+		t.Fatalf("EnforceSessionLimitService at the limit error = %v, want %v", err, ErrSessionLimitReached)
+	}
+	for _, jti := range jtis {
+		if isRevoked(t, service, jti) {
+			t.Fatalf("the reject policy revoked %s", jti)
+		}
+	}
+}
+
+func TestEnforceSessionLimitServiceEvictsTheOldest(t *testing.T) {
+	service, user := newTestRefreshTokenService(t, config.SessionLimitConfig{MAX_SESSIONS: 2, POLICY: config.SessionLimitEvictOldest})
+	jtis := startSessions(t, service, user, 3)
+	evicted, err := service.EnforceSessionLimitService(context.Background(), user)
+	if err != nil || evicted != 2 {
+		t.Fatalf("EnforceSessionLimitService = %d, %v; want 2", evicted, err)
+	}
+	// Queda la sesion mas reciente mas la que se va a abrir.
+	for i, jti := range jtis {
+		if want := i < 2; isRevoked(t, service, jti) != want {
+			t.Fatalf("%s revoked = %v, want %v", jti, !want, want)
+		}
+	}
+}
+
+func TestEnforceSessionLimitServiceRoleOverride(t *testing.T) {
+	limits := config.SessionLimitConfig{
+		MAX_SESSIONS:      1,
+		ROLE_MAX_SESSIONS: map[string]int{models.RoleAdmin: 0, models.RoleUser: 3},
+		POLICY:            config.SessionLimitReject,
+	}
+	service, user := newTestRefreshTokenService(t, limits)
+	ctx := context.Background()
+	startSessions(t, service, user, 2)
+	if _, err := service.EnforceSessionLimitService(ctx, user); err != nil {
+		t.Fatalf("EnforceSessionLimitService under the role limit: %v", err)
+	}
+	startSession(t, service, user, "session-2", time.Now(), time.Now())
+	if _, err := service.EnforceSessionLimitService(ctx, user); !errors.Is(err, ErrSessionLimitReached) {
+		t.Fatalf("EnforceSessionLimitService at the role limit error = %v, want %v", err, ErrSessionLimitReached)
+	}
+	// El limite 0 del rol admin deja sus sesiones sin limite aunque haya uno global.
+	admin := *user
+	admin.Role = models.RoleAdmin
+	if _, err := service.EnforceSessionLimitService(ctx, &admin); err != nil {
+		t.Fatalf("EnforceSessionLimitService of an admin: %v", err)
+	}
+}
+
+func TestRotateRefreshTokenServiceEvictedSession(t *testing.T) {
+	service, user := newTestRefreshTokenService(t, config.SessionLimitConfig{MAX_SESSIONS: 1, POLICY: config.SessionLimitEvictOldest})
+	ctx := context.Background()
+	jtis := startSessions(t, service, user, 1)
+	if evicted, err := service.EnforceSessionLimitService(ctx, user); evicted != 1 || err != nil {
+		t.Fatalf("EnforceSessionLimitService = %d, %v; want 1", evicted, err)
+	}
+	_, err := service.RotateRefreshTokenService(ctx, jtis[0], testClientId, "")
+	if !errors.Is(err, ErrSessionEvicted) || !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("RotateRefreshTokenService of an evicted session error = %v, want %v", err, ErrSessionEvicted)
+	}
+	if errors.Is(err, ErrTokenReuse) {
+		t.Fatal("an evicted session was handled as a token reuse")
+	}
+}
+
+// rotate canjea jti y devuelve la sesion guardada con el nuevo refresh token.
+func rotate(t *testing.T, service *RefreshTokenService, jti string) *models.RefreshToken {
+	t.Helper()
+	tokens, err := service.RotateRefreshTokenService(context.Background(), jti, testClientId, "")
+	if err != nil {
+		t.Fatalf("RotateRefreshTokenService: %v", err)
+	}
+	refreshToken, err := service.RefreshTokenRepository.FindRefreshTokenByID(context.Background(), tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return refreshToken
+}
+
+func assertAround(t *testing.T, name string, got time.Time, want time.Time) {
+	t.Helper()
+	if got.Before(want.Add(-time.Minute)) || got.After(want.Add(time.Minute)) {
+		t.Fatalf("%s = %s, want about %s", name, got, want)
+	}
+}
+
+func TestRefreshTokenExpirySlidesOnRotation(t *testing.T) {
+	service, user := newTestRefreshTokenService(t, config.SessionLimitConfig{})
+	now := time.Now()
+	authTime := now.Add(-30 * time.Minute)
+	startSession(t, service, user, "session-0", authTime, authTime)
+
+	rotated := rotate(t, service, "session-0")
+	assertAround(t, "expiry after the rotation", rotated.Expires, now.Add(time.Hour))
+	if !rotated.AuthTime.Equal(authTime) {
+		t.Fatalf("auth time after the rotation = %s, want %s", rotated.AuthTime, authTime)
+	}
+}
+
+func TestRefreshTokenExpiryStopsAtTheAbsoluteLifetime(t *testing.T) {
+	service, user := newTestRefreshTokenService(t, config.SessionLimitConfig{})
+	now := time.Now()
+	authTime := now.Add(-150 * time.Minute)
+	startSession(t, service, user, "session-0", authTime, now.Add(-10*time.Minute))
+
+	// Quedan 30 minutos de las 3 horas: la inactividad ya no extiende la sesion.
+	rotated := rotate(t, service, "session-0")
+	if limit := authTime.Add(3 * time.Hour); !rotated.Expires.Equal(limit) {
+		t.Fatalf("expiry after the rotation = %s, want the absolute limit %s", rotated.Expires, limit)
+	}
+	again := rotate(t, service, rotated.Jti)
+	if !again.Expires.Equal(rotated.Expires) || !again.AuthTime.Equal(authTime) {
+		t.Fatalf("second rotation = %+v, want the same limit and auth time", again)
+	}
+
+	// Pasado el limite absoluto la sesion no se refresca aunque el token no haya expirado.
+	startSession(t, service, user, "session-1", now.Add(-3*time.Hour-time.Minute), now.Add(-time.Minute))
+	if _, err := service.RotateRefreshTokenService(context.Background(), "session-1", testClientId, ""); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("RotateRefreshTokenService after the absolute lifetime error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestRefreshTokenExpiryRememberMe(t *testing.T) {
+	service, _ := newTestRefreshTokenService(t, config.SessionLimitConfig{})
+	now := time.Now()
+	if idle, absolute := service.sessionPolicy(true); idle != 24*time.Hour || absolute != 72*time.Hour {
+		t.Fatalf("remember me policy = %s, %s; want 24h, 72h", idle, absolute)
+	}
+	if idle, absolute := service.sessionPolicy(false); idle != time.Hour || absolute != 3*time.Hour {
+		t.Fatalf("default policy = %s, %s; want 1h, 3h", idle, absolute)
+	}
+	assertAround(t, "remember me expiry", service.refreshTokenExpiry(now, true), now.Add(24*time.Hour))
+	assertAround(t, "default expiry", service.refreshTokenExpiry(now, false), now.Add(time.Hour))
+	// Cerca del limite absoluto se corta en el de la politica elegida.
+	authTime := now.Add(-71 * time.Hour)
+	if got, want := service.refreshTokenExpiry(authTime, true), authTime.Add(72*time.Hour); !got.Equal(want) {
+		t.Fatalf("remember me expiry near the limit = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,27 @@
+package service
+
+import "context"
+
+// RequestMetadata describes who is calling the service. Handlers attach it to
+// the request context so services can record it without depending on gin.
+type RequestMetadata struct {
+	ActorId           string
+	IP                string
+	UserAgent         string
+	DeviceFingerprint string
+	// Prueba DPoP de la peticion y el metodo y la ruta que debe firmar.
+	DPoPProof string
+	Method    string
+	Path      string
+}
+
+type requestMetadataKey struct{}
+
+func WithRequestMetadata(ctx context.Context, metadata RequestMetadata) context.Context {
+	return context.WithValue(ctx, requestMetadataKey{}, metadata)
+}
+
+func RequestMetadataFromContext(ctx context.Context) RequestMetadata {
+	metadata, _ := ctx.Value(requestMetadataKey{}).(RequestMetadata)
+	return metadata
+}
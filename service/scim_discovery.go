@@ -0,0 +1,155 @@
+package service
+
+import "users-microservice/dto"
+
+const (
+	scimServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimResourceTypeSchema          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	scimSchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+)
+
+// ServiceProviderConfigService describes the SCIM features supported here
+// (RFC 7643 section 5).
+func (service *ScimService) ServiceProviderConfigService() map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":          []string{scimServiceProviderConfigSchema},
+		"documentationUri": service.config.PUBLIC_BASE_URL + "/scim/v2",
+		"patch":            map[string]interface{}{"supported": true},
+		"bulk":             map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]interface{}{"supported": true, "maxResults": scimMaxResults},
+		"changePassword":   map[string]interface{}{"supported": true},
+		"sort":             map[string]interface{}{"supported": false},
+		"etag":             map[string]interface{}{"supported": false},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "One static bearer token per tenant",
+			"primary":     true,
+		}},
+		"meta": map[string]interface{}{
+			"resourceType": "ServiceProviderConfig",
+			"location":     service.config.PUBLIC_BASE_URL + "/scim/v2/ServiceProviderConfig",
+		},
+	}
+}
+
+func (service *ScimService) ResourceTypesService() []map[string]interface{} {
+	return []map[string]interface{}{
+		service.resourceType("User", "/Users", dto.ScimUserSchema),
+		service.resourceType("Group", "/Groups", dto.ScimGroupSchema),
+	}
+}
+
+// ResourceTypeService returns nil for an unknown resource type.
+func (service *ScimService) ResourceTypeService(name string) map[string]interface{} {
+	for _, resourceType := range service.ResourceTypesService() {
+		if resourceType["id"] == name {
+			return resourceType
+		}
+	}
+	return nil
+}
+
+func (service *ScimService) SchemasService() []map[string]interface{} {
+	return []map[string]interface{}{
+		service.schema(dto.ScimUserSchema, "User", []map[string]interface{}{
+			scimAttribute("userName", "string", true, "readWrite", "server"),
+			scimAttribute("externalId", "string", false, "readWrite", "none"),
+			scimComplexAttribute("name", false, []map[string]interface{}{
+				scimAttribute("formatted", "string", false, "readOnly", "none"),
+				scimAttribute("givenName", "string", false, "readWrite", "none"),
+				scimAttribute("familyName", "string", false, "readWrite", "none"),
+			}),
+			scimAttribute("displayName", "string", false, "readOnly", "none"),
+			scimMultiValuedAttribute("emails", "readWrite", []map[string]interface{}{
+				scimAttribute("value", "string", false, "readWrite", "server"),
+				scimAttribute("type", "string", false, "readWrite", "none"),
+				scimAttribute("primary", "boolean", false, "readWrite", "none"),
+			}),
+			scimAttribute("active", "boolean", false, "readWrite", "none"),
+			withReturned(scimAttribute("password", "string", false, "writeOnly", "none"), "never"),
+			scimMultiValuedAttribute("groups", "readOnly", []map[string]interface{}{
+				scimAttribute("value", "string", false, "readOnly", "none"),
+				scimAttribute("$ref", "reference", false, "readOnly", "none"),
+				scimAttribute("display", "string", false, "readOnly", "none"),
+			}),
+		}),
+		service.schema(dto.ScimGroupSchema, "Group", []map[string]interface{}{
+			scimAttribute("displayName", "string", true, "readWrite", "server"),
+			scimAttribute("externalId", "string", false, "readWrite", "none"),
+			scimMultiValuedAttribute("members", "readWrite", []map[string]interface{}{
+				scimAttribute("value", "string", false, "immutable", "none"),
+				scimAttribute("$ref", "reference", false, "immutable", "none"),
+			}),
+		}),
+	}
+}
+
+// SchemaService returns nil for an unknown schema URN.
+func (service *ScimService) SchemaService(id string) map[string]interface{} {
+	for _, schema := range service.SchemasService() {
+		if schema["id"] == id {
+			return schema
+		}
+	}
+	return nil
+}
+
+func (service *ScimService) resourceType(name string, endpoint string, schema string) map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":     []string{scimResourceTypeSchema},
+		"id":          name,
+		"name":        name,
+		"endpoint":    endpoint,
+		"description": name + " account",
+		"schema":      schema,
+		"meta": map[string]interface{}{
+			"resourceType": "ResourceType",
+			"location":     service.config.PUBLIC_BASE_URL + "/scim/v2/ResourceTypes/" + name,
+		},
+	}
+}
+
+func (service *ScimService) schema(id string, name string, attributes []map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":    []string{scimSchemaSchema},
+		"id":         id,
+		"name":       name,
+		"attributes": attributes,
+		"meta": map[string]interface{}{
+			"resourceType": "Schema",
+			"location":     service.config.PUBLIC_BASE_URL + "/scim/v2/Schemas/" + id,
+		},
+	}
+}
+
+func scimAttribute(name string, attributeType string, required bool, mutability string, uniqueness string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"type":        attributeType,
+		"multiValued": false,
+		"required":    required,
+		"caseExact":   false,
+		"mutability":  mutability,
+		"returned":    "default",
+		"uniqueness":  uniqueness,
+	}
+}
+
+func scimComplexAttribute(name string, multiValued bool, subAttributes []map[string]interface{}) map[string]interface{} {
+	attribute := scimAttribute(name, "complex", false, "readWrite", "none")
+	attribute["multiValued"] = multiValued
+	attribute["subAttributes"] = subAttributes
+	return attribute
+}
+
+func scimMultiValuedAttribute(name string, mutability string, subAttributes []map[string]interface{}) map[string]interface{} {
+	attribute := scimComplexAttribute(name, true, subAttributes)
+	attribute["mutability"] = mutability
+	return attribute
+}
+
+func withReturned(attribute map[string]interface{}, returned string) map[string]interface{} {
+	attribute["returned"] = returned
+	return attribute
+}
@@ -0,0 +1,457 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"users-microservice/repository"
+)
+
+var ErrScimInvalidFilter = errors.New("invalid SCIM filter")
+
+// scimResource is the attribute view of a SCIM resource used to evaluate
+// filters: keys are lower case attribute names, complex attributes are nested
+// maps and multi-valued attributes are slices.
+type scimResource map[string]interface{}
+
+// scimFilter is a compiled SCIM filter expression (RFC 7644 section 3.4.2.2).
+type scimFilter func(resource scimResource) bool
+
+// parseScimFilter compiles a filter such as
+// `userName eq "a@b.com" and (emails[type eq "work"] pr or not (active eq false))`
+// into a predicate. An empty filter matches every resource.
+func parseScimFilter(filter string) (scimFilter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return func(scimResource) bool { return true }, nil
+	}
+	tokens, err := tokenizeScimFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	parser := &scimFilterParser{tokens: tokens}
+	expression, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !parser.done() {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrScimInvalidFilter, parser.peek().text)
+	}
+	return expression, nil
+}
+
+// scimUserLookup translates a filter made only of eq comparisons of userName,
+// externalId or id with a string, joined by and, into a repository query. Those
+// are the lookups identity providers send before provisioning a user. ok is
+// false for any other filter, which has to be evaluated in memory. externalId
+// and id are compared exactly, as RFC 7643 declares them caseExact, and
+// userName goes through the email normalization of the repository.
+func scimUserLookup(filter string) (query repository.TenantUserQuery, ok bool) {
+	tokens, err := tokenizeScimFilter(filter)
+	if err != nil || len(tokens)%4 != 3 {
+		return query, false
+	}
+	for i := 0; i < len(tokens); i += 4 {
+		if i > 0 && (tokens[i-1].kind != scimTokenWord || !strings.EqualFold(tokens[i-1].text, "and")) {
+			return query, false
+		}
+		attribute, operator, value := tokens[i], tokens[i+1], tokens[i+2]
+		if attribute.kind != scimTokenWord || operator.kind != scimTokenWord ||
+			!strings.EqualFold(operator.text, "eq") || value.kind != scimTokenString || value.text == "" {
+			return query, false
+		}
+		var field *string
+		switch path := normalizeScimPath(attribute.text); {
+		case len(path) != 1:
+			return query, false
+		case path[0] == "username":
+			field = &query.Email
+		case path[0] == "externalid":
+			field = &query.ExternalId
+		case path[0] == "id":
+			field = &query.UserId
+		default:
+			return query, false
+		}
+		// Dos valores distintos del mismo atributo se dejan al filtro en memoria.
+		if *field != "" && *field != value.text {
+			return query, false
+		}
+		*field = value.text
+	}
+	return query, true
+}
+
+type scimTokenKind int
+
+const (
+	scimTokenWord scimTokenKind = iota
+	scimTokenString
+	scimTokenOpen
+	scimTokenClose
+	scimTokenOpenBracket
+	scimTokenCloseBracket
+)
+
+type scimToken struct {
+	kind scimTokenKind
+	text string
+}
+
+func tokenizeScimFilter(filter string) ([]scimToken, error) {
+	var tokens []scimToken
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		switch current := runes[i]; {
+		case unicode.IsSpace(current):
+			i++
+		case current == '(':
+			tokens = append(tokens, scimToken{kind: scimTokenOpen, text: "("})
+			i++
+		case current == ')':
+			tokens = append(tokens, scimToken{kind: scimTokenClose, text: ")"})
+			i++
+		case current == '[':
+			tokens = append(tokens, scimToken{kind: scimTokenOpenBracket, text: "["})
+			i++
+		case current == ']':
+			tokens = append(tokens, scimToken{kind: scimTokenCloseBracket, text: "]"})
+			i++
+		case current == '"':
+			end := i + 1
+			for ; end < len(runes) && runes[end] != '"'; end++ {
+				if runes[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrScimInvalidFilter)
+			}
+			var value string
+			if err := json.Unmarshal([]byte(string(runes[i:end+1])), &value); err != nil {
+				return nil, fmt.Errorf("%w: invalid string %s", ErrScimInvalidFilter, string(runes[i:end+1]))
+			}
+			tokens = append(tokens, scimToken{kind: scimTokenString, text: value})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()[]\"", runes[end]) {
+				end++
+			}
+			tokens = append(tokens, scimToken{kind: scimTokenWord, text: string(runes[i:end])})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens   []scimToken
+	position int
+}
+
+func (parser *scimFilterParser) done() bool {
+	return parser.position >= len(parser.tokens)
+}
+
+func (parser *scimFilterParser) peek() scimToken {
+	if parser.done() {
+		return scimToken{kind: -1}
+	}
+	return parser.tokens[parser.position]
+}
+
+func (parser *scimFilterParser) next() scimToken {
+	token := parser.peek()
+	parser.position++
+	return token
+}
+
+func (parser *scimFilterParser) peekKeyword(keyword string) bool {
+	token := parser.peek()
+	return token.kind == scimTokenWord && strings.EqualFold(token.text, keyword)
+}
+
+func (parser *scimFilterParser) expect(kind scimTokenKind, text string) error {
+	if token := parser.next(); token.kind != kind {
+		return fmt.Errorf("%w: expected %q", ErrScimInvalidFilter, text)
+	}
+	return nil
+}
+
+func (parser *scimFilterParser) parseOr() (scimFilter, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.peekKeyword("or") {
+		parser.next()
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orScimFilter(left, right)
+	}
+	return left, nil
+}
+
+func (parser *scimFilterParser) parseAnd() (scimFilter, error) {
+	left, err := parser.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for parser.peekKeyword("and") {
+		parser.next()
+		right, err := parser.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = andScimFilter(left, right)
+	}
+	return left, nil
+}
+
+func (parser *scimFilterParser) parseFactor() (scimFilter, error) {
+	if parser.peekKeyword("not") {
+		parser.next()
+		if err := parser.expect(scimTokenOpen, "("); err != nil {
+			return nil, err
+		}
+		inner, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.expect(scimTokenClose, ")"); err != nil {
+			return nil, err
+		}
+		return func(resource scimResource) bool { return !inner(resource) }, nil
+	}
+	if parser.peek().kind == scimTokenOpen {
+		parser.next()
+		inner, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.expect(scimTokenClose, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+	attribute := parser.next()
+	if attribute.kind != scimTokenWord {
+		return nil, fmt.Errorf("%w: expected an attribute", ErrScimInvalidFilter)
+	}
+	path := normalizeScimPath(attribute.text)
+	if parser.peek().kind == scimTokenOpenBracket {
+		parser.next()
+		inner, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.expect(scimTokenCloseBracket, "]"); err != nil {
+			return nil, err
+		}
+		return valuePathScimFilter(path, inner), nil
+	}
+	operator := parser.next()
+	if operator.kind != scimTokenWord {
+		return nil, fmt.Errorf("%w: expected an operator after %s", ErrScimInvalidFilter, attribute.text)
+	}
+	operatorName := strings.ToLower(operator.text)
+	if operatorName == "pr" {
+		return func(resource scimResource) bool { return len(resolveScimPath(resource, path)) > 0 }, nil
+	}
+	value, err := parser.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	compare, ok := scimOperators[operatorName]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrScimInvalidFilter, operator.text)
+	}
+	return func(resource scimResource) bool {
+		values := resolveScimPath(resource, path)
+		if value == nil {
+			// "eq null" matches a missing attribute and "ne null" a present one.
+			return (operatorName == "eq") == (len(values) == 0)
+		}
+		if operatorName == "ne" {
+			for _, candidate := range values {
+				if scimEqual(candidate, value) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, candidate := range values {
+			if compare(candidate, value) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func (parser *scimFilterParser) parseValue() (interface{}, error) {
+	token := parser.next()
+	switch token.kind {
+	case scimTokenString:
+		return token.text, nil
+	case scimTokenWord:
+		switch strings.ToLower(token.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		var number float64
+		if err := json.Unmarshal([]byte(token.text), &number); err == nil {
+			return number, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid value %q", ErrScimInvalidFilter, token.text)
+}
+
+func orScimFilter(left scimFilter, right scimFilter) scimFilter {
+	return func(resource scimResource) bool { return left(resource) || right(resource) }
+}
+
+func andScimFilter(left scimFilter, right scimFilter) scimFilter {
+	return func(resource scimResource) bool { return left(resource) && right(resource) }
+}
+
+// valuePathScimFilter matches when one element of a multi-valued complex
+// attribute, e.g. emails[type eq "work"], matches the inner filter.
+func valuePathScimFilter(path []string, inner scimFilter) scimFilter {
+	return func(resource scimResource) bool {
+		for _, element := range resolveScimPath(resource, path) {
+			if complex, ok := element.(scimResource); ok && inner(complex) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// normalizeScimPath lower cases an attribute path, drops the schema URN prefix
+// and splits the sub-attributes.
+func normalizeScimPath(path string) []string {
+	path = strings.ToLower(path)
+	if strings.HasPrefix(path, "urn:") {
+		path = path[strings.LastIndex(path, ":")+1:]
+	}
+	return strings.Split(path, ".")
+}
+
+// resolveScimPath returns every value reachable through path, flattening
+// multi-valued attributes. Empty strings count as missing.
+func resolveScimPath(resource scimResource, path []string) []interface{} {
+	value, ok := resource[path[0]]
+	if !ok || value == nil {
+		return nil
+	}
+	var values []interface{}
+	switch typed := value.(type) {
+	case []scimResource:
+		for _, element := range typed {
+			if len(path) == 1 {
+				values = append(values, element)
+			} else {
+				values = append(values, resolveScimPath(element, path[1:])...)
+			}
+		}
+	case scimResource:
+		if len(path) == 1 {
+			return []interface{}{typed}
+		}
+		return resolveScimPath(typed, path[1:])
+	case []string:
+		for _, element := range typed {
+			values = append(values, element)
+		}
+	case string:
+		if typed != "" && len(path) == 1 {
+			values = append(values, typed)
+		}
+	default:
+		if len(path) == 1 {
+			values = append(values, typed)
+		}
+	}
+	return values
+}
+
+var scimOperators = map[string]func(candidate interface{}, value interface{}) bool{
+	"eq": scimEqual,
+	"ne": scimEqual, // negated by parseFactor
+	"co": scimStringOperator(strings.Contains),
+	"sw": scimStringOperator(strings.HasPrefix),
+	"ew": scimStringOperator(strings.HasSuffix),
+	"gt": scimOrderOperator(func(order int) bool { return order > 0 }),
+	"ge": scimOrderOperator(func(order int) bool { return order >= 0 }),
+	"lt": scimOrderOperator(func(order int) bool { return order < 0 }),
+	"le": scimOrderOperator(func(order int) bool { return order <= 0 }),
+}
+
+// scimEqual compares strings case-insensitively, as every attribute exposed
+// here has caseExact false.
+func scimEqual(candidate interface{}, value interface{}) bool {
+	if order, ok := scimCompare(candidate, value); ok {
+		return order == 0
+	}
+	return candidate == value
+}
+
+func scimStringOperator(match func(string, string) bool) func(interface{}, interface{}) bool {
+	return func(candidate interface{}, value interface{}) bool {
+		candidateString, ok := candidate.(string)
+		valueString, isString := value.(string)
+		return ok && isString && match(strings.ToLower(candidateString), strings.ToLower(valueString))
+	}
+}
+
+func scimOrderOperator(accept func(int) bool) func(interface{}, interface{}) bool {
+	return func(candidate interface{}, value interface{}) bool {
+		order, ok := scimCompare(candidate, value)
+		return ok && accept(order)
+	}
+}
+
+// scimCompare orders strings, numbers and dates; booleans are not ordered.
+func scimCompare(candidate interface{}, value interface{}) (int, bool) {
+	switch typed := candidate.(type) {
+	case string:
+		valueString, ok := value.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(strings.ToLower(typed), strings.ToLower(valueString)), true
+	case time.Time:
+		valueString, ok := value.(string)
+		if !ok {
+			return 0, false
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, valueString)
+		if err != nil {
+			return 0, false
+		}
+		return typed.Compare(parsed), true
+	case float64:
+		number, ok := value.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case typed < number:
+			return -1, true
+		case typed > number:
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
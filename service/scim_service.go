@@ -0,0 +1,767 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"users-microservice/config"
+	"users-microservice/dto"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	scimDefaultCount  = 100
+	scimMaxResults    = 200
+	scimMaxOperations = 100
+)
+
+var ErrScimInvalidValue = errors.New("invalid SCIM value")
+var ErrScimInvalidPath = errors.New("invalid SCIM path")
+var ErrScimMutability = errors.New("SCIM attribute is not mutable")
+var ErrScimInvalidSyntax = errors.New("invalid SCIM request body")
+var ErrScimResourceNotFound = errors.New("SCIM resource not found")
+var ErrScimUnauthorized = errors.New("missing or invalid SCIM bearer token")
+var ErrGroupNotFound = errors.New("group not found")
+var ErrGroupNameConflict = errors.New("group display name already in use")
+
+// ScimService exposes the users of a tenant and its groups as SCIM 2.0
+// resources. User changes go through UserService so they are audited and
+// published like any other change.
+type ScimService struct {
+	userService     *UserService
+	groupRepository repository.GroupRepository
+	config          config.Config
+}
+
+func NewScimService(userService *UserService, groupRepo repository.GroupRepository, config *config.Config) *ScimService {
+	return &ScimService{
+		userService:     userService,
+		groupRepository: groupRepo,
+		config:          *config,
+	}
+}
+
+// ListUsersService answers the lookups by userName, externalId and id, and the
+// listing without filter, with a page of the repository. Any other filter is
+// evaluated in memory over the whole tenant.
+func (service *ScimService) ListUsersService(ctx context.Context, tenantId string, query *dto.ScimListQueryDTO) (*dto.ScimListResponseDTO, error) {
+	filter, err := parseScimFilter(query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := service.groupRepository.ListGroups(ctx, tenantId)
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	lookup, ok := scimUserLookup(query.Filter)
+	if strings.TrimSpace(query.Filter) == "" {
+		lookup, ok = repository.TenantUserQuery{}, true
+	}
+	if ok {
+		startIndex, count := scimPaging(query)
+		lookup.TenantId = tenantId
+		lookup.Offset = startIndex - 1
+		lookup.Limit = count
+		page, err := service.userService.FindTenantUsersService(ctx, lookup)
+		if err != nil {
+			return nil, err
+		}
+		resources := []interface{}{}
+		for i := range page.Users {
+			resources = append(resources, service.mapUserToScim(&page.Users[i], groups))
+		}
+		return &dto.ScimListResponseDTO{
+			Schemas:      []string{dto.ScimListResponseSchema},
+			TotalResults: page.Total,
+			StartIndex:   startIndex,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		}, nil
+	}
+
+	users, err := service.userService.ListTenantUsersService(ctx, tenantId)
+	if err != nil {
+		return nil, err
+	}
+	var matches []interface{}
+	for i := range users {
+		scimUser := service.mapUserToScim(&users[i], groups)
+		if filter(scimUserResource(scimUser)) {
+			matches = append(matches, scimUser)
+		}
+	}
+	return scimListResponse(matches, query), nil
+}
+
+func (service *ScimService) GetUserService(ctx context.Context, tenantId string, userId string) (*dto.ScimUserDTO, error) {
+	user, err := service.findTenantUser(ctx, tenantId, userId)
+	if err != nil {
+		return nil, err
+	}
+	return service.mapUserWithGroups(ctx, user)
+}
+
+func (service *ScimService) CreateUserService(ctx context.Context, tenantId string, request *dto.ScimUserDTO) (*dto.ScimUserDTO, error) {
+	user := models.User{TenantId: tenantId}
+	if err := applyScimUser(&user, request); err != nil {
+		return nil, err
+	}
+	password := request.Password
+	if password == "" {
+		// Sin contraseña el usuario solo puede entrar tras resetearla.
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return nil, fmt.Errorf("error: generating password: %w", err)
+		}
+		password = hex.EncodeToString(random)
+	}
+	created, err := service.userService.ProvisionUserService(ctx, &user, password)
+	if err != nil {
+		return nil, err
+	}
+	return service.mapUserToScim(created, nil), nil
+}
+
+// ReplaceUserService implements PUT: attributes missing from request are reset.
+func (service *ScimService) ReplaceUserService(ctx context.Context, tenantId string, userId string, request *dto.ScimUserDTO) (*dto.ScimUserDTO, error) {
+	user, err := service.findTenantUser(ctx, tenantId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if request.Id != "" && request.Id != userId {
+		return nil, fmt.Errorf("%w: id is immutable", ErrScimMutability)
+	}
+	updated := *user
+	updated.Name, updated.LastName, updated.ExternalId = "", "", ""
+	if err := applyScimUser(&updated, request); err != nil {
+		return nil, err
+	}
+	if request.Password != "" {
+		if err := setScimPassword(&updated, request.Password); err != nil {
+			return nil, err
+		}
+	}
+	return service.saveUser(ctx, user, &updated)
+}
+
+func (service *ScimService) PatchUserService(ctx context.Context, tenantId string, userId string, patch *dto.ScimPatchDTO) (*dto.ScimUserDTO, error) {
+	user, err := service.findTenantUser(ctx, tenantId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateScimPatch(patch); err != nil {
+		return nil, err
+	}
+	updated := *user
+	for _, operation := range patch.Operations {
+		if err := applyScimUserOperation(&updated, operation); err != nil {
+			return nil, err
+		}
+	}
+	return service.saveUser(ctx, user, &updated)
+}
+
+// DeleteUserService soft deletes the user like DELETE /users/me and removes it
+// from the groups of the tenant.
+func (service *ScimService) DeleteUserService(ctx context.Context, tenantId string, userId string) error {
+	user, err := service.findTenantUser(ctx, tenantId, userId)
+	if err != nil {
+		return err
+	}
+	if err := service.userService.DeleteUserService(ctx, user.Email); err != nil {
+		return err
+	}
+	if err := service.groupRepository.RemoveMember(ctx, tenantId, userId); err != nil {
+		return fmt.Errorf("error: removing group memberships: %w", err)
+	}
+	return nil
+}
+
+func (service *ScimService) ListGroupsService(ctx context.Context, tenantId string, query *dto.ScimListQueryDTO) (*dto.ScimListResponseDTO, error) {
+	filter, err := parseScimFilter(query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := service.groupRepository.ListGroups(ctx, tenantId)
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	var matches []interface{}
+	for i := range groups {
+		scimGroup := service.mapGroupToScim(&groups[i])
+		if filter(scimGroupResource(scimGroup)) {
+			matches = append(matches, scimGroup)
+		}
+	}
+	return scimListResponse(matches, query), nil
+}
+
+func (service *ScimService) GetGroupService(ctx context.Context, tenantId string, groupId string) (*dto.ScimGroupDTO, error) {
+	group, err := service.findGroup(ctx, tenantId, groupId)
+	if err != nil {
+		return nil, err
+	}
+	return service.mapGroupToScim(group), nil
+}
+
+func (service *ScimService) CreateGroupService(ctx context.Context, tenantId string, request *dto.ScimGroupDTO) (*dto.ScimGroupDTO, error) {
+	groupId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error: error generating group id: %w", err)
+	}
+	now := time.Now().UTC()
+	group := models.Group{
+		ID:          groupId.String(),
+		TenantId:    tenantId,
+		DisplayName: request.DisplayName,
+		ExternalId:  request.ExternalId,
+		Members:     []string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := service.setMembers(ctx, &group, request.Members); err != nil {
+		return nil, err
+	}
+	if group.DisplayName == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrScimInvalidValue)
+	}
+	err = service.groupRepository.CreateGroup(ctx, &group)
+	if errors.Is(err, repository.ErrGroupNameTaken) {
+		return nil, ErrGroupNameConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: creating group: %w", err)
+	}
+	return service.mapGroupToScim(&group), nil
+}
+
+func (service *ScimService) ReplaceGroupService(ctx context.Context, tenantId string, groupId string, request *dto.ScimGroupDTO) (*dto.ScimGroupDTO, error) {
+	group, err := service.findGroup(ctx, tenantId, groupId)
+	if err != nil {
+		return nil, err
+	}
+	if request.DisplayName == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrScimInvalidValue)
+	}
+	group.DisplayName = request.DisplayName
+	group.ExternalId = request.ExternalId
+	group.Members = []string{}
+	if err := service.setMembers(ctx, group, request.Members); err != nil {
+		return nil, err
+	}
+	return service.saveGroup(ctx, group)
+}
+
+func (service *ScimService) PatchGroupService(ctx context.Context, tenantId string, groupId string, patch *dto.ScimPatchDTO) (*dto.ScimGroupDTO, error) {
+	group, err := service.findGroup(ctx, tenantId, groupId)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateScimPatch(patch); err != nil {
+		return nil, err
+	}
+	for _, operation := range patch.Operations {
+		if err := service.applyGroupOperation(ctx, group, operation); err != nil {
+			return nil, err
+		}
+	}
+	if group.DisplayName == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrScimInvalidValue)
+	}
+	return service.saveGroup(ctx, group)
+}
+
+func (service *ScimService) DeleteGroupService(ctx context.Context, tenantId string, groupId string) error {
+	err := service.groupRepository.DeleteGroup(ctx, tenantId, groupId)
+	if errors.Is(err, repository.ErrGroupNotFound) {
+		return ErrGroupNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error: db error: %w", err)
+	}
+	return nil
+}
+
+func (service *ScimService) findTenantUser(ctx context.Context, tenantId string, userId string) (*models.User, error) {
+	user, err := service.userService.FindUserByIDService(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TenantId != tenantId {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// saveUser stores updated and, when the user was deactivated or got a new
+// password, signs out every session.
+func (service *ScimService) saveUser(ctx context.Context, current *models.User, updated *models.User) (*dto.ScimUserDTO, error) {
+	revokeSessions := updated.PasswordHash != current.PasswordHash || (updated.Locked && !current.Locked)
+	if updated.Locked && !current.Locked {
+		updated.SessionVersion++
+	}
+	if !isScimEmail(updated.Email) {
+		return nil, fmt.Errorf("%w: userName must be an email address", ErrScimInvalidValue)
+	}
+	if _, err := service.userService.UpdateUserService(ctx, current.Email, updated); err != nil {
+		return nil, err
+	}
+	if revokeSessions {
+		revokeErr := service.userService.refreshTokenService.RefreshTokenRepository.RevokeAllTokenFromUser(ctx, updated.UserId)
+		if revokeErr != nil {
+			return nil, fmt.Errorf("error: revoking sessions: %w", revokeErr)
+		}
+	}
+	return service.mapUserWithGroups(ctx, updated)
+}
+
+func (service *ScimService) findGroup(ctx context.Context, tenantId string, groupId string) (*models.Group, error) {
+	group, err := service.groupRepository.FindGroup(ctx, tenantId, groupId)
+	if errors.Is(err, repository.ErrGroupNotFound) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	return group, nil
+}
+
+func (service *ScimService) saveGroup(ctx context.Context, group *models.Group) (*dto.ScimGroupDTO, error) {
+	group.UpdatedAt = time.Now().UTC()
+	err := service.groupRepository.UpdateGroup(ctx, group)
+	if errors.Is(err, repository.ErrGroupNameTaken) {
+		return nil, ErrGroupNameConflict
+	}
+	if errors.Is(err, repository.ErrGroupNotFound) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: saving group: %w", err)
+	}
+	return service.mapGroupToScim(group), nil
+}
+
+// setMembers adds members to group; every member must be a user of the tenant.
+func (service *ScimService) setMembers(ctx context.Context, group *models.Group, members []dto.ScimMemberDTO) error {
+	for _, member := range members {
+		if slices.Contains(group.Members, member.Value) {
+			continue
+		}
+		if _, err := service.findTenantUser(ctx, group.TenantId, member.Value); err != nil {
+			if errors.Is(err, ErrUserNotFound) {
+				return fmt.Errorf("%w: unknown member %q", ErrScimInvalidValue, member.Value)
+			}
+			return err
+		}
+		group.Members = append(group.Members, member.Value)
+	}
+	return nil
+}
+
+func (service *ScimService) applyGroupOperation(ctx context.Context, group *models.Group, operation dto.ScimPatchOperationDTO) error {
+	op := strings.ToLower(operation.Op)
+	if operation.Path == "" {
+		if op == "remove" {
+			return fmt.Errorf("%w: remove requires a path", ErrScimInvalidPath)
+		}
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return fmt.Errorf("%w: value must be an object", ErrScimInvalidValue)
+		}
+		for name, value := range attributes {
+			path := dto.ScimPatchOperationDTO{Op: operation.Op, Path: name, Value: value}
+			if err := service.applyGroupOperation(ctx, group, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	attribute, valueFilter, _, err := parseScimPatchPath(operation.Path)
+	if err != nil {
+		return err
+	}
+	switch attribute {
+	case "displayname":
+		if op == "remove" {
+			return fmt.Errorf("%w: displayName is required", ErrScimMutability)
+		}
+		return decodeScimValue(operation.Value, &group.DisplayName)
+	case "externalid":
+		if op == "remove" {
+			group.ExternalId = ""
+			return nil
+		}
+		return decodeScimValue(operation.Value, &group.ExternalId)
+	case "id":
+		return fmt.Errorf("%w: id is immutable", ErrScimMutability)
+	case "members":
+		var members []dto.ScimMemberDTO
+		if len(operation.Value) > 0 {
+			if err := decodeScimValue(operation.Value, &members); err != nil {
+				return err
+			}
+		}
+		switch op {
+		case "add":
+			return service.setMembers(ctx, group, members)
+		case "replace":
+			group.Members = []string{}
+			return service.setMembers(ctx, group, members)
+		}
+		if valueFilter == nil && len(members) == 0 {
+			group.Members = []string{}
+			return nil
+		}
+		group.Members = slices.DeleteFunc(group.Members, func(userId string) bool {
+			if valueFilter != nil {
+				return valueFilter(scimResource{"value": userId})
+			}
+			return slices.ContainsFunc(members, func(member dto.ScimMemberDTO) bool { return member.Value == userId })
+		})
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrScimInvalidPath, operation.Path)
+}
+
+func (service *ScimService) mapUserWithGroups(ctx context.Context, user *models.User) (*dto.ScimUserDTO, error) {
+	groups, err := service.groupRepository.ListGroups(ctx, user.TenantId)
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	return service.mapUserToScim(user, groups), nil
+}
+
+func (service *ScimService) mapUserToScim(user *models.User, groups []models.Group) *dto.ScimUserDTO {
+	active := !user.Locked
+	scimUser := &dto.ScimUserDTO{
+		Schemas:    []string{dto.ScimUserSchema},
+		Id:         user.UserId,
+		ExternalId: user.ExternalId,
+		UserName:   user.Email,
+		Name: &dto.ScimNameDTO{
+			Formatted:  strings.TrimSpace(user.Name + " " + user.LastName),
+			GivenName:  user.Name,
+			FamilyName: user.LastName,
+		},
+		DisplayName: strings.TrimSpace(user.Name + " " + user.LastName),
+		Emails:      []dto.ScimEmailDTO{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &dto.ScimMetaDTO{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.CreatedAt,
+			Location:     service.config.PUBLIC_BASE_URL + "/scim/v2/Users/" + user.UserId,
+		},
+	}
+	for _, group := range groups {
+		if slices.Contains(group.Members, user.UserId) {
+			scimUser.Groups = append(scimUser.Groups, dto.ScimGroupRefDTO{
+				Value:   group.ID,
+				Ref:     service.config.PUBLIC_BASE_URL + "/scim/v2/Groups/" + group.ID,
+				Display: group.DisplayName,
+			})
+		}
+	}
+	return scimUser
+}
+
+func (service *ScimService) mapGroupToScim(group *models.Group) *dto.ScimGroupDTO {
+	scimGroup := &dto.ScimGroupDTO{
+		Schemas:     []string{dto.ScimGroupSchema},
+		Id:          group.ID,
+		ExternalId:  group.ExternalId,
+		DisplayName: group.DisplayName,
+		Members:     make([]dto.ScimMemberDTO, 0, len(group.Members)),
+		Meta: &dto.ScimMetaDTO{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     service.config.PUBLIC_BASE_URL + "/scim/v2/Groups/" + group.ID,
+		},
+	}
+	for _, userId := range group.Members {
+		scimGroup.Members = append(scimGroup.Members, dto.ScimMemberDTO{
+			Value: userId,
+			Ref:   service.config.PUBLIC_BASE_URL + "/scim/v2/Users/" + userId,
+		})
+	}
+	return scimGroup
+}
+
+// applyScimUser copies the writable attributes of a SCIM user onto user. The
+// primary email wins over userName when both are sent.
+func applyScimUser(user *models.User, request *dto.ScimUserDTO) error {
+	user.Email = request.UserName
+	if email := primaryScimEmail(request.Emails); email != "" {
+		user.Email = email
+	}
+	if request.Name != nil {
+		user.Name = request.Name.GivenName
+		user.LastName = request.Name.FamilyName
+	}
+	user.ExternalId = request.ExternalId
+	user.Locked = request.Active != nil && !*request.Active
+	if !isScimEmail(user.Email) {
+		return fmt.Errorf("%w: userName must be an email address", ErrScimInvalidValue)
+	}
+	return nil
+}
+
+func applyScimUserOperation(user *models.User, operation dto.ScimPatchOperationDTO) error {
+	op := strings.ToLower(operation.Op)
+	if operation.Path == "" {
+		if op == "remove" {
+			return fmt.Errorf("%w: remove requires a path", ErrScimInvalidPath)
+		}
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return fmt.Errorf("%w: value must be an object", ErrScimInvalidValue)
+		}
+		for name, value := range attributes {
+			path := dto.ScimPatchOperationDTO{Op: operation.Op, Path: name, Value: value}
+			if err := applyScimUserOperation(user, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	attribute, _, subAttribute, err := parseScimPatchPath(operation.Path)
+	if err != nil {
+		return err
+	}
+	if op == "remove" {
+		switch attribute {
+		case "externalid":
+			user.ExternalId = ""
+		case "displayname", "name.formatted":
+		default:
+			return fmt.Errorf("%w: %s cannot be removed", ErrScimMutability, operation.Path)
+		}
+		return nil
+	}
+	switch attribute {
+	case "username":
+		return decodeScimValue(operation.Value, &user.Email)
+	case "externalid":
+		return decodeScimValue(operation.Value, &user.ExternalId)
+	case "active":
+		active, err := decodeScimBool(operation.Value)
+		if err != nil {
+			return err
+		}
+		user.Locked = !active
+		return nil
+	case "name":
+		var name dto.ScimNameDTO
+		if err := decodeScimValue(operation.Value, &name); err != nil {
+			return err
+		}
+		if name.GivenName != "" {
+			user.Name = name.GivenName
+		}
+		if name.FamilyName != "" {
+			user.LastName = name.FamilyName
+		}
+		return nil
+	case "name.givenname":
+		return decodeScimValue(operation.Value, &user.Name)
+	case "name.familyname":
+		return decodeScimValue(operation.Value, &user.LastName)
+	case "emails":
+		if subAttribute == "value" {
+			return decodeScimValue(operation.Value, &user.Email)
+		}
+		var emails []dto.ScimEmailDTO
+		if err := decodeScimValue(operation.Value, &emails); err != nil {
+			return err
+		}
+		if email := primaryScimEmail(emails); email != "" {
+			user.Email = email
+		}
+		return nil
+	case "password":
+		var password string
+		if err := decodeScimValue(operation.Value, &password); err != nil {
+			return err
+		}
+		return setScimPassword(user, password)
+	case "displayname", "name.formatted":
+		// Se calculan a partir del nombre y el apellido.
+		return nil
+	case "id", "meta", "groups":
+		return fmt.Errorf("%w: %s is read-only", ErrScimMutability, operation.Path)
+	}
+	return fmt.Errorf("%w: %s", ErrScimInvalidPath, operation.Path)
+}
+
+func validateScimPatch(patch *dto.ScimPatchDTO) error {
+	if !slices.Contains(patch.Schemas, dto.ScimPatchOpSchema) {
+		return fmt.Errorf("%w: schemas must contain %s", ErrScimInvalidValue, dto.ScimPatchOpSchema)
+	}
+	if len(patch.Operations) == 0 || len(patch.Operations) > scimMaxOperations {
+		return fmt.Errorf("%w: between 1 and %d operations are required", ErrScimInvalidValue, scimMaxOperations)
+	}
+	for _, operation := range patch.Operations {
+		switch strings.ToLower(operation.Op) {
+		case "add", "replace", "remove":
+		default:
+			return fmt.Errorf("%w: unknown op %q", ErrScimInvalidValue, operation.Op)
+		}
+	}
+	return nil
+}
+
+// parseScimPatchPath splits a PATCH path such as
+// `emails[type eq "work"].value` into the attribute, the compiled value filter
+// and the sub-attribute.
+func parseScimPatchPath(path string) (string, scimFilter, string, error) {
+	attribute, subAttribute := path, ""
+	var valueFilter scimFilter
+	if open := strings.Index(path, "["); open >= 0 {
+		end := strings.LastIndex(path, "]")
+		if end < open {
+			return "", nil, "", fmt.Errorf("%w: %s", ErrScimInvalidPath, path)
+		}
+		filter, err := parseScimFilter(path[open+1 : end])
+		if err != nil {
+			return "", nil, "", fmt.Errorf("%w: %s", ErrScimInvalidPath, path)
+		}
+		attribute, valueFilter = path[:open], filter
+		subAttribute = strings.ToLower(strings.TrimPrefix(path[end+1:], "."))
+	}
+	return strings.Join(normalizeScimPath(attribute), "."), valueFilter, subAttribute, nil
+}
+
+func decodeScimValue(raw json.RawMessage, target interface{}) error {
+	if err := json.Unmarshal(raw, target); err != nil {
+		return fmt.Errorf("%w: %s", ErrScimInvalidValue, string(raw))
+	}
+	return nil
+}
+
+// decodeScimBool also accepts "True"/"False" strings, which some identity
+// providers send for active.
+func decodeScimBool(raw json.RawMessage) (bool, error) {
+	var value bool
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		if parsed, err := strconv.ParseBool(text); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, fmt.Errorf("%w: %s", ErrScimInvalidValue, string(raw))
+}
+
+func setScimPassword(user *models.User, password string) error {
+	if len(password) < 8 {
+		return fmt.Errorf("%w: password must have at least 8 characters", ErrScimInvalidValue)
+	}
+	passwordHashed, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return fmt.Errorf("error: hashing the password: %w", err)
+	}
+	user.PasswordHash = string(passwordHashed)
+	user.SessionVersion++
+	user.PasswordResetRequired = false
+	return nil
+}
+
+func isScimEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+func primaryScimEmail(emails []dto.ScimEmailDTO) string {
+	for _, email := range emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+func scimUserResource(user *dto.ScimUserDTO) scimResource {
+	emails := make([]scimResource, 0, len(user.Emails))
+	for _, email := range user.Emails {
+		emails = append(emails, scimResource{"value": email.Value, "type": email.Type, "primary": email.Primary})
+	}
+	groups := make([]scimResource, 0, len(user.Groups))
+	for _, group := range user.Groups {
+		groups = append(groups, scimResource{"value": group.Value, "display": group.Display})
+	}
+	return scimResource{
+		"id":          user.Id,
+		"externalid":  user.ExternalId,
+		"username":    user.UserName,
+		"displayname": user.DisplayName,
+		"name": scimResource{
+			"formatted":  user.Name.Formatted,
+			"givenname":  user.Name.GivenName,
+			"familyname": user.Name.FamilyName,
+		},
+		"emails": emails,
+		"active": *user.Active,
+		"groups": groups,
+		"meta":   scimResource{"created": user.Meta.Created, "lastmodified": user.Meta.LastModified, "resourcetype": "User"},
+	}
+}
+
+func scimGroupResource(group *dto.ScimGroupDTO) scimResource {
+	members := make([]scimResource, 0, len(group.Members))
+	for _, member := range group.Members {
+		members = append(members, scimResource{"value": member.Value})
+	}
+	return scimResource{
+		"id":          group.Id,
+		"externalid":  group.ExternalId,
+		"displayname": group.DisplayName,
+		"members":     members,
+		"meta":        scimResource{"created": group.Meta.Created, "lastmodified": group.Meta.LastModified, "resourcetype": "Group"},
+	}
+}
+
+// scimListResponse pages resources with the 1-based startIndex and count of
+// RFC 7644 section 3.4.2.4.
+// scimPaging returns the 1-based startIndex and the count of query, with
+// their defaults and limits applied.
+func scimPaging(query *dto.ScimListQueryDTO) (int, int) {
+	startIndex := max(query.StartIndex, 1)
+	count := scimDefaultCount
+	if query.Count != nil {
+		count = min(max(*query.Count, 0), scimMaxResults)
+	}
+	return startIndex, count
+}
+
+func scimListResponse(resources []interface{}, query *dto.ScimListQueryDTO) *dto.ScimListResponseDTO {
+	startIndex, count := scimPaging(query)
+	page := []interface{}{}
+	if startIndex <= len(resources) {
+		page = resources[startIndex-1 : min(startIndex-1+count, len(resources))]
+	}
+	return &dto.ScimListResponseDTO{
+		Schemas:      []string{dto.ScimListResponseSchema},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}
+}
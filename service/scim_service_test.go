@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+	"users-microservice/config"
+	"users-microservice/dto"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+func TestScimUserLookup(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   repository.TenantUserQuery
+		ok     bool
+	}{
+		{filter: `userName eq "Ana@Example.com"`, want: repository.TenantUserQuery{Email: "Ana@Example.com"}, ok: true},
+		{filter: `externalId eq "ext-1" AND id eq "user-1"`, want: repository.TenantUserQuery{ExternalId: "ext-1", UserId: "user-1"}, ok: true},
+		{filter: `urn:ietf:params:scim:schemas:core:2.0:User:userName eq "a@b.com"`, want: repository.TenantUserQuery{Email: "a@b.com"}, ok: true},
+		{filter: `userName eq "a@b.com" and userName eq "a@b.com"`, want: repository.TenantUserQuery{Email: "a@b.com"}, ok: true},
+		{filter: `userName eq "a@b.com" and userName eq "c@d.com"`},
+		{filter: `userName eq "a@b.com" or externalId eq "ext-1"`},
+		{filter: `userName co "example"`},
+		{filter: `displayName eq "Ana"`},
+		{filter: `name.givenName eq "Ana"`},
+		{filter: `active eq true`},
+		{filter: `(userName eq "a@b.com")`},
+		{filter: `userName eq ""`},
+	}
+	for _, test := range tests {
+		got, ok := scimUserLookup(test.filter)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("scimUserLookup(%s) = %+v, %v; want %+v, %v", test.filter, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+// newTestScimService crea un tenant con cinco usuarios, del mas antiguo al
+// mas reciente, y un usuario de otro tenant.
+func newTestScimService(t *testing.T) (*ScimService, []*models.User) {
+	t.Helper()
+	userRepository := repository.NewEmailNormalizingUserRepository(repository.NewMemoryUserRepository(), false)
+	var users []*models.User
+	for i := range 6 {
+		user := &models.User{
+			UserId:     fmt.Sprintf("user-%d", i),
+			Name:       "Name",
+			LastName:   "Last",
+			Email:      fmt.Sprintf("user%d@example.com", i),
+			ExternalId: fmt.Sprintf("ext-%d", i%2),
+			TenantId:   "tenant-a",
+			CreatedAt:  time.Date(2024, 3, 1, 12, i, 0, 0, time.UTC),
+		}
+		if i == 5 {
+			user.TenantId = "tenant-b"
+		}
+		if err := userRepository.CreateUser(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	config := &config.Config{PUBLIC_BASE_URL: "https://users.example.com"}
+	userService := NewUserService(userRepository, nil, nil, nil, config)
+	return NewScimService(userService, repository.NewMemoryGroupRepository(), config), users[:5]
+}
+
+func TestListUsersService(t *testing.T) {
+	service, users := newTestScimService(t)
+	count := func(count int) *int { return &count }
+	tests := []struct {
+		name      string
+		query     dto.ScimListQueryDTO
+		want      []*models.User
+		wantTotal int
+	}{
+		{name: "whole tenant", want: users, wantTotal: 5},
+		{name: "startIndex and count", query: dto.ScimListQueryDTO{StartIndex: 2, Count: count(2)}, want: users[1:3], wantTotal: 5},
+		{name: "count zero", query: dto.ScimListQueryDTO{Count: count(0)}, wantTotal: 5},
+		{name: "userName ignores case", query: dto.ScimListQueryDTO{Filter: `userName eq "USER3@example.com"`}, want: users[3:4], wantTotal: 1},
+		{name: "userName of another tenant", query: dto.ScimListQueryDTO{Filter: `userName eq "user5@example.com"`}, wantTotal: 0},
+		{name: "externalId page", query: dto.ScimListQueryDTO{Filter: `externalId eq "ext-0"`, StartIndex: 2, Count: count(1)}, want: users[2:3], wantTotal: 3},
+		{name: "in memory filter", query: dto.ScimListQueryDTO{Filter: `userName sw "user1" or id eq "user-4"`}, want: []*models.User{users[1], users[4]}, wantTotal: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := service.ListUsersService(context.Background(), "tenant-a", &test.query)
+			if err != nil {
+				t.Fatalf("ListUsersService: %v", err)
+			}
+			var got, want []string
+			for _, resource := range response.Resources {
+				got = append(got, resource.(*dto.ScimUserDTO).Id)
+			}
+			for _, user := range test.want {
+				want = append(want, user.UserId)
+			}
+			if !slices.Equal(got, want) || response.TotalResults != test.wantTotal || response.ItemsPerPage != len(want) {
+				t.Fatalf("ListUsersService = %v (total %d, items %d), want %v (total %d)",
+					got, response.TotalResults, response.ItemsPerPage, want, test.wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"time"
+	"users-microservice/config"
+	"users-microservice/models"
+	"users-microservice/notification"
+	"users-microservice/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	purposeNotMe         = "not_me"
+	purposePasswordReset = "password_reset"
+
+	notMeLinkTTL         = 7 * 24 * time.Hour
+	passwordResetLinkTTL = time.Hour
+)
+
+var ErrPasswordResetRequired = errors.New("password reset required")
+var ErrInvalidSecurityToken = errors.New("invalid or expired link")
+
+// SecurityService detects sign-ins from unknown devices and handles the
+// "this wasn't me" flow: revoke every session and force a password reset.
+type SecurityService struct {
+	userRepository         repository.UserRepository
+	refreshTokenRepository repository.RefreshTokenRepository
+	outboxRepository       repository.OutboxRepository
+	transactionManager     repository.TransactionManager
+	mailer                 notification.Mailer
+	config                 config.Config
+	AuditService           *AuditService
+}
+
+func NewSecurityService(userRepo repository.UserRepository, refreshTokenRepo repository.RefreshTokenRepository, outboxRepo repository.OutboxRepository, transactionManager repository.TransactionManager, mailer notification.Mailer, config *config.Config) *SecurityService {
+	return &SecurityService{
+		userRepository:         userRepo,
+		refreshTokenRepository: refreshTokenRepo,
+		outboxRepository:       outboxRepo,
+		transactionManager:     transactionManager,
+		mailer:                 mailer,
+		config:                 *config,
+	}
+}
+
+// CheckNewDevice compares the device of the current login with the metadata
+// stored on the refresh tokens of the user and emails a notification when the
+// fingerprint or the IP range was never seen. It must run before the refresh
+// token of the current login is stored. A nil SecurityService does nothing.
+func (service *SecurityService) CheckNewDevice(ctx context.Context, user *models.User) {
+	if service == nil {
+		return
+	}
+	refreshTokens, err := service.refreshTokenRepository.FindTokensByUser(ctx, user.UserId)
+	if err != nil {
+		log.Printf("security: loading sessions of %s failed: %v", user.UserId, err)
+		return
+	}
+	metadata := RequestMetadataFromContext(ctx)
+	fingerprint := deviceFingerprint(metadata)
+	currentRange := ipRange(metadata.IP)
+	knownDevice, knownRange, hasHistory := false, false, false
+	for _, refreshToken := range refreshTokens {
+		// Los tokens anteriores a esta funcionalidad no tienen metadatos.
+		if refreshToken.DeviceFingerprint == "" && refreshToken.IP == "" {
+			continue
+		}
+		hasHistory = true
+		knownDevice = knownDevice || refreshToken.DeviceFingerprint == fingerprint
+		knownRange = knownRange || ipRange(refreshToken.IP) == currentRange
+	}
+	if !hasHistory || (knownDevice && knownRange) {
+		return
+	}
+
+	// Ligado a la version de sesion actual: deja de servir en cuanto se usa o se
+	// cambia la contraseña.
+	link, err := service.signPurposeToken(purposeNotMe, user.UserId, user.SessionVersion, notMeLinkTTL)
+	if err != nil {
+		log.Printf("security: signing link for %s failed: %v", user.UserId, err)
+		return
+	}
+	notMeURL := fmt.Sprintf("%s/users/security/not-me?token=%s", service.config.PUBLIC_BASE_URL, url.QueryEscape(link))
+	message := notification.Message{
+		To:      user.Email,
+		Subject: "New sign-in to your account",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account was just accessed from a new device or location.\n\n"+
+			"Time: %s\nIP address: %s\nDevice: %s\n\n"+
+			"If this was you, you can ignore this email.\n"+
+			"If it wasn't, open this link to sign out every session and reset your password:\n%s\n",
+			user.Name, time.Now().UTC().Format(time.RFC1123), metadata.IP, metadata.UserAgent, notMeURL),
+	}
+	service.sendAsync(ctx, message)
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditNewDeviceLogin,
+		ActorId:  user.UserId,
+		TargetId: user.UserId,
+		Outcome:  models.AuditOutcomeSuccess,
+		Details:  map[string]string{"new_device": fmt.Sprint(!knownDevice), "new_ip_range": fmt.Sprint(!knownRange)},
+	})
+}
+
+// ReportUnrecognizedLoginService handles the "this wasn't me" link: every
+// session is revoked, login is blocked until the password is reset and a
+// password reset link is emailed. The link works once: forcing the reset bumps
+// the session version it is bound to.
+func (service *SecurityService) ReportUnrecognizedLoginService(ctx context.Context, token string) error {
+	userId, sessionVersion, err := service.parsePurposeToken(token, purposeNotMe)
+	if err != nil {
+		return err
+	}
+	user, err := service.userRepository.FindUserByID(ctx, userId)
+	if errors.Is(err, repository.ErrUserNotFound) || (err == nil && (user.IsDeleted() || user.SessionVersion != sessionVersion)) {
+		return ErrInvalidSecurityToken
+	}
+	if err != nil {
+		return fmt.Errorf("error: db error: %w", err)
+	}
+	err = service.userRepository.ForcePasswordReset(ctx, userId, sessionVersion)
+	if errors.Is(err, repository.ErrUserNotFound) || errors.Is(err, repository.ErrVersionConflict) {
+		return ErrInvalidSecurityToken
+	}
+	if err != nil {
+		return fmt.Errorf("error: forcing password reset: %w", err)
+	}
+	// El enlace ya se consumio y la nueva version de sesion invalida los refresh
+	// tokens aunque falle la revocacion, asi que el correo de reseteo sale igual.
+	if err := service.refreshTokenRepository.RevokeAllTokenFromUser(ctx, userId); err != nil {
+		log.Printf("security: revoking sessions of %s failed: %v", userId, err)
+	}
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditUnrecognizedLoginReported,
+		ActorId:  userId,
+		TargetId: userId,
+		Outcome:  models.AuditOutcomeSuccess,
+	})
+
+	// El token de reseteo queda ligado a la version de sesion actual: solo sirve una vez.
+	resetToken, err := service.signPurposeToken(purposePasswordReset, userId, sessionVersion+1, passwordResetLinkTTL)
+	if err != nil {
+		return fmt.Errorf("error: signing reset link: %w", err)
+	}
+	service.sendAsync(ctx, notification.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nAll your sessions were signed out. Choose a new password within the next hour:\n%s?token=%s\n",
+			user.Name, service.config.PASSWORD_RESET_URL, url.QueryEscape(resetToken)),
+	})
+	return nil
+}
+
+func (service *SecurityService) ResetPasswordService(ctx context.Context, token string, newPassword string) error {
+	userId, sessionVersion, err := service.parsePurposeToken(token, purposePasswordReset)
+	if err != nil {
+		return err
+	}
+	user, err := service.userRepository.FindUserByID(ctx, userId)
+	if errors.Is(err, repository.ErrUserNotFound) || (err == nil && (user.IsDeleted() || user.SessionVersion != sessionVersion)) {
+		return ErrInvalidSecurityToken
+	}
+	if err != nil {
+		return fmt.Errorf("error: db error: %w", err)
+	}
+	passwordHashed, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	if err != nil {
+		return fmt.Errorf("error: hashing the password: %w", err)
+	}
+	err = service.transactionManager.WithTransaction(ctx, func(txCtx context.Context) error {
+		updated, err := service.userRepository.SetPasswordHash(txCtx, userId, string(passwordHashed))
+		if err != nil {
+			return err
+		}
+		event, err := newUserOutboxEvent(models.EventUserPasswordChanged, updated)
+		if err != nil {
+			return err
+		}
+		return service.outboxRepository.AppendEvent(txCtx, event)
+	})
+	if err != nil {
+		return fmt.Errorf("error: saving the password: %w", err)
+	}
+	if err := service.refreshTokenRepository.RevokeAllTokenFromUser(ctx, userId); err != nil {
+		return fmt.Errorf("error: revoking sessions: %w", err)
+	}
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditPasswordReset,
+		ActorId:  userId,
+		TargetId: userId,
+		Outcome:  models.AuditOutcomeSuccess,
+	})
+	return nil
+}
+
+func (service *SecurityService) sendAsync(ctx context.Context, message notification.Message) {
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	go func() {
+		defer cancel()
+		if err := service.mailer.Send(sendCtx, message); err != nil {
+			log.Printf("security: sending %q to %s failed: %v", message.Subject, message.To, err)
+		}
+	}()
+}
+
+func (service *SecurityService) signPurposeToken(purpose string, userId string, sessionVersion int, ttl time.Duration) (string, error) {
+	tokenId, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":     userId,
+		"jti":     tokenId.String(),
+		"purpose": purpose,
+		"iat":     now.Unix(),
+		"exp":     now.Add(ttl).Unix(),
+	}
+	if sessionVersion > 0 {
+		claims["sv"] = sessionVersion
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(service.config.JWT_SECRET_KEY))
+}
+
+func (service *SecurityService) parsePurposeToken(token string, purpose string) (string, int, error) {
+	claims, ok := extractClaims(token, service.config)
+	if !ok || claims["purpose"] != purpose {
+		return "", 0, ErrInvalidSecurityToken
+	}
+	userId, err := claims.GetSubject()
+	if err != nil || userId == "" {
+		return "", 0, ErrInvalidSecurityToken
+	}
+	sessionVersion, _ := claims["sv"].(float64)
+	return userId, int(sessionVersion), nil
+}
+
+// deviceFingerprint hashes the X-Device-Fingerprint sent by the client, or the
+// user agent when the client sends none.
+func deviceFingerprint(metadata RequestMetadata) string {
+	source := "fp:" + metadata.DeviceFingerprint
+	if metadata.DeviceFingerprint == "" {
+		if metadata.UserAgent == "" {
+			return ""
+		}
+		source = "ua:" + metadata.UserAgent
+	}
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// ipRange returns the /24 network of an IPv4 address or the /48 of an IPv6 one.
+func ipRange(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return address
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
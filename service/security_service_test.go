@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"users-microservice/config"
+	"users-microservice/models"
+	"users-microservice/notification"
+	"users-microservice/repository"
+)
+
+// recordingMailer guarda los mensajes enviados.
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []notification.Message
+}
+
+func (mailer *recordingMailer) Send(ctx context.Context, message notification.Message) error {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+	mailer.messages = append(mailer.messages, message)
+	return nil
+}
+
+func newTestSecurityService(t *testing.T) (*SecurityService, *models.User) {
+	t.Helper()
+	userRepository := repository.NewMemoryUserRepository()
+	user := &models.User{
+		UserId:         "user-1",
+		Name:           "John",
+		LastName:       "Doe",
+		Email:          "john@example.com",
+		PasswordHash:   "hash",
+		SessionVersion: 1,
+		Role:           models.RoleUser,
+	}
+	if err := userRepository.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	service := NewSecurityService(userRepository, repository.NewMemoryRefreshTokenRepository(), repository.NewMemoryOutboxRepository(),
+		repository.NewMemoryTransactionManager(), &recordingMailer{}, &config.Config{
+			JWT_SECRET_KEY:     "secret",
+			PASSWORD_RESET_URL: "https://users.example.com/users/password/reset",
+		})
+	return service, user
+}
+
+func TestReportUnrecognizedLoginServiceIsSingleUse(t *testing.T) {
+	service, user := newTestSecurityService(t)
+	link, err := service.signPurposeToken(purposeNotMe, user.UserId, user.SessionVersion, notMeLinkTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.ReportUnrecognizedLoginService(context.Background(), link); err != nil {
+		t.Fatalf("ReportUnrecognizedLoginService: %v", err)
+	}
+	found, err := service.userRepository.FindUserByID(context.Background(), user.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found.PasswordResetRequired || found.SessionVersion != user.SessionVersion+1 {
+		t.Fatalf("after the report user = %+v", found)
+	}
+	if err := service.ReportUnrecognizedLoginService(context.Background(), link); !errors.Is(err, ErrInvalidSecurityToken) {
+		t.Fatalf("second ReportUnrecognizedLoginService error = %v, want %v", err, ErrInvalidSecurityToken)
+	}
+}
+
+func TestReportUnrecognizedLoginServiceConcurrentUses(t *testing.T) {
+	service, user := newTestSecurityService(t)
+	link, err := service.signPurposeToken(purposeNotMe, user.UserId, user.SessionVersion, notMeLinkTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const uses = 10
+	errs := make([]error, uses)
+	var wg sync.WaitGroup
+	for i := range uses {
+		wg.Go(func() {
+			errs[i] = service.ReportUnrecognizedLoginService(context.Background(), link)
+		})
+	}
+	wg.Wait()
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrInvalidSecurityToken):
+			t.Fatalf("ReportUnrecognizedLoginService: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("the link was used %d times, want 1", succeeded)
+	}
+}
+
+func TestReportUnrecognizedLoginServiceAfterPasswordChange(t *testing.T) {
+	service, user := newTestSecurityService(t)
+	link, err := service.signPurposeToken(purposeNotMe, user.UserId, user.SessionVersion, notMeLinkTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.userRepository.SetPasswordHash(context.Background(), user.UserId, "new-hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.ReportUnrecognizedLoginService(context.Background(), link); !errors.Is(err, ErrInvalidSecurityToken) {
+		t.Fatalf("ReportUnrecognizedLoginService error = %v, want %v", err, ErrInvalidSecurityToken)
+	}
+}
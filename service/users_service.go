@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 	"users-microservice/config"
 	"users-microservice/dto"
@@ -19,25 +20,53 @@ var ErrUserNotFound = errors.New("user not found")
 var ErrUpdateFailed = errors.New("update failed")
 var ErrInvalidCredencials = errors.New("invalid credencials")
 var ErrInternalServer = errors.New("internal server error")
+var ErrInvalidQuery = errors.New("invalid query")
+var ErrUserNotDeleted = errors.New("user is not deleted")
+var ErrRestoreWindowExpired = errors.New("restore window expired")
+var ErrUserLocked = errors.New("user is locked")
+var ErrVersionConflict = errors.New("user was modified by another request")
 
 type UserService struct {
 	userService         repository.UserRepository
+	outboxRepository    repository.OutboxRepository
+	transactionManager  repository.TransactionManager
 	refreshTokenService *RefreshTokenService
 	config              config.Config
+	AuditService        *AuditService
+	LoginHistoryService *LoginHistoryService
+	SecurityService     *SecurityService
 }
 
 type FieldUpdateFunc func(context.Context, string, string) (*models.User, error)
 
-func NewUserService(userRepo repository.UserRepository, refreshTokenService *RefreshTokenService, config *config.Config) *UserService {
+func NewUserService(userRepo repository.UserRepository, outboxRepo repository.OutboxRepository, transactionManager repository.TransactionManager, refreshTokenService *RefreshTokenService, config *config.Config) *UserService {
 	return &UserService{
 		userService:         userRepo,
+		outboxRepository:    outboxRepo,
+		transactionManager:  transactionManager,
 		refreshTokenService: refreshTokenService,
 		config:              *config,
 	}
 }
 
 func (service *UserService) CreateUserService(ctx context.Context, userDTO *dto.UserDTO) (*dto.UserDTO, error) {
-	passwordHashed, err := bcrypt.GenerateFromPassword([]byte(userDTO.Password), 12)
+	user := models.User{
+		Name:     userDTO.Name,
+		LastName: userDTO.LastName,
+		Email:    userDTO.Email,
+	}
+	created, err := service.ProvisionUserService(ctx, &user, userDTO.Password)
+	if err != nil {
+		return nil, err
+	}
+	return mapModelToDTO(created), nil
+}
+
+// ProvisionUserService stores a new user keeping the profile fields already set
+// on user (name, email, tenant, locked...) and filling the id, password hash,
+// session version, default role and creation time.
+func (service *UserService) ProvisionUserService(ctx context.Context, user *models.User, password string) (*models.User, error) {
+	passwordHashed, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return nil, fmt.Errorf("error: hashing the password: %w", err)
 	}
@@ -45,33 +74,46 @@ func (service *UserService) CreateUserService(ctx context.Context, userDTO *dto.
 	if err != nil {
 		return nil, fmt.Errorf("error: error generating user_id: %w", err)
 	}
-
-	user := models.User{
-		Name:           userDTO.Name,
-		LastName:       userDTO.LastName,
-		Email:          userDTO.Email,
-		UserId:         userId.String(),
-		PasswordHash:   string(passwordHashed),
-		SessionVersion: 1,
+	user.UserId = userId.String()
+	user.PasswordHash = string(passwordHashed)
+	user.SessionVersion = 1
+	user.Version = 1
+	user.CreatedAt = time.Now().UTC()
+	if user.Role == "" {
+		user.Role = models.RoleUser
 	}
 
-	duplicateEmail, findErr := service.userService.FindUser(ctx, userDTO.Email)
-	if findErr != nil && !errors.Is(findErr, repository.ErrUserNotFound) {
-		return nil, fmt.Errorf("error: email duplicate validation: %w", findErr)
-	}
-	if duplicateEmail != nil {
+	// El indice unico del email decide los duplicados: una consulta previa no
+	// evita que dos altas simultaneas con el mismo email pasen a la vez.
+	repoError := service.transactionManager.WithTransaction(ctx, func(txCtx context.Context) error {
+		if err := service.userService.CreateUser(txCtx, user); err != nil {
+			return err
+		}
+		return service.appendEvent(txCtx, models.EventUserCreated, user)
+	})
+	if errors.Is(repoError, repository.ErrEmailConflict) {
+		service.AuditService.Record(ctx, models.AuditEvent{
+			Type:    models.AuditUserRegistered,
+			Outcome: models.AuditOutcomeFailure,
+			Details: map[string]string{"email": user.Email, "reason": "email_conflict"},
+		})
 		return nil, ErrEmailConflict
 	}
-	repoError := service.userService.CreateUser(ctx, &user)
 	if repoError != nil {
 		return nil, fmt.Errorf("error: register failed in db: %w", repoError)
 	}
-	return mapModelToDTO(&user), nil
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditUserRegistered,
+		ActorId:  user.UserId,
+		TargetId: user.UserId,
+		Outcome:  models.AuditOutcomeSuccess,
+	})
+	return user, nil
 }
 
 func (service *UserService) FindUserService(ctx context.Context, email string) (*dto.UserDTO, error) {
 	user, err := service.userService.FindUser(ctx, email)
-	if errors.Is(err, repository.ErrUserNotFound) {
+	if errors.Is(err, repository.ErrUserNotFound) || (err == nil && user.IsDeleted()) {
 		return nil, ErrUserNotFound
 	}
 	if err != nil {
@@ -82,7 +124,7 @@ func (service *UserService) FindUserService(ctx context.Context, email string) (
 
 func (service *UserService) FindUserByIDService(ctx context.Context, userId string) (*models.User, error) {
 	user, err := service.userService.FindUserByID(ctx, userId)
-	if errors.Is(err, repository.ErrUserNotFound) {
+	if errors.Is(err, repository.ErrUserNotFound) || (err == nil && user.IsDeleted()) {
 		return nil, ErrUserNotFound
 	}
 	if err != nil {
@@ -91,56 +133,287 @@ func (service *UserService) FindUserByIDService(ctx context.Context, userId stri
 	return user, nil
 }
 
+// UpdateUserService replaces the user stored with email. user.Version must be
+// the version that was read: if the user changed since, ErrVersionConflict is
+// returned and nothing is written.
 func (service *UserService) UpdateUserService(ctx context.Context, email string, user *models.User) (*dto.UserDTO, error) {
-	user, err := service.userService.UpdateUser(ctx, email, user)
+	updated, err := service.updateUser(ctx, email, user)
 	if err != nil {
-		return nil, fmt.Errorf("error: update error: %w", err)
+		return nil, err
 	}
+	return mapModelToDTO(updated), nil
+}
 
-	return mapModelToDTO(user), nil
+// FindProfileService returns the profile of the signed in user.
+func (service *UserService) FindProfileService(ctx context.Context, userId string) (*dto.UserProfileDTO, error) {
+	user, err := service.FindUserByIDService(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return mapModelToProfileDTO(user), nil
 }
 
+// UpdateProfileService applies patch to the profile of the signed in user.
+// With ifMatch the update only happens while the version of the user is one
+// of them (the If-Match header); otherwise ErrVersionConflict is returned.
+// A nil ifMatch skips the check, but a concurrent write between the read and
+// the update is still detected.
+func (service *UserService) UpdateProfileService(ctx context.Context, userId string, patch *dto.UserProfilePatchDTO, ifMatch []int) (*dto.UserProfileDTO, error) {
+	user, err := service.FindUserByIDService(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if ifMatch != nil && !slices.Contains(ifMatch, user.Version) {
+		return nil, ErrVersionConflict
+	}
+	if patch.Name != nil {
+		user.Name = *patch.Name
+	}
+	if patch.LastName != nil {
+		user.LastName = *patch.LastName
+	}
+	updated, err := service.updateUser(ctx, user.Email, user)
+	if err != nil {
+		return nil, err
+	}
+	return mapModelToProfileDTO(updated), nil
+}
+
+func (service *UserService) updateUser(ctx context.Context, email string, user *models.User) (*models.User, error) {
+	err := service.transactionManager.WithTransaction(ctx, func(txCtx context.Context) error {
+		updated, err := service.userService.UpdateUser(txCtx, email, user)
+		if err != nil {
+			return err
+		}
+		user = updated
+		return service.appendEvent(txCtx, models.EventUserUpdated, user)
+	})
+	if errors.Is(err, repository.ErrEmailConflict) {
+		return nil, ErrEmailConflict
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, ErrVersionConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: update error: %w", err)
+	}
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditUserUpdated,
+		TargetId: user.UserId,
+		Outcome:  models.AuditOutcomeSuccess,
+	})
+	return user, nil
+}
+
+// DeleteUserService soft deletes the user and revokes all of its sessions. The
+// document is purged by PurgeDeletedUsersService once the grace period ends.
 func (service *UserService) DeleteUserService(ctx context.Context, email string) error {
-	err := service.userService.DeleteUser(ctx, email)
+	user, err := service.userService.FindUser(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) || (err == nil && user.IsDeleted()) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error: db error: %w", err)
+	}
+	err = service.transactionManager.WithTransaction(ctx, func(txCtx context.Context) error {
+		if err := service.userService.DeleteUser(txCtx, email); err != nil {
+			return err
+		}
+		revokeErr := service.refreshTokenService.RefreshTokenRepository.RevokeAllTokenFromUser(txCtx, user.UserId)
+		if revokeErr != nil {
+			return fmt.Errorf("revoking sessions of deleted user: %w", revokeErr)
+		}
+		deletedAt := time.Now().UTC()
+		user.DeletedAt = &deletedAt
+		return service.appendEvent(txCtx, models.EventUserDeleted, user)
+	})
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrUserNotFound
+	}
 	if err != nil {
 		return fmt.Errorf("error: error deleting the user with this email: %s: %w", email, err)
 	}
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditUserDeleted,
+		TargetId: user.UserId,
+		Outcome:  models.AuditOutcomeSuccess,
+	})
 	return nil
 }
 
+func (service *UserService) DeleteUserByIDService(ctx context.Context, userId string) error {
+	user, err := service.FindUserByIDService(ctx, userId)
+	if err != nil {
+		return err
+	}
+	return service.DeleteUserService(ctx, user.Email)
+}
+
+func (service *UserService) RestoreUserService(ctx context.Context, userId string) (*dto.AdminUserDTO, error) {
+	user, err := service.userService.FindUserByID(ctx, userId)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	if !user.IsDeleted() {
+		return nil, ErrUserNotDeleted
+	}
+	if time.Now().After(user.DeletedAt.Add(service.config.USER_DELETION_CONFIG.GRACE_PERIOD)) {
+		return nil, ErrRestoreWindowExpired
+	}
+	var restored *models.User
+	err = service.transactionManager.WithTransaction(ctx, func(txCtx context.Context) error {
+		var restoreErr error
+		if restored, restoreErr = service.userService.RestoreUser(txCtx, userId); restoreErr != nil {
+			return restoreErr
+		}
+		return service.appendEvent(txCtx, models.EventUserRestored, restored)
+	})
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, ErrUserNotDeleted
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: restore failed in db: %w", err)
+	}
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditUserRestored,
+		TargetId: restored.UserId,
+		Outcome:  models.AuditOutcomeSuccess,
+	})
+	restoredDTO := mapModelToAdminDTO(restored)
+	return &restoredDTO, nil
+}
+
+// PurgeDeletedUsersService hard deletes up to batchSize users whose grace
+// period is over, together with their refresh tokens.
+func (service *UserService) PurgeDeletedUsersService(ctx context.Context, batchSize int) (int, error) {
+	before := time.Now().Add(-service.config.USER_DELETION_CONFIG.GRACE_PERIOD)
+	users, err := service.userService.FindUsersDeletedBefore(ctx, before, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("error: finding users to purge: %w", err)
+	}
+	purged := 0
+	for _, user := range users {
+		err := service.transactionManager.WithTransaction(ctx, func(txCtx context.Context) error {
+			tokenErr := service.refreshTokenService.RefreshTokenRepository.DeleteAllTokensFromUser(txCtx, user.UserId)
+			if tokenErr != nil {
+				return fmt.Errorf("deleting tokens: %w", tokenErr)
+			}
+			if deleteErr := service.userService.HardDeleteUser(txCtx, user.UserId); deleteErr != nil {
+				return deleteErr
+			}
+			return service.appendEvent(txCtx, models.EventUserPurged, &user)
+		})
+		if err != nil {
+			return purged, fmt.Errorf("error: purging user %s: %w", user.UserId, err)
+		}
+		service.AuditService.Record(ctx, models.AuditEvent{
+			Type:     models.AuditUserPurged,
+			ActorId:  models.AuditActorSystem,
+			TargetId: user.UserId,
+			Outcome:  models.AuditOutcomeSuccess,
+		})
+		purged++
+	}
+	return purged, nil
+}
+
 func (service *UserService) UpdateFieldService(ctx context.Context, email string, newValue string, fieldFunc FieldUpdateFunc, errMessage string) (*dto.UserDTO, error) {
-	userModified, err := fieldFunc(ctx, email, newValue)
+	var userModified *models.User
+	err := service.transactionManager.WithTransaction(ctx, func(txCtx context.Context) error {
+		var updateErr error
+		if userModified, updateErr = fieldFunc(txCtx, email, newValue); updateErr != nil {
+			return updateErr
+		}
+		return service.appendEvent(txCtx, models.EventUserUpdated, userModified, errMessage)
+	})
+	if errors.Is(err, repository.ErrEmailConflict) {
+		return nil, ErrEmailConflict
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error: error modifing the %s: %w", errMessage, err)
 	}
+	service.AuditService.Record(ctx, models.AuditEvent{
+		Type:     models.AuditUserFieldUpdated,
+		TargetId: userModified.UserId,
+		Outcome:  models.AuditOutcomeSuccess,
+		Details:  map[string]string{"field": errMessage},
+	})
 	return mapModelToDTO(userModified), nil
 }
 
-func (userService *UserService) AuthenticationService(ctx context.Context, email string, password string) (*dto.AuthResponse, error) {
+// VerifyCredentialsService checks the email and password of a sign-in and
+// records the attempt. It does not issue any token.
+func (userService *UserService) VerifyCredentialsService(ctx context.Context, email string, password string) (*models.User, error) {
 	user, err := userService.userService.FindUser(ctx, email)
 	if err != nil {
 	if errors.Is(err, repository.ErrUserNotFound) {
+		userService.recordLogin(ctx, "", email, "user_not_found")
 		return nil, ErrUserNotFound
 	}
 	return nil, ErrInternalServer
 }
+	if user.IsDeleted() {
+		userService.recordLogin(ctx, user.UserId, email, "user_deleted")
+		return nil, ErrUserNotFound
+	}
 	credencialErr := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if credencialErr != nil {
+		userService.recordLogin(ctx, user.UserId, email, "invalid_credentials")
 		return nil, ErrInvalidCredencials
 	}
-	token, createJwtErr := createJwtToken(user, userService.refreshTokenService)
-	if createJwtErr != nil {
-		return nil, nil
+	if user.Locked {
+		userService.recordLogin(ctx, user.UserId, email, "user_locked")
+		return nil, ErrUserLocked
+	}
+	if user.PasswordResetRequired {
+		userService.recordLogin(ctx, user.UserId, email, "password_reset_required")
+		return nil, ErrPasswordResetRequired
+	}
+	userService.recordLogin(ctx, user.UserId, email, "")
+	return user, nil
+}
+
+func (userService *UserService) AuthenticationService(ctx context.Context, login *dto.LoginRequestDTO) (*dto.AuthResponse, error) {
+	audiences, err := userService.refreshTokenService.ResolveAudiences(login.Audiences)
+	if err != nil {
+		return nil, err
 	}
+	// Con una prueba DPoP la sesion queda ligada a su clave.
+	jkt, err := userService.refreshTokenService.DPoPService.ProofKeyService(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	user, err := userService.VerifyCredentialsService(ctx, login.Email, login.Password)
+	if err != nil {
+		return nil, err
+	}
+	// El access token comparte el jti con el refresh token para poder refrescarlo.
 	refreshToken, uuidErr := uuid.NewRandom()
+	if uuidErr != nil {
+		return nil, uuidErr
+	}
+	token, createJwtErr := userService.refreshTokenService.signAccessToken(user, refreshToken.String(), audiences, addConfirmationClaim(nil, jkt))
+	if createJwtErr != nil {
+		return nil, createJwtErr
+	}
 
 	// Guardar el refresh token en la db con el servicio de los refresh token. ✅
 	// Hacer que los usuarios puedan tener varios dispositivos logeados de manera independiente. (La implementacion del modelo hace esta parte) ✅
 	refreshTokenDTO := dto.RefreshTokenCreateDTO{
 		UserId:     user.UserId,
 		Jti: refreshToken.String(),
-		ExpiresAt:  time.Now().Add(userService.config.REFRESH_TOKEN_CONFIG.EXPIRY_TIME),
+		Audiences:  audiences,
+		RememberMe: login.RememberMe,
+		DPoPJkt:    jkt,
+	}
+	evictedSessions, limitErr := userService.refreshTokenService.EnforceSessionLimitService(ctx, user)
+	if limitErr != nil {
+		return nil, limitErr
 	}
+	userService.SecurityService.CheckNewDevice(ctx, user)
 	refreshTokenErr := userService.refreshTokenService.CreateRefreshTokenService(ctx, &refreshTokenDTO)
 	if refreshTokenErr != nil {
 		return nil, refreshTokenErr
@@ -154,18 +427,129 @@ func (userService *UserService) AuthenticationService(ctx context.Context, email
 	//		* Tener errores generales para ambos.
 	//	~ Utilizar esta config en toda la app.
 
-	if uuidErr != nil {
-		return nil, uuidErr
-	}
 	response := dto.AuthResponse{
-		UserId: user.UserId,
-		Name:   user.Name,
-		Email:  email,
-		JWT:    token,
+		UserId:          user.UserId,
+		Name:            user.Name,
+		Email:           user.Email,
+		JWT:             token,
+		TokenType:       dpopTokenType(jkt),
+		EvictedSessions: evictedSessions,
+	}
+	return &response, nil
+}
+
+// appendEvent writes a user event to the outbox. It must be called with the
+// ctx of the transaction that changes the user.
+func (service *UserService) appendEvent(ctx context.Context, eventType string, user *models.User, changedFields ...string) error {
+	event, err := newUserOutboxEvent(eventType, user, changedFields...)
+	if err != nil {
+		return err
+	}
+	return service.outboxRepository.AppendEvent(ctx, event)
+}
+
+// recordLogin audits a password login attempt and adds it to the login history
+// of the user; an empty failureReason means success.
+func (userService *UserService) recordLogin(ctx context.Context, userId string, email string, failureReason string) {
+	event := models.AuditEvent{
+		Type:     models.AuditUserLogin,
+		ActorId:  userId,
+		TargetId: userId,
+		Outcome:  models.AuditOutcomeSuccess,
+	}
+	if failureReason != "" {
+		event.Outcome = models.AuditOutcomeFailure
+		event.Details = map[string]string{"email": email, "reason": failureReason}
+	}
+	userService.AuditService.Record(ctx, event)
+	userService.LoginHistoryService.Record(ctx, userId, models.LoginMethodPassword, failureReason)
+}
+
+// ListTenantUsersService returns every user provisioned by a SCIM tenant,
+// oldest first.
+func (service *UserService) ListTenantUsersService(ctx context.Context, tenantId string) ([]models.User, error) {
+	var users []models.User
+	filter := repository.UserListFilter{TenantId: tenantId, Limit: repository.MaxListLimit}
+	for {
+		page, err := service.userService.ListUsers(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("error: db error: %w", err)
+		}
+		users = append(users, page.Users...)
+		if page.NextCursor == "" {
+			return users, nil
+		}
+		filter.Cursor = page.NextCursor
+	}
+}
+
+// FindTenantUsersService returns the page of the users of a SCIM tenant
+// selected by query.
+func (service *UserService) FindTenantUsersService(ctx context.Context, query repository.TenantUserQuery) (*repository.TenantUserPage, error) {
+	page, err := service.userService.FindTenantUsers(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	return page, nil
+}
+
+func (service *UserService) ListUsersService(ctx context.Context, query *dto.UserListQueryDTO) (*dto.UserListResponseDTO, error) {
+	filter := repository.UserListFilter{
+		Search:       query.Search,
+		Verified:     query.Verified,
+		Locked:       query.Locked,
+		Role:         query.Role,
+		CreatedAfter: query.CreatedAfter,
+		OnlyDeleted:  query.Deleted,
+		SortBy:       query.Sort,
+		SortDesc:     query.Order == "desc",
+		Cursor:       query.Cursor,
+		Limit:        query.Limit,
+	}
+	page, err := service.userService.ListUsers(ctx, filter)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	response := dto.UserListResponseDTO{
+		Users:      make([]dto.AdminUserDTO, 0, len(page.Users)),
+		NextCursor: page.NextCursor,
+	}
+	for i := range page.Users {
+		response.Users = append(response.Users, mapModelToAdminDTO(&page.Users[i]))
 	}
 	return &response, nil
 }
 
+func mapModelToAdminDTO(model *models.User) dto.AdminUserDTO {
+	return dto.AdminUserDTO{
+		UserId:    model.UserId,
+		Name:      model.Name,
+		LastName:  model.LastName,
+		Email:     model.Email,
+		Role:      model.Role,
+		Verified:  model.Verified,
+		Locked:    model.Locked,
+		CreatedAt: model.CreatedAt,
+		DeletedAt: model.DeletedAt,
+	}
+}
+
+func mapModelToProfileDTO(model *models.User) *dto.UserProfileDTO {
+	return &dto.UserProfileDTO{
+		UserId:    model.UserId,
+		Name:      model.Name,
+		LastName:  model.LastName,
+		Email:     model.Email,
+		Role:      model.Role,
+		Verified:  model.Verified,
+		CreatedAt: model.CreatedAt,
+		Version:   model.Version,
+	}
+}
+
 func mapModelToDTO(model *models.User) *dto.UserDTO {
 	var userDTO = dto.UserDTO{
 		Name:     model.Name,
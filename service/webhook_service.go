@@ -0,0 +1,338 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+	"users-microservice/config"
+	"users-microservice/dto"
+	"users-microservice/events"
+	"users-microservice/models"
+	"users-microservice/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+var ErrWebhookNotFound = errors.New("webhook subscription not found")
+var ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+var ErrWebhookDeliveryNotDeadLetter = errors.New("webhook delivery is not dead lettered")
+var ErrInvalidWebhookURL = errors.New("webhook url must be a public http or https url")
+
+// WebhookService manages the webhook subscriptions and delivers the user
+// events to them. It is an events.Publisher: the outbox relay hands it every
+// event and it stores one delivery per matching subscription, which the
+// webhook worker then sends.
+type WebhookService struct {
+	webhookRepository repository.WebhookRepository
+	httpClient        *http.Client
+	config            config.Config
+}
+
+// NewWebhookService rejects the receivers on private, loopback and link-local
+// addresses unless WEBHOOK_ALLOW_PRIVATE_URLS is set, both when a webhook is
+// created and on every connection, so a DNS name that later resolves to an
+// internal address or a redirect to one is refused too.
+func NewWebhookService(webhookRepo repository.WebhookRepository, config *config.Config) *WebhookService {
+	dialer := &net.Dialer{Timeout: config.WEBHOOK_CONFIG.TIMEOUT}
+	if !config.WEBHOOK_CONFIG.ALLOW_PRIVATE_URLS {
+		dialer.Control = publicAddressControl
+	}
+	return &WebhookService{
+		webhookRepository: webhookRepo,
+		// Sin proxy: la comprobacion de la direccion se hace sobre el receptor.
+		httpClient: &http.Client{
+			Timeout:   config.WEBHOOK_CONFIG.TIMEOUT,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+		},
+		config: *config,
+	}
+}
+
+func (service *WebhookService) CreateWebhookService(ctx context.Context, request *dto.WebhookRequestDTO) (*dto.WebhookCreatedDTO, error) {
+	if err := service.validateWebhookURL(ctx, request.URL); err != nil {
+		return nil, err
+	}
+	subscriptionId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error: error generating webhook id: %w", err)
+	}
+	secret := request.Secret
+	if secret == "" {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return nil, fmt.Errorf("error: error generating webhook secret: %w", err)
+		}
+		secret = hex.EncodeToString(random)
+	}
+	eventTypes := request.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	subscription := models.WebhookSubscription{
+		ID:         subscriptionId.String(),
+		URL:        request.URL,
+		EventTypes: eventTypes,
+		Secret:     secret,
+		Active:     true,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := service.webhookRepository.CreateSubscription(ctx, &subscription); err != nil {
+		return nil, fmt.Errorf("error: creating webhook: %w", err)
+	}
+	return &dto.WebhookCreatedDTO{WebhookSubscription: subscription, Secret: secret}, nil
+}
+
+func (service *WebhookService) ListWebhooksService(ctx context.Context) (*dto.WebhookListDTO, error) {
+	subscriptions, err := service.webhookRepository.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	if subscriptions == nil {
+		subscriptions = []models.WebhookSubscription{}
+	}
+	return &dto.WebhookListDTO{Webhooks: subscriptions}, nil
+}
+
+func (service *WebhookService) DeleteWebhookService(ctx context.Context, subscriptionId string) error {
+	err := service.webhookRepository.DeleteSubscription(ctx, subscriptionId)
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error: db error: %w", err)
+	}
+	return nil
+}
+
+func (service *WebhookService) ListDeliveriesService(ctx context.Context, subscriptionId string, query *dto.WebhookDeliveryQueryDTO) (*dto.WebhookDeliveryListDTO, error) {
+	page, err := service.webhookRepository.ListDeliveries(ctx, repository.WebhookDeliveryFilter{
+		SubscriptionId: subscriptionId,
+		Status:         query.Status,
+		Cursor:         query.Cursor,
+		Limit:          query.Limit,
+	})
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	response := dto.WebhookDeliveryListDTO{Deliveries: page.Deliveries, NextCursor: page.NextCursor}
+	if response.Deliveries == nil {
+		response.Deliveries = []models.WebhookDelivery{}
+	}
+	return &response, nil
+}
+
+// RetryDeliveryService puts a dead lettered delivery back in the queue with a
+// fresh attempt budget.
+func (service *WebhookService) RetryDeliveryService(ctx context.Context, deliveryId string) (*models.WebhookDelivery, error) {
+	delivery, err := service.webhookRepository.FindDelivery(ctx, deliveryId)
+	if errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	if delivery.Status != models.WebhookDeliveryDeadLetter {
+		return nil, ErrWebhookDeliveryNotDeadLetter
+	}
+	delivery.Status = models.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now().UTC()
+	delivery.ExpiresAt = nil
+	if err := service.webhookRepository.UpdateDelivery(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("error: db error: %w", err)
+	}
+	return delivery, nil
+}
+
+// Publish implements events.Publisher.
+func (service *WebhookService) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	subscriptions, err := service.webhookRepository.FindSubscriptionsForEvent(ctx, event.Type)
+	if err != nil || len(subscriptions) == 0 {
+		return err
+	}
+	payload, err := json.Marshal(events.NewCloudEvent(service.config.EVENTS_CONFIG.SOURCE, event))
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, subscription := range subscriptions {
+		delivery := models.WebhookDelivery{
+			ID:             event.ID + ":" + subscription.ID,
+			SubscriptionId: subscription.ID,
+			EventId:        event.ID,
+			EventType:      event.Type,
+			Payload:        string(payload),
+			Status:         models.WebhookDeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		}
+		err := service.webhookRepository.CreateDelivery(ctx, &delivery)
+		if err != nil && !errors.Is(err, repository.ErrWebhookDeliveryExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements events.Publisher.
+func (service *WebhookService) Close() error {
+	return nil
+}
+
+// DeliverDueWebhooksService sends up to batchSize deliveries whose next attempt
+// is due and returns how many were attempted.
+func (service *WebhookService) DeliverDueWebhooksService(ctx context.Context, batchSize int) (int, error) {
+	lease := service.config.WEBHOOK_CONFIG.TIMEOUT + time.Minute
+	for attempted := 0; attempted < batchSize; attempted++ {
+		delivery, err := service.webhookRepository.ClaimDueDelivery(ctx, time.Now().UTC(), lease)
+		if errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+			return attempted, nil
+		}
+		if err != nil {
+			return attempted, fmt.Errorf("error: claiming webhook delivery: %w", err)
+		}
+		service.deliver(ctx, delivery)
+		if err := service.webhookRepository.UpdateDelivery(ctx, delivery); err != nil {
+			return attempted, fmt.Errorf("error: saving webhook delivery %s: %w", delivery.ID, err)
+		}
+	}
+	return batchSize, nil
+}
+
+// deliver sends the delivery once and schedules the next attempt with
+// exponential backoff, or dead letters it when the attempts are exhausted.
+func (service *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+	statusCode, err := service.send(ctx, delivery)
+	delivery.LastStatusCode = statusCode
+	now := time.Now().UTC()
+	expiresAt := now.Add(service.config.WEBHOOK_CONFIG.LOG_RETENTION)
+	if err == nil {
+		delivery.Status = models.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		delivery.ExpiresAt = &expiresAt
+		return
+	}
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= service.config.WEBHOOK_CONFIG.MAX_ATTEMPTS || errors.Is(err, ErrWebhookNotFound) {
+		delivery.Status = models.WebhookDeliveryDeadLetter
+		delivery.ExpiresAt = &expiresAt
+		return
+	}
+	delivery.NextAttemptAt = now.Add(exponentialBackoff(delivery.Attempts, service.config.WEBHOOK_CONFIG.BACKOFF_BASE, service.config.WEBHOOK_CONFIG.BACKOFF_MAX))
+}
+
+func (service *WebhookService) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	subscription, err := service.webhookRepository.FindSubscription(ctx, delivery.SubscriptionId)
+	if errors.Is(err, repository.ErrWebhookNotFound) || (err == nil && !subscription.Active) {
+		return 0, ErrWebhookNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/cloudevents+json")
+	request.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	request.Header.Set(WebhookTimestampHeader, timestamp)
+	request.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(subscription.Secret, timestamp, []byte(delivery.Payload)))
+	response, err := service.httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("receiver answered %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of "<timestamp>.<payload>".
+// Receivers recompute it with their secret and should reject old timestamps
+// to prevent replays.
+func SignWebhookPayload(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhookURL requires an http or https URL whose host only resolves to
+// public addresses, unless WEBHOOK_ALLOW_PRIVATE_URLS is set.
+func (service *WebhookService) validateWebhookURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return ErrInvalidWebhookURL
+	}
+	if service.config.WEBHOOK_CONFIG.ALLOW_PRIVATE_URLS {
+		return nil
+	}
+	addresses, err := net.DefaultResolver.LookupNetIP(ctx, "ip", parsed.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: %s does not resolve", ErrInvalidWebhookURL, parsed.Hostname())
+	}
+	for _, address := range addresses {
+		if !isPublicAddress(address) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrInvalidWebhookURL, parsed.Hostname(), address)
+		}
+	}
+	return nil
+}
+
+// publicAddressControl refuses the connections to non public addresses. It
+// runs after DNS resolution, for every address dialed.
+func publicAddressControl(network string, address string, _ syscall.RawConn) error {
+	addressPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddress(addressPort.Addr()) {
+		return fmt.Errorf("%w: refusing to connect to %s", ErrInvalidWebhookURL, addressPort.Addr())
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier grade NAT range of RFC 6598.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func isPublicAddress(address netip.Addr) bool {
+	address = address.Unmap()
+	return address.IsGlobalUnicast() && !address.IsPrivate() && !sharedAddressSpace.Contains(address)
+}
+
+// exponentialBackoff doubles base for every attempt after the first, up to max.
+func exponentialBackoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	return min(backoff, max)
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"users-microservice/config"
+	"users-microservice/dto"
+	"users-microservice/models"
+	"users-microservice/repository"
+)
+
+const testWebhookSecret = "0123456789abcdef0123456789abcdef"
+
+func newTestWebhookService(webhookRepository repository.WebhookRepository, allowPrivateURLs bool) *WebhookService {
+	return NewWebhookService(webhookRepository, &config.Config{
+		EVENTS_CONFIG: config.EventsConfig{SOURCE: "users-microservice"},
+		WEBHOOK_CONFIG: config.WebhookConfig{
+			TIMEOUT:            5 * time.Second,
+			MAX_ATTEMPTS:       3,
+			BACKOFF_BASE:       time.Minute,
+			BACKOFF_MAX:        time.Hour,
+			LOG_RETENTION:      24 * time.Hour,
+			ALLOW_PRIVATE_URLS: allowPrivateURLs,
+		},
+	})
+}
+
+// subscribeAndPublish registra url y encola la entrega de un evento para ella.
+func subscribeAndPublish(t *testing.T, service *WebhookService, url string) string {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := service.CreateWebhookService(ctx, &dto.WebhookRequestDTO{URL: url, Secret: testWebhookSecret}); err != nil {
+		t.Fatalf("CreateWebhookService: %v", err)
+	}
+	event, err := newUserOutboxEvent(models.EventUserCreated, &models.User{UserId: "user-1", Email: "john@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Publish(ctx, event); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	subscriptions, _ := service.webhookRepository.ListSubscriptions(ctx)
+	return event.ID + ":" + subscriptions[0].ID
+}
+
+// makeDue adelanta el siguiente intento de la entrega, como si la espera ya hubiera pasado.
+func makeDue(t *testing.T, webhookRepository repository.WebhookRepository, deliveryId string) {
+	t.Helper()
+	delivery, err := webhookRepository.FindDelivery(context.Background(), deliveryId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery.NextAttemptAt = time.Now().UTC().Add(-time.Second)
+	if err := webhookRepository.UpdateDelivery(context.Background(), delivery); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliverDueWebhooksServiceSignsPayloads(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header.Clone(), body: body}
+	}))
+	defer receiver.Close()
+	webhookRepository := repository.NewMemoryWebhookRepository()
+	service := newTestWebhookService(webhookRepository, true)
+	deliveryId := subscribeAndPublish(t, service, receiver.URL+"/hook")
+
+	attempted, err := service.DeliverDueWebhooksService(context.Background(), 10)
+	if err != nil || attempted != 1 {
+		t.Fatalf("DeliverDueWebhooksService = %d, %v; want 1 delivery", attempted, err)
+	}
+	request := <-requests
+	timestamp := request.header.Get(WebhookTimestampHeader)
+	signature := "sha256=" + SignWebhookPayload(testWebhookSecret, timestamp, request.body)
+	if !hmac.Equal([]byte(request.header.Get(WebhookSignatureHeader)), []byte(signature)) {
+		t.Fatalf("%s = %q, want %q", WebhookSignatureHeader, request.header.Get(WebhookSignatureHeader), signature)
+	}
+	if request.header.Get(WebhookDeliveryHeader) != deliveryId || request.header.Get("Content-Type") != "application/cloudevents+json" {
+		t.Fatalf("headers = %v", request.header)
+	}
+	if !strings.Contains(string(request.body), `"type":"user.created"`) {
+		t.Fatalf("body = %s", request.body)
+	}
+	delivery, _ := webhookRepository.FindDelivery(context.Background(), deliveryId)
+	if delivery.Status != models.WebhookDeliveryDelivered || delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusOK {
+		t.Fatalf("delivery = %+v", delivery)
+	}
+	if delivery.ExpiresAt == nil || delivery.ExpiresAt.Before(delivery.DeliveredAt.Add(24*time.Hour-time.Second)) {
+		t.Fatalf("delivered delivery expires at %v, want 24h after the delivery", delivery.ExpiresAt)
+	}
+}
+
+func TestDeliverDueWebhooksServiceRetriesAndDeadLetters(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+	webhookRepository := repository.NewMemoryWebhookRepository()
+	service := newTestWebhookService(webhookRepository, true)
+	deliveryId := subscribeAndPublish(t, service, receiver.URL)
+
+	// MAX_ATTEMPTS es 3: los dos primeros fallos reintentan tras 1m y 2m.
+	for attempt, wantBackoff := range []time.Duration{time.Minute, 2 * time.Minute} {
+		before := time.Now()
+		if _, err := service.DeliverDueWebhooksService(context.Background(), 10); err != nil {
+			t.Fatal(err)
+		}
+		delivery, _ := webhookRepository.FindDelivery(context.Background(), deliveryId)
+		if delivery.Status != models.WebhookDeliveryPending || delivery.Attempts != attempt+1 ||
+			delivery.LastStatusCode != http.StatusServiceUnavailable || delivery.ExpiresAt != nil {
+			t.Fatalf("after attempt %d delivery = %+v", attempt+1, delivery)
+		}
+		if delivery.NextAttemptAt.Before(before.Add(wantBackoff)) || delivery.NextAttemptAt.After(time.Now().Add(wantBackoff)) {
+			t.Fatalf("after attempt %d next attempt at %v, want in %s", attempt+1, delivery.NextAttemptAt, wantBackoff)
+		}
+		// Antes de que venza la espera no se reintenta.
+		if attempted, _ := service.DeliverDueWebhooksService(context.Background(), 10); attempted != 0 {
+			t.Fatalf("a delivery backing off was attempted")
+		}
+		makeDue(t, webhookRepository, deliveryId)
+	}
+	if _, err := service.DeliverDueWebhooksService(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	delivery, _ := webhookRepository.FindDelivery(context.Background(), deliveryId)
+	if delivery.Status != models.WebhookDeliveryDeadLetter || delivery.Attempts != 3 || delivery.ExpiresAt == nil {
+		t.Fatalf("after MAX_ATTEMPTS delivery = %+v", delivery)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("the receiver got %d requests, want 3", calls.Load())
+	}
+
+	retried, err := service.RetryDeliveryService(context.Background(), deliveryId)
+	if err != nil {
+		t.Fatalf("RetryDeliveryService: %v", err)
+	}
+	if retried.Status != models.WebhookDeliveryPending || retried.Attempts != 0 || retried.ExpiresAt != nil {
+		t.Fatalf("retried delivery = %+v", retried)
+	}
+}
+
+func TestCreateWebhookServiceRejectsInternalURLs(t *testing.T) {
+	service := newTestWebhookService(repository.NewMemoryWebhookRepository(), false)
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://93.184.216.34/hook"},
+		{url: "http://[2606:2800:220:1:248:1893:25c8:1946]/hook"},
+		{url: "ftp://93.184.216.34/hook", wantErr: true},
+		{url: "http://127.0.0.1:8080/hook", wantErr: true},
+		{url: "http://localhost/hook", wantErr: true},
+		{url: "http://[::1]/hook", wantErr: true},
+		{url: "http://10.1.2.3/hook", wantErr: true},
+		{url: "http://172.16.0.1/hook", wantErr: true},
+		{url: "http://192.168.1.1/hook", wantErr: true},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{url: "http://100.64.0.1/hook", wantErr: true},
+		{url: "http://0.0.0.0/hook", wantErr: true},
+		{url: "http://[fd00::1]/hook", wantErr: true},
+		{url: "http://[fe80::1]/hook", wantErr: true},
+		{url: "http://[::ffff:127.0.0.1]/hook", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			_, err := service.CreateWebhookService(context.Background(), &dto.WebhookRequestDTO{URL: test.url})
+			if test.wantErr != errors.Is(err, ErrInvalidWebhookURL) || (!test.wantErr && err != nil) {
+				t.Fatalf("CreateWebhookService(%q) error = %v, want error %v", test.url, err, test.wantErr)
+			}
+		})
+	}
+}
+
+// Una suscripcion ya guardada que apunta a la red interna no recibe nada.
+func TestDeliverDueWebhooksServiceRefusesInternalAddresses(t *testing.T) {
+	var mu sync.Mutex
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		called = true
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+	webhookRepository := repository.NewMemoryWebhookRepository()
+	deliveryId := subscribeAndPublish(t, newTestWebhookService(webhookRepository, true), receiver.URL)
+
+	service := newTestWebhookService(webhookRepository, false)
+	if _, err := service.DeliverDueWebhooksService(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	delivery, _ := webhookRepository.FindDelivery(context.Background(), deliveryId)
+	if delivery.Status != models.WebhookDeliveryPending || !strings.Contains(delivery.LastError, ErrInvalidWebhookURL.Error()) {
+		t.Fatalf("delivery = %+v", delivery)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if called {
+		t.Fatal("the internal receiver was called")
+	}
+}
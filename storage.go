@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	"users-microservice/config"
+	"users-microservice/db"
+	"users-microservice/repository"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// repositories agrupa los repositorios del backend elegido con STORAGE_BACKEND.
+type repositories struct {
+	users         repository.UserRepository
+	refreshTokens repository.RefreshTokenRepository
+	exportJobs    repository.ExportJobRepository
+	exportFiles   repository.ExportArchiveRepository
+	audit         repository.AuditRepository
+	loginHistory  repository.LoginHistoryRepository
+	outbox        repository.OutboxRepository
+	webhooks      repository.WebhookRepository
+	groups        repository.GroupRepository
+	oauth         repository.OAuthRepository
+	dpopProofs    repository.DPoPProofRepository
+	idempotency   repository.IdempotencyRepository
+	transactions  repository.TransactionManager
+	// Solo con postgres: borra lo que en Mongo caduca con indices TTL.
+	postgresCleaner *repository.PostgresCleaner
+}
+
+func newRepositories(cfg *config.Config) (*repositories, error) {
+	var repos *repositories
+	var err error
+	switch cfg.STORAGE_BACKEND {
+	case config.StorageBackendMemory:
+		log.Printf("STORAGE_BACKEND=memory: los datos se pierden al reiniciar el servicio")
+		repos = newMemoryRepositories()
+	case config.StorageBackendPostgres:
+		repos, err = newPostgresRepositories(cfg)
+	default:
+		repos, err = newMongoRepositories(cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Los emails se normalizan antes de llegar a cualquier backend, asi el indice
+	// unico detecta los duplicados que solo difieren en mayusculas o espacios.
+	repos.users = repository.NewEmailNormalizingUserRepository(repos.users, cfg.EMAIL_NORMALIZE_NFKC)
+	return repos, nil
+}
+
+func newMemoryRepositories() *repositories {
+	return &repositories{
+		users:         repository.NewMemoryUserRepository(),
+		refreshTokens: repository.NewMemoryRefreshTokenRepository(),
+		exportJobs:    repository.NewMemoryExportJobRepository(),
+		exportFiles:   repository.NewMemoryExportArchiveRepository(),
+		audit:         repository.NewMemoryAuditRepository(),
+		loginHistory:  repository.NewMemoryLoginHistoryRepository(),
+		outbox:        repository.NewMemoryOutboxRepository(),
+		webhooks:      repository.NewMemoryWebhookRepository(),
+		groups:        repository.NewMemoryGroupRepository(),
+		oauth:         repository.NewMemoryOAuthRepository(),
+		dpopProofs:    repository.NewMemoryDPoPProofRepository(),
+		idempotency:   repository.NewMemoryIdempotencyRepository(),
+		transactions:  repository.NewMemoryTransactionManager(),
+	}
+}
+
+// newPostgresRepositories guarda todo en Postgres, sin depender de Mongo.
+func newPostgresRepositories(cfg *config.Config) (*repositories, error) {
+	pool, err := db.Postgres_connection(cfg.POSTGRES_URL)
+	if err != nil {
+		return nil, err
+	}
+	repos := postgresRepositories(pool, cfg)
+	if cfg.MIGRATE_ON_STARTUP {
+		migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), migrationTimeout)
+		defer cancelMigrate()
+		if err := migratePostgres(migrateCtx, pool, cfg); err != nil {
+			return nil, err
+		}
+	}
+	checkCtx, cancelCheck := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelCheck()
+	if err := requirePostgresNFKCEmails(checkCtx, pool, cfg); err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// postgresRepositories crea los repositorios sobre las tablas de MigratePostgres.
+func postgresRepositories(pool *pgxpool.Pool, cfg *config.Config) *repositories {
+	return &repositories{
+		users:         repository.NewPostgresUserRepository(pool),
+		refreshTokens: repository.NewPostgresRefreshTokenRepository(pool),
+		exportJobs:    repository.NewPostgresExportJobRepository(pool),
+		exportFiles:   repository.NewPostgresExportArchiveRepository(pool),
+		audit:         repository.NewPostgresAuditRepository(pool),
+		loginHistory:  repository.NewPostgresLoginHistoryRepository(pool),
+		outbox:        repository.NewPostgresOutboxRepository(pool),
+		webhooks:      repository.NewPostgresWebhookRepository(pool),
+		groups:        repository.NewPostgresGroupRepository(pool),
+		oauth:         repository.NewPostgresOAuthRepository(pool),
+		dpopProofs:    repository.NewPostgresDPoPProofRepository(pool),
+		idempotency:   repository.NewPostgresIdempotencyRepository(pool),
+		transactions:  repository.NewPostgresTransactionManager(pool),
+		postgresCleaner: repository.NewPostgresCleaner(pool, repository.PostgresRetention{
+			Audit:        cfg.AUDIT_CONFIG.RETENTION,
+			LoginHistory: cfg.LOGIN_HISTORY_RETENTION,
+		}),
+	}
+}
+
+func newMongoRepositories(config *config.Config) (*repositories, error) {
+	client, err := db.Db_connection()
+	if err != nil {
+		return nil, err
+	}
+	topologyCtx, cancelTopology := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelTopology()
+	if err := requireMongoTransactions(topologyCtx, client); err != nil {
+		return nil, err
+	}
+	repos := &repositories{
+		users:         repository.NewMongoUserRepository(client, config.DB_NAME, config.DB_COLLECTION_USERS),
+		refreshTokens: repository.NewRefreshTokenRepository(client, config.DB_NAME, config.DB_COLLECTION_REFRESH_TOKENS),
+		exportJobs:    repository.NewExportJobRepository(client, config.DB_NAME, config.DB_COLLECTION_EXPORT_JOBS),
+		exportFiles:   repository.NewExportArchiveRepository(client, config.DB_NAME, config.DB_COLLECTION_EXPORT_FILES),
+		audit:         repository.NewAuditRepository(client, config.DB_NAME, config.DB_COLLECTION_AUDIT_EVENTS),
+		loginHistory:  repository.NewLoginHistoryRepository(client, config.DB_NAME, config.DB_COLLECTION_LOGIN_HISTORY),
+		outbox:        repository.NewOutboxRepository(client, config.DB_NAME, config.DB_COLLECTION_OUTBOX),
+		webhooks:      repository.NewWebhookRepository(client, config.DB_NAME, config.DB_COLLECTION_WEBHOOKS, config.DB_COLLECTION_WEBHOOK_LOG),
+		groups:        repository.NewGroupRepository(client, config.DB_NAME, config.DB_COLLECTION_GROUPS),
+		oauth:         repository.NewOAuthRepository(client, config.DB_NAME, config.DB_COLLECTION_OAUTH_CLIENTS, config.DB_COLLECTION_OAUTH_CODES),
+		dpopProofs:    repository.NewDPoPProofRepository(client, config.DB_NAME, config.DB_COLLECTION_DPOP_PROOFS),
+		idempotency:   repository.NewIdempotencyRepository(client, config.DB_NAME, config.DB_COLLECTION_IDEMPOTENCY),
+		transactions:  repository.NewMongoTransactionManager(client),
+	}
+
+	// Los indices de usuarios y refresh tokens se crean con migraciones.
+	if config.MIGRATE_ON_STARTUP {
+		migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), migrationTimeout)
+		defer cancelMigrate()
+		if err := migrateMongo(migrateCtx, client, config); err != nil {
+			return nil, err
+		}
+	}
+	checkCtx, cancelCheck := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelCheck()
+	if err := requireMongoNFKCEmails(checkCtx, client, config); err != nil {
+		return nil, err
+	}
+	indexCtx, cancelIndex := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelIndex()
+	if indexErr := repository.EnsureExportJobIndexes(indexCtx, client, config.DB_NAME, config.DB_COLLECTION_EXPORT_JOBS); indexErr != nil {
+		log.Printf("No se pudieron crear los indices de exportaciones: %v", indexErr)
+	}
+	if indexErr := repository.EnsureExportArchiveIndexes(indexCtx, client, config.DB_NAME, config.DB_COLLECTION_EXPORT_FILES); indexErr != nil {
+		log.Printf("No se pudieron crear los indices de los archivos de exportacion: %v", indexErr)
+	}
+	if indexErr := repository.EnsureAuditIndexes(indexCtx, client, config.DB_NAME, config.DB_COLLECTION_AUDIT_EVENTS, config.AUDIT_CONFIG.RETENTION); indexErr != nil {
+		log.Printf("No se pudieron crear los indices de auditoria: %v", indexErr)
+	}
+	if indexErr := repository.EnsureLoginHistoryIndexes(indexCtx, client, config.DB_NAME, config.DB_COLLECTION_LOGIN_HISTORY, config.LOGIN_HISTORY_RETENTION); indexErr != nil {
+		log.Printf("No se pudieron crear los indices del historial de sesiones: %v", indexErr)
+	}
+	if indexErr := repository.EnsureOutboxIndexes(indexCtx, client, config.DB_NAME, config.DB_COLLECTION_OUTBOX, config.OUTBOX_CONFIG.RETENTION); indexErr != nil {
+		log.Printf("No se pudieron crear los indices del outbox: %v", indexErr)
+	}
+	if indexErr := repository.EnsureWebhookIndexes(indexCtx, client, config.DB_NAME, config.DB_COLLECTION_WEBHOOKS, config.DB_COLLECTION_WEBHOOK_LOG, config.WEBHOOK_CONFIG.LOG_RETENTION); indexErr != nil {
+		log.Printf("No se pudieron crear los indices de webhooks: %v", indexErr)
+	}
+	if indexErr := repository.EnsureGroupIndexes(indexCtx, client, config.DB_NAME, config.DB_COLLECTION_GROUPS); indexErr != nil {
+		log.Printf("No se pudieron crear los indices de grupos: %v", indexErr)
+	}
+	if indexErr := repository.EnsureOAuthIndexes(indexCtx, client, config.DB_NAME, config.DB_COLLECTION_OAUTH_CODES); indexErr != nil {
+		log.Printf("No se pudieron crear los indices de OAuth: %v", indexErr)
+	}
+	if indexErr := repository.EnsureDPoPIndexes(indexCtx, client, config.DB_NAME, config.DB_COLLECTION_DPOP_PROOFS); indexErr != nil {
+		log.Printf("No se pudieron crear los indices de DPoP: %v", indexErr)
+	}
+	if indexErr := repository.EnsureIdempotencyIndexes(indexCtx, client, config.DB_NAME, config.DB_COLLECTION_IDEMPOTENCY); indexErr != nil {
+		log.Printf("No se pudieron crear los indices de las claves de idempotencia: %v", indexErr)
+	}
+	return repos, nil
+}
+
+// requireMongoTransactions falla al arrancar si MongoDB es un servidor aislado:
+// los usuarios y sus eventos se escriben en transacciones, que solo existen en
+// replica sets y clusters con sharding. Sin esta comprobacion cada escritura
+// fallaria en tiempo de ejecucion.
+func requireMongoTransactions(ctx context.Context, client *mongo.Client) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return fmt.Errorf("no se pudo consultar la topologia de MongoDB: %w", err)
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return fmt.Errorf("MongoDB debe ejecutarse como replica set (basta uno de un solo nodo) o con mongos: las transacciones no funcionan en un servidor aislado")
+	}
+	return nil
+}
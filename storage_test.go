@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"users-microservice/config"
+)
+
+// missing devuelve los repositorios que el backend dejo sin configurar, asi un
+// repositorio nuevo tambien se exige a todos los backends. postgresCleaner solo
+// existe con postgres.
+func (repos *repositories) missing() []string {
+	value := reflect.ValueOf(repos).Elem()
+	var missing []string
+	for i := range value.NumField() {
+		name := value.Type().Field(i).Name
+		if value.Field(i).IsNil() && name != "postgresCleaner" {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+func TestMemoryRepositoriesAreComplete(t *testing.T) {
+	if missing := newMemoryRepositories().missing(); len(missing) > 0 {
+		t.Fatalf("the memory backend is missing %v", missing)
+	}
+}
+
+// El backend de Postgres guarda todo sin recurrir a Mongo. Las pruebas de
+// conformidad de repository comprueban cada implementacion.
+func TestPostgresRepositoriesAreComplete(t *testing.T) {
+	repos := postgresRepositories(nil, &config.Config{})
+	if missing := repos.missing(); len(missing) > 0 {
+		t.Fatalf("the postgres backend is missing %v", missing)
+	}
+	if repos.postgresCleaner == nil {
+		t.Fatal("the postgres backend has no cleaner for the expired rows")
+	}
+}
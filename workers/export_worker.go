@@ -0,0 +1,52 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+	"users-microservice/service"
+)
+
+// ExportWorker processes the asynchronous personal data export jobs and
+// removes the archives of the expired ones.
+type ExportWorker struct {
+	ExportService *service.ExportService
+	Interval      time.Duration
+}
+
+func NewExportWorker(exportService *service.ExportService, interval time.Duration) *ExportWorker {
+	return &ExportWorker{
+		ExportService: exportService,
+		Interval:      interval,
+	}
+}
+
+// Run blocks until ctx is cancelled.
+func (worker *ExportWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(worker.Interval)
+	defer ticker.Stop()
+	for {
+		worker.drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (worker *ExportWorker) drain(ctx context.Context) {
+	if _, err := worker.ExportService.PurgeExpiredArchivesService(ctx); err != nil {
+		log.Printf("export archive purge failed: %v", err)
+	}
+	for ctx.Err() == nil {
+		processed, err := worker.ExportService.ProcessNextExportJobService(ctx)
+		if err != nil {
+			log.Printf("export job failed: %v", err)
+			return
+		}
+		if !processed {
+			return
+		}
+	}
+}
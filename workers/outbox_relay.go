@@ -0,0 +1,56 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+	"users-microservice/service"
+)
+
+// OutboxRelay publishes the pending outbox events and deletes the ones
+// published more than OUTBOX_RETENTION ago. Run a single relay per
+// deployment: two relays would still deliver every event but could break the
+// per user order.
+type OutboxRelay struct {
+	OutboxService *service.OutboxService
+	Interval      time.Duration
+	BatchSize     int
+}
+
+func NewOutboxRelay(outboxService *service.OutboxService, interval time.Duration, batchSize int) *OutboxRelay {
+	return &OutboxRelay{
+		OutboxService: outboxService,
+		Interval:      interval,
+		BatchSize:     batchSize,
+	}
+}
+
+// Run blocks until ctx is cancelled.
+func (relay *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relay.Interval)
+	defer ticker.Stop()
+	for {
+		relay.relay(ctx)
+		if _, err := relay.OutboxService.PurgePublishedEventsService(ctx, relay.BatchSize); err != nil {
+			log.Printf("outbox purge failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (relay *OutboxRelay) relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		published, err := relay.OutboxService.RelayPendingEventsService(ctx, relay.BatchSize)
+		if err != nil {
+			log.Printf("outbox relay failed: %v", err)
+			return
+		}
+		if published < relay.BatchSize {
+			return
+		}
+	}
+}
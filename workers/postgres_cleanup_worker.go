@@ -0,0 +1,66 @@
+package workers
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+)
+
+// postgresCleanupMetrics se publica como postgres_cleanup en /admin/metrics.
+var postgresCleanupMetrics = expvar.NewMap("postgres_cleanup")
+
+// ExpiredRowsDeleter deletes up to limit expired rows per table, see
+// repository.PostgresCleaner.
+type ExpiredRowsDeleter interface {
+	DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error)
+}
+
+// PostgresCleanupWorker deletes, in batches, the rows the Mongo backend
+// removes with TTL indexes. It only runs with STORAGE_BACKEND=postgres.
+type PostgresCleanupWorker struct {
+	Cleaner   ExpiredRowsDeleter
+	Interval  time.Duration
+	BatchSize int
+}
+
+func NewPostgresCleanupWorker(cleaner ExpiredRowsDeleter, interval time.Duration, batchSize int) *PostgresCleanupWorker {
+	return &PostgresCleanupWorker{
+		Cleaner:   cleaner,
+		Interval:  interval,
+		BatchSize: batchSize,
+	}
+}
+
+// Run blocks until ctx is cancelled.
+func (worker *PostgresCleanupWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(worker.Interval)
+	defer ticker.Stop()
+	for {
+		worker.cleanup(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (worker *PostgresCleanupWorker) cleanup(ctx context.Context) {
+	postgresCleanupMetrics.Add("runs", 1)
+	for ctx.Err() == nil {
+		deleted, err := worker.Cleaner.DeleteExpired(ctx, time.Now().UTC(), worker.BatchSize)
+		if err != nil {
+			postgresCleanupMetrics.Add("errors", 1)
+			log.Printf("postgres cleanup failed: %v", err)
+			return
+		}
+		postgresCleanupMetrics.Add("deleted", int64(deleted))
+		if deleted > 0 {
+			log.Printf("postgres cleanup: %d expired rows deleted", deleted)
+		}
+		if deleted < worker.BatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package workers
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+	"users-microservice/service"
+)
+
+// refreshTokenCleanupMetrics se publica como refresh_token_cleanup en
+// /admin/metrics; el router de gin no sirve /debug/vars.
+var refreshTokenCleanupMetrics = expvar.NewMap("refresh_token_cleanup")
+
+// RefreshTokenCleanupWorker deletes the expired refresh tokens and the revoked
+// ones once their retention is over, in batches.
+type RefreshTokenCleanupWorker struct {
+	RefreshTokenService *service.RefreshTokenService
+	Interval            time.Duration
+	BatchSize           int
+}
+
+func NewRefreshTokenCleanupWorker(refreshTokenService *service.RefreshTokenService, interval time.Duration, batchSize int) *RefreshTokenCleanupWorker {
+	return &RefreshTokenCleanupWorker{
+		RefreshTokenService: refreshTokenService,
+		Interval:            interval,
+		BatchSize:           batchSize,
+	}
+}
+
+// Run blocks until ctx is cancelled.
+func (worker *RefreshTokenCleanupWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(worker.Interval)
+	defer ticker.Stop()
+	for {
+		worker.cleanup(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (worker *RefreshTokenCleanupWorker) cleanup(ctx context.Context) {
+	refreshTokenCleanupMetrics.Add("runs", 1)
+	for ctx.Err() == nil {
+		deleted, err := worker.RefreshTokenService.DeleteExpiredTokensService(ctx, worker.BatchSize)
+		if err != nil {
+			refreshTokenCleanupMetrics.Add("errors", 1)
+			log.Printf("refresh token cleanup failed: %v", err)
+			return
+		}
+		refreshTokenCleanupMetrics.Add("deleted", int64(deleted))
+		if deleted > 0 {
+			log.Printf("refresh token cleanup: %d tokens deleted", deleted)
+		}
+		if deleted < worker.BatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+	"users-microservice/service"
+)
+
+// UserPurgeWorker hard deletes soft deleted users once their grace period is
+// over, cascading to their refresh tokens.
+type UserPurgeWorker struct {
+	UserService *service.UserService
+	Interval    time.Duration
+	BatchSize   int
+}
+
+func NewUserPurgeWorker(userService *service.UserService, interval time.Duration, batchSize int) *UserPurgeWorker {
+	return &UserPurgeWorker{
+		UserService: userService,
+		Interval:    interval,
+		BatchSize:   batchSize,
+	}
+}
+
+// Run blocks until ctx is cancelled.
+func (worker *UserPurgeWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(worker.Interval)
+	defer ticker.Stop()
+	for {
+		worker.purge(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (worker *UserPurgeWorker) purge(ctx context.Context) {
+	for ctx.Err() == nil {
+		purged, err := worker.UserService.PurgeDeletedUsersService(ctx, worker.BatchSize)
+		if err != nil {
+			log.Printf("user purge failed: %v", err)
+			return
+		}
+		if purged > 0 {
+			log.Printf("user purge: %d users deleted", purged)
+		}
+		if purged < worker.BatchSize {
+			return
+		}
+	}
+}
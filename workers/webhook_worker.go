@@ -0,0 +1,50 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+	"users-microservice/service"
+)
+
+// WebhookWorker sends the due webhook deliveries.
+type WebhookWorker struct {
+	WebhookService *service.WebhookService
+	Interval       time.Duration
+	BatchSize      int
+}
+
+func NewWebhookWorker(webhookService *service.WebhookService, interval time.Duration, batchSize int) *WebhookWorker {
+	return &WebhookWorker{
+		WebhookService: webhookService,
+		Interval:       interval,
+		BatchSize:      batchSize,
+	}
+}
+
+// Run blocks until ctx is cancelled.
+func (worker *WebhookWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(worker.Interval)
+	defer ticker.Stop()
+	for {
+		worker.deliver(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (worker *WebhookWorker) deliver(ctx context.Context) {
+	for ctx.Err() == nil {
+		attempted, err := worker.WebhookService.DeliverDueWebhooksService(ctx, worker.BatchSize)
+		if err != nil {
+			log.Printf("webhook delivery failed: %v", err)
+			return
+		}
+		if attempted < worker.BatchSize {
+			return
+		}
+	}
+}